@@ -0,0 +1,88 @@
+package api
+
+import (
+	"time"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/db"
+)
+
+// RegisterAccount registers the xpub or output descriptor as a watch-only account, which is tracked continuously by the index
+// The account is scanned immediately so that its discovery state is persisted and updated by the connected blocks.
+// Registration of an already registered account changes its gap.
+func (w *Worker) RegisterAccount(descriptor string, gap int) (*db.Account, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, ErrUnsupportedXpub
+	}
+	xd, err := w.chainParser.ParseXpub(descriptor)
+	if err != nil {
+		return nil, NewAPIError("Invalid xpub or descriptor: "+err.Error(), true)
+	}
+	a, err := w.db.GetAccount(xd.XpubDescriptor)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		a = &db.Account{Descriptor: xd.XpubDescriptor, Registered: time.Now().Unix()}
+	}
+	a.Gap = xpubGap(gap)
+	if err = w.db.StoreAccount(a); err != nil {
+		return nil, err
+	}
+	// drop the xpub from the memory cache to force the scan, which persists the discovery state
+	cachedXpubsMux.Lock()
+	delete(cachedXpubs, xd.XpubDescriptor)
+	cachedXpubsMux.Unlock()
+	if _, _, _, err = w.getXpubData(xd, 0, 1, AccountDetailsBasic, &AddressFilter{Vout: AddressFilterVoutOff}, a.Gap); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// UnregisterAccount stops the tracking of the account, its discovery state is then evicted as of any other xpub
+func (w *Worker) UnregisterAccount(descriptor string) error {
+	xd, err := w.chainParser.ParseXpub(descriptor)
+	if err != nil {
+		return NewAPIError("Invalid xpub or descriptor: "+err.Error(), true)
+	}
+	return w.db.DeleteAccount(xd.XpubDescriptor)
+}
+
+// GetAccounts returns the registered accounts
+func (w *Worker) GetAccounts() ([]db.Account, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, ErrUnsupportedXpub
+	}
+	return w.db.GetAccounts()
+}
+
+// GetAccount returns the registered account of the xpub or output descriptor or nil if the account is not registered
+func (w *Worker) GetAccount(descriptor string) (*db.Account, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, ErrUnsupportedXpub
+	}
+	xd, err := w.chainParser.ParseXpub(descriptor)
+	if err != nil {
+		return nil, NewAPIError("Invalid xpub or descriptor: "+err.Error(), true)
+	}
+	return w.db.GetAccount(xd.XpubDescriptor)
+}
+
+// GetAccountAddressDescriptors returns the addresses of the account derived up to the gap after the last used address
+func (w *Worker) GetAccountAddressDescriptors(a *db.Account) ([]bchain.AddressDescriptor, error) {
+	xd, err := w.chainParser.ParseXpub(a.Descriptor)
+	if err != nil {
+		return nil, err
+	}
+	data, _, _, err := w.getXpubData(xd, 0, 1, AccountDetailsBasic, &AddressFilter{Vout: AddressFilterVoutOff}, a.Gap)
+	if err != nil {
+		return nil, err
+	}
+	var addrDescs []bchain.AddressDescriptor
+	for _, da := range data.addresses {
+		for i := range da {
+			addrDescs = append(addrDescs, da[i].addrDesc)
+		}
+	}
+	return addrDescs, nil
+}
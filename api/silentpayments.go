@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// GetSilentPaymentTweaks returns the silent payment (BIP-352) tweaks of the taproot-eligible transactions in the block
+// The light wallets scan the taproot outputs of the returned transactions using the tweaks instead of the transactions' inputs.
+func (w *Worker) GetSilentPaymentTweaks(height uint32) (*SilentPaymentTweaks, error) {
+	if w.chainType != bchain.ChainBitcoinType || !w.db.HasSilentPayments() {
+		return nil, NewAPIError("Silent payments index not enabled", true)
+	}
+	start := time.Now()
+	if height < w.is.SilentPaymentsHeight {
+		return nil, NewAPIError("Silent payments are indexed from block "+strconv.FormatUint(uint64(w.is.SilentPaymentsHeight), 10), true)
+	}
+	hash, err := w.db.GetBlockHash(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockHash %v", height)
+	}
+	if hash == "" {
+		return nil, NewAPIError("Block not found", true)
+	}
+	tweaks, err := w.db.GetSilentPaymentTweaks(height)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetSilentPaymentTweaks %v", height)
+	}
+	r := &SilentPaymentTweaks{Height: height, Hash: hash, Tweaks: make([]SilentPaymentTweak, len(tweaks))}
+	for i := range tweaks {
+		r.Tweaks[i] = SilentPaymentTweak{Txid: tweaks[i].Txid, Tweak: hex.EncodeToString(tweaks[i].Tweak)}
+	}
+	glog.Info("GetSilentPaymentTweaks ", height, ", ", len(r.Tweaks), " tweaks, ", time.Since(start))
+	return r, nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/db"
+)
+
+// stake is a coinstake transaction with the net reward of one or more addresses
+type stake struct {
+	height    uint32
+	rewardSat big.Int
+}
+
+// stakes is a map of txids of coinstake transactions to stakes
+type stakes map[string]*stake
+
+func (s stakes) add(txid string, height uint32, rewardSat *big.Int) {
+	st, found := s[txid]
+	if !found {
+		st = &stake{height: height}
+		s[txid] = st
+	}
+	st.rewardSat.Add(&st.rewardSat, rewardSat)
+}
+
+// addrDescStakes adds coinstake transactions of the address to stakes
+func (w *Worker) addrDescStakes(addrDesc bchain.AddressDescriptor, s stakes) error {
+	if w.db.HasStakingIndex() {
+		return w.db.GetAddrDescStakes(addrDesc, 0, maxUint32, func(as *db.AddrStake) error {
+			s.add(as.Txid, as.Height, as.RewardSat())
+			return nil
+		})
+	}
+	// without the index of stakes it is necessary to check all transactions of the address
+	return w.db.GetAddrDescTransactions(addrDesc, 0, maxUint32, func(txid string, height uint32, indexes []int32) error {
+		ta, err := w.db.GetTxAddresses(txid)
+		if err != nil {
+			return err
+		}
+		if ta == nil {
+			glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+			return nil
+		}
+		if ta.IsCoinstake() {
+			s.add(txid, height, ta.StakingReward(addrDesc))
+		}
+		return nil
+	})
+}
+
+func (w *Worker) stakingInfoFromStakes(address string, s stakes) *StakingInfo {
+	r := &StakingInfo{
+		Address:        address,
+		TotalRewardSat: &Amount{},
+	}
+	var firstHeight uint32
+	for _, st := range s {
+		if r.Stakes == 0 || st.height < firstHeight {
+			firstHeight = st.height
+		}
+		if st.height > r.LastStakeHeight {
+			r.LastStakeHeight = st.height
+		}
+		(*big.Int)(r.TotalRewardSat).Add((*big.Int)(r.TotalRewardSat), &st.rewardSat)
+		r.Stakes++
+	}
+	if r.Stakes > 0 {
+		r.LastStakeTime = int64(w.is.GetBlockTime(r.LastStakeHeight))
+		if r.Stakes > 1 {
+			r.AverageInterval = (r.LastStakeTime - int64(w.is.GetBlockTime(firstHeight))) / int64(r.Stakes-1)
+		}
+	}
+	return r
+}
+
+// GetStakingInfo returns staking statistics of the address
+func (w *Worker) GetStakingInfo(address string) (*StakingInfo, error) {
+	if !w.chainParser.SupportsCoinstake() {
+		return nil, NewAPIError("Staking not supported", true)
+	}
+	start := time.Now()
+	addrDesc, address, err := w.getAddrDescAndNormalizeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	s := make(stakes)
+	if err = w.addrDescStakes(addrDesc, s); err != nil {
+		return nil, err
+	}
+	r := w.stakingInfoFromStakes(address, s)
+	glog.Info("GetStakingInfo ", address, ", stakes ", r.Stakes, ", ", time.Since(start))
+	return r, nil
+}
+
+// GetDescriptorStakingInfo returns staking statistics of the xpub (or output descriptor) or of the address
+// The descriptor is treated as an address only if it cannot be parsed as an xpub, the errors of the xpub are returned as they are.
+func (w *Worker) GetDescriptorStakingInfo(descriptor string, gap int) (r *StakingInfo, xpub bool, err error) {
+	if !w.chainParser.SupportsCoinstake() {
+		return nil, false, NewAPIError("Staking not supported", true)
+	}
+	xd, errXpub := w.chainParser.ParseXpub(descriptor)
+	if errXpub == nil {
+		r, err = w.getXpubStakingInfo(descriptor, xd, gap)
+		return r, true, err
+	}
+	if _, err = w.chainParser.GetAddrDescFromAddress(descriptor); err != nil {
+		if _, errAd := bchain.AddressDescriptorFromString(descriptor); errAd != nil {
+			return nil, false, NewAPIError(fmt.Sprintf("Invalid address or xpub, %v", errXpub), true)
+		}
+	}
+	r, err = w.GetStakingInfo(descriptor)
+	return r, false, err
+}
+
+// getXpubStakingInfo returns staking statistics of the addresses derived from the xpub
+func (w *Worker) getXpubStakingInfo(xpub string, xd *bchain.XpubDescriptor, gap int) (*StakingInfo, error) {
+	start := time.Now()
+	data, _, inCache, err := w.getXpubData(xd, 0, 1, AccountDetailsBasic, &AddressFilter{
+		Vout:          AddressFilterVoutOff,
+		OnlyConfirmed: true,
+	}, gap)
+	if err != nil {
+		return nil, err
+	}
+	s := make(stakes)
+	for _, da := range data.addresses {
+		for i := range da {
+			ad := &da[i]
+			if ad.balance == nil {
+				continue
+			}
+			if err = w.addrDescStakes(ad.addrDesc, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	r := w.stakingInfoFromStakes(xpub, s)
+	glog.Info("GetXpubStakingInfo ", xpub[:xpubLogPrefix], ", cache ", inCache, ", stakes ", r.Stakes, ", ", time.Since(start))
+	return r, nil
+}
@@ -263,6 +263,7 @@ type Tx struct {
 	FeesSat                *Amount           `json:"fees,omitempty"`
 	Hex                    string            `json:"hex,omitempty"`
 	Rbf                    bool              `json:"rbf,omitempty"`
+	StakingRewardSat       *Amount           `json:"stakingReward,omitempty"`
 	CoinSpecificData       json.RawMessage   `json:"coinSpecificData,omitempty" ts_type:"any"`
 	TokenTransfers         []TokenTransfer   `json:"tokenTransfers,omitempty"`
 	EthereumSpecific       *EthereumSpecific `json:"ethereumSpecific,omitempty"`
@@ -328,6 +329,8 @@ type Address struct {
 	Txs                   int                  `json:"txs"`
 	NonTokenTxs           int                  `json:"nonTokenTxs,omitempty"`
 	InternalTxs           int                  `json:"internalTxs,omitempty"`
+	FirstSeen             uint32               `json:"firstSeen,omitempty"` // height of the first block with a transaction of the address
+	LastSeen              uint32               `json:"lastSeen,omitempty"`  // height of the last block with a transaction of the address
 	Transactions          []*Tx                `json:"transactions,omitempty"`
 	Txids                 []string             `json:"txids,omitempty"`
 	Nonce                 string               `json:"nonce,omitempty"`
@@ -341,6 +344,7 @@ type Address struct {
 	ContractInfo          *bchain.ContractInfo `json:"contractInfo,omitempty"`
 	Erc20Contract         *bchain.ContractInfo `json:"erc20Contract,omitempty"` // deprecated
 	AddressAliases        AddressAliasesMap    `json:"addressAliases,omitempty"`
+	HistoryPrunedBelow    uint32               `json:"historyPrunedBelow,omitempty"` // transactions below this height are not in the returned history
 	// helpers for explorer
 	Filter        string              `json:"-"`
 	XPubAddresses map[string]struct{} `json:"-"`
@@ -380,13 +384,43 @@ func (a Utxos) Less(i, j int) bool {
 
 // BalanceHistory contains info about one point in time of balance history
 type BalanceHistory struct {
-	Time          uint32             `json:"time"`
-	Txs           uint32             `json:"txs"`
-	ReceivedSat   *Amount            `json:"received"`
-	SentSat       *Amount            `json:"sent"`
-	SentToSelfSat *Amount            `json:"sentToSelf"`
-	FiatRates     map[string]float32 `json:"rates,omitempty"`
-	Txid          string             `json:"txid,omitempty"`
+	Time             uint32             `json:"time"`
+	Txs              uint32             `json:"txs"`
+	ReceivedSat      *Amount            `json:"received"`
+	SentSat          *Amount            `json:"sent"`
+	SentToSelfSat    *Amount            `json:"sentToSelf"`
+	StakingRewardSat *Amount            `json:"stakingReward,omitempty"`
+	FiatRates        map[string]float32 `json:"rates,omitempty"`
+	Txid             string             `json:"txid,omitempty"`
+}
+
+// XpubExportTx is one transaction of the export of the xpub transaction history
+// The amounts are from the point of view of the xpub, the change is the part of the received amount returned to the change addresses.
+type XpubExportTx struct {
+	Txid        string  `json:"txid"`
+	BlockHeight uint32  `json:"blockHeight"`
+	BlockTime   int64   `json:"blockTime"`
+	Type        string  `json:"type"`
+	ReceivedSat *Amount `json:"received"`
+	ChangeSat   *Amount `json:"change"`
+	SentSat     *Amount `json:"sent"`
+	// FeeSat is set only if all inputs of the transaction belong to the xpub
+	FeeSat   *Amount `json:"fee,omitempty"`
+	NetSat   *Amount `json:"net"`
+	Currency string  `json:"currency,omitempty"`
+	FiatRate float32 `json:"fiatRate,omitempty"`
+	FiatNet  float64 `json:"fiatNet,omitempty"`
+	FiatFee  float64 `json:"fiatFee,omitempty"`
+}
+
+// StakingInfo contains staking statistics of an address or xpub
+type StakingInfo struct {
+	Address         string  `json:"address"`
+	Stakes          int     `json:"stakes"`
+	TotalRewardSat  *Amount `json:"totalReward"`
+	LastStakeHeight uint32  `json:"lastStakeHeight,omitempty"`
+	LastStakeTime   int64   `json:"lastStakeTime,omitempty"`
+	AverageInterval int64   `json:"averageInterval,omitempty"`
 }
 
 // BalanceHistories is array of BalanceHistory
@@ -436,6 +470,12 @@ func (a BalanceHistories) SortAndAggregate(groupByTime uint32) BalanceHistories
 			(*big.Int)(bha.ReceivedSat).Add((*big.Int)(bha.ReceivedSat), (*big.Int)(bh.ReceivedSat))
 			(*big.Int)(bha.SentSat).Add((*big.Int)(bha.SentSat), (*big.Int)(bh.SentSat))
 			(*big.Int)(bha.SentToSelfSat).Add((*big.Int)(bha.SentToSelfSat), (*big.Int)(bh.SentToSelfSat))
+			if bh.StakingRewardSat != nil {
+				if bha.StakingRewardSat == nil {
+					bha.StakingRewardSat = &Amount{}
+				}
+				(*big.Int)(bha.StakingRewardSat).Add((*big.Int)(bha.StakingRewardSat), (*big.Int)(bh.StakingRewardSat))
+			}
 		}
 		if bha.Txs > 0 {
 			bha.Txid = ""
@@ -451,6 +491,68 @@ type Blocks struct {
 	Blocks []db.BlockInfo `json:"blocks"`
 }
 
+// RichListItem is an address in the list of addresses sorted by balance
+type RichListItem struct {
+	Rank    int     `json:"rank"`
+	Address string  `json:"address"`
+	Balance *Amount `json:"balance"`
+}
+
+// RichList is the list of addresses with the highest balance with paging information
+type RichList struct {
+	Paging
+	TotalAddresses int            `json:"totalAddresses"`
+	Addresses      []RichListItem `json:"addresses"`
+}
+
+// SilentPaymentTweak is the BIP-352 tweak of a taproot-eligible transaction, the compressed public key in hex
+type SilentPaymentTweak struct {
+	Txid  string `json:"txid"`
+	Tweak string `json:"tweak"`
+}
+
+// SilentPaymentTweaks contains the silent payment tweaks of the transactions in a block
+type SilentPaymentTweaks struct {
+	Height uint32               `json:"height"`
+	Hash   string               `json:"hash"`
+	Tweaks []SilentPaymentTweak `json:"tweaks"`
+}
+
+// BlockStats contains the aggregated statistics of the transactions and addresses of a block
+type BlockStats struct {
+	Height          uint32  `json:"height"`
+	Time            int64   `json:"time"`
+	Txs             uint32  `json:"txs"`
+	ActiveAddresses uint32  `json:"activeAddresses"`
+	NewAddresses    uint32  `json:"newAddresses"`
+	CoinsCreated    *Amount `json:"coinsCreated"`
+	Fees            *Amount `json:"fees"`
+}
+
+// ChainStats contains the statistics of the blocks in the range of heights
+type ChainStats struct {
+	From   uint32       `json:"from"`
+	To     uint32       `json:"to"`
+	Blocks []BlockStats `json:"blocks"`
+}
+
+// OrphanedBlock is a block disconnected from the index because of a chain reorganization
+type OrphanedBlock struct {
+	Height       uint32 `json:"height"`
+	Hash         string `json:"hash"`
+	Time         int64  `json:"time"`
+	Txs          uint32 `json:"txs"`
+	Size         uint32 `json:"size"`
+	OrphanedTime int64  `json:"orphanedTime"`
+}
+
+// Orphans contains the orphaned blocks in the range of heights
+type Orphans struct {
+	From   uint32          `json:"from"`
+	To     uint32          `json:"to"`
+	Blocks []OrphanedBlock `json:"blocks"`
+}
+
 // BlockInfo contains extended block header data and a list of block txids
 type BlockInfo struct {
 	Hash          string            `json:"hash"`
@@ -506,6 +608,8 @@ type BlockbookInfo struct {
 	HistoricalTokenFiatRatesTime *time.Time                   `json:"historicalTokenFiatRatesTime,omitempty"`
 	DbSizeFromColumns            int64                        `json:"dbSizeFromColumns,omitempty"`
 	DbColumns                    []common.InternalStateColumn `json:"dbColumns,omitempty"`
+	PruneHeight                  uint32                       `json:"pruneHeight,omitempty"`
+	ReorgDepthExceeded           *common.ReorgDepthExceeded   `json:"reorgDepthExceeded,omitempty"`
 	About                        string                       `json:"about"`
 }
 
@@ -164,6 +164,63 @@ func TestBalanceHistories_SortAndAggregate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "aggregate staking",
+			a: []BalanceHistory{
+				{
+					ReceivedSat:      (*Amount)(big.NewInt(1000)),
+					SentSat:          (*Amount)(big.NewInt(900)),
+					SentToSelfSat:    (*Amount)(big.NewInt(0)),
+					StakingRewardSat: (*Amount)(big.NewInt(100)),
+					Time:             1521504812,
+					Txid:             "0011223344556677889900112233445566778899001122334455667788990011",
+					Txs:              1,
+				},
+				{
+					ReceivedSat:   (*Amount)(big.NewInt(3)),
+					SentSat:       (*Amount)(big.NewInt(0)),
+					SentToSelfSat: (*Amount)(big.NewInt(0)),
+					Time:          1521504812,
+					Txid:          "00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840",
+					Txs:           1,
+				},
+				{
+					ReceivedSat:      (*Amount)(big.NewInt(1100)),
+					SentSat:          (*Amount)(big.NewInt(1000)),
+					SentToSelfSat:    (*Amount)(big.NewInt(0)),
+					StakingRewardSat: (*Amount)(big.NewInt(100)),
+					Time:             1521506812,
+					Txid:             "1122334455667788990011223344556677889900112233445566778899001100",
+					Txs:              1,
+				},
+				{
+					ReceivedSat:   (*Amount)(big.NewInt(5)),
+					SentSat:       (*Amount)(big.NewInt(0)),
+					SentToSelfSat: (*Amount)(big.NewInt(0)),
+					Time:          1521514812,
+					Txid:          "2233445566778899001122334455667788990011223344556677889900110011",
+					Txs:           1,
+				},
+			},
+			groupByTime: 3600,
+			want: []BalanceHistory{
+				{
+					ReceivedSat:      (*Amount)(big.NewInt(2103)),
+					SentSat:          (*Amount)(big.NewInt(1900)),
+					SentToSelfSat:    (*Amount)(big.NewInt(0)),
+					StakingRewardSat: (*Amount)(big.NewInt(200)),
+					Time:             1521504000,
+					Txs:              3,
+				},
+				{
+					ReceivedSat:   (*Amount)(big.NewInt(5)),
+					SentSat:       (*Amount)(big.NewInt(0)),
+					SentToSelfSat: (*Amount)(big.NewInt(0)),
+					Time:          1521514800,
+					Txs:           1,
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
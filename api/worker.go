@@ -23,7 +23,7 @@ import (
 
 // Worker is handle to api worker
 type Worker struct {
-	db                *db.RocksDB
+	db                db.Store
 	txCache           *db.TxCache
 	chain             bchain.BlockChain
 	chainParser       bchain.BlockChainParser
@@ -35,7 +35,7 @@ type Worker struct {
 }
 
 // NewWorker creates new api worker
-func NewWorker(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*Worker, error) {
+func NewWorker(db db.Store, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*Worker, error) {
 	w := &Worker{
 		db:                db,
 		txCache:           txCache,
@@ -270,6 +270,7 @@ func (w *Worker) getTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 	var ta *db.TxAddresses
 	var tokens []TokenTransfer
 	var ethSpecific *EthereumSpecific
+	var stakingRewardSat *Amount
 	var blockhash string
 	if bchainTx.Confirmations > 0 {
 		if w.chainType == bchain.ChainBitcoinType {
@@ -425,6 +426,7 @@ func (w *Worker) getTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 			feesSat.SetUint64(0)
 		}
 		pValInSat = &valInSat
+		stakingRewardSat = w.getStakingReward(ta)
 	} else if w.chainType == bchain.ChainEthereumType {
 		tokenTransfers, err := w.chainParser.EthereumTypeGetTokenTransfersFromTx(bchainTx)
 		if err != nil {
@@ -500,6 +502,7 @@ func (w *Worker) getTransactionFromBchainTx(bchainTx *bchain.Tx, height int, spe
 		VSize:            int(bchainTx.VSize),
 		Hex:              bchainTx.Hex,
 		Rbf:              rbf,
+		StakingRewardSat: stakingRewardSat,
 		Vin:              vins,
 		Vout:             vouts,
 		CoinSpecificData: sj,
@@ -837,6 +840,22 @@ func (t *Tx) getAddrVinValue(addrDesc bchain.AddressDescriptor) *big.Int {
 	return &val
 }
 
+// getStakingReward returns the amount of coins created by the coinstake transaction,
+// nil is returned if the transaction is not a coinstake
+func (w *Worker) getStakingReward(ta *db.TxAddresses) *Amount {
+	if ta == nil || !w.chainParser.SupportsCoinstake() || !ta.IsCoinstake() {
+		return nil
+	}
+	var r big.Int
+	for i := range ta.Outputs {
+		r.Add(&r, &ta.Outputs[i].ValueSat)
+	}
+	for i := range ta.Inputs {
+		r.Sub(&r, &ta.Inputs[i].ValueSat)
+	}
+	return (*Amount)(&r)
+}
+
 // GetUniqueTxids removes duplicate transactions
 func GetUniqueTxids(txids []string) []string {
 	ut := make([]string, len(txids))
@@ -922,16 +941,17 @@ func (w *Worker) txFromTxAddress(txid string, ta *db.TxAddresses, bi *db.BlockIn
 		feesSat.SetUint64(0)
 	}
 	r := &Tx{
-		Blockhash:     bi.Hash,
-		Blockheight:   int(ta.Height),
-		Blocktime:     bi.Time,
-		Confirmations: bestheight - ta.Height + 1,
-		FeesSat:       (*Amount)(&feesSat),
-		Txid:          txid,
-		ValueInSat:    (*Amount)(&valInSat),
-		ValueOutSat:   (*Amount)(&valOutSat),
-		Vin:           vins,
-		Vout:          vouts,
+		Blockhash:        bi.Hash,
+		Blockheight:      int(ta.Height),
+		Blocktime:        bi.Time,
+		Confirmations:    bestheight - ta.Height + 1,
+		FeesSat:          (*Amount)(&feesSat),
+		Txid:             txid,
+		ValueInSat:       (*Amount)(&valInSat),
+		ValueOutSat:      (*Amount)(&valOutSat),
+		StakingRewardSat: w.getStakingReward(ta),
+		Vin:              vins,
+		Vout:             vouts,
 	}
 	if w.chainParser.SupportsVSize() {
 		r.VSize = int(ta.VSize)
@@ -1110,7 +1130,9 @@ func (w *Worker) getEthereumTypeAddressBalances(addrDesc bchain.AddressDescripto
 	}
 	if ca != nil {
 		ba = &db.AddrBalance{
-			Txs: uint32(ca.TotalTxs),
+			Txs:       uint32(ca.TotalTxs),
+			FirstSeen: ca.FirstSeen,
+			LastSeen:  ca.LastSeen,
 		}
 		if b != nil {
 			ba.BalanceSat = *b
@@ -1270,6 +1292,14 @@ func setIsOwnAddress(tx *Tx, address string) {
 	}
 }
 
+// historyPrunedBelow returns the height below which the requested history was pruned, 0 if the history is complete
+func (w *Worker) historyPrunedBelow(option AccountDetails, filter *AddressFilter) uint32 {
+	if option >= AccountDetailsTxidHistory && filter.FromHeight < w.is.PruneHeight {
+		return w.is.PruneHeight
+	}
+	return 0
+}
+
 // GetAddress computes address value and gets transactions for given address
 func (w *Worker) GetAddress(address string, page int, txsOnPage int, option AccountDetails, filter *AddressFilter, secondaryCoin string) (*Address, error) {
 	start := time.Now()
@@ -1306,8 +1336,8 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 			return nil, NewAPIError(fmt.Sprintf("Address not found, %v", err), true)
 		}
 		if ba != nil {
-			// totalResults is known only if there is no filter
-			if filter.Vout == AddressFilterVoutOff && filter.FromHeight == 0 && filter.ToHeight == 0 {
+			// totalResults is known only if there is no filter and the history is not pruned
+			if filter.Vout == AddressFilterVoutOff && filter.FromHeight == 0 && filter.ToHeight == 0 && w.is.PruneHeight == 0 {
 				totalResults = int(ba.Txs)
 			} else {
 				totalResults = -1
@@ -1416,6 +1446,8 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 		Txs:                   int(ba.Txs),
 		NonTokenTxs:           ed.nonContractTxs,
 		InternalTxs:           ed.internalTxs,
+		FirstSeen:             ba.FirstSeen,
+		LastSeen:              ba.LastSeen,
 		UnconfirmedBalanceSat: (*Amount)(&uBalSat),
 		UnconfirmedTxs:        unconfirmedTxs,
 		Transactions:          txs,
@@ -1429,6 +1461,7 @@ func (w *Worker) GetAddress(address string, page int, txsOnPage int, option Acco
 		ContractInfo:          ed.contractInfo,
 		Nonce:                 ed.nonce,
 		AddressAliases:        w.getAddressAliases(addresses),
+		HistoryPrunedBelow:    w.historyPrunedBelow(option, filter),
 	}
 	// keep address backward compatible, set deprecated Erc20Contract value if ERC20 token
 	if ed.contractInfo != nil && ed.contractInfo.Type == bchain.ERC20TokenType {
@@ -1524,6 +1557,10 @@ func (w *Worker) balanceHistoryForTxid(addrDesc bchain.AddressDescriptor, txid s
 				}
 			}
 		}
+		// staking reward is part of the received amount, it is reported separately to distinguish it from payments
+		if w.chainParser.SupportsCoinstake() && ta.IsCoinstake() {
+			bh.StakingRewardSat = (*Amount)(ta.StakingReward(addrDesc))
+		}
 	} else if w.chainType == bchain.ChainEthereumType {
 		var value big.Int
 		ethTxData := eth.GetEthereumTxData(bchainTx)
@@ -1858,6 +1895,143 @@ func (w *Worker) GetBlocks(page int, blocksOnPage int) (*Blocks, error) {
 	return r, nil
 }
 
+const defaultChainStatsBlocks = 100
+const maxChainStatsBlocks = 10000
+
+// GetChainStats returns the statistics of the blocks in the range of heights from-to (inclusive)
+// Negative to means the best block, negative from means the last defaultChainStatsBlocks blocks up to to.
+// The range is limited to maxChainStatsBlocks blocks.
+func (w *Worker) GetChainStats(from, to int) (*ChainStats, error) {
+	if w.chainType != bchain.ChainBitcoinType {
+		return nil, NewAPIError("Not supported", true)
+	}
+	start := time.Now()
+	bestHeight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestBlock")
+	}
+	if to < 0 || to > int(bestHeight) {
+		to = int(bestHeight)
+	}
+	if from < 0 {
+		from = to - defaultChainStatsBlocks + 1
+		if from < 0 {
+			from = 0
+		}
+	}
+	if from > to {
+		return nil, NewAPIError(fmt.Sprintf("Invalid range %d-%d", from, to), true)
+	}
+	if to-from+1 > maxChainStatsBlocks {
+		to = from + maxChainStatsBlocks - 1
+	}
+	bs, err := w.db.GetBlockStats(uint32(from), uint32(to))
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBlockStats %d-%d", from, to)
+	}
+	r := &ChainStats{From: uint32(from), To: uint32(to), Blocks: make([]BlockStats, len(bs))}
+	for i := range bs {
+		b := &bs[i]
+		r.Blocks[i] = BlockStats{
+			Height:          b.Height,
+			Time:            b.Time,
+			Txs:             b.Txs,
+			ActiveAddresses: b.ActiveAddresses,
+			NewAddresses:    b.NewAddresses,
+			CoinsCreated:    (*Amount)(&b.CoinsCreated),
+			Fees:            (*Amount)(&b.Fees),
+		}
+	}
+	glog.Info("GetChainStats ", from, "-", to, ", ", time.Since(start))
+	return r, nil
+}
+
+const defaultOrphansBlocks = 10000
+const maxOrphansBlocks = 1000000
+
+// GetOrphanedBlocks returns the blocks orphaned by chain reorganizations in the range of heights from-to (inclusive)
+// Negative to means the best block, negative from means the last defaultOrphansBlocks blocks up to to.
+// The range is limited to maxOrphansBlocks blocks.
+func (w *Worker) GetOrphanedBlocks(from, to int) (*Orphans, error) {
+	bestHeight, _, err := w.db.GetBestBlock()
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetBestBlock")
+	}
+	// to is not limited by the best block, the orphaned blocks may be above it if the new chain is shorter
+	if to < 0 {
+		to = int(bestHeight)
+	}
+	if from < 0 {
+		from = to - defaultOrphansBlocks + 1
+		if from < 0 {
+			from = 0
+		}
+	}
+	if from > to {
+		return nil, NewAPIError(fmt.Sprintf("Invalid range %d-%d", from, to), true)
+	}
+	if to-from+1 > maxOrphansBlocks {
+		to = from + maxOrphansBlocks - 1
+	}
+	obs, err := w.db.GetOrphanedBlocks(uint32(from), uint32(to))
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetOrphanedBlocks %d-%d", from, to)
+	}
+	r := &Orphans{From: uint32(from), To: uint32(to), Blocks: make([]OrphanedBlock, len(obs))}
+	for i := range obs {
+		ob := &obs[i]
+		r.Blocks[i] = OrphanedBlock{
+			Height:       ob.Height,
+			Hash:         ob.Hash,
+			Time:         ob.Time,
+			Txs:          ob.Txs,
+			Size:         ob.Size,
+			OrphanedTime: ob.OrphanedTime,
+		}
+	}
+	return r, nil
+}
+
+// GetRichList returns a page of addresses sorted by balance in descending order
+func (w *Worker) GetRichList(page int, itemsOnPage int) (*RichList, error) {
+	if w.chainType != bchain.ChainBitcoinType || !w.db.HasRichList() {
+		return nil, NewAPIError("Rich list not enabled", true)
+	}
+	start := time.Now()
+	page--
+	if page < 0 {
+		page = 0
+	}
+	total := w.db.RichListSize()
+	// only the top of the rich list is paged
+	listed := total
+	if listed > db.MaxRichListPosition {
+		listed = db.MaxRichListPosition
+	}
+	pg, from, to, page := computePaging(listed, page, itemsOnPage)
+	items, err := w.db.GetRichList(from, to)
+	if err != nil {
+		return nil, errors.Annotatef(err, "GetRichList")
+	}
+	r := &RichList{Paging: pg, TotalAddresses: total, Addresses: make([]RichListItem, len(items))}
+	for i := range items {
+		item := &items[i]
+		var address string
+		a, _, err := w.chainParser.GetAddressesFromAddrDesc(item.AddrDesc)
+		if err != nil {
+			glog.Warning("GetAddressesFromAddrDesc ", item.AddrDesc, ": ", err)
+		}
+		if len(a) == 1 {
+			address = a[0]
+		} else {
+			address = item.AddrDesc.String()
+		}
+		r.Addresses[i] = RichListItem{Rank: from + i + 1, Address: address, Balance: (*Amount)(&item.BalanceSat)}
+	}
+	glog.Info("GetRichList page ", page, ", ", time.Since(start))
+	return r, nil
+}
+
 // removeEmpty removes empty strings from a slice
 func removeEmpty(stringSlice []string) []string {
 	var ret []string
@@ -2372,6 +2546,8 @@ func (w *Worker) GetSystemInfo(internal bool) (*SystemInfo, error) {
 		DbSize:                       w.db.DatabaseSizeOnDisk(),
 		DbSizeFromColumns:            internalDBSize,
 		DbColumns:                    columnStats,
+		PruneHeight:                  w.is.PruneHeight,
+		ReorgDepthExceeded:           w.is.GetReorgDepthExceeded(),
 		About:                        Text.BlockbookAbout,
 	}
 	backendInfo := &common.BackendInfo{
@@ -2389,6 +2565,8 @@ func (w *Worker) GetSystemInfo(internal bool) (*SystemInfo, error) {
 		Warnings:         ci.Warnings,
 		ConsensusVersion: ci.ConsensusVersion,
 		Consensus:        ci.Consensus,
+		ActiveBackend:    ci.ActiveBackend,
+		Backends:         ci.Backends,
 	}
 	w.is.SetBackendInfo(backendInfo)
 	glog.Info("GetSystemInfo, ", time.Since(start))
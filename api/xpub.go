@@ -22,6 +22,12 @@ const txOutput = 2
 
 const xpubCacheExpirationSeconds = 3600
 
+// the xpubs persisted in the db are evicted after 30 days without access
+const xpubPersistedCacheExpirationSeconds = 30 * 24 * 3600
+
+// the maximum number of the xpubs persisted in the db, the least recently accessed xpubs over the limit are evicted
+const xpubPersistedCacheMaxCount = 10000
+
 var cachedXpubs map[string]xpubData
 var cachedXpubsMux sync.Mutex
 
@@ -54,6 +60,8 @@ type xpubAddress struct {
 	maxHeight uint32
 	complete  bool
 	txids     xpubTxids
+	// height of the best block when the balance was loaded, 0 if not loaded
+	balanceHeight uint32
 }
 
 type xpubData struct {
@@ -79,6 +87,14 @@ func (w *Worker) initXpubCache() {
 				w.evictXpubCacheItems()
 			}
 		}()
+		go func() {
+			for {
+				time.Sleep(time.Hour)
+				if _, err := w.db.EvictXpubCache(time.Now().Unix()-xpubPersistedCacheExpirationSeconds, xpubPersistedCacheMaxCount); err != nil {
+					glog.Error("EvictXpubCache error ", err)
+				}
+			}
+		}()
 	}
 	cachedXpubsMux.Unlock()
 }
@@ -188,10 +204,13 @@ func (w *Worker) xpubCheckAndLoadTxids(ad *xpubAddress, filter *AddressFilter, m
 	return nil
 }
 
-func (w *Worker) xpubDerivedAddressBalance(data *xpubData, ad *xpubAddress) (bool, error) {
-	var err error
-	if ad.balance, err = w.db.GetAddrDescBalance(ad.addrDesc, db.AddressBalanceDetailUTXO); err != nil {
-		return false, err
+func (w *Worker) xpubDerivedAddressBalance(data *xpubData, ad *xpubAddress, load bool) (bool, error) {
+	if load {
+		var err error
+		if ad.balance, err = w.db.GetAddrDescBalance(ad.addrDesc, db.AddressBalanceDetailUTXO); err != nil {
+			return false, err
+		}
+		ad.balanceHeight = data.dataHeight
 	}
 	if ad.balance != nil {
 		data.txCountEstimate += ad.balance.Txs
@@ -202,7 +221,12 @@ func (w *Worker) xpubDerivedAddressBalance(data *xpubData, ad *xpubAddress) (boo
 	return false, nil
 }
 
-func (w *Worker) xpubScanAddresses(xd *bchain.XpubDescriptor, data *xpubData, addresses []xpubAddress, gap int, change uint32, minDerivedIndex int, fork bool) (int, []xpubAddress, error) {
+func (w *Worker) xpubScanAddresses(xd *bchain.XpubDescriptor, data *xpubData, addresses []xpubAddress, xc *db.XpubCache, chain int, gap int, change uint32, minDerivedIndex int, fork bool) (int, []xpubAddress, error) {
+	persisted := xc.Addresses[chain]
+	// load only the balances changed since the last load according to the persisted cache
+	mustLoad := func(i int, ad *xpubAddress) bool {
+		return fork || !xc.Valid || i >= len(persisted) || persisted[i].BalanceHeight > ad.balanceHeight
+	}
 	// rescan known addresses
 	lastUsed := 0
 	for i := range addresses {
@@ -214,13 +238,14 @@ func (w *Worker) xpubScanAddresses(xd *bchain.XpubDescriptor, data *xpubData, ad
 			ad.complete = false
 			ad.txids = nil
 		}
-		used, err := w.xpubDerivedAddressBalance(data, ad)
+		used, err := w.xpubDerivedAddressBalance(data, ad, mustLoad(i, ad))
 		if err != nil {
 			return 0, nil, err
 		}
 		if used {
 			lastUsed = i
 		}
+		xc.SetAddress(chain, i, ad.addrDesc, ad.balance)
 	}
 	// derive new addresses as necessary
 	missing := len(addresses) - lastUsed
@@ -230,19 +255,28 @@ func (w *Worker) xpubScanAddresses(xd *bchain.XpubDescriptor, data *xpubData, ad
 		if to < minDerivedIndex {
 			to = minDerivedIndex
 		}
-		descriptors, err := w.chainParser.DeriveAddressDescriptorsFromTo(xd, change, uint32(from), uint32(to))
-		if err != nil {
-			return 0, nil, err
+		// the addresses derived before are taken from the persisted cache
+		descriptors := make([]bchain.AddressDescriptor, 0, to-from)
+		for i := from; i < to && i < len(persisted); i++ {
+			descriptors = append(descriptors, persisted[i].AddrDesc)
+		}
+		if from+len(descriptors) < to {
+			derived, err := w.chainParser.DeriveAddressDescriptorsFromTo(xd, change, uint32(from+len(descriptors)), uint32(to))
+			if err != nil {
+				return 0, nil, err
+			}
+			descriptors = append(descriptors, derived...)
 		}
 		for i, a := range descriptors {
 			ad := xpubAddress{addrDesc: a}
-			used, err := w.xpubDerivedAddressBalance(data, &ad)
+			used, err := w.xpubDerivedAddressBalance(data, &ad, mustLoad(i+from, &ad))
 			if err != nil {
 				return 0, nil, err
 			}
 			if used {
 				lastUsed = i + from
 			}
+			xc.SetAddress(chain, i+from, a, ad.balance)
 			addresses = append(addresses, ad)
 		}
 		missing = len(addresses) - lastUsed
@@ -305,6 +339,17 @@ func setIsOwnAddresses(txs []*Tx, xpubAddresses map[string]struct{}) {
 	}
 }
 
+// xpubGap returns the gap of the xpub discovery, the default one if not specified
+func xpubGap(gap int) int {
+	if gap <= 0 {
+		return defaultAddressesGap
+	} else if gap > maxAddressesGap {
+		// limit the maximum gap to protect against unreasonably big values that could cause high load of the server
+		return maxAddressesGap
+	}
+	return gap
+}
+
 func (w *Worker) getXpubData(xd *bchain.XpubDescriptor, page int, txsOnPage int, option AccountDetails, filter *AddressFilter, gap int) (*xpubData, uint32, bool, error) {
 	if w.chainType != bchain.ChainBitcoinType {
 		return nil, 0, false, ErrUnsupportedXpub
@@ -314,14 +359,8 @@ func (w *Worker) getXpubData(xd *bchain.XpubDescriptor, page int, txsOnPage int,
 		bestheight uint32
 		besthash   string
 	)
-	if gap <= 0 {
-		gap = defaultAddressesGap
-	} else if gap > maxAddressesGap {
-		// limit the maximum gap to protect against unreasonably big values that could cause high load of the server
-		gap = maxAddressesGap
-	}
 	// gap is increased one as there must be gap of empty addresses before the derivation is stopped
-	gap++
+	gap = xpubGap(gap) + 1
 	var processedHash string
 	cachedXpubsMux.Lock()
 	data, inCache := cachedXpubs[xd.XpubDescriptor]
@@ -362,13 +401,24 @@ func (w *Worker) getXpubData(xd *bchain.XpubDescriptor, page int, txsOnPage int,
 			data.balanceSat = *new(big.Int)
 			data.sentSat = *new(big.Int)
 			data.txCountEstimate = 0
+			xc, err := w.db.GetXpubCache(xd.XpubDescriptor)
+			if err != nil {
+				return nil, 0, inCache, err
+			}
+			if xc == nil || len(xc.Addresses) != len(xd.ChangeIndexes) {
+				xc = db.NewXpubCache(len(xd.ChangeIndexes))
+			}
 			var minDerivedIndex int
 			for i, change := range xd.ChangeIndexes {
-				minDerivedIndex, data.addresses[i], err = w.xpubScanAddresses(xd, &data, data.addresses[i], gap, change, minDerivedIndex, fork)
+				minDerivedIndex, data.addresses[i], err = w.xpubScanAddresses(xd, &data, data.addresses[i], xc, i, gap, change, minDerivedIndex, fork)
 				if err != nil {
 					return nil, 0, inCache, err
 				}
 			}
+			// the failure to persist the cache does not affect the result
+			if err = w.db.StoreXpubCache(xd.XpubDescriptor, xc, bestheight); err != nil {
+				glog.Error("StoreXpubCache ", xd.XpubDescriptor[:xpubLogPrefix], ", error ", err)
+			}
 		}
 		if option >= AccountDetailsTxidHistory {
 			for _, da := range data.addresses {
@@ -598,6 +648,7 @@ func (w *Worker) GetXpubAddress(xpub string, page int, txsOnPage int, option Acc
 		SecondaryValue:        secondaryValue,
 		XPubAddresses:         xpubAddresses,
 		AddressAliases:        w.getAddressAliases(addresses),
+		HistoryPrunedBelow:    w.historyPrunedBelow(option, filter),
 	}
 	glog.Info("GetXpubAddress ", xpub[:xpubLogPrefix], ", cache ", inCache, ", ", txCount, " txs, ", time.Since(start))
 	return &addr, nil
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	xpubExportReceived = "received"
+	xpubExportSent     = "sent"
+	xpubExportSelf     = "self"
+)
+
+// ExportXpubTransactions calls fn for each confirmed transaction of the xpub in the blocks fromHeight to toHeight (0 means the best block),
+// ordered from the oldest one. The transactions are read from the index, they are not loaded from the backend,
+// so that the whole history of large accounts can be exported at once.
+// If currency is specified, the fiat values are computed using the rate at the time of the block of the transaction.
+func (w *Worker) ExportXpubTransactions(xpub string, fromHeight, toHeight uint32, currency string, gap int, fn func(tx *XpubExportTx) error) error {
+	start := time.Now()
+	currency = strings.ToLower(currency)
+	if currency != "" {
+		if ticker := w.is.GetCurrentTicker("", ""); ticker != nil {
+			if _, found := ticker.Rates[currency]; !found {
+				return NewAPIError("Unsupported currency "+currency, true)
+			}
+		}
+	}
+	xd, err := w.chainParser.ParseXpub(xpub)
+	if err != nil {
+		return NewAPIError("Invalid xpub or descriptor: "+err.Error(), true)
+	}
+	data, _, inCache, err := w.getXpubData(xd, 0, 1, AccountDetailsTxidHistory, &AddressFilter{
+		Vout:          AddressFilterVoutOff,
+		OnlyConfirmed: true,
+		FromHeight:    fromHeight,
+		ToHeight:      toHeight,
+	}, gap)
+	if err != nil {
+		return err
+	}
+	if toHeight == 0 {
+		toHeight = maxUint32
+	}
+	// own addresses with the index of their chain, the chains after the first one are considered change
+	own := make(map[string]int)
+	heights := make(map[string]uint32)
+	for chain, da := range data.addresses {
+		for i := range da {
+			ad := &da[i]
+			own[string(ad.addrDesc)] = chain
+			for _, txid := range ad.txids {
+				if txid.height >= fromHeight && txid.height <= toHeight {
+					heights[txid.txid] = txid.height
+				}
+			}
+		}
+	}
+	txids := make(xpubTxids, 0, len(heights))
+	for txid, height := range heights {
+		txids = append(txids, xpubTxid{txid: txid, height: height})
+	}
+	sort.Slice(txids, func(i, j int) bool {
+		if txids[i].height == txids[j].height {
+			return txids[i].txid < txids[j].txid
+		}
+		return txids[i].height < txids[j].height
+	})
+	var (
+		rate     float32
+		rateTime int64 = -1
+		count    int
+	)
+	for i := range txids {
+		tx, err := w.xpubExportTx(txids[i].txid, own)
+		if err != nil {
+			return err
+		}
+		if tx == nil {
+			continue
+		}
+		if currency != "" {
+			if tx.BlockTime != rateTime {
+				rateTime = tx.BlockTime
+				rate = 0
+				t := time.Unix(tx.BlockTime, 0)
+				ticker, err := w.db.FiatRatesFindTicker(&t, "", "")
+				if err != nil {
+					glog.Errorf("Error finding ticker by date %v. Error: %v", t, err)
+				} else if ticker != nil {
+					rate = ticker.Rates[currency]
+				}
+			}
+			if rate != 0 {
+				tx.Currency = currency
+				tx.FiatRate = rate
+				tx.FiatNet = w.amountToFiat(tx.NetSat, rate)
+				tx.FiatFee = w.amountToFiat(tx.FeeSat, rate)
+			}
+		}
+		if err = fn(tx); err != nil {
+			return err
+		}
+		count++
+	}
+	glog.Info("ExportXpubTransactions ", xpub[:xpubLogPrefix], ", cache ", inCache, ", blocks ", fromHeight, "-", toHeight, ", count ", count, ", ", time.Since(start))
+	return nil
+}
+
+func (w *Worker) xpubExportTx(txid string, own map[string]int) (*XpubExportTx, error) {
+	ta, err := w.db.GetTxAddresses(txid)
+	if err != nil {
+		return nil, err
+	}
+	if ta == nil {
+		glog.Warning("DB inconsistency:  tx ", txid, ": not found in txAddresses")
+		return nil, nil
+	}
+	var received, change, sent, inputs, outputs big.Int
+	ownInputs := 0
+	for i := range ta.Inputs {
+		tai := &ta.Inputs[i]
+		inputs.Add(&inputs, &tai.ValueSat)
+		if _, found := own[string(tai.AddrDesc)]; found {
+			sent.Add(&sent, &tai.ValueSat)
+			ownInputs++
+		}
+	}
+	foreignOutputs := 0
+	for i := range ta.Outputs {
+		tao := &ta.Outputs[i]
+		outputs.Add(&outputs, &tao.ValueSat)
+		if chain, found := own[string(tao.AddrDesc)]; found {
+			// only the funds returned by the xpub's own transaction are change
+			if ownInputs > 0 && chain > 0 {
+				change.Add(&change, &tao.ValueSat)
+			} else {
+				received.Add(&received, &tao.ValueSat)
+			}
+		} else if tao.ValueSat.Sign() > 0 {
+			foreignOutputs++
+		}
+	}
+	// the xpub cannot get back more than it put in, the rest was paid by the other inputs
+	if change.Cmp(&sent) > 0 {
+		var excess big.Int
+		excess.Sub(&change, &sent)
+		received.Add(&received, &excess)
+		change.Set(&sent)
+	}
+	tx := &XpubExportTx{
+		Txid:        txid,
+		BlockHeight: ta.Height,
+		BlockTime:   int64(w.is.GetBlockTime(ta.Height)),
+		ReceivedSat: (*Amount)(&received),
+		ChangeSat:   (*Amount)(&change),
+		SentSat:     (*Amount)(&sent),
+	}
+	if ownInputs == 0 {
+		tx.Type = xpubExportReceived
+	} else if foreignOutputs == 0 {
+		tx.Type = xpubExportSelf
+	} else {
+		tx.Type = xpubExportSent
+	}
+	// the fee can be attributed to the xpub only if it funded the whole transaction
+	if ownInputs > 0 && ownInputs == len(ta.Inputs) {
+		var fee big.Int
+		fee.Sub(&inputs, &outputs)
+		tx.FeeSat = (*Amount)(&fee)
+	}
+	var net big.Int
+	net.Add(&received, &change)
+	net.Sub(&net, &sent)
+	tx.NetSat = (*Amount)(&net)
+	return tx, nil
+}
+
+func (w *Worker) amountToFiat(a *Amount, rate float32) float64 {
+	if a == nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(a.DecimalString(w.chainParser.AmountDecimals()), 64)
+	if err != nil {
+		return 0
+	}
+	return v * float64(rate)
+}
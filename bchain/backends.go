@@ -0,0 +1,294 @@
+package bchain
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/common"
+)
+
+// BackendConfig is the configuration of one of the backend nodes of the coin
+type BackendConfig struct {
+	// Name identifies the backend in logs and in the backend info, defaults to the host of RPCURL
+	Name                string `json:"name,omitempty"`
+	RPCURL              string `json:"rpc_url"`
+	RPCUser             string `json:"rpc_user,omitempty"`
+	RPCPass             string `json:"rpc_pass,omitempty"`
+	MessageQueueBinding string `json:"message_queue_binding,omitempty"`
+}
+
+const (
+	// number of consecutive failed calls after which the backend is considered unhealthy
+	maxBackendErrors = 3
+	// backend more blocks behind the best of the backends is considered unhealthy
+	maxBackendLag = 10
+	// weight of the last call in the moving average of the latency of the backend
+	backendLatencyWeight = 0.2
+)
+
+// Backend is one of the backend nodes of the coin together with its health statistics
+type Backend struct {
+	BackendConfig
+	Index     int
+	latency   time.Duration
+	errors    int
+	lastError string
+	height    uint32
+	lagging   bool
+}
+
+func (b *Backend) healthy() bool {
+	return b.errors < maxBackendErrors && !b.lagging
+}
+
+// score returns the preference of the backend, lower is better
+func (b *Backend) score() float64 {
+	if !b.healthy() {
+		return math.Inf(1)
+	}
+	return float64(b.latency) * float64(1+b.errors)
+}
+
+// Backends routes the calls to a set of backend nodes
+// The calls are sticky to the active backend and fail over to the other backends ordered by their score.
+// The active backend is switched only when it becomes unhealthy, the subscriptions follow the active backend.
+type Backends struct {
+	mux      sync.Mutex
+	backends []*Backend
+	active   *Backend
+	done     chan struct{}
+	// OnSwitch is called when the active backend is switched
+	OnSwitch func(active *Backend)
+}
+
+// NewBackends returns the Backends for the configured backend nodes, the first backend is active
+func NewBackends(configs []BackendConfig) (*Backends, error) {
+	if len(configs) == 0 {
+		return nil, errors.New("No backend configured")
+	}
+	bs := &Backends{
+		backends: make([]*Backend, len(configs)),
+		done:     make(chan struct{}),
+	}
+	for i := range configs {
+		if configs[i].RPCURL == "" {
+			return nil, errors.Errorf("Backend %d: missing rpc_url", i)
+		}
+		b := &Backend{BackendConfig: configs[i], Index: i}
+		if b.Name == "" {
+			b.Name = strconv.Itoa(i)
+			if u, err := url.Parse(b.RPCURL); err == nil && u.Host != "" {
+				b.Name = u.Host
+			}
+		}
+		bs.backends[i] = b
+	}
+	bs.active = bs.backends[0]
+	return bs, nil
+}
+
+// Len returns the number of the backends
+func (bs *Backends) Len() int {
+	return len(bs.backends)
+}
+
+// Active returns the backend to which the calls and subscriptions are routed
+func (bs *Backends) Active() *Backend {
+	bs.mux.Lock()
+	defer bs.mux.Unlock()
+	return bs.active
+}
+
+// ordered returns the backends in the order in which the calls are tried, the active backend first
+func (bs *Backends) ordered() []*Backend {
+	bs.mux.Lock()
+	defer bs.mux.Unlock()
+	r := make([]*Backend, 0, len(bs.backends))
+	r = append(r, bs.active)
+	for _, b := range bs.backends {
+		if b != bs.active {
+			r = append(r, b)
+		}
+	}
+	others := r[1:]
+	sort.SliceStable(others, func(i, j int) bool {
+		return others[i].score() < others[j].score()
+	})
+	return r
+}
+
+// selectActive switches the active backend to the best healthy backend if the active backend is not healthy
+// it must be called with the lock held, returns the new active backend or nil if not switched
+func (bs *Backends) selectActive() *Backend {
+	if bs.active.healthy() {
+		return nil
+	}
+	var best *Backend
+	for _, b := range bs.backends {
+		if b.healthy() && (best == nil || b.score() < best.score()) {
+			best = b
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	glog.Warning("backends: backend ", bs.active.Name, " is unhealthy (", bs.active.lastError, "), switching to backend ", best.Name)
+	bs.active = best
+	return best
+}
+
+func (bs *Backends) switched(active *Backend) {
+	if active != nil && bs.OnSwitch != nil {
+		bs.OnSwitch(active)
+	}
+}
+
+// report updates the statistics of the backend by the result of a call
+func (bs *Backends) report(b *Backend, latency time.Duration, err error) {
+	bs.mux.Lock()
+	if err != nil {
+		b.errors++
+		b.lastError = err.Error()
+		if b.errors == maxBackendErrors {
+			glog.Error("backends: backend ", b.Name, " is unhealthy, error ", err)
+		}
+	} else {
+		if b.errors >= maxBackendErrors {
+			glog.Info("backends: backend ", b.Name, " recovered")
+		}
+		b.errors = 0
+		b.lastError = ""
+		if b.latency == 0 {
+			b.latency = latency
+		} else {
+			b.latency = time.Duration(backendLatencyWeight*float64(latency) + (1-backendLatencyWeight)*float64(b.latency))
+		}
+	}
+	active := bs.selectActive()
+	bs.mux.Unlock()
+	bs.switched(active)
+}
+
+// Call calls f with the backends in the order of preference until it succeeds or the context is done
+// f must return error only if the backend failed, not if the backend processed the call with an error result.
+// Only the read calls can be repeated with the other backends, the writes must use CallActive.
+func (bs *Backends) Call(ctx context.Context, f func(ctx context.Context, b *Backend) error) error {
+	var err error
+	for _, b := range bs.ordered() {
+		start := time.Now()
+		err = f(ctx, b)
+		bs.report(b, time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if len(bs.backends) > 1 {
+			glog.Warning("backends: call to backend ", b.Name, " failed, error ", err)
+		}
+	}
+	return err
+}
+
+// CallActive calls f only with the active backend, it is used for the calls which must not be repeated,
+// for example sending a transaction, which could have been processed by the backend even if the call failed
+func (bs *Backends) CallActive(ctx context.Context, f func(ctx context.Context, b *Backend) error) error {
+	b := bs.Active()
+	start := time.Now()
+	err := f(ctx, b)
+	bs.report(b, time.Since(start), err)
+	return err
+}
+
+// HealthCheck checks all backends using check which returns the best height of the backend,
+// the backends lagging behind the best of the backends are marked unhealthy
+func (bs *Backends) HealthCheck(check func(b *Backend) (uint32, error)) {
+	heights := make([]uint32, len(bs.backends))
+	ok := make([]bool, len(bs.backends))
+	var best uint32
+	for i, b := range bs.backends {
+		start := time.Now()
+		h, err := check(b)
+		bs.report(b, time.Since(start), err)
+		if err == nil {
+			heights[i], ok[i] = h, true
+			if h > best {
+				best = h
+			}
+		}
+	}
+	bs.mux.Lock()
+	for i, b := range bs.backends {
+		if !ok[i] {
+			continue
+		}
+		b.height = heights[i]
+		lagging := heights[i]+maxBackendLag < best
+		if lagging && !b.lagging {
+			glog.Error("backends: backend ", b.Name, " is lagging at height ", heights[i], ", best height ", best)
+			b.lastError = "lagging " + strconv.Itoa(int(best-heights[i])) + " blocks"
+		}
+		b.lagging = lagging
+	}
+	active := bs.selectActive()
+	bs.mux.Unlock()
+	bs.switched(active)
+}
+
+// StartHealthCheck runs HealthCheck periodically until Close, only if there are backends to fail over to
+func (bs *Backends) StartHealthCheck(period time.Duration, check func(b *Backend) (uint32, error)) {
+	if len(bs.backends) < 2 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-bs.done:
+				return
+			case <-ticker.C:
+				bs.HealthCheck(check)
+			}
+		}
+	}()
+}
+
+// Close stops the health checks
+func (bs *Backends) Close() {
+	select {
+	case <-bs.done:
+	default:
+		close(bs.done)
+	}
+}
+
+// Status returns the name of the active backend and the statistics of all backends, only if there are more backends
+func (bs *Backends) Status() (string, []common.BackendStatus) {
+	if bs == nil || len(bs.backends) < 2 {
+		return "", nil
+	}
+	bs.mux.Lock()
+	defer bs.mux.Unlock()
+	r := make([]common.BackendStatus, len(bs.backends))
+	for i, b := range bs.backends {
+		r[i] = common.BackendStatus{
+			Name:      b.Name,
+			Active:    b == bs.active,
+			Healthy:   b.healthy(),
+			Height:    b.height,
+			LatencyMs: float64(b.latency) / float64(time.Millisecond),
+			Errors:    b.errors,
+			LastError: b.lastError,
+		}
+	}
+	return bs.active.Name, r
+}
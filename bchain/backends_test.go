@@ -0,0 +1,170 @@
+//go:build unittest
+
+package bchain
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTestBackends(t *testing.T) *Backends {
+	bs, err := NewBackends([]BackendConfig{
+		{RPCURL: "http://node1:8030"},
+		{Name: "second", RPCURL: "http://node2:8030"},
+		{RPCURL: "http://node3:8030"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range bs.backends {
+		b.latency = time.Duration(i+1) * time.Second
+	}
+	return bs
+}
+
+func TestBackends_Call(t *testing.T) {
+	bs := newTestBackends(t)
+	var switched []string
+	bs.OnSwitch = func(active *Backend) {
+		switched = append(switched, active.Name)
+	}
+	failing := map[string]bool{"node1:8030": true}
+	call := func() ([]string, error) {
+		var tried []string
+		err := bs.Call(context.Background(), func(ctx context.Context, b *Backend) error {
+			tried = append(tried, b.Name)
+			if failing[b.Name] {
+				return errors.New("connection refused")
+			}
+			return nil
+		})
+		return tried, err
+	}
+
+	// the active backend fails, the call is sent to the next backend, active backend is not switched yet
+	for i := 0; i < maxBackendErrors-1; i++ {
+		tried, err := call()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"node1:8030", "second"}; !reflect.DeepEqual(tried, want) {
+			t.Fatalf("call %d: tried %v, want %v", i, tried, want)
+		}
+		if bs.Active().Name != "node1:8030" {
+			t.Fatalf("call %d: active %v", i, bs.Active().Name)
+		}
+	}
+	// after maxBackendErrors the active backend is unhealthy and the active backend is switched
+	if _, err := call(); err != nil {
+		t.Fatal(err)
+	}
+	if bs.Active().Name != "second" {
+		t.Fatalf("active %v, want second", bs.Active().Name)
+	}
+	if !reflect.DeepEqual(switched, []string{"second"}) {
+		t.Fatalf("switched %v", switched)
+	}
+	tried, err := call()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"second"}; !reflect.DeepEqual(tried, want) {
+		t.Fatalf("tried %v, want %v", tried, want)
+	}
+
+	// all backends fail
+	failing = map[string]bool{"node1:8030": true, "second": true, "node3:8030": true}
+	tried, err = call()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(tried) != 3 || tried[0] != "second" {
+		t.Fatalf("tried %v", tried)
+	}
+
+	active, status := bs.Status()
+	if active != "second" || len(status) != 3 || status[0].Healthy || !status[1].Active || status[2].Errors != 1 {
+		t.Fatalf("Status %v %+v", active, status)
+	}
+
+	// the call is not retried after the context is done
+	failing = map[string]bool{"second": true}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tried = nil
+	err = bs.Call(ctx, func(ctx context.Context, b *Backend) error {
+		tried = append(tried, b.Name)
+		return ctx.Err()
+	})
+	if err == nil || len(tried) != 1 {
+		t.Fatalf("tried %v, err %v", tried, err)
+	}
+}
+
+func TestBackends_CallActive(t *testing.T) {
+	bs := newTestBackends(t)
+	for i := 0; i < maxBackendErrors; i++ {
+		var tried []string
+		err := bs.CallActive(context.Background(), func(ctx context.Context, b *Backend) error {
+			tried = append(tried, b.Name)
+			return errors.New("connection refused")
+		})
+		// the call is not repeated with the other backends
+		if err == nil || !reflect.DeepEqual(tried, []string{"node1:8030"}) {
+			t.Fatalf("call %d: tried %v, err %v", i, tried, err)
+		}
+	}
+	// the failures are counted in the health of the backend
+	if bs.Active().Name != "second" {
+		t.Fatalf("active %v, want second", bs.Active().Name)
+	}
+}
+
+func TestBackends_HealthCheck(t *testing.T) {
+	bs := newTestBackends(t)
+	var switched []string
+	bs.OnSwitch = func(active *Backend) {
+		switched = append(switched, active.Name)
+	}
+	heights := map[string]uint32{"node1:8030": 1000, "second": 1020, "node3:8030": 1015}
+	bs.HealthCheck(func(b *Backend) (uint32, error) {
+		return heights[b.Name], nil
+	})
+	// node1 lags by 20 blocks, the active backend is switched to one of the healthy backends
+	active := bs.Active().Name
+	if active == "node1:8030" {
+		t.Fatal("lagging backend is active")
+	}
+	if !reflect.DeepEqual(switched, []string{active}) {
+		t.Fatalf("switched %v", switched)
+	}
+	_, status := bs.Status()
+	if status[0].Healthy || !status[1].Healthy || !status[2].Healthy || status[0].Height != 1000 {
+		t.Fatalf("Status %+v", status)
+	}
+	// node1 catches up and is healthy again, the active backend is not switched back
+	heights["node1:8030"] = 1020
+	bs.HealthCheck(func(b *Backend) (uint32, error) {
+		return heights[b.Name], nil
+	})
+	_, status = bs.Status()
+	if !status[0].Healthy || bs.Active().Name != active || len(switched) != 1 {
+		t.Fatalf("Status %+v, active %v, switched %v", status, bs.Active().Name, switched)
+	}
+}
+
+func TestBackends_Single(t *testing.T) {
+	bs, err := NewBackends([]BackendConfig{{RPCURL: "http://localhost:8030"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, status := bs.Status(); active != "" || status != nil {
+		t.Fatalf("Status %v %v", active, status)
+	}
+	if _, err := NewBackends([]BackendConfig{{Name: "empty"}}); err == nil {
+		t.Fatal("expected error for missing rpc_url")
+	}
+}
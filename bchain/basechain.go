@@ -39,6 +39,11 @@ func (b *BaseChain) GetMempoolEntry(txid string) (*MempoolEntry, error) {
 	return nil, errors.New("GetMempoolEntry: not supported")
 }
 
+// GetTxOutSetInfo is not supported by default
+func (b *BaseChain) GetTxOutSetInfo(hashType string, height int) (*TxOutSetInfo, error) {
+	return nil, errors.New("GetTxOutSetInfo: not supported")
+}
+
 // EthereumTypeGetBalance is not supported
 func (b *BaseChain) EthereumTypeGetBalance(addrDesc AddressDescriptor) (*big.Int, error) {
 	return nil, errors.New("Not supported")
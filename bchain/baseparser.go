@@ -178,6 +178,11 @@ func (p *BaseParser) SupportsVSize() bool {
 	return false
 }
 
+// SupportsCoinstake returns true if the coin is proof of stake with coinstake transactions
+func (p *BaseParser) SupportsCoinstake() bool {
+	return false
+}
+
 // PackTx packs transaction to byte array using protobuf
 func (p *BaseParser) PackTx(tx *Tx, height uint32, blockTime int64) ([]byte, error) {
 	var err error
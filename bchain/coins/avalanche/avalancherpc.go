@@ -56,7 +56,7 @@ func (b *AvalancheRPC) Initialize() error {
 		return rc, c, nil
 	}
 
-	rpcClient, client, err := b.OpenRPC(b.ChainConfig.RPCURL)
+	rpcClient, client, err := b.OpenBackends()
 	if err != nil {
 		return err
 	}
@@ -70,6 +70,21 @@ func (c *AvalancheRPCClient) CallContext(ctx context.Context, result interface{}
 	return nil
 }
 
+// BatchCallContext sends all given requests as a single batch and waits for the responses
+func (c *AvalancheRPCClient) BatchCallContext(ctx context.Context, b []bchain.EVMBatchElem) error {
+	be := make([]rpc.BatchElem, len(b))
+	for i := range b {
+		be[i] = rpc.BatchElem{Method: b[i].Method, Args: b[i].Args, Result: b[i].Result}
+	}
+	if err := c.Client.BatchCallContext(ctx, be); err != nil {
+		return err
+	}
+	for i := range be {
+		b[i].Error = be[i].Error
+	}
+	return nil
+}
+
 // AvalancheHeader wraps a block header to implement the EVMHeader interface
 type AvalancheHeader struct {
 	*types.Header
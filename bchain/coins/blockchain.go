@@ -262,6 +262,11 @@ func (c *blockChainWithMetrics) GetChainInfo() (v *bchain.ChainInfo, err error)
 	return c.b.GetChainInfo()
 }
 
+func (c *blockChainWithMetrics) GetTxOutSetInfo(hashType string, height int) (v *bchain.TxOutSetInfo, err error) {
+	defer func(s time.Time) { c.observeRPCLatency("GetTxOutSetInfo", s, err) }(time.Now())
+	return c.b.GetTxOutSetInfo(hashType, height)
+}
+
 func (c *blockChainWithMetrics) GetBestBlockHash() (v string, err error) {
 	defer func(s time.Time) { c.observeRPCLatency("GetBestBlockHash", s, err) }(time.Now())
 	return c.b.GetBestBlockHash()
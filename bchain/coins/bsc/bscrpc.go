@@ -56,7 +56,7 @@ func (b *BNBSmartChainRPC) Initialize() error {
 		return rc, ec, nil
 	}
 
-	rc, ec, err := b.OpenRPC(b.ChainConfig.RPCURL)
+	rc, ec, err := b.OpenBackends()
 	if err != nil {
 		return err
 	}
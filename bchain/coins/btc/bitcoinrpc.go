@@ -11,6 +11,7 @@ import (
 	"net"
 	"net/http"
 	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
@@ -24,12 +25,12 @@ import (
 type BitcoinRPC struct {
 	*bchain.BaseChain
 	client       http.Client
-	rpcURL       string
-	user         string
-	password     string
+	slowClient   http.Client // without timeout, for the calls which take longer than rpc_timeout
+	backends     *bchain.Backends
 	Mempool      *bchain.MempoolBitcoinType
 	ParseBlocks  bool
 	pushHandler  func(bchain.NotificationType)
+	mqMux        sync.Mutex
 	mq           *bchain.MQ
 	ChainConfig  *Configuration
 	RPCMarshaler RPCMarshaler
@@ -60,6 +61,11 @@ type Configuration struct {
 	AlternativeEstimateFee       string `json:"alternative_estimate_fee,omitempty"`
 	AlternativeEstimateFeeParams string `json:"alternative_estimate_fee_params,omitempty"`
 	MinimumCoinbaseConfirmations int    `json:"minimumCoinbaseConfirmations,omitempty"`
+
+	// Backends are the backend nodes used with failover, if not set, rpc_url and message_queue_binding are used
+	Backends []bchain.BackendConfig `json:"backends,omitempty"`
+	// BackendsHealthCheckPeriod is the period of the health check of the backends in seconds, default 10
+	BackendsHealthCheckPeriod int `json:"backends_health_check_period,omitempty"`
 }
 
 // NewBitcoinRPC returns new BitcoinRPC instance.
@@ -89,6 +95,11 @@ func NewBitcoinRPC(config json.RawMessage, pushHandler func(bchain.NotificationT
 	c.SupportsEstimateFee = true
 	c.SupportsEstimateSmartFee = true
 
+	backends, err := bchain.NewBackends(backendConfigs(&c))
+	if err != nil {
+		return nil, errors.Annotatef(err, "Invalid configuration file")
+	}
+
 	transport := &http.Transport{
 		Dial:                (&net.Dialer{KeepAlive: 600 * time.Second}).Dial,
 		MaxIdleConns:        100,
@@ -98,18 +109,85 @@ func NewBitcoinRPC(config json.RawMessage, pushHandler func(bchain.NotificationT
 	s := &BitcoinRPC{
 		BaseChain:    &bchain.BaseChain{},
 		client:       http.Client{Timeout: time.Duration(c.RPCTimeout) * time.Second, Transport: transport},
-		rpcURL:       c.RPCURL,
-		user:         c.RPCUser,
-		password:     c.RPCPass,
+		slowClient:   http.Client{Transport: transport},
+		backends:     backends,
 		ParseBlocks:  c.Parse,
 		ChainConfig:  &c,
 		pushHandler:  pushHandler,
 		RPCMarshaler: JSONMarshalerV2{},
 	}
+	backends.OnSwitch = s.onBackendSwitch
+	period := c.BackendsHealthCheckPeriod
+	if period <= 0 {
+		period = 10
+	}
+	backends.StartHealthCheck(time.Duration(period)*time.Second, s.checkBackend)
 
 	return s, nil
 }
 
+// backendConfigs returns the configured backends, the backends without credentials use the credentials of rpc_url
+func backendConfigs(c *Configuration) []bchain.BackendConfig {
+	if len(c.Backends) == 0 {
+		return []bchain.BackendConfig{{
+			RPCURL:              c.RPCURL,
+			RPCUser:             c.RPCUser,
+			RPCPass:             c.RPCPass,
+			MessageQueueBinding: c.MessageQueueBinding,
+		}}
+	}
+	r := make([]bchain.BackendConfig, len(c.Backends))
+	for i, be := range c.Backends {
+		if be.RPCUser == "" && be.RPCPass == "" {
+			be.RPCUser = c.RPCUser
+			be.RPCPass = c.RPCPass
+		}
+		r[i] = be
+	}
+	return r
+}
+
+// checkBackend returns the best height of the backend, it is used by the health check of the backends
+func (b *BitcoinRPC) checkBackend(be *bchain.Backend) (uint32, error) {
+	httpData, err := b.RPCMarshaler.Marshal(&CmdGetBlockCount{Method: "getblockcount"})
+	if err != nil {
+		return 0, err
+	}
+	res := ResGetBlockCount{}
+	if err = b.call(&b.client, be, httpData, &res); err != nil {
+		return 0, err
+	}
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.Result, nil
+}
+
+// onBackendSwitch moves the ZeroMQ subscription to the new active backend
+// and triggers the synchronization, the notifications may have been lost during the outage
+func (b *BitcoinRPC) onBackendSwitch(active *bchain.Backend) {
+	b.mqMux.Lock()
+	if b.mq != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := b.mq.Shutdown(ctx); err != nil {
+			glog.Error("MQ.Shutdown error: ", err)
+		}
+		cancel()
+		mq, err := bchain.NewMQ(active.MessageQueueBinding, b.pushHandler)
+		if err != nil {
+			glog.Error("mq: backend ", active.Name, ", error ", err)
+			b.mq = nil
+		} else {
+			b.mq = mq
+		}
+	}
+	b.mqMux.Unlock()
+	if b.pushHandler != nil {
+		b.pushHandler(bchain.NotificationNewBlock)
+		b.pushHandler(bchain.NotificationNewTx)
+	}
+}
+
 // Initialize initializes BitcoinRPC instance.
 func (b *BitcoinRPC) Initialize() error {
 	b.ChainConfig.SupportsEstimateFee = false
@@ -163,8 +241,10 @@ func (b *BitcoinRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOut
 	b.Mempool.AddrDescForOutpoint = addrDescForOutpoint
 	b.Mempool.OnNewTxAddr = onNewTxAddr
 	b.Mempool.OnNewTx = onNewTx
+	b.mqMux.Lock()
+	defer b.mqMux.Unlock()
 	if b.mq == nil {
-		mq, err := bchain.NewMQ(b.ChainConfig.MessageQueueBinding, b.pushHandler)
+		mq, err := bchain.NewMQ(b.backends.Active().MessageQueueBinding, b.pushHandler)
 		if err != nil {
 			glog.Error("mq: ", err)
 			return err
@@ -176,6 +256,9 @@ func (b *BitcoinRPC) InitializeMempool(addrDescForOutpoint bchain.AddrDescForOut
 
 // Shutdown ZeroMQ and other resources
 func (b *BitcoinRPC) Shutdown(ctx context.Context) error {
+	b.backends.Close()
+	b.mqMux.Lock()
+	defer b.mqMux.Unlock()
 	if b.mq != nil {
 		if err := b.mq.Shutdown(ctx); err != nil {
 			glog.Error("MQ.Shutdown error: ", err)
@@ -323,6 +406,51 @@ type ResGetBlockFull struct {
 	Result bchain.Block     `json:"result"`
 }
 
+// resGetBlockFullWitness decodes the block together with the witnesses of the inputs,
+// which are not part of the json representation of bchain.Vin
+type resGetBlockFullWitness struct {
+	ResGetBlockFull
+}
+
+func (r *resGetBlockFullWitness) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &r.ResGetBlockFull); err != nil {
+		return err
+	}
+	if !bytes.Contains(data, []byte(`"txinwitness"`)) {
+		return nil
+	}
+	var w struct {
+		Result struct {
+			Txs []struct {
+				Vin []struct {
+					Witness []string `json:"txinwitness"`
+				} `json:"vin"`
+			} `json:"tx"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return err
+	}
+	txs := r.Result.Txs
+	for i := 0; i < len(w.Result.Txs) && i < len(txs); i++ {
+		for j, vin := range w.Result.Txs[i].Vin {
+			if j >= len(txs[i].Vin) || len(vin.Witness) == 0 {
+				continue
+			}
+			witness := make([][]byte, len(vin.Witness))
+			for k := range vin.Witness {
+				b, err := hex.DecodeString(vin.Witness[k])
+				if err != nil {
+					return errors.Annotatef(err, "tx %v, input %v", txs[i].Txid, j)
+				}
+				witness[k] = b
+			}
+			txs[i].Vin[j].Witness = witness
+		}
+	}
+	return nil
+}
+
 type ResGetBlockInfo struct {
 	Error  *bchain.RPCError `json:"error"`
 	Result bchain.BlockInfo `json:"result"`
@@ -392,6 +520,24 @@ type ResSendRawTransaction struct {
 	Result string           `json:"result"`
 }
 
+// gettxoutsetinfo
+
+type CmdGetTxOutSetInfo struct {
+	Method string        `json:"method"`
+	Params []interface{} `json:"params,omitempty"`
+}
+
+type ResGetTxOutSetInfo struct {
+	Error  *bchain.RPCError `json:"error"`
+	Result struct {
+		Height      uint32            `json:"height"`
+		BestBlock   string            `json:"bestblock"`
+		TxOuts      int64             `json:"txouts"`
+		MuHash      string            `json:"muhash"`
+		TotalAmount common.JSONNumber `json:"total_amount"`
+	} `json:"result"`
+}
+
 // getmempoolentry
 
 type CmdGetMempoolEntry struct {
@@ -480,6 +626,48 @@ func (b *BitcoinRPC) GetChainInfo() (*bchain.ChainInfo, error) {
 	if resCi.Result.Warnings != resNi.Result.Warnings {
 		rv.Warnings += resNi.Result.Warnings
 	}
+	rv.ActiveBackend, rv.Backends = b.backends.Status()
+	return rv, nil
+}
+
+// GetTxOutSetInfo returns statistics of the unspent outputs set of the active backend
+// hashType (for example muhash) and height are passed to the backend only if set, height requires coinstatsindex
+// The backend computes the statistics by scanning its whole utxo set, the call is not limited by rpc_timeout
+// and it is not repeated with the other backends, their statistics would not match the height of the active backend.
+func (b *BitcoinRPC) GetTxOutSetInfo(hashType string, height int) (*bchain.TxOutSetInfo, error) {
+	glog.V(1).Info("rpc: gettxoutsetinfo ", hashType, " ", height)
+
+	res := ResGetTxOutSetInfo{}
+	req := CmdGetTxOutSetInfo{Method: "gettxoutsetinfo"}
+	if hashType != "" {
+		req.Params = append(req.Params, hashType)
+		if height >= 0 {
+			req.Params = append(req.Params, height)
+		}
+	}
+	httpData, err := b.RPCMarshaler.Marshal(&req)
+	if err != nil {
+		return nil, err
+	}
+	err = b.backends.CallActive(context.Background(), func(ctx context.Context, be *bchain.Backend) error {
+		return b.call(&b.slowClient, be, httpData, &res)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	rv := &bchain.TxOutSetInfo{
+		Height:    res.Result.Height,
+		BestBlock: res.Result.BestBlock,
+		TxOuts:    res.Result.TxOuts,
+		MuHash:    res.Result.MuHash,
+	}
+	rv.TotalAmount, err = b.Parser.AmountToBigInt(res.Result.TotalAmount)
+	if err != nil {
+		return nil, err
+	}
 	return rv, nil
 }
 
@@ -637,7 +825,7 @@ func (b *BitcoinRPC) GetBlockBytes(hash string) ([]byte, error) {
 func (b *BitcoinRPC) GetBlockFull(hash string) (*bchain.Block, error) {
 	glog.V(1).Info("rpc: getblock (verbosity=2) ", hash)
 
-	res := ResGetBlockFull{}
+	res := resGetBlockFullWitness{}
 	req := CmdGetBlock{Method: "getblock"}
 	req.Params.BlockHash = hash
 	req.Params.Verbosity = 2
@@ -675,7 +863,7 @@ func (b *BitcoinRPC) GetMempoolTransactions() ([]string, error) {
 
 	res := ResGetMempool{}
 	req := CmdGetMempool{Method: "getrawmempool"}
-	err := b.Call(&req, &res)
+	err := b.CallActive(&req, &res)
 
 	if err != nil {
 		return nil, err
@@ -701,7 +889,7 @@ func (b *BitcoinRPC) GetTransactionForMempool(txid string) (*bchain.Tx, error) {
 	req := CmdGetRawTransaction{Method: "getrawtransaction"}
 	req.Params.Txid = txid
 	req.Params.Verbose = false
-	err := b.Call(&req, &res)
+	err := b.CallActive(&req, &res)
 	if err != nil {
 		return nil, errors.Annotatef(err, "txid %v", txid)
 	}
@@ -834,7 +1022,7 @@ func (b *BitcoinRPC) SendRawTransaction(tx string) (string, error) {
 	res := ResSendRawTransaction{}
 	req := CmdSendRawTransaction{Method: "sendrawtransaction"}
 	req.Params = []string{tx}
-	err := b.Call(&req, &res)
+	err := b.CallActive(&req, &res)
 
 	if err != nil {
 		return "", err
@@ -854,7 +1042,7 @@ func (b *BitcoinRPC) GetMempoolEntry(txid string) (*bchain.MempoolEntry, error)
 		Method: "getmempoolentry",
 		Params: []string{txid},
 	}
-	err := b.Call(&req, &res)
+	err := b.CallActive(&req, &res)
 	if err != nil {
 		return nil, err
 	}
@@ -893,17 +1081,39 @@ func safeDecodeResponse(body io.ReadCloser, res interface{}) (err error) {
 }
 
 // Call calls Backend RPC interface, using RPCMarshaler interface to marshall the request
+// The call is sent to the active backend and in case of its failure to the other backends.
 func (b *BitcoinRPC) Call(req interface{}, res interface{}) error {
 	httpData, err := b.RPCMarshaler.Marshal(req)
 	if err != nil {
 		return err
 	}
-	httpReq, err := http.NewRequest("POST", b.rpcURL, bytes.NewBuffer(httpData))
+	return b.backends.Call(context.Background(), func(ctx context.Context, be *bchain.Backend) error {
+		return b.call(&b.client, be, httpData, res)
+	})
+}
+
+// CallActive calls Backend RPC interface like Call, but only using the active backend,
+// the call is not repeated with the other backends, it is used for the calls which change the state of the backend
+// and for the mempool calls, the mempools of the backends differ
+func (b *BitcoinRPC) CallActive(req interface{}, res interface{}) error {
+	httpData, err := b.RPCMarshaler.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return b.backends.CallActive(context.Background(), func(ctx context.Context, be *bchain.Backend) error {
+		return b.call(&b.client, be, httpData, res)
+	})
+}
+
+// call sends the marshalled request to the backend be using the client, returns error only if the backend failed,
+// RPC errors are returned in res
+func (b *BitcoinRPC) call(client *http.Client, be *bchain.Backend, httpData []byte, res interface{}) error {
+	httpReq, err := http.NewRequest("POST", be.RPCURL, bytes.NewBuffer(httpData))
 	if err != nil {
 		return err
 	}
-	httpReq.SetBasicAuth(b.user, b.password)
-	httpRes, err := b.client.Do(httpReq)
+	httpReq.SetBasicAuth(be.RPCUser, be.RPCPass)
+	httpRes, err := client.Do(httpReq)
 	// in some cases the httpRes can contain data even if it returns error
 	// see http://devs.cloudimmunity.com/gotchas-and-common-mistakes-in-go-golang/
 	if httpRes != nil {
@@ -0,0 +1,43 @@
+//go:build unittest
+
+package btc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func Test_resGetBlockFullWitness(t *testing.T) {
+	data := []byte(`{"result":{"hash":"0000000000000000000150ae4de8b0b8a2d9fb3b9d3ab7e6c6e0a5dd7e9c1f1d","height":800000,"tx":[` +
+		`{"txid":"aa","vin":[{"coinbase":"03","txinwitness":["0000000000000000000000000000000000000000000000000000000000000000"],"sequence":4294967295}]},` +
+		`{"txid":"bb","vin":[{"txid":"cc","vout":1,"scriptSig":{"hex":""},"txinwitness":["3044","02aabb"],"sequence":4294967293},{"txid":"dd","vout":0,"scriptSig":{"hex":"00"},"sequence":4294967293}]}` +
+		`]},"error":null}`)
+	var res resGetBlockFullWitness
+	if err := json.Unmarshal(data, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Error != nil || res.Result.Height != 800000 || len(res.Result.Txs) != 2 {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	want := [][][]byte{
+		{make([]byte, 32)},
+		{{0x30, 0x44}, {0x02, 0xaa, 0xbb}},
+		nil,
+	}
+	got := [][][]byte{
+		res.Result.Txs[0].Vin[0].Witness,
+		res.Result.Txs[1].Vin[0].Witness,
+		res.Result.Txs[1].Vin[1].Witness,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("witness = %x, want %x", got, want)
+	}
+	if res.Result.Txs[1].Vin[0].Txid != "cc" || res.Result.Txs[1].Vin[0].Vout != 1 {
+		t.Errorf("vin = %+v", res.Result.Txs[1].Vin[0])
+	}
+
+	if err := json.Unmarshal([]byte(`{"result":{"tx":[{"vin":[{"txinwitness":["xx"]}]}]}}`), &res); err == nil {
+		t.Error("expected error of invalid witness hex")
+	}
+}
@@ -0,0 +1,409 @@
+package btc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/martinboehm/btcutil"
+	"github.com/martinboehm/btcutil/hdkeychain"
+	"github.com/martinboehm/btcutil/txscript"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// the checksum of output descriptors according to https://github.com/bitcoin/bips/blob/master/bip-0380.mediawiki
+const (
+	descriptorInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+var descriptorChecksumGenerator = [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+
+// maximum number of keys of a multisig script, P2SH is limited by the size of the redeem script
+const (
+	maxMultisigKeysP2SH = 15
+	maxMultisigKeys     = 20
+)
+
+func descriptorPolymod(c uint64, v int) uint64 {
+	c0 := c >> 35
+	c = ((c & 0x7ffffffff) << 5) ^ uint64(v)
+	for i := range descriptorChecksumGenerator {
+		if (c0>>uint(i))&1 != 0 {
+			c ^= descriptorChecksumGenerator[i]
+		}
+	}
+	return c
+}
+
+// descriptorChecksum computes the 8 character checksum of the descriptor without the checksum part
+func descriptorChecksum(desc string) (string, error) {
+	c := uint64(1)
+	cls, clsCount := 0, 0
+	for _, ch := range desc {
+		pos := strings.IndexRune(descriptorInputCharset, ch)
+		if pos < 0 {
+			return "", errors.Errorf("Invalid character %q in descriptor", ch)
+		}
+		c = descriptorPolymod(c, pos&31)
+		cls = cls*3 + pos>>5
+		clsCount++
+		if clsCount == 3 {
+			c = descriptorPolymod(c, cls)
+			cls, clsCount = 0, 0
+		}
+	}
+	if clsCount > 0 {
+		c = descriptorPolymod(c, cls)
+	}
+	for i := 0; i < 8; i++ {
+		c = descriptorPolymod(c, 0)
+	}
+	c ^= 1
+	r := make([]byte, 8)
+	for i := range r {
+		r[i] = descriptorChecksumCharset[(c>>(5*(7-uint(i))))&31]
+	}
+	return string(r), nil
+}
+
+// descriptorKey is a key expression of an output descriptor in the form [fingerprint/origin path]xpub/path/<change;...>/*
+type descriptorKey struct {
+	origin  string
+	xpub    string
+	extKey  *hdkeychain.ExtendedKey // xpub derived by the steps of the path preceding the change index
+	changes []uint32
+}
+
+// splitDescriptorFunc splits expression name(args) to the name and the args
+func splitDescriptorFunc(s string) (string, string, bool) {
+	i := strings.IndexByte(s, '(')
+	if i <= 0 || !strings.HasSuffix(s, ")") {
+		return "", "", false
+	}
+	return s[:i], s[i+1 : len(s)-1], true
+}
+
+// splitDescriptorArgs splits the arguments of a descriptor function by the commas which are not nested in brackets
+func splitDescriptorArgs(s string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(', '[', '{', '<':
+			depth++
+		case ')', ']', '}', '>':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(args, s[start:])
+}
+
+func parseDescriptorIndex(s string) (uint32, error) {
+	i, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || i >= hdkeychain.HardenedKeyStart {
+		return 0, errors.Errorf("Invalid xpub descriptor, unsupported path element %s", s)
+	}
+	return uint32(i), nil
+}
+
+// parseDescriptorChanges parses the change index, which can be a single number or a list in the format <0;1> or {0,1}
+func parseDescriptorChanges(s string) ([]uint32, error) {
+	var changes []string
+	if strings.HasPrefix(s, "<") && strings.HasSuffix(s, ">") {
+		changes = strings.Split(s[1:len(s)-1], ";")
+	} else if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		changes = strings.Split(s[1:len(s)-1], ",")
+	} else {
+		changes = []string{s}
+	}
+	r := make([]uint32, len(changes))
+	for i, ch := range changes {
+		change, err := parseDescriptorIndex(ch)
+		if err != nil {
+			return nil, err
+		}
+		r[i] = change
+	}
+	return r, nil
+}
+
+func (p *BitcoinLikeParser) parseDescriptorKey(s string) (*descriptorKey, error) {
+	var k descriptorKey
+	if strings.HasPrefix(s, "[") {
+		e := strings.IndexByte(s, ']')
+		if e < 0 {
+			return nil, errors.New("Invalid xpub descriptor, unterminated key origin")
+		}
+		origin := strings.Split(s[1:e], "/")
+		if fp, err := hex.DecodeString(origin[0]); err != nil || len(fp) != 4 {
+			return nil, errors.Errorf("Invalid xpub descriptor, key fingerprint %s", origin[0])
+		}
+		for i := 1; i < len(origin); i++ {
+			step := origin[i]
+			hardened := strings.HasSuffix(step, "'") || strings.HasSuffix(step, "h")
+			if hardened {
+				step = step[:len(step)-1]
+			}
+			if _, err := parseDescriptorIndex(step); err != nil {
+				return nil, err
+			}
+			if hardened {
+				step += "'"
+			}
+			origin[i] = step
+		}
+		k.origin = strings.Join(origin[1:], "/")
+		s = s[e+1:]
+	}
+	path := strings.Split(s, "/")
+	k.xpub = path[0]
+	extKey, err := hdkeychain.NewKeyFromString(k.xpub, p.Params.Base58CksumHasher)
+	if err != nil {
+		return nil, err
+	}
+	path = path[1:]
+	if len(path) == 0 {
+		// default to <0;1>
+		k.changes = []uint32{0, 1}
+		k.extKey = extKey
+		return &k, nil
+	}
+	if len(path) < 2 || path[len(path)-1] != "*" {
+		return nil, errors.New("Invalid xpub descriptor, the path of the key must end with /<change>/*")
+	}
+	for _, step := range path[:len(path)-2] {
+		i, err := parseDescriptorIndex(step)
+		if err != nil {
+			return nil, err
+		}
+		if extKey, err = extKey.Derive(i); err != nil {
+			return nil, err
+		}
+	}
+	if k.changes, err = parseDescriptorChanges(path[len(path)-2]); err != nil {
+		return nil, err
+	}
+	k.extKey = extKey
+	return &k, nil
+}
+
+// parseMultisig parses the expression multi(k,key1,key2,...) or sortedmulti(k,key1,key2,...)
+func (p *BitcoinLikeParser) parseMultisig(descriptor *bchain.XpubDescriptor, s string, maxKeys int) error {
+	name, args, ok := splitDescriptorFunc(s)
+	if !ok || (name != "multi" && name != "sortedmulti") {
+		return errors.Errorf("Xpub descriptor %s is not supported", s)
+	}
+	a := splitDescriptorArgs(args)
+	threshold, err := strconv.Atoi(a[0])
+	if err != nil || threshold < 1 || threshold > len(a)-1 || len(a)-1 > maxKeys {
+		return errors.Errorf("Invalid xpub descriptor, multisig %s of %d keys", a[0], len(a)-1)
+	}
+	descriptor.Threshold = threshold
+	descriptor.Sorted = name == "sortedmulti"
+	descriptor.ExtKeys = make([]interface{}, len(a)-1)
+	for i, ks := range a[1:] {
+		k, err := p.parseDescriptorKey(ks)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			descriptor.Xpub = k.xpub
+			descriptor.ExtKey = k.extKey
+			descriptor.KeyOrigin = k.origin
+			descriptor.ChangeIndexes = k.changes
+		} else if len(k.changes) != len(descriptor.ChangeIndexes) {
+			return errors.New("Invalid xpub descriptor, the keys have different number of change indexes")
+		} else {
+			for j := range k.changes {
+				if k.changes[j] != descriptor.ChangeIndexes[j] {
+					return errors.New("Invalid xpub descriptor, the keys have different change indexes")
+				}
+			}
+		}
+		descriptor.ExtKeys[i] = k.extKey
+	}
+	return nil
+}
+
+// singlePathDescriptor replaces the multipath groups {0,1} or <0;1> of the descriptor by their first path, the receive chain
+func singlePathDescriptor(desc string) string {
+	var b strings.Builder
+	for i := 0; i < len(desc); i++ {
+		c := desc[i]
+		if c != '{' && c != '<' {
+			b.WriteByte(c)
+			continue
+		}
+		end, sep := byte('}'), byte(',')
+		if c == '<' {
+			end, sep = '>', ';'
+		}
+		j := strings.IndexByte(desc[i:], end)
+		if j < 0 {
+			return desc
+		}
+		group := desc[i+1 : i+j]
+		if k := strings.IndexByte(group, sep); k >= 0 {
+			group = group[:k]
+		}
+		b.WriteString(group)
+		i += j
+	}
+	return b.String()
+}
+
+// parseOutputDescriptor parses the output descriptor in the form <type>(<key>)[#checksum]
+// Single key types pkh, wpkh, sh(wpkh) and tr (without script tree) and multisig types sh(multi), wsh(multi)
+// and sh(wsh(multi)) (or sortedmulti) are supported.
+func (p *BitcoinLikeParser) parseOutputDescriptor(xpub string) (*bchain.XpubDescriptor, error) {
+	desc := xpub
+	if i := strings.IndexByte(desc, '#'); i >= 0 {
+		checksum, err := descriptorChecksum(desc[:i])
+		if err != nil {
+			return nil, err
+		}
+		if desc[i+1:] != checksum {
+			// the clients send the multipath descriptor with the checksum of its receive chain
+			single, err := descriptorChecksum(singlePathDescriptor(desc[:i]))
+			if err != nil {
+				return nil, err
+			}
+			if desc[i+1:] != single {
+				return nil, errors.Errorf("Invalid xpub descriptor checksum %s, expected %s", desc[i+1:], checksum)
+			}
+		}
+		desc = desc[:i]
+	}
+	descriptor := &bchain.XpubDescriptor{XpubDescriptor: xpub}
+	name, args, ok := splitDescriptorFunc(desc)
+	if !ok {
+		return nil, errors.Errorf("Invalid xpub descriptor %s", xpub)
+	}
+	key := args
+	switch name {
+	case "pkh":
+		descriptor.Type = bchain.P2PKH
+		descriptor.Bip = "44"
+	case "wpkh":
+		descriptor.Type = bchain.P2WPKH
+		descriptor.Bip = "84"
+	case "tr":
+		descriptor.Type = bchain.P2TR
+		descriptor.Bip = "86"
+	case "sh", "wsh":
+		inner, innerArgs, ok := splitDescriptorFunc(args)
+		if !ok {
+			return nil, errors.Errorf("Xpub descriptor %s is not supported", name)
+		}
+		switch {
+		case name == "sh" && inner == "wpkh":
+			descriptor.Type = bchain.P2SHWPKH
+			descriptor.Bip = "49"
+			key = innerArgs
+		case name == "sh" && inner == "wsh":
+			descriptor.Type = bchain.P2SHWSH
+			descriptor.Bip = "48"
+			if err := p.parseMultisig(descriptor, innerArgs, maxMultisigKeys); err != nil {
+				return nil, err
+			}
+		case name == "sh":
+			descriptor.Type = bchain.P2SH
+			descriptor.Bip = "45"
+			if err := p.parseMultisig(descriptor, args, maxMultisigKeysP2SH); err != nil {
+				return nil, err
+			}
+		default:
+			descriptor.Type = bchain.P2WSH
+			descriptor.Bip = "48"
+			if err := p.parseMultisig(descriptor, args, maxMultisigKeys); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errors.Errorf("Xpub descriptor %s is not supported", name)
+	}
+	if descriptor.ExtKeys == nil {
+		if len(splitDescriptorArgs(key)) != 1 {
+			return nil, errors.Errorf("Xpub descriptor %s is not supported", name)
+		}
+		k, err := p.parseDescriptorKey(key)
+		if err != nil {
+			return nil, err
+		}
+		descriptor.Xpub = k.xpub
+		descriptor.ExtKey = k.extKey
+		descriptor.KeyOrigin = k.origin
+		descriptor.ChangeIndexes = k.changes
+	}
+	if descriptor.KeyOrigin != "" {
+		descriptor.Bip = strings.TrimSuffix(strings.Split(descriptor.KeyOrigin, "/")[0], "'")
+	}
+	return descriptor, nil
+}
+
+// multisigAddrDesc returns the output script of the multisig descriptor for the keys derived by change and index
+func (p *BitcoinLikeParser) multisigAddrDesc(changeExtKeys []*hdkeychain.ExtendedKey, index uint32, descriptor *bchain.XpubDescriptor) (bchain.AddressDescriptor, error) {
+	pubKeys := make([][]byte, len(changeExtKeys))
+	for i, changeExtKey := range changeExtKeys {
+		indexExtKey, err := changeExtKey.Derive(index)
+		if err != nil {
+			return nil, err
+		}
+		pubKeys[i] = indexExtKey.PubKeyBytes()
+	}
+	if descriptor.Sorted {
+		sort.Slice(pubKeys, func(i, j int) bool { return bytes.Compare(pubKeys[i], pubKeys[j]) < 0 })
+	}
+	b := txscript.NewScriptBuilder().AddInt64(int64(descriptor.Threshold))
+	for _, pk := range pubKeys {
+		b.AddData(pk)
+	}
+	script, err := b.AddInt64(int64(len(pubKeys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		return nil, err
+	}
+	var a btcutil.Address
+	switch descriptor.Type {
+	case bchain.P2SH:
+		a, err = btcutil.NewAddressScriptHashFromHash(btcutil.Hash160(script), p.Params)
+	case bchain.P2WSH:
+		h := sha256.Sum256(script)
+		a, err = btcutil.NewAddressWitnessScriptHash(h[:], p.Params)
+	case bchain.P2SHWSH:
+		// redeemScript <witness version: OP_0><len scriptHash: 32><32-byte-scriptHash>
+		h := sha256.Sum256(script)
+		redeemScript := make([]byte, len(h)+2)
+		redeemScript[0] = 0
+		redeemScript[1] = byte(len(h))
+		copy(redeemScript[2:], h[:])
+		a, err = btcutil.NewAddressScriptHashFromHash(btcutil.Hash160(redeemScript), p.Params)
+	default:
+		return nil, errors.New("Unsupported xpub descriptor type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return txscript.PayToAddrScript(a)
+}
+
+// deriveChangeExtKeys derives the keys of all cosigners of the multisig descriptor for the change index
+func deriveChangeExtKeys(descriptor *bchain.XpubDescriptor, change uint32) ([]*hdkeychain.ExtendedKey, error) {
+	keys := make([]*hdkeychain.ExtendedKey, len(descriptor.ExtKeys))
+	for i := range descriptor.ExtKeys {
+		var err error
+		if keys[i], err = descriptor.ExtKeys[i].(*hdkeychain.ExtendedKey).Derive(change); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
@@ -329,6 +329,93 @@ func (b *EthereumRPC) fetchContractInfo(address string) (*bchain.ContractInfo, e
 	return &contract, nil
 }
 
+// maxContractInfoBatch is the maximum number of eth_call requests sent in one rpc batch
+const maxContractInfoBatch = 100
+
+// ethCallBatch calls the methods of the contracts in rpc batches, the result is empty for the failed calls
+func (b *EthereumRPC) ethCallBatch(data []string, to []string) ([]string, error) {
+	r := make([]string, len(data))
+	for from := 0; from < len(data); from += maxContractInfoBatch {
+		end := from + maxContractInfoBatch
+		if end > len(data) {
+			end = len(data)
+		}
+		batch := make([]bchain.EVMBatchElem, end-from)
+		for i := range batch {
+			batch[i] = bchain.EVMBatchElem{
+				Method: "eth_call",
+				Args: []interface{}{map[string]interface{}{
+					"data": data[from+i],
+					"to":   to[from+i],
+				}, "latest"},
+				Result: &r[from+i],
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+		err := b.RPC.BatchCallContext(ctx, batch)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			if batch[i].Error != nil {
+				r[from+i] = ""
+			}
+		}
+	}
+	return r, nil
+}
+
+// fetchContractInfos is the batched version of fetchContractInfo, the info is nil for the addresses which are not contracts
+func (b *EthereumRPC) fetchContractInfos(addresses []string) ([]*bchain.ContractInfo, error) {
+	r := make([]*bchain.ContractInfo, len(addresses))
+	names := make([]string, len(addresses))
+	for i := range names {
+		names[i] = contractNameSignature
+	}
+	data, err := b.ethCallBatch(names, addresses)
+	if err != nil {
+		return nil, err
+	}
+	// get symbol and decimals of the addresses which returned a name
+	var indexes []int
+	var calls, to []string
+	for i := range data {
+		name := strings.TrimSpace(parseSimpleStringProperty(data[i]))
+		if name != "" {
+			r[i] = &bchain.ContractInfo{
+				Contract: addresses[i],
+				Name:     name,
+			}
+			indexes = append(indexes, i)
+			calls = append(calls, contractSymbolSignature, contractDecimalsSignature)
+			to = append(to, addresses[i], addresses[i])
+		}
+	}
+	if len(indexes) == 0 {
+		return r, nil
+	}
+	data, err = b.ethCallBatch(calls, to)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		// the failed symbol call means that the address is not a contract, failed decimals call is ignored
+		if data[2*j] == "" {
+			r[i] = nil
+			continue
+		}
+		r[i].Symbol = strings.TrimSpace(parseSimpleStringProperty(data[2*j]))
+		d := parseSimpleNumericProperty(data[2*j+1])
+		if d != nil {
+			r[i].Decimals = int(uint8(d.Uint64()))
+		} else {
+			r[i].Decimals = EtherAmountDecimalPoint
+		}
+	}
+	return r, nil
+}
+
 // GetContractInfo returns information about a contract
 func (b *EthereumRPC) GetContractInfo(contractDesc bchain.AddressDescriptor) (*bchain.ContractInfo, error) {
 	address := EIP55Address(contractDesc)
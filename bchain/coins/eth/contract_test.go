@@ -3,8 +3,12 @@
 package eth
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math/big"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -289,3 +293,69 @@ func Test_contractGetTransfersFromTx(t *testing.T) {
 		})
 	}
 }
+
+type testBatchRPCClient struct {
+	bchain.EVMRPCClient
+	// results of eth_call by contract address and method signature, missing result is returned as error
+	results map[string]string
+	batches int
+}
+
+func (c *testBatchRPCClient) BatchCallContext(ctx context.Context, b []bchain.EVMBatchElem) error {
+	c.batches++
+	if len(b) > maxContractInfoBatch {
+		return fmt.Errorf("batch of %d requests", len(b))
+	}
+	for i := range b {
+		args := b[i].Args[0].(map[string]interface{})
+		r, found := c.results[args["to"].(string)+args["data"].(string)]
+		if !found {
+			b[i].Error = errors.New("execution reverted")
+			continue
+		}
+		*b[i].Result.(*string) = r
+	}
+	return nil
+}
+
+func Test_fetchContractInfos(t *testing.T) {
+	token := "0x1234567890123456789012345678901234567890"
+	noSymbol := "0x2234567890123456789012345678901234567890"
+	noDecimals := "0x3234567890123456789012345678901234567890"
+	client := &testBatchRPCClient{
+		results: map[string]string{
+			token + contractNameSignature:          "0x" + hex.EncodeToString([]byte("Test Token")),
+			token + contractSymbolSignature:        "0x" + hex.EncodeToString([]byte("TT")),
+			token + contractDecimalsSignature:      "0x0000000000000000000000000000000000000000000000000000000000000006",
+			noSymbol + contractNameSignature:       "0x" + hex.EncodeToString([]byte("No Symbol")),
+			noDecimals + contractNameSignature:     "0x" + hex.EncodeToString([]byte("No Decimals")),
+			noDecimals + contractSymbolSignature:   "0x" + hex.EncodeToString([]byte("ND")),
+			noDecimals + contractDecimalsSignature: "0x",
+		},
+	}
+	b := &EthereumRPC{RPC: client}
+	addresses := []string{token, noSymbol, noDecimals}
+	// addresses which are not contracts, enough to split the name calls to two batches
+	for i := 0; i < maxContractInfoBatch; i++ {
+		addresses = append(addresses, fmt.Sprintf("0x%040x", i))
+	}
+	got, err := b.fetchContractInfos(addresses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*bchain.ContractInfo{
+		{Contract: token, Name: "Test Token", Symbol: "TT", Decimals: 6},
+		nil,
+		{Contract: noDecimals, Name: "No Decimals", Symbol: "ND", Decimals: EtherAmountDecimalPoint},
+	}
+	for i := 0; i < maxContractInfoBatch; i++ {
+		want = append(want, nil)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetchContractInfos() = %+v, want %+v", got[:3], want[:3])
+	}
+	// two batches of names, one batch of symbols and decimals
+	if client.batches != 3 {
+		t.Errorf("fetchContractInfos() sent %d batches, want 3", client.batches)
+	}
+}
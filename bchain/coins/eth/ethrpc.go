@@ -62,6 +62,11 @@ type Configuration struct {
 	ProcessInternalTransactions     bool   `json:"processInternalTransactions"`
 	ProcessZeroInternalTransactions bool   `json:"processZeroInternalTransactions"`
 	ConsensusNodeVersionURL         string `json:"consensusNodeVersion"`
+
+	// Backends are the backend nodes used with failover, if not set, rpc_url is used
+	Backends []bchain.BackendConfig `json:"backends,omitempty"`
+	// BackendsHealthCheckPeriod is the period of the health check of the backends in seconds, default 10
+	BackendsHealthCheckPeriod int `json:"backends_health_check_period,omitempty"`
 }
 
 // EthereumRPC is an interface to JSON-RPC eth service.
@@ -74,6 +79,7 @@ type EthereumRPC struct {
 	Parser               *EthereumParser
 	PushHandler          func(bchain.NotificationType)
 	OpenRPC              func(string) (bchain.EVMRPCClient, bchain.EVMClient, error)
+	backends             *bchain.Backends
 	Mempool              *bchain.MempoolEthereumType
 	mempoolInitialized   bool
 	bestHeaderLock       sync.Mutex
@@ -129,7 +135,7 @@ func (b *EthereumRPC) Initialize() error {
 		return rc, ec, nil
 	}
 
-	rc, ec, err := b.OpenRPC(b.ChainConfig.RPCURL)
+	rc, ec, err := b.OpenBackends()
 	if err != nil {
 		return err
 	}
@@ -235,6 +241,27 @@ func (b *EthereumRPC) subscribeEvents() error {
 		}
 	}()
 
+	// new mempool transaction notifications handling
+	go func() {
+		for {
+			t, ok := b.NewTx.Read()
+			if !ok {
+				break
+			}
+			hex := t.Hex()
+			if glog.V(2) {
+				glog.Info("rpc: new tx ", hex)
+			}
+			b.Mempool.AddTransactionToMempool(hex)
+			b.PushHandler(bchain.NotificationNewTx)
+		}
+	}()
+
+	return b.subscribeNotifications()
+}
+
+// subscribeNotifications subscribes to newHeads and newPendingTransactions, the notifications are handled by subscribeEvents
+func (b *EthereumRPC) subscribeNotifications() error {
 	// new block subscription
 	if err := b.subscribe(func() (bchain.EVMClientSubscription, error) {
 		// invalidate the previous subscription - it is either the first one or there was an error
@@ -252,22 +279,6 @@ func (b *EthereumRPC) subscribeEvents() error {
 		return err
 	}
 
-	// new mempool transaction notifications handling
-	go func() {
-		for {
-			t, ok := b.NewTx.Read()
-			if !ok {
-				break
-			}
-			hex := t.Hex()
-			if glog.V(2) {
-				glog.Info("rpc: new tx ", hex)
-			}
-			b.Mempool.AddTransactionToMempool(hex)
-			b.PushHandler(bchain.NotificationNewTx)
-		}
-	}()
-
 	// new mempool transaction subscription
 	if err := b.subscribe(func() (bchain.EVMClientSubscription, error) {
 		// invalidate the previous subscription - it is either the first one or there was an error
@@ -328,13 +339,23 @@ func (b *EthereumRPC) subscribe(f func() (bchain.EVMClientSubscription, error))
 	return nil
 }
 
-func (b *EthereumRPC) closeRPC() {
+func (b *EthereumRPC) unsubscribeNotifications() {
 	if b.newBlockSubscription != nil {
 		b.newBlockSubscription.Unsubscribe()
 	}
 	if b.newTxSubscription != nil {
 		b.newTxSubscription.Unsubscribe()
 	}
+}
+
+// resubscribeEvents moves the subscriptions to the active backend
+func (b *EthereumRPC) resubscribeEvents() error {
+	b.unsubscribeNotifications()
+	return b.subscribeNotifications()
+}
+
+func (b *EthereumRPC) closeRPC() {
+	b.unsubscribeNotifications()
 	if b.RPC != nil {
 		b.RPC.Close()
 	}
@@ -343,13 +364,13 @@ func (b *EthereumRPC) closeRPC() {
 func (b *EthereumRPC) reconnectRPC() error {
 	glog.Info("Reconnecting RPC")
 	b.closeRPC()
-	rc, ec, err := b.OpenRPC(b.ChainConfig.RPCURL)
+	rc, ec, err := b.OpenBackends()
 	if err != nil {
 		return err
 	}
 	b.RPC = rc
 	b.Client = ec
-	return b.subscribeEvents()
+	return b.subscribeNotifications()
 }
 
 // Shutdown cleans up rpc interface to ethereum
@@ -426,6 +447,7 @@ func (b *EthereumRPC) GetChainInfo() (*bchain.ChainInfo, error) {
 		Version:          ver,
 		ConsensusVersion: consensusVersion,
 	}
+	rv.ActiveBackend, rv.Backends = b.backends.Status()
 	idi := int(id.Uint64())
 	if idi == int(b.MainNetChainID) {
 		rv.Chain = "mainnet"
@@ -615,16 +637,43 @@ type rpcTraceResult struct {
 	Result rpcCallTrace `json:"result"`
 }
 
-func (b *EthereumRPC) getCreationContractInfo(contract string, height uint32) *bchain.ContractInfo {
-	ci, err := b.fetchContractInfo(contract)
-	if ci == nil || err != nil {
-		ci = &bchain.ContractInfo{
-			Contract: contract,
+// getCreationContractInfo returns the info of a contract created in the block,
+// the name, symbol and decimals are filled for all contracts of the block at once by fillCreationContractsInfo
+func getCreationContractInfo(contract string, height uint32) *bchain.ContractInfo {
+	return &bchain.ContractInfo{
+		Contract:       contract,
+		Type:           bchain.UnknownTokenType,
+		CreatedInBlock: height,
+	}
+}
+
+// fillCreationContractsInfo fetches in rpc batches the info of the contracts created in the block
+func (b *EthereumRPC) fillCreationContractsInfo(contracts []bchain.ContractInfo, height uint32) {
+	var indexes []int
+	var addresses []string
+	for i := range contracts {
+		if contracts[i].CreatedInBlock == height {
+			indexes = append(indexes, i)
+			addresses = append(addresses, contracts[i].Contract)
+		}
+	}
+	if len(addresses) == 0 {
+		return
+	}
+	infos, err := b.fetchContractInfos(addresses)
+	if err != nil {
+		// the contracts are stored without the info as if they were not token contracts
+		glog.Error("fetchContractInfos block ", height, ", error ", err)
+		return
+	}
+	for j, ci := range infos {
+		if ci != nil {
+			c := &contracts[indexes[j]]
+			c.Name = ci.Name
+			c.Symbol = ci.Symbol
+			c.Decimals = ci.Decimals
 		}
 	}
-	ci.Type = bchain.UnknownTokenType
-	ci.CreatedInBlock = height
-	return ci
 }
 
 func (b *EthereumRPC) processCallTrace(call *rpcCallTrace, d *bchain.EthereumInternalData, contracts []bchain.ContractInfo, blockHeight uint32) []bchain.ContractInfo {
@@ -636,7 +685,7 @@ func (b *EthereumRPC) processCallTrace(call *rpcCallTrace, d *bchain.EthereumInt
 			From:  call.From,
 			To:    call.To, // new contract address
 		})
-		contracts = append(contracts, *b.getCreationContractInfo(call.To, blockHeight))
+		contracts = append(contracts, *getCreationContractInfo(call.To, blockHeight))
 	} else if call.Type == "SELFDESTRUCT" {
 		d.Transfers = append(d.Transfers, bchain.EthereumInternalTransfer{
 			Type:  bchain.SELFDESTRUCT,
@@ -687,7 +736,7 @@ func (b *EthereumRPC) getInternalDataForBlock(blockHash string, blockHeight uint
 			if r.Type == "CREATE" || r.Type == "CREATE2" {
 				d.Type = bchain.CREATE
 				d.Contract = r.To
-				contracts = append(contracts, *b.getCreationContractInfo(d.Contract, blockHeight))
+				contracts = append(contracts, *getCreationContractInfo(d.Contract, blockHeight))
 			} else if r.Type == "SELFDESTRUCT" {
 				d.Type = bchain.SELFDESTRUCT
 			}
@@ -716,6 +765,7 @@ func (b *EthereumRPC) getInternalDataForBlock(blockHash string, blockHeight uint
 				// glog.Infof("Internal Data Error %d %s: %s", n, transactions[i].Hash, UnpackInternalTransactionError([]byte(d.Error)))
 			}
 		}
+		b.fillCreationContractsInfo(contracts, blockHeight)
 	}
 	return data, contracts, nil
 }
@@ -738,15 +788,26 @@ func (b *EthereumRPC) GetBlock(hash string, height uint32) (*bchain.Block, error
 	if err != nil {
 		return nil, errors.Annotatef(err, "hash %v, height %v", hash, height)
 	}
-	// get block events
-	// TODO - could be possibly done in parallel to getInternalDataForBlock
-	logs, ens, err := b.processEventsForBlock(head.Number)
-	if err != nil {
-		return nil, err
+	// get block events in parallel to the debug trace of the block
+	type eventsResult struct {
+		logs map[string][]*bchain.RpcLog
+		ens  []bchain.AddressAliasRecord
+		err  error
 	}
+	ech := make(chan eventsResult, 1)
+	go func() {
+		var r eventsResult
+		r.logs, r.ens, r.err = b.processEventsForBlock(head.Number)
+		ech <- r
+	}()
 	// error fetching internal data does not stop the block processing
 	var blockSpecificData *bchain.EthereumBlockSpecificData
 	internalData, contracts, err := b.getInternalDataForBlock(head.Hash, bbh.Height, body.Transactions)
+	events := <-ech
+	if events.err != nil {
+		return nil, events.err
+	}
+	logs, ens := events.logs, events.ens
 	// pass internalData error and ENS records in blockSpecificData to be stored
 	if err != nil || len(ens) > 0 || len(contracts) > 0 {
 		blockSpecificData = &bchain.EthereumBlockSpecificData{}
@@ -57,6 +57,21 @@ func (c *EthereumRPCClient) EthSubscribe(ctx context.Context, channel interface{
 	return &EthereumClientSubscription{ClientSubscription: sub}, nil
 }
 
+// BatchCallContext sends all given requests as a single batch and waits for the responses
+func (c *EthereumRPCClient) BatchCallContext(ctx context.Context, b []bchain.EVMBatchElem) error {
+	be := make([]rpc.BatchElem, len(b))
+	for i := range b {
+		be[i] = rpc.BatchElem{Method: b[i].Method, Args: b[i].Args, Result: b[i].Result}
+	}
+	if err := c.Client.BatchCallContext(ctx, be); err != nil {
+		return err
+	}
+	for i := range be {
+		b[i].Error = be[i].Error
+	}
+	return nil
+}
+
 // EthereumHeader wraps a block header to implement the EVMHeader interface
 type EthereumHeader struct {
 	*types.Header
@@ -0,0 +1,235 @@
+package eth
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/golang/glog"
+	"github.com/gorilla/websocket"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// writeMethods are the rpc methods which change the state of the backend, they are not repeated with the other backends
+var writeMethods = map[string]struct{}{
+	"eth_sendRawTransaction": {},
+	"eth_sendTransaction":    {},
+}
+
+// backendFailed returns true if the error is a connection or transport error of the backend,
+// not an error result of a processed request or the expiration of the context of the call
+func backendFailed(err error) bool {
+	if err == nil || stderrors.Is(err, context.DeadlineExceeded) || stderrors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	var httpErr rpc.HTTPError
+	var closeErr *websocket.CloseError
+	if stderrors.As(err, &netErr) || stderrors.As(err, &httpErr) || stderrors.As(err, &closeErr) ||
+		stderrors.Is(err, io.EOF) || stderrors.Is(err, io.ErrUnexpectedEOF) || stderrors.Is(err, rpc.ErrClientQuit) {
+		return true
+	}
+	// unexported errors of the go-ethereum rpc client about a lost connection
+	switch err.Error() {
+	case "connection lost", "client reconnected":
+		return true
+	}
+	return false
+}
+
+// callBackends calls f using the backends, the error result of a backend which did not fail is returned as is
+// If write, f is called only with the active backend.
+func callBackends(ctx context.Context, backends *bchain.Backends, write bool, f func(ctx context.Context, be *bchain.Backend) error) error {
+	var result error
+	call := backends.Call
+	if write {
+		call = backends.CallActive
+	}
+	err := call(ctx, func(ctx context.Context, be *bchain.Backend) error {
+		result = f(ctx, be)
+		if backendFailed(result) {
+			return result
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// failoverRPCClient implements the EVMRPCClient interface over the rpc clients of more backends
+type failoverRPCClient struct {
+	backends *bchain.Backends
+	rpcs     []bchain.EVMRPCClient
+}
+
+// EthSubscribe subscribes to the events of the active backend
+func (c *failoverRPCClient) EthSubscribe(ctx context.Context, channel interface{}, args ...interface{}) (bchain.EVMClientSubscription, error) {
+	return c.rpcs[c.backends.Active().Index].EthSubscribe(ctx, channel, args...)
+}
+
+// CallContext performs the rpc call using the active backend, in case of its failure using the other backends
+// The write methods are called only using the active backend.
+func (c *failoverRPCClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	_, write := writeMethods[method]
+	return callBackends(ctx, c.backends, write, func(ctx context.Context, be *bchain.Backend) error {
+		return c.rpcs[be.Index].CallContext(ctx, result, method, args...)
+	})
+}
+
+// BatchCallContext sends the batch using the active backend, in case of its failure using the other backends
+// A batch containing a write method is sent only using the active backend.
+func (c *failoverRPCClient) BatchCallContext(ctx context.Context, b []bchain.EVMBatchElem) error {
+	var write bool
+	for i := range b {
+		if _, ok := writeMethods[b[i].Method]; ok {
+			write = true
+		}
+	}
+	return callBackends(ctx, c.backends, write, func(ctx context.Context, be *bchain.Backend) error {
+		return c.rpcs[be.Index].BatchCallContext(ctx, b)
+	})
+}
+
+// Close closes the rpc clients of all backends
+func (c *failoverRPCClient) Close() {
+	c.backends.Close()
+	for _, r := range c.rpcs {
+		r.Close()
+	}
+}
+
+// failoverClient implements the EVMClient interface over the clients of more backends
+type failoverClient struct {
+	backends *bchain.Backends
+	clients  []bchain.EVMClient
+}
+
+// NetworkID returns the network ID
+func (c *failoverClient) NetworkID(ctx context.Context) (*big.Int, error) {
+	var r *big.Int
+	err := callBackends(ctx, c.backends, false, func(ctx context.Context, be *bchain.Backend) (err error) {
+		r, err = c.clients[be.Index].NetworkID(ctx)
+		return err
+	})
+	return r, err
+}
+
+// HeaderByNumber returns the block header of the given number or the latest block header if number is nil
+func (c *failoverClient) HeaderByNumber(ctx context.Context, number *big.Int) (bchain.EVMHeader, error) {
+	var r bchain.EVMHeader
+	err := callBackends(ctx, c.backends, false, func(ctx context.Context, be *bchain.Backend) (err error) {
+		r, err = c.clients[be.Index].HeaderByNumber(ctx, number)
+		return err
+	})
+	return r, err
+}
+
+// SuggestGasPrice returns the gas price suggested by the backend
+func (c *failoverClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var r *big.Int
+	err := callBackends(ctx, c.backends, false, func(ctx context.Context, be *bchain.Backend) (err error) {
+		r, err = c.clients[be.Index].SuggestGasPrice(ctx)
+		return err
+	})
+	return r, err
+}
+
+// EstimateGas returns the estimated gas cost for executing a transaction
+func (c *failoverClient) EstimateGas(ctx context.Context, msg interface{}) (uint64, error) {
+	var r uint64
+	err := callBackends(ctx, c.backends, false, func(ctx context.Context, be *bchain.Backend) (err error) {
+		r, err = c.clients[be.Index].EstimateGas(ctx, msg)
+		return err
+	})
+	return r, err
+}
+
+// BalanceAt returns the balance for the given account at a specific block, or latest known block if no block number is provided
+func (c *failoverClient) BalanceAt(ctx context.Context, addrDesc bchain.AddressDescriptor, blockNumber *big.Int) (*big.Int, error) {
+	var r *big.Int
+	err := callBackends(ctx, c.backends, false, func(ctx context.Context, be *bchain.Backend) (err error) {
+		r, err = c.clients[be.Index].BalanceAt(ctx, addrDesc, blockNumber)
+		return err
+	})
+	return r, err
+}
+
+// NonceAt returns the nonce for the given account at a specific block, or latest known block if no block number is provided
+func (c *failoverClient) NonceAt(ctx context.Context, addrDesc bchain.AddressDescriptor, blockNumber *big.Int) (uint64, error) {
+	var r uint64
+	err := callBackends(ctx, c.backends, false, func(ctx context.Context, be *bchain.Backend) (err error) {
+		r, err = c.clients[be.Index].NonceAt(ctx, addrDesc, blockNumber)
+		return err
+	})
+	return r, err
+}
+
+// backendConfigs returns the configured backends or the backend given by rpc_url
+func backendConfigs(c *Configuration) []bchain.BackendConfig {
+	if len(c.Backends) == 0 {
+		return []bchain.BackendConfig{{RPCURL: c.RPCURL}}
+	}
+	return c.Backends
+}
+
+// OpenBackends opens the rpc clients of the configured backends using OpenRPC
+// If only rpc_url is configured, the clients returned by OpenRPC are used directly.
+func (b *EthereumRPC) OpenBackends() (bchain.EVMRPCClient, bchain.EVMClient, error) {
+	configs := backendConfigs(b.ChainConfig)
+	if len(configs) == 1 {
+		return b.OpenRPC(configs[0].RPCURL)
+	}
+	backends, err := bchain.NewBackends(configs)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc := &failoverRPCClient{backends: backends, rpcs: make([]bchain.EVMRPCClient, len(configs))}
+	ec := &failoverClient{backends: backends, clients: make([]bchain.EVMClient, len(configs))}
+	for i := range configs {
+		rc.rpcs[i], ec.clients[i], err = b.OpenRPC(configs[i].RPCURL)
+		if err != nil {
+			for j := 0; j < i; j++ {
+				rc.rpcs[j].Close()
+			}
+			return nil, nil, errors.Annotatef(err, "backend %v", configs[i].RPCURL)
+		}
+	}
+	backends.OnSwitch = b.onBackendSwitch
+	period := b.ChainConfig.BackendsHealthCheckPeriod
+	if period <= 0 {
+		period = 10
+	}
+	backends.StartHealthCheck(time.Duration(period)*time.Second, func(be *bchain.Backend) (uint32, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), b.Timeout)
+		defer cancel()
+		h, err := ec.clients[be.Index].HeaderByNumber(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		return uint32(h.Number().Uint64()), nil
+	})
+	b.backends = backends
+	return rc, ec, nil
+}
+
+// onBackendSwitch moves the subscriptions to the new active backend
+// and triggers the synchronization, the notifications may have been lost during the outage
+func (b *EthereumRPC) onBackendSwitch(active *bchain.Backend) {
+	go func() {
+		if b.mempoolInitialized {
+			if err := b.resubscribeEvents(); err != nil {
+				glog.Error("rpc: resubscribe to backend ", active.Name, ", error ", err)
+			}
+		}
+		if b.PushHandler != nil {
+			b.PushHandler(bchain.NotificationNewBlock)
+		}
+	}()
+}
@@ -0,0 +1,101 @@
+//go:build unittest
+
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/trezor/blockbook/bchain"
+)
+
+func Test_backendFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"rpc error", rpc.ErrNoResult, false},
+		{"not found", errors.New("not found"), false},
+		{"context timeout", context.DeadlineExceeded, false},
+		{"wrapped context timeout", fmt.Errorf("call: %w", context.DeadlineExceeded), false},
+		{"context canceled", context.Canceled, false},
+		{"connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"http error", rpc.HTTPError{StatusCode: 502, Status: "502 Bad Gateway"}, true},
+		{"eof", io.EOF, true},
+		{"client closed", rpc.ErrClientQuit, true},
+		{"connection lost", errors.New("connection lost"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backendFailed(tt.err); got != tt.want {
+				t.Errorf("backendFailed(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+type testFailoverRPCClient struct {
+	bchain.EVMRPCClient
+	name  string
+	calls *[]string
+}
+
+func (c *testFailoverRPCClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	*c.calls = append(*c.calls, c.name+" "+method)
+	return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+}
+
+func (c *testFailoverRPCClient) BatchCallContext(ctx context.Context, b []bchain.EVMBatchElem) error {
+	*c.calls = append(*c.calls, c.name+" batch")
+	return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+}
+
+func Test_failoverRPCClient(t *testing.T) {
+	backends, err := bchain.NewBackends([]bchain.BackendConfig{
+		{Name: "first", RPCURL: "http://node1:8545"},
+		{Name: "second", RPCURL: "http://node2:8545"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	c := &failoverRPCClient{
+		backends: backends,
+		rpcs: []bchain.EVMRPCClient{
+			&testFailoverRPCClient{name: "first", calls: &calls},
+			&testFailoverRPCClient{name: "second", calls: &calls},
+		},
+	}
+	// the read calls fail over to the other backend
+	if err := c.CallContext(context.Background(), nil, "eth_getBalance"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := c.BatchCallContext(context.Background(), []bchain.EVMBatchElem{{Method: "eth_call"}}); err == nil {
+		t.Fatal("expected error")
+	}
+	// the writes are sent only to the active backend
+	if err := c.CallContext(context.Background(), nil, "eth_sendRawTransaction", "0x00"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := c.BatchCallContext(context.Background(), []bchain.EVMBatchElem{{Method: "eth_call"}, {Method: "eth_sendRawTransaction"}}); err == nil {
+		t.Fatal("expected error")
+	}
+	want := []string{
+		"first eth_getBalance", "second eth_getBalance",
+		"first batch", "second batch",
+		"first eth_sendRawTransaction",
+		// the third failure of the first backend switched the active backend to the second one
+		"second batch",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
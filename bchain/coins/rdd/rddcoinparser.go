@@ -1,14 +1,19 @@
 package rdd
 
 import (
-	"github.com/trezor/blockbook/bchain"
-	"github.com/trezor/blockbook/bchain/coins/btc"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
 	"math/big"
 	"time"
 
+	"github.com/juju/errors"
 	"github.com/martinboehm/btcd/chaincfg/chainhash"
 	"github.com/martinboehm/btcd/wire"
 	"github.com/martinboehm/btcutil/chaincfg"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/bchain/coins/btc"
 )
 
 const (
@@ -17,6 +22,12 @@ const (
 	TestReddNet wire.BitcoinNet = 0x545048 // TP
 )
 
+// posvTxVersion is the first transaction version serialized with the PoSV nTime field
+const posvTxVersion = 2
+
+// maxBlockSignatureLen limits the size of the block signature appended to PoSV blocks
+const maxBlockSignatureLen = 1024
+
 var (
 	// bigOne is 1 represented as a big.Int.  It is defined here to avoid
 	// the overhead of creating it multiple times.
@@ -185,6 +196,11 @@ func GetChainParams(chain string) *chaincfg.Params {
 	}
 }
 
+// SupportsCoinstake returns true, Reddcoin PoSV blocks contain coinstake transactions
+func (p *ReddParser) SupportsCoinstake() bool {
+	return true
+}
+
 // PackTx packs transaction to byte array using protobuf
 func (p *ReddParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) ([]byte, error) {
 	return p.baseparser.PackTx(tx, height, blockTime)
@@ -194,3 +210,100 @@ func (p *ReddParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) ([]by
 func (p *ReddParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
 	return p.baseparser.UnpackTx(buf)
 }
+
+// ParseBlock parses raw block to our Block struct
+// PoSV blocks contain transactions with nTime field and are followed by the block signature
+func (p *ReddParser) ParseBlock(b []byte) (*bchain.Block, error) {
+	r := bytes.NewReader(b)
+	h := wire.BlockHeader{}
+	err := h.Deserialize(r)
+	if err != nil {
+		return nil, errors.Annotatef(err, "Deserialize")
+	}
+
+	txCount, err := wire.ReadVarInt(r, 0)
+	if err != nil {
+		return nil, errors.Annotatef(err, "ReadVarInt")
+	}
+	txs := make([]bchain.Tx, txCount)
+	for i := range txs {
+		t, err := decodeReddTx(r)
+		if err != nil {
+			return nil, errors.Annotatef(err, "tx %d", i)
+		}
+		txs[i] = p.TxFromReddTx(t, false)
+	}
+
+	// the block signature is present only in PoSV blocks, it is not used but must be consumed
+	if r.Len() > 0 {
+		if _, err = wire.ReadVarBytes(r, 0, maxBlockSignatureLen, "BlockSig"); err != nil {
+			return nil, errors.Annotatef(err, "BlockSig")
+		}
+	}
+
+	return &bchain.Block{
+		BlockHeader: bchain.BlockHeader{
+			Size: len(b),
+			Time: h.Timestamp.Unix(),
+		},
+		Txs: txs,
+	}, nil
+}
+
+// ParseTx parses byte array containing transaction and returns Tx struct
+func (p *ReddParser) ParseTx(b []byte) (*bchain.Tx, error) {
+	r := bytes.NewReader(b)
+	t, err := decodeReddTx(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, errors.Errorf("Unexpected %d bytes after transaction", r.Len())
+	}
+	tx := p.TxFromReddTx(t, true)
+	tx.Hex = hex.EncodeToString(b)
+	return &tx, nil
+}
+
+// ReddTx is a Reddcoin transaction, bitcoin transaction extended by the PoSV nTime field
+type ReddTx struct {
+	wire.MsgTx
+	Time uint32
+}
+
+// TxHash computes txid of the transaction, the nTime field is part of the hashed data
+func (t *ReddTx) TxHash() chainhash.Hash {
+	buf := bytes.NewBuffer(make([]byte, 0, t.SerializeSizeStripped()+4))
+	_ = t.SerializeNoWitness(buf)
+	if t.Version >= posvTxVersion {
+		var tb [4]byte
+		binary.LittleEndian.PutUint32(tb[:], t.Time)
+		buf.Write(tb[:])
+	}
+	return chainhash.DoubleHashH(buf.Bytes())
+}
+
+// TxFromReddTx converts Reddcoin transaction to bchain.Tx
+func (p *ReddParser) TxFromReddTx(t *ReddTx, parseAddresses bool) bchain.Tx {
+	tx := p.TxFromMsgTx(&t.MsgTx, parseAddresses)
+	tx.Txid = t.TxHash().String()
+	if t.Version >= posvTxVersion {
+		tx.Time = int64(t.Time)
+	}
+	return tx
+}
+
+func decodeReddTx(r io.Reader) (*ReddTx, error) {
+	t := ReddTx{}
+	if err := t.BtcDecode(r, 0, wire.WitnessEncoding); err != nil {
+		return nil, err
+	}
+	if t.Version >= posvTxVersion {
+		var tb [4]byte
+		if _, err := io.ReadFull(r, tb[:]); err != nil {
+			return nil, errors.Annotatef(err, "nTime")
+		}
+		t.Time = binary.LittleEndian.Uint32(tb[:])
+	}
+	return &t, nil
+}
@@ -0,0 +1,545 @@
+//go:build unittest
+
+package rdd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/martinboehm/btcd/wire"
+	"github.com/martinboehm/btcutil/chaincfg"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/bchain/coins/btc"
+)
+
+func TestMain(m *testing.M) {
+	c := m.Run()
+	chaincfg.ResetParams()
+	os.Exit(c)
+}
+
+func Test_GetAddrDescFromAddress(t *testing.T) {
+	type args struct {
+		address string
+		chain   string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "P2PKH mainnet",
+			args:    args{address: "RsyJMcKLtiRY59qphXEQjXhegH457UHohr", chain: "main"},
+			want:    "76a914d44b295c41dd43cf041d88718320357fd346e8cc88ac",
+			wantErr: false,
+		},
+		{
+			name:    "P2SH mainnet",
+			args:    args{address: "3CjaEbgGyq2vc3zDM3V6WXrV3ZfbgtXYAz", chain: "main"},
+			want:    "a9147925300a0f99841cc01b1258f7e8054b91c3c62687",
+			wantErr: false,
+		},
+		{
+			name:    "P2PKH testnet",
+			args:    args{address: "yGLMA5ZpGnZsrxiacFDGZJw1md9eXhap3a", chain: "test"},
+			want:    "76a914d44b295c41dd43cf041d88718320357fd346e8cc88ac",
+			wantErr: false,
+		},
+		{
+			name:    "P2SH testnet",
+			args:    args{address: "8qU227rJvMXC47wRgv9ZJHfVrdGofTgGqP", chain: "test"},
+			want:    "a9147925300a0f99841cc01b1258f7e8054b91c3c62687",
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewReddParser(GetChainParams(tt.args.chain), &btc.Configuration{})
+			got, err := parser.GetAddrDescFromAddress(tt.args.address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetAddrDescFromAddress() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			h := hex.EncodeToString(got)
+			if !reflect.DeepEqual(h, tt.want) {
+				t.Errorf("GetAddrDescFromAddress() = %v, want %v", h, tt.want)
+			}
+		})
+	}
+}
+
+func Test_GetAddressesFromAddrDesc(t *testing.T) {
+	type args struct {
+		script string
+		chain  string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		want2   bool
+		wantErr bool
+	}{
+		{
+			name:    "P2PKH mainnet",
+			args:    args{script: "76a914d44b295c41dd43cf041d88718320357fd346e8cc88ac", chain: "main"},
+			want:    []string{"RsyJMcKLtiRY59qphXEQjXhegH457UHohr"},
+			want2:   true,
+			wantErr: false,
+		},
+		{
+			name:    "P2SH mainnet",
+			args:    args{script: "a9147925300a0f99841cc01b1258f7e8054b91c3c62687", chain: "main"},
+			want:    []string{"3CjaEbgGyq2vc3zDM3V6WXrV3ZfbgtXYAz"},
+			want2:   true,
+			wantErr: false,
+		},
+		{
+			name:    "P2PKH testnet",
+			args:    args{script: "76a914d44b295c41dd43cf041d88718320357fd346e8cc88ac", chain: "test"},
+			want:    []string{"yGLMA5ZpGnZsrxiacFDGZJw1md9eXhap3a"},
+			want2:   true,
+			wantErr: false,
+		},
+		{
+			name:    "P2SH testnet",
+			args:    args{script: "a9147925300a0f99841cc01b1258f7e8054b91c3c62687", chain: "test"},
+			want:    []string{"8qU227rJvMXC47wRgv9ZJHfVrdGofTgGqP"},
+			want2:   true,
+			wantErr: false,
+		},
+		{
+			name:    "empty coinstake marker",
+			args:    args{script: "", chain: "main"},
+			want:    []string{},
+			want2:   false,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewReddParser(GetChainParams(tt.args.chain), &btc.Configuration{})
+			b, _ := hex.DecodeString(tt.args.script)
+			got, got2, err := parser.GetAddressesFromAddrDesc(b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetAddressesFromAddrDesc() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAddressesFromAddrDesc() = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(got2, tt.want2) {
+				t.Errorf("GetAddressesFromAddrDesc() = %v, want %v", got2, tt.want2)
+			}
+		})
+	}
+}
+
+var (
+	// PoSV coinstake transaction, version 2 with the nTime field
+	testTx1       bchain.Tx
+	testTxPacked1 = "0a20679bc03c932a3359b9e840ecd652815152b04f5f3a2b527dd34fbfda84f3fbeb12ef0102000000018c6b4a2f0e8d6c4b2a1f9e7d5c3b1a0f8d6e4c2a1b3f7d8e9a4c2b0e5f1c6a5d010000006b4830303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303021020202020202020202020202020202020202020202020202020202020202020202ffffffff0300000000000000000000a89c13460200001976a914d44b295c41dd43cf041d88718320357fd346e8cc88ac80a8d66b4c0200001976a914d44b295c41dd43cf041d88718320357fd346e8cc88ac00000000f0e65d6618f0cdf7b20628e898800232970112205d6a1c5f0e2b4c9a8e7d3f1b2a4c6e8d0f1a3b5c7d9e1f2a4b6c8d0e2f4a6b8c1801226b483030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030302102020202020202020202020202020202020202020202020202020202020202020228ffffffff0f3a003a490a060246139ca80010011a1976a914d44b295c41dd43cf041d88718320357fd346e8cc88ac22225273794a4d634b4c7469525935397170685845516a586865674834353755486f68723a490a06024c6bd6a88010021a1976a914d44b295c41dd43cf041d88718320357fd346e8cc88ac22225273794a4d634b4c7469525935397170685845516a586865674834353755486f68724002"
+
+	// legacy transaction, version 1 without the nTime field
+	testTx2       bchain.Tx
+	testTxPacked2 = "0a209887625e8d9eb3254708d0f798c240e98004da22702b73c58315d3840566cf4012e20101000000012b0e9c7a5f3d1b8e6c4a2f0d9b7e5c3a1f8d6b4e2c0a9f7d5b3e1c8a6f4d2e9b000000006b4830303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303021020202020202020202020202020202020202020202020202020202020202020202feffffff0200a2941a1d0000001976a9142bd806c97f0e00af1a1fc3328fa763a9269723c888ac40a12905090000001976a91481b637d8fcd2c6da6359e6963113a1170de795e488ac670c400018f0cdf7b20620e798800228e898800232950112209b2e4d6f8a1c3e5b7d9f0a2c4e6b8d1f3a5c7e9b0d2f4a6c8e1b3d5f7a9c0e2b226b483030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030302102020202020202020202020202020202020202020202020202020202020202020228feffffff0f3a460a051d1a94a2001a1976a9142bd806c97f0e00af1a1fc3328fa763a9269723c888ac2222526363637566396532434b5257506931617a4a7354354d53684b6a677476665653613a480a05090529a14010011a1976a91481b637d8fcd2c6da6359e6963113a1170de795e488ac2222526b536558374c686553776869536e6d795a686d776a417255547145697346625a394001"
+
+	// coinbase transaction of the mainnet genesis block
+	testTxGenesis bchain.Tx
+)
+
+func init() {
+	testTx1 = bchain.Tx{
+		Hex:      "02000000018c6b4a2f0e8d6c4b2a1f9e7d5c3b1a0f8d6e4c2a1b3f7d8e9a4c2b0e5f1c6a5d010000006b4830303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303021020202020202020202020202020202020202020202020202020202020202020202ffffffff0300000000000000000000a89c13460200001976a914d44b295c41dd43cf041d88718320357fd346e8cc88ac80a8d66b4c0200001976a914d44b295c41dd43cf041d88718320357fd346e8cc88ac00000000f0e65d66",
+		Txid:     "679bc03c932a3359b9e840ecd652815152b04f5f3a2b527dd34fbfda84f3fbeb",
+		Version:  2,
+		LockTime: 0,
+		Vin: []bchain.Vin{
+			{
+				ScriptSig: bchain.ScriptSig{
+					Hex: "4830303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303021020202020202020202020202020202020202020202020202020202020202020202",
+				},
+				Txid:     "5d6a1c5f0e2b4c9a8e7d3f1b2a4c6e8d0f1a3b5c7d9e1f2a4b6c8d0e2f4a6b8c",
+				Vout:     1,
+				Sequence: 4294967295,
+			},
+		},
+		Vout: []bchain.Vout{
+			{
+				ValueSat: *big.NewInt(0),
+				N:        0,
+				ScriptPubKey: bchain.ScriptPubKey{
+					Hex: "",
+				},
+			},
+			{
+				ValueSat: *big.NewInt(2500000000000),
+				N:        1,
+				ScriptPubKey: bchain.ScriptPubKey{
+					Hex: "76a914d44b295c41dd43cf041d88718320357fd346e8cc88ac",
+					Addresses: []string{
+						"RsyJMcKLtiRY59qphXEQjXhegH457UHohr",
+					},
+				},
+			},
+			{
+				ValueSat: *big.NewInt(2527250000000),
+				N:        2,
+				ScriptPubKey: bchain.ScriptPubKey{
+					Hex: "76a914d44b295c41dd43cf041d88718320357fd346e8cc88ac",
+					Addresses: []string{
+						"RsyJMcKLtiRY59qphXEQjXhegH457UHohr",
+					},
+				},
+			},
+		},
+		Blocktime: 1717430000,
+		Time:      1717430000,
+	}
+
+	testTx2 = bchain.Tx{
+		Hex:      "01000000012b0e9c7a5f3d1b8e6c4a2f0d9b7e5c3a1f8d6b4e2c0a9f7d5b3e1c8a6f4d2e9b000000006b4830303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303021020202020202020202020202020202020202020202020202020202020202020202feffffff0200a2941a1d0000001976a9142bd806c97f0e00af1a1fc3328fa763a9269723c888ac40a12905090000001976a91481b637d8fcd2c6da6359e6963113a1170de795e488ac670c4000",
+		Txid:     "9887625e8d9eb3254708d0f798c240e98004da22702b73c58315d3840566cf40",
+		Version:  1,
+		LockTime: 4197479,
+		Vin: []bchain.Vin{
+			{
+				ScriptSig: bchain.ScriptSig{
+					Hex: "4830303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303021020202020202020202020202020202020202020202020202020202020202020202",
+				},
+				Txid:     "9b2e4d6f8a1c3e5b7d9f0a2c4e6b8d1f3a5c7e9b0d2f4a6c8e1b3d5f7a9c0e2b",
+				Vout:     0,
+				Sequence: 4294967294,
+			},
+		},
+		Vout: []bchain.Vout{
+			{
+				ValueSat: *big.NewInt(125000000000),
+				N:        0,
+				ScriptPubKey: bchain.ScriptPubKey{
+					Hex: "76a9142bd806c97f0e00af1a1fc3328fa763a9269723c888ac",
+					Addresses: []string{
+						"Rcccuf9e2CKRWPi1azJsT5MShKjgtvfVSa",
+					},
+				},
+			},
+			{
+				ValueSat: *big.NewInt(38741320000),
+				N:        1,
+				ScriptPubKey: bchain.ScriptPubKey{
+					Hex: "76a91481b637d8fcd2c6da6359e6963113a1170de795e488ac",
+					Addresses: []string{
+						"RkSeX7LheSwhiSnmyZhmwjArUTqEisFbZ9",
+					},
+				},
+			},
+		},
+		Blocktime: 1717430000,
+		Time:      1717430000,
+	}
+
+	testTxGenesis = bchain.Tx{
+		Hex:      "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff3004ffff001d0104284a616e75617279203231737420323031342077617320737563682061206e696365206461792e2e2effffffff010010a5d4e80000004341040184710fa689ad5023690c80f3a49c8f13f8d45b8c857fbcbc8bc4a8e4d3eb4b10f4d4604fa08dce601aaf0f470216fe1b51850b4acf21b179c45070ac7b03a9ac00000000",
+		Txid:     "b502bc1dc42b07092b9187e92f70e32f9a53247feae16d821bebffa916af79ff",
+		Version:  1,
+		LockTime: 0,
+		Vin: []bchain.Vin{
+			{
+				Coinbase: "04ffff001d0104284a616e75617279203231737420323031342077617320737563682061206e696365206461792e2e2e",
+				Sequence: 4294967295,
+			},
+		},
+		Vout: []bchain.Vout{
+			{
+				ValueSat: *big.NewInt(1000000000000),
+				N:        0,
+				ScriptPubKey: bchain.ScriptPubKey{
+					Hex: "41040184710fa689ad5023690c80f3a49c8f13f8d45b8c857fbcbc8bc4a8e4d3eb4b10f4d4604fa08dce601aaf0f470216fe1b51850b4acf21b179c45070ac7b03a9ac",
+					Addresses: []string{
+						"RtEu5n2yuHa5pQ5evhiAhRYbzypVzR28dp",
+					},
+				},
+			},
+		},
+	}
+}
+
+func Test_PackTx(t *testing.T) {
+	type args struct {
+		tx        bchain.Tx
+		height    uint32
+		blockTime int64
+		parser    *ReddParser
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "rdd-1",
+			args: args{
+				tx:        testTx1,
+				height:    4197480,
+				blockTime: 1717430000,
+				parser:    NewReddParser(GetChainParams("main"), &btc.Configuration{}),
+			},
+			want:    testTxPacked1,
+			wantErr: false,
+		},
+		{
+			name: "rdd-2",
+			args: args{
+				tx:        testTx2,
+				height:    4197480,
+				blockTime: 1717430000,
+				parser:    NewReddParser(GetChainParams("main"), &btc.Configuration{}),
+			},
+			want:    testTxPacked2,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.args.parser.PackTx(&tt.args.tx, tt.args.height, tt.args.blockTime)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("packTx() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			h := hex.EncodeToString(got)
+			if !reflect.DeepEqual(h, tt.want) {
+				t.Errorf("packTx() = %v, want %v", h, tt.want)
+			}
+		})
+	}
+}
+
+func Test_UnpackTx(t *testing.T) {
+	type args struct {
+		packedTx string
+		parser   *ReddParser
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *bchain.Tx
+		want1   uint32
+		wantErr bool
+	}{
+		{
+			name: "rdd-1",
+			args: args{
+				packedTx: testTxPacked1,
+				parser:   NewReddParser(GetChainParams("main"), &btc.Configuration{}),
+			},
+			want:    &testTx1,
+			want1:   4197480,
+			wantErr: false,
+		},
+		{
+			name: "rdd-2",
+			args: args{
+				packedTx: testTxPacked2,
+				parser:   NewReddParser(GetChainParams("main"), &btc.Configuration{}),
+			},
+			want:    &testTx2,
+			want1:   4197480,
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.args.packedTx)
+			got, got1, err := tt.args.parser.UnpackTx(b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unpackTx() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unpackTx() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("unpackTx() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
+func Test_ParseTx(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   *bchain.Tx
+		time int64
+	}{
+		{
+			name: "rdd-1",
+			tx:   &testTx1,
+			time: 1717430000,
+		},
+		{
+			name: "rdd-2",
+			tx:   &testTx2,
+			time: 0,
+		},
+		{
+			name: "rdd-genesis",
+			tx:   &testTxGenesis,
+			time: 0,
+		},
+	}
+	parser := NewReddParser(GetChainParams("main"), &btc.Configuration{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.tx.Hex)
+			got, err := parser.ParseTx(b)
+			if err != nil {
+				t.Fatalf("ParseTx() error = %v", err)
+			}
+			if got.Txid != tt.tx.Txid {
+				t.Errorf("ParseTx() txid = %v, want %v", got.Txid, tt.tx.Txid)
+			}
+			if got.Hex != tt.tx.Hex {
+				t.Errorf("ParseTx() hex = %v, want %v", got.Hex, tt.tx.Hex)
+			}
+			if got.Time != tt.time {
+				t.Errorf("ParseTx() time = %v, want %v", got.Time, tt.time)
+			}
+			if !reflect.DeepEqual(got.Vin, tt.tx.Vin) {
+				t.Errorf("ParseTx() vin = %+v, want %+v", got.Vin, tt.tx.Vin)
+			}
+			if len(got.Vout) != len(tt.tx.Vout) {
+				t.Fatalf("ParseTx() number of vouts = %v, want %v", len(got.Vout), len(tt.tx.Vout))
+			}
+			for i := range got.Vout {
+				if got.Vout[i].ValueSat.Cmp(&tt.tx.Vout[i].ValueSat) != 0 {
+					t.Errorf("ParseTx() vout %d value = %v, want %v", i, got.Vout[i].ValueSat.String(), tt.tx.Vout[i].ValueSat.String())
+				}
+				got, want := &got.Vout[i].ScriptPubKey, &tt.tx.Vout[i].ScriptPubKey
+				if got.Hex != want.Hex || len(got.Addresses) != len(want.Addresses) ||
+					(len(want.Addresses) > 0 && !reflect.DeepEqual(got.Addresses, want.Addresses)) {
+					t.Errorf("ParseTx() vout %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+	// trailing data after the nTime field must be rejected
+	b, _ := hex.DecodeString(testTx1.Hex + "00")
+	if _, err := parser.ParseTx(b); err == nil {
+		t.Error("ParseTx() with trailing data, expected error")
+	}
+}
+
+type testBlock struct {
+	hash   string
+	size   int
+	time   int64
+	txs    []string
+	sigLen int
+}
+
+var testParseBlockTxs = map[int]testBlock{
+	// mainnet genesis block, proof of work without the block signature
+	0: {
+		hash: "b868e0d95a3c3c0e0dadc67ee587aaf9dc8acbf99e3b4b3110fad4eb74c1decc",
+		size: 256,
+		time: 1390280400,
+		txs: []string{
+			"b502bc1dc42b07092b9187e92f70e32f9a53247feae16d821bebffa916af79ff",
+		},
+	},
+	// PoSV block with coinbase, coinstake and legacy transaction, followed by the block signature
+	4197480: {
+		hash: "d6f2974d5c6dc3e0889b5a9960778cdde8c67119f210f8c48c56b53cdd46bd71",
+		size: 687,
+		time: 1717430000,
+		txs: []string{
+			"902d2d54cbf3d27c877ed5879c6088bbe1c7c743f2ba5169b8eeb8730f3c9496",
+			"679bc03c932a3359b9e840ecd652815152b04f5f3a2b527dd34fbfda84f3fbeb",
+			"9887625e8d9eb3254708d0f798c240e98004da22702b73c58315d3840566cf40",
+		},
+		sigLen: 71,
+	},
+}
+
+func helperLoadBlock(t *testing.T, height int) []byte {
+	name := fmt.Sprintf("block_dump.%d", height)
+	path := filepath.Join("testdata", name)
+
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d = bytes.TrimSpace(d)
+
+	b := make([]byte, hex.DecodedLen(len(d)))
+	_, err = hex.Decode(b, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestParseBlock(t *testing.T) {
+	p := NewReddParser(GetChainParams("main"), &btc.Configuration{})
+
+	for height, tb := range testParseBlockTxs {
+		b := helperLoadBlock(t, height)
+
+		blk, err := p.ParseBlock(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var h wire.BlockHeader
+		if err = h.Deserialize(bytes.NewReader(b)); err != nil {
+			t.Fatal(err)
+		}
+		if h.BlockHash().String() != tb.hash {
+			t.Errorf("ParseBlock() block hash: got %s, want %s", h.BlockHash().String(), tb.hash)
+		}
+
+		if blk.Size != tb.size {
+			t.Errorf("ParseBlock() block size: got %d, want %d", blk.Size, tb.size)
+		}
+
+		if blk.Time != tb.time {
+			t.Errorf("ParseBlock() block time: got %d, want %d", blk.Time, tb.time)
+		}
+
+		if len(blk.Txs) != len(tb.txs) {
+			t.Errorf("ParseBlock() number of transactions: got %d, want %d", len(blk.Txs), len(tb.txs))
+		}
+
+		for ti, tx := range tb.txs {
+			if blk.Txs[ti].Txid != tx {
+				t.Errorf("ParseBlock() transaction %d: got %s, want %s", ti, blk.Txs[ti].Txid, tx)
+			}
+		}
+
+		if tb.sigLen == 0 {
+			continue
+		}
+		// the block without the signature is a valid block as well
+		blk, err = p.ParseBlock(b[:len(b)-tb.sigLen])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blk.Txs) != len(tb.txs) {
+			t.Errorf("ParseBlock() without signature, number of transactions: got %d, want %d", len(blk.Txs), len(tb.txs))
+		}
+	}
+}
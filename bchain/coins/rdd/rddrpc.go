@@ -1,12 +1,12 @@
 package rdd
 
 import (
-	"github.com/trezor/blockbook/bchain"
-	"github.com/trezor/blockbook/bchain/coins/btc"
 	"encoding/json"
 
 	"github.com/golang/glog"
 	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/bchain/coins/btc"
 )
 
 type ReedRPC struct {
@@ -53,21 +53,29 @@ func (b *ReedRPC) Initialize() error {
 
 // GetBlock returns block with given hash.
 func (s *ReedRPC) GetBlock(hash string, height uint32) (*bchain.Block, error) {
+	if s.ParseBlocks {
+		return s.BitcoinRPC.GetBlock(hash, height)
+	}
 	var err error
-	if hash == "" && height > 0 {
+	if hash == "" {
 		hash, err = s.GetBlockHash(height)
 		if err != nil {
 			return nil, err
 		}
 	}
+	return s.getBlockWithTransactions(hash)
+}
 
+// getBlockWithTransactions gets the list of txids in the block and then each transaction one by one,
+// it is much slower than parsing of the raw block and is used only if block parsing is disabled
+func (s *ReedRPC) getBlockWithTransactions(hash string) (*bchain.Block, error) {
 	glog.V(1).Info("rpc: getblock (verbosity=1) ", hash)
 
 	res := btc.ResGetBlockThin{}
 	req := btc.CmdGetBlock{Method: "getblock"}
 	req.Params.BlockHash = hash
 	req.Params.Verbosity = 1
-	err = s.Call(&req, &res)
+	err := s.Call(&req, &res)
 
 	if err != nil {
 		return nil, errors.Annotatef(err, "hash %v", hash)
@@ -98,5 +106,8 @@ func (s *ReedRPC) GetBlock(hash string, height uint32) (*bchain.Block, error) {
 // GetTransactionForMempool returns a transaction by the transaction ID.
 // It could be optimized for mempool, i.e. without block time and confirmations
 func (s *ReedRPC) GetTransactionForMempool(txid string) (*bchain.Tx, error) {
+	if s.ParseBlocks {
+		return s.BitcoinRPC.GetTransactionForMempool(txid)
+	}
 	return s.GetTransaction(txid)
 }
@@ -0,0 +1,191 @@
+//go:build unittest
+
+package rdd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/trezor/blockbook/bchain"
+)
+
+// rpcRecording is a backend response to a request with the given method and params
+type rpcRecording struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+}
+
+// fakeBackend is a stand-in for reddcoind, it answers the json-rpc requests from recorded responses
+type fakeBackend struct {
+	recordings map[string]json.RawMessage
+}
+
+func fakeBackendKey(method string, params json.RawMessage) string {
+	p := []interface{}{}
+	json.Unmarshal(params, &p)
+	b, _ := json.Marshal(p)
+	return method + string(b)
+}
+
+func newFakeBackend(t *testing.T) *httptest.Server {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "rpc_recording.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rr []rpcRecording
+	if err = json.Unmarshal(b, &rr); err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeBackend{recordings: make(map[string]json.RawMessage)}
+	for _, r := range rr {
+		f.recordings[fakeBackendKey(r.Method, r.Params)] = r.Result
+	}
+	return httptest.NewServer(f)
+}
+
+func (f *fakeBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var res struct {
+		Result json.RawMessage  `json:"result"`
+		Error  *bchain.RPCError `json:"error"`
+	}
+	result, found := f.recordings[fakeBackendKey(req.Method, req.Params)]
+	if found {
+		res.Result = result
+	} else {
+		res.Result = json.RawMessage("null")
+		switch req.Method {
+		case "getrawtransaction":
+			res.Error = &bchain.RPCError{Code: -5, Message: "No such mempool or blockchain transaction"}
+		case "getblockhash":
+			res.Error = &bchain.RPCError{Code: -8, Message: "Block height out of range"}
+		default:
+			res.Error = &bchain.RPCError{Code: -32601, Message: "Method not found"}
+		}
+	}
+	json.NewEncoder(w).Encode(&res)
+}
+
+func newTestReddRPC(t *testing.T, url string, parse bool) *ReedRPC {
+	config, _ := json.Marshal(map[string]interface{}{
+		"coin_name":   "Reddcoin",
+		"rpc_url":     url,
+		"rpc_user":    "rpc",
+		"rpc_pass":    "rpc",
+		"rpc_timeout": 25,
+		"parse":       parse,
+	})
+	bc, err := NewReddRPC(config, func(bchain.NotificationType) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bc.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return bc.(*ReedRPC)
+}
+
+func TestReddRPC_GetBlock(t *testing.T) {
+	s := newFakeBackend(t)
+	defer s.Close()
+
+	tb := testParseBlockTxs[4197480]
+	for _, parse := range []bool{true, false} {
+		rpc := newTestReddRPC(t, s.URL, parse)
+		if rpc.Network != "livenet" {
+			t.Errorf("Initialize() network = %v, want livenet", rpc.Network)
+		}
+		blk, err := rpc.GetBlock("", 4197480)
+		if err != nil {
+			t.Fatalf("GetBlock(parse=%v) error = %v", parse, err)
+		}
+		if blk.Hash != "d6f2974d5c6dc3e0889b5a9960778cdde8c67119f210f8c48c56b53cdd46bd71" {
+			t.Errorf("GetBlock(parse=%v) hash = %v", parse, blk.Hash)
+		}
+		if len(blk.Txs) != len(tb.txs) {
+			t.Fatalf("GetBlock(parse=%v) number of transactions: got %d, want %d", parse, len(blk.Txs), len(tb.txs))
+		}
+		for ti, tx := range tb.txs {
+			if blk.Txs[ti].Txid != tx {
+				t.Errorf("GetBlock(parse=%v) transaction %d: got %s, want %s", parse, ti, blk.Txs[ti].Txid, tx)
+			}
+		}
+		// the coinstake transaction keeps its PoSV time in both modes
+		if blk.Txs[1].Time != tb.time {
+			t.Errorf("GetBlock(parse=%v) coinstake time: got %d, want %d", parse, blk.Txs[1].Time, tb.time)
+		}
+		if v := blk.Txs[1].Vout[2].ValueSat; v.Cmp(big.NewInt(2527250000000)) != 0 {
+			t.Errorf("GetBlock(parse=%v) coinstake value: got %v, want 2527250000000", parse, v.String())
+		}
+		// only the hash is known, the header is fetched from the backend
+		blk, err = rpc.GetBlock("d6f2974d5c6dc3e0889b5a9960778cdde8c67119f210f8c48c56b53cdd46bd71", 0)
+		if err != nil {
+			t.Fatalf("GetBlock(parse=%v, hash) error = %v", parse, err)
+		}
+		if blk.Height != 4197480 || len(blk.Txs) != len(tb.txs) {
+			t.Errorf("GetBlock(parse=%v, hash) height %d, %d transactions", parse, blk.Height, len(blk.Txs))
+		}
+	}
+}
+
+func TestReddRPC_GetTransaction(t *testing.T) {
+	s := newFakeBackend(t)
+	defer s.Close()
+	rpc := newTestReddRPC(t, s.URL, true)
+
+	for _, want := range []*bchain.Tx{&testTx1, &testTx2} {
+		got, err := rpc.GetTransaction(want.Txid)
+		if err != nil {
+			t.Fatalf("GetTransaction(%v) error = %v", want.Txid, err)
+		}
+		if got.Hex != want.Hex || got.Version != want.Version || got.LockTime != want.LockTime {
+			t.Errorf("GetTransaction(%v) = %+v, want %+v", want.Txid, got, want)
+		}
+		if got.Blocktime != want.Blocktime || got.Confirmations != 1 {
+			t.Errorf("GetTransaction(%v) blocktime %v, confirmations %v", want.Txid, got.Blocktime, got.Confirmations)
+		}
+		for i := range want.Vout {
+			if got.Vout[i].ValueSat.Cmp(&want.Vout[i].ValueSat) != 0 {
+				t.Errorf("GetTransaction(%v) vout %d value = %v, want %v", want.Txid, i, got.Vout[i].ValueSat.String(), want.Vout[i].ValueSat.String())
+			}
+		}
+	}
+
+	if _, err := rpc.GetBlockHash(4197481); err != bchain.ErrBlockNotFound {
+		t.Errorf("GetBlockHash() of unknown block error = %v, want %v", err, bchain.ErrBlockNotFound)
+	}
+	if _, err := rpc.GetTransaction("0000000000000000000000000000000000000000000000000000000000000000"); err != bchain.ErrTxNotFound {
+		t.Errorf("GetTransaction() of unknown tx error = %v, want %v", err, bchain.ErrTxNotFound)
+	}
+	if tx, err := rpc.GetTransactionForMempool(testTx1.Txid); err != nil || tx.Txid != testTx1.Txid {
+		t.Errorf("GetTransactionForMempool() = %v, %v", tx, err)
+	}
+}
+
+func TestReddRPC_FakeBackendRecording(t *testing.T) {
+	// the recorded raw block must match the block dump used by the parser tests
+	s := newFakeBackend(t)
+	defer s.Close()
+	rpc := newTestReddRPC(t, s.URL, true)
+	b, err := rpc.GetBlockBytes("d6f2974d5c6dc3e0889b5a9960778cdde8c67119f210f8c48c56b53cdd46bd71")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, helperLoadBlock(t, 4197480)) {
+		t.Error("Recorded block differs from testdata/block_dump.4197480")
+	}
+}
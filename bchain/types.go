@@ -57,6 +57,9 @@ type Vin struct {
 	ScriptSig ScriptSig `json:"scriptSig"`
 	Sequence  uint32    `json:"sequence"`
 	Addresses []string  `json:"addresses"`
+	// Witness is the witness stack of the input, it is set only in the transactions of the blocks,
+	// either parsed from the raw data or returned by the backend in json with the txinwitness field
+	Witness [][]byte `json:"-"`
 }
 
 // ScriptPubKey contains data about output script
@@ -217,6 +220,19 @@ type ChainInfo struct {
 	Warnings         string      `json:"warnings"`
 	ConsensusVersion string      `json:"consensus_version,omitempty"`
 	Consensus        interface{} `json:"consensus,omitempty"`
+	// the active backend and the statistics of the backends, only if more backends are configured
+	ActiveBackend string                 `json:"-"`
+	Backends      []common.BackendStatus `json:"-"`
+}
+
+// TxOutSetInfo contains statistics of the unspent transaction outputs set of the backend
+// MuHash is set only if the backend supports the muhash hash type
+type TxOutSetInfo struct {
+	Height      uint32
+	BestBlock   string
+	TxOuts      int64
+	TotalAmount big.Int
+	MuHash      string
 }
 
 // RPCError defines rpc error returned by backend
@@ -260,6 +276,10 @@ const (
 	P2SHWPKH
 	P2WPKH
 	P2TR
+	// multisig scripts multi or sortedmulti, wrapped in P2SH, P2WSH or P2WSH nested in P2SH
+	P2SH
+	P2WSH
+	P2SHWSH
 )
 
 // XpubDescriptor contains parsed data from xpub descriptor
@@ -270,6 +290,11 @@ type XpubDescriptor struct {
 	Bip            string
 	ChangeIndexes  []uint32
 	ExtKey         interface{} // extended key parsed from xpub, usually of type *hdkeychain.ExtendedKey
+	KeyOrigin      string      // derivation path of the key origin info of the (first) key, for example 48'/0'/0'/2'
+	// multisig descriptors only
+	Threshold int           // number of signatures required by the multisig script
+	Sorted    bool          // the keys in the multisig script are sorted (sortedmulti)
+	ExtKeys   []interface{} // extended keys of all cosigners, ExtKey is the first of them
 }
 
 // MempoolTxidEntries is array of MempoolTxidEntry
@@ -284,6 +309,9 @@ type OnNewTxAddrFunc func(tx *Tx, desc AddressDescriptor)
 // OnNewTxFunc is used to send notification about a new transaction/address
 type OnNewTxFunc func(tx *MempoolTx)
 
+// OnMempoolSyncFunc is used to send notification about a finished resync of the mempool
+type OnMempoolSyncFunc func()
+
 // AddrDescForOutpointFunc returns address descriptor and value for given outpoint or nil if outpoint not found
 type AddrDescForOutpointFunc func(outpoint Outpoint) (AddressDescriptor, *big.Int)
 
@@ -304,6 +332,7 @@ type BlockChain interface {
 	GetSubversion() string
 	GetCoinName() string
 	GetChainInfo() (*ChainInfo, error)
+	GetTxOutSetInfo(hashType string, height int) (*TxOutSetInfo, error)
 	// requests
 	GetBestBlockHash() (string, error)
 	GetBestBlockHeight() (uint32, error)
@@ -346,6 +375,8 @@ type BlockChainParser interface {
 	MinimumCoinbaseConfirmations() int
 	// SupportsVSize returns true if vsize of a transaction should be computed and returned by API
 	SupportsVSize() bool
+	// SupportsCoinstake returns true if the coin is proof of stake with coinstake transactions
+	SupportsCoinstake() bool
 	// AmountToDecimalString converts amount in big.Int to string with decimal point in the correct place
 	AmountToDecimalString(a *big.Int) string
 	// AmountToBigInt converts amount in common.JSONNumber (string) to big.Int
@@ -98,6 +98,7 @@ export interface Tx {
     fees?: string;
     hex?: string;
     rbf?: boolean;
+    stakingReward?: string;
     coinSpecificData?: any;
     tokenTransfers?: TokenTransfer[];
     ethereumSpecific?: EthereumSpecific;
@@ -178,6 +179,7 @@ export interface BalanceHistory {
     received?: string;
     sent?: string;
     sentToSelf?: string;
+    stakingReward?: string;
     rates?: { [key: string]: number };
     txid?: string;
 }
@@ -188,6 +190,14 @@ export interface BlockInfo {
     Size: number;
     Height: number;
 }
+export interface StakingInfo {
+    address: string;
+    stakes: number;
+    totalReward?: string;
+    lastStakeHeight?: number;
+    lastStakeTime?: number;
+    averageInterval?: number;
+}
 export interface Blocks {
     page?: number;
     totalPages?: number;
@@ -292,6 +302,7 @@ export interface WsReq {
         | 'getBlockHash'
         | 'getAccountUtxo'
         | 'getBalanceHistory'
+        | 'getStakingInfo'
         | 'getTransaction'
         | 'getTransactionSpecific'
         | 'estimateFee'
@@ -365,6 +376,10 @@ export interface WsBalanceHistoryReq {
     gap?: number;
     groupBy?: number;
 }
+export interface WsStakingInfoReq {
+    descriptor: string;
+    gap?: number;
+}
 export interface WsTransactionReq {
     txid: string;
 }
@@ -13,6 +13,8 @@ import (
 	"os/signal"
 	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -55,6 +57,12 @@ var (
 	synchronize = flag.Bool("sync", false, "synchronizes until tip, if together with zeromq, keeps index synchronized")
 	repair      = flag.Bool("repair", false, "repair the database")
 	fixUtxo     = flag.Bool("fixutxo", false, "check and fix utxo db and exit")
+	verifyUtxo  = flag.Bool("verifyutxo", false, "compare the unspent outputs in the db with the backend gettxoutsetinfo and exit")
+	pruneBlocks = flag.Int("prune", 0, "keep the history of the addresses only for the given number of last blocks, 0 keeps the full history")
+	snapshotDir = flag.String("snapshot", "", "create a snapshot of the database in the given directory and exit")
+	restoreDir  = flag.String("restore", "", "restore the database from the snapshot in the given directory to datadir and exit")
+	exportDir   = flag.String("export", "", "export blocks, inputs, outputs and balances to csv files in the given directory, continue from the last export, and exit")
+	exportParts = flag.Int("exportpartition", 100000, "number of blocks in one partition of the exported files")
 	prof        = flag.String("prof", "", "http server binding [address]:port of the interface to profiling data /debug/pprof/ (default no profiling)")
 
 	syncChunk   = flag.Int("chunk", 100, "block chunk size for processing in bulk mode")
@@ -78,6 +86,9 @@ var (
 	computeColumnStats  = flag.Bool("computedbstats", false, "compute column stats and exit")
 	computeFeeStatsFlag = flag.Bool("computefeestats", false, "compute fee stats for blocks in blockheight-blockuntil range and exit")
 	dbStatsPeriodHours  = flag.Int("dbstatsperiod", 24, "period of db stats collection in hours, 0 disables stats collection")
+	dbCompactPeriod     = flag.Int("dbcompactperiod", 0, "period of the compaction of the db columns in hours, 0 disables the periodic compaction")
+	dbCompactColumns    = flag.String("dbcompactcolumns", "", "comma separated list of the db columns compacted periodically, default addresses and txAddresses")
+	reindexColumn       = flag.String("reindex", "", "rebuild the db column (internalData, addressContracts, txAddresses or silentPayments) from the backend for blocks in blockheight-blockuntil range and exit")
 
 	// resync index at least each resyncIndexPeriodMs (could be more often if invoked by message from ZeroMQ)
 	resyncIndexPeriodMs = flag.Int("resyncindexperiod", 935093, "resync index period in milliseconds")
@@ -85,7 +96,9 @@ var (
 	// resync mempool at least each resyncMempoolPeriodMs (could be more often if invoked by message from ZeroMQ)
 	resyncMempoolPeriodMs = flag.Int("resyncmempoolperiod", 60017, "resync mempool period in milliseconds")
 
-	extendedIndex = flag.Bool("extendedindex", false, "if true, create index of input txids and spending transactions")
+	extendedIndex  = flag.Bool("extendedindex", false, "if true, create index of input txids and spending transactions")
+	richList       = flag.Bool("richlist", false, "if true, create and maintain index of addresses sorted by balance (UTXO chains only), if false, the index is deleted")
+	silentPayments = flag.Bool("silentpayments", false, "if true, index the silent payment (BIP-352) tweaks of the taproot-eligible transactions of new blocks (Bitcoin type coins only), if false, the index is deleted")
 )
 
 var (
@@ -103,8 +116,10 @@ var (
 	syncWorker                    *db.SyncWorker
 	internalState                 *common.InternalState
 	callbacksOnNewBlock           []bchain.OnNewBlockFunc
+	callbacksOnReorg              []db.OnReorgFunc
 	callbacksOnNewTxAddr          []bchain.OnNewTxAddrFunc
 	callbacksOnNewTx              []bchain.OnNewTxFunc
+	callbacksOnMempoolSync        []bchain.OnMempoolSyncFunc
 	callbacksOnNewFiatRatesTicker []fiat.OnNewFiatRatesTicker
 	chanOsSignal                  chan os.Signal
 )
@@ -174,7 +189,33 @@ func mainWithExitCode() int {
 		return exitCodeFatal
 	}
 
-	index, err = db.NewRocksDB(*dbPath, *dbCache, *dbMaxOpenFiles, chain.GetChainParser(), metrics, *extendedIndex)
+	if *restoreDir != "" {
+		si, err := db.RestoreSnapshot(*restoreDir, *dbPath, chain.GetChainParser(), coin)
+		if err != nil {
+			glog.Errorf("RestoreSnapshot %s: %v", *restoreDir, err)
+			return exitCodeFatal
+		}
+		glog.Infof("Snapshot of block %d restored to %s", si.BestHeight, si.Dir)
+		return exitCodeOK
+	}
+
+	if *pruneBlocks > 0 {
+		if chain.GetChainParser().GetChainType() != bchain.ChainBitcoinType {
+			glog.Error("prune: supported only for bitcoin type coins")
+			return exitCodeFatal
+		}
+		if *pruneBlocks < chain.GetChainParser().KeepBlockAddresses() {
+			glog.Error("prune: the number of blocks must be at least ", chain.GetChainParser().KeepBlockAddresses())
+			return exitCodeFatal
+		}
+	}
+
+	if *reindexColumn == "txAddresses" && !*extendedIndex {
+		glog.Error("reindex: txAddresses can be reindexed only to create the extended index, run with -extendedindex")
+		return exitCodeFatal
+	}
+	// the reindex of txAddresses opens the db in the format without the extended index and converts it
+	index, err = db.NewRocksDB(*dbPath, *dbCache, *dbMaxOpenFiles, chain.GetChainParser(), metrics, *extendedIndex && *reindexColumn != "txAddresses")
 	if err != nil {
 		glog.Error("rocksDB: ", err)
 		return exitCodeFatal
@@ -187,6 +228,15 @@ func mainWithExitCode() int {
 		return exitCodeFatal
 	}
 
+	// upgrade the columns of the db to the current version, the migration can be interrupted and continues on the next start
+	if db.MigrationPending(internalState) {
+		err = index.MigrateColumns(internalState, chanOsSignal)
+		if err != nil {
+			glog.Error("migrateColumns: ", err)
+			return exitCodeFatal
+		}
+	}
+
 	// fix possible inconsistencies in the UTXO index
 	if *fixUtxo || !internalState.UtxoChecked {
 		err = index.FixUtxos(chanOsSignal)
@@ -208,10 +258,68 @@ func mainWithExitCode() int {
 
 	if internalState.DbState != common.DbStateClosed {
 		if internalState.DbState == common.DbStateInconsistent {
-			glog.Error("internalState: database is in inconsistent state and cannot be used")
+			if internalState.BulkCheckpoint == nil {
+				glog.Error("internalState: database is in inconsistent state and cannot be used")
+				return exitCodeFatal
+			}
+			glog.Warning("internalState: initial sync was interrupted, resuming from the checkpoint at height ", internalState.BulkCheckpoint.Height)
+			if err = index.ResumeBulkConnect(chain); err != nil {
+				glog.Error("internalState: ", err)
+				return exitCodeFatal
+			}
+		} else {
+			glog.Warning("internalState: database was left in open state, possibly previous ungraceful shutdown")
+		}
+	}
+
+	if internalState.Reindex != nil && internalState.Reindex.Column != *reindexColumn {
+		glog.Errorf("internalState: reindex of column %v was interrupted, run with -reindex=%v", internalState.Reindex.Column, internalState.Reindex.Column)
+		return exitCodeFatal
+	}
+
+	if *verifyUtxo {
+		r, err := index.VerifyUtxoSet(chain, chanOsSignal)
+		if err != nil {
+			glog.Error("VerifyUtxoSet: ", err)
+			return exitCodeFatal
+		}
+		if r.DivergedHeight > 0 {
+			glog.Errorf("VerifyUtxoSet: the index differs from the backend from block %d", r.DivergedHeight)
+			return exitCodeFatal
+		}
+		if r.HashMismatch {
+			glog.Error("VerifyUtxoSet: the index has the same best block as the backend, but different unspent outputs, the index must be rebuilt")
 			return exitCodeFatal
 		}
-		glog.Warning("internalState: database was left in open state, possibly previous ungraceful shutdown")
+		if !r.Match {
+			glog.Error("VerifyUtxoSet: the unspent outputs of the index do not match the backend")
+			return exitCodeFatal
+		}
+		if !r.HashCompared {
+			glog.Warning("VerifyUtxoSet: the backend does not support muhash, only the number and the amount of the unspent outputs were compared")
+		}
+		glog.Info("VerifyUtxoSet: the unspent outputs of the index match the backend at block ", r.Index.Height)
+		return exitCodeOK
+	}
+
+	if *snapshotDir != "" {
+		if _, err = index.CreateSnapshot(*snapshotDir); err != nil {
+			glog.Errorf("CreateSnapshot %s: %v", *snapshotDir, err)
+			return exitCodeFatal
+		}
+		return exitCodeOK
+	}
+
+	if *exportDir != "" {
+		if *exportParts <= 0 {
+			glog.Error("exportpartition must be greater than 0")
+			return exitCodeFatal
+		}
+		if err = index.Export(*exportDir, uint32(*exportParts), *blockUntil, chanOsSignal); err != nil {
+			glog.Errorf("Export %s: %v", *exportDir, err)
+			return exitCodeFatal
+		}
+		return exitCodeOK
 	}
 
 	if *computeFeeStatsFlag {
@@ -235,6 +343,28 @@ func mainWithExitCode() int {
 		return exitCodeOK
 	}
 
+	if *reindexColumn != "" {
+		internalState.DbState = common.DbStateOpen
+		err = index.ReindexColumn(chain, *reindexColumn, *blockFrom, *blockUntil, chanOsSignal)
+		if err != nil && err != db.ErrOperationInterrupted {
+			glog.Error("reindex: ", err)
+			return exitCodeFatal
+		}
+		return exitCodeOK
+	}
+
+	// build or delete the rich list index according to the flag, the index is then maintained together with the balances
+	if err = index.SetRichList(*richList, chanOsSignal); err != nil {
+		glog.Error("richList: ", err)
+		return exitCodeFatal
+	}
+
+	// the silent payment tweaks are indexed from the next block, the older blocks can be indexed by -reindex=silentPayments
+	if err = index.SetSilentPayments(*silentPayments); err != nil {
+		glog.Error("silentPayments: ", err)
+		return exitCodeFatal
+	}
+
 	syncWorker, err = db.NewSyncWorker(index, chain, *syncWorkers, *syncChunk, *blockFrom, *dryRun, chanOsSignal, metrics, internalState)
 	if err != nil {
 		glog.Errorf("NewSyncWorker %v", err)
@@ -288,7 +418,7 @@ func mainWithExitCode() int {
 	if *synchronize {
 		internalState.SyncMode = true
 		internalState.InitialSync = true
-		if err := syncWorker.ResyncIndex(nil, true); err != nil {
+		if err := syncWorker.ResyncIndex(nil, nil, true); err != nil {
 			if err != db.ErrOperationInterrupted {
 				glog.Error("resyncIndex ", err)
 				return exitCodeFatal
@@ -314,14 +444,27 @@ func mainWithExitCode() int {
 		go syncIndexLoop()
 		go syncMempoolLoop()
 		internalState.InitialSync = false
+		columns := []string{"addresses"}
+		if chain.GetChainParser().GetChainType() == bchain.ChainBitcoinType {
+			columns = append(columns, "txAddresses")
+		}
+		if *dbCompactColumns != "" {
+			columns = strings.Split(*dbCompactColumns, ",")
+		}
+		if err = index.StartCompactionScheduler(time.Duration(*dbCompactPeriod)*time.Hour, columns); err != nil {
+			glog.Error("compaction: ", err)
+			return exitCodeFatal
+		}
 	}
 	go storeInternalStateLoop()
 
 	if publicServer != nil {
 		// start full public interface
 		callbacksOnNewBlock = append(callbacksOnNewBlock, publicServer.OnNewBlock)
+		callbacksOnReorg = append(callbacksOnReorg, publicServer.OnReorg)
 		callbacksOnNewTxAddr = append(callbacksOnNewTxAddr, publicServer.OnNewTxAddr)
 		callbacksOnNewTx = append(callbacksOnNewTx, publicServer.OnNewTx)
+		callbacksOnMempoolSync = append(callbacksOnMempoolSync, publicServer.OnMempoolSync)
 		callbacksOnNewFiatRatesTicker = append(callbacksOnNewFiatRatesTicker, publicServer.OnNewFiatRatesTicker)
 		publicServer.ConnectFullPublicInterface()
 	}
@@ -503,18 +646,40 @@ func newInternalState(coin, coinShortcut, coinLabel string, d *db.RocksDB, enabl
 }
 
 func syncIndexLoop() {
-	defer close(chanSyncIndexDone)
+	// the prune scans the whole columns, it runs in the background so that it does not delay the sync of new blocks
+	var pruneRunning int32
+	var pruneDone sync.WaitGroup
+	stopPrune := make(chan os.Signal, 1)
+	defer func() {
+		pruneDone.Wait()
+		signal.Stop(stopPrune)
+		close(chanSyncIndexDone)
+	}()
+	signal.Notify(stopPrune, syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 	glog.Info("syncIndexLoop starting")
 	// resync index about every 15 minutes if there are no chanSyncIndex requests, with debounce 1 second
 	common.TickAndDebounce(time.Duration(*resyncIndexPeriodMs)*time.Millisecond, debounceResyncIndexMs*time.Millisecond, chanSyncIndex, func() {
-		if err := syncWorker.ResyncIndex(onNewBlockHash, false); err != nil {
+		if err := syncWorker.ResyncIndex(onNewBlockHash, onReorg, false); err != nil {
 			glog.Error("syncIndexLoop ", errors.ErrorStack(err), ", will retry...")
 			// retry once in case of random network error, after a slight delay
 			time.Sleep(time.Millisecond * 2500)
-			if err := syncWorker.ResyncIndex(onNewBlockHash, false); err != nil {
+			if err := syncWorker.ResyncIndex(onNewBlockHash, onReorg, false); err != nil {
 				glog.Error("syncIndexLoop ", errors.ErrorStack(err))
+				return
 			}
 		}
+		if *pruneBlocks > 0 && atomic.CompareAndSwapInt32(&pruneRunning, 0, 1) {
+			pruneDone.Add(1)
+			go func() {
+				defer func() {
+					atomic.StoreInt32(&pruneRunning, 0)
+					pruneDone.Done()
+				}()
+				if err := index.PruneHistory(uint32(*pruneBlocks), stopPrune); err != nil {
+					glog.Error("syncIndexLoop PruneHistory ", err)
+				}
+			}()
+		}
 	})
 	glog.Info("syncIndexLoop stopped")
 }
@@ -530,6 +695,17 @@ func onNewBlockHash(hash string, height uint32) {
 	}
 }
 
+func onReorg(reorg *db.Reorg) {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Error("onReorg recovered from panic: ", r)
+		}
+	}()
+	for _, c := range callbacksOnReorg {
+		c(reorg)
+	}
+}
+
 func onNewFiatRatesTicker(ticker *common.CurrencyRatesTicker) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -552,7 +728,7 @@ func syncMempoolLoop() {
 			glog.Error("syncMempoolLoop ", errors.ErrorStack(err))
 		} else {
 			internalState.FinishedMempoolSync(count)
-
+			onMempoolSync()
 		}
 	})
 	glog.Info("syncMempoolLoop stopped")
@@ -626,6 +802,17 @@ func onNewTx(tx *bchain.MempoolTx) {
 	}
 }
 
+func onMempoolSync() {
+	defer func() {
+		if r := recover(); r != nil {
+			glog.Error("onMempoolSync recovered from panic: ", r)
+		}
+	}()
+	for _, c := range callbacksOnMempoolSync {
+		c()
+	}
+}
+
 func pushSynchronizationHandler(nt bchain.NotificationType) {
 	glog.V(1).Info("MQ: notification ", nt)
 	if common.IsInShutdown() {
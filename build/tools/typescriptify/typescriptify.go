@@ -28,6 +28,7 @@ func main() {
 	t.Add(api.Address{})
 	t.Add(api.Utxo{})
 	t.Add(api.BalanceHistory{})
+	t.Add(api.StakingInfo{})
 	t.Add(api.Blocks{})
 	t.Add(api.Block{})
 	t.Add(api.BlockRaw{})
@@ -46,6 +47,7 @@ func main() {
 	t.Add(server.WsBlockReq{})
 	t.Add(server.WsAccountUtxoReq{})
 	t.Add(server.WsBalanceHistoryReq{})
+	t.Add(server.WsStakingInfoReq{})
 	t.Add(server.WsTransactionReq{})
 	t.Add(server.WsTransactionSpecificReq{})
 	t.Add(server.WsEstimateFeeReq{})
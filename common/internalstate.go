@@ -29,6 +29,57 @@ type InternalStateColumn struct {
 	KeyBytes   int64     `json:"keyBytes"`
 	ValueBytes int64     `json:"valueBytes"`
 	Updated    time.Time `json:"updated"`
+	SizeOnDisk int64     `json:"sizeOnDisk,omitempty"`
+	Compacted  time.Time `json:"compacted"`
+}
+
+// MigrationState contains the progress of the migration of a db column to a new version
+type MigrationState struct {
+	Column      string    `json:"column"`
+	FromVersion uint32    `json:"fromVersion"`
+	LastKey     []byte    `json:"lastKey,omitempty"`
+	Rows        int64     `json:"rows"`
+	Started     time.Time `json:"started"`
+}
+
+// ReindexState contains the progress of the rebuild of a db column from the blocks of the backend
+type ReindexState struct {
+	Column string `json:"column"`
+	From   uint32 `json:"from"`
+	To     uint32 `json:"to"`
+	// Height is the next block to be reindexed
+	Height  uint32    `json:"height"`
+	Started time.Time `json:"started"`
+}
+
+// BulkCheckpoint is the last block stored completely by the bulk connect of the initial sync
+type BulkCheckpoint struct {
+	Height uint32    `json:"height"`
+	Hash   string    `json:"hash"`
+	Time   time.Time `json:"time"`
+}
+
+// ReorgDepthExceeded describes the fork of the index which could not be disconnected,
+// because the data needed to disconnect the forked blocks are not available
+type ReorgDepthExceeded struct {
+	// Height and Hash of the forked block of the index which could not be disconnected
+	Height uint32 `json:"height"`
+	Hash   string `json:"hash"`
+	// BestHeight is the best height of the index at the time the fork was found
+	BestHeight uint32    `json:"bestHeight"`
+	Error      string    `json:"error"`
+	Time       time.Time `json:"time"`
+}
+
+// BackendStatus contains the health statistics of one of the backend nodes
+type BackendStatus struct {
+	Name      string  `json:"name"`
+	Active    bool    `json:"active"`
+	Healthy   bool    `json:"healthy"`
+	Height    uint32  `json:"height,omitempty"`
+	LatencyMs float64 `json:"latencyMs"`
+	Errors    int     `json:"errors,omitempty"`
+	LastError string  `json:"lastError,omitempty"`
 }
 
 // BackendInfo is used to get information about blockchain
@@ -47,6 +98,9 @@ type BackendInfo struct {
 	Warnings         string      `json:"warnings,omitempty"`
 	ConsensusVersion string      `json:"consensus_version,omitempty"`
 	Consensus        interface{} `json:"consensus,omitempty"`
+	// the active backend and the statistics of the backends, only if more backends are configured
+	ActiveBackend string          `json:"activeBackend,omitempty"`
+	Backends      []BackendStatus `json:"backends,omitempty"`
 }
 
 // InternalState contains the data of the internal state
@@ -60,6 +114,18 @@ type InternalState struct {
 
 	DbState       uint32 `json:"dbState"`
 	ExtendedIndex bool   `json:"extendedIndex"`
+	StakingIndex  bool   `json:"stakingIndex,omitempty"`
+	// the addresses are indexed by balance in the richList column
+	RichList bool `json:"richList,omitempty"`
+	// the silent payment tweaks of the blocks are indexed in the silentPayments column from the block SilentPaymentsHeight
+	SilentPayments       bool   `json:"silentPayments,omitempty"`
+	SilentPaymentsHeight uint32 `json:"silentPaymentsHeight,omitempty"`
+	// history of the addresses below PruneHeight was deleted, 0 if the history is complete
+	PruneHeight uint32 `json:"pruneHeight,omitempty"`
+	// checkpoint of the running bulk connect, the db in inconsistent state is resumed from it
+	BulkCheckpoint *BulkCheckpoint `json:"bulkCheckpoint,omitempty"`
+	// set if the index is forked deeper than it is possible to disconnect, the index does not synchronize until the fork is resolved
+	ReorgDepthExceeded *ReorgDepthExceeded `json:"reorgDepthExceeded,omitempty"`
 
 	LastStore time.Time `json:"lastStore"`
 
@@ -79,6 +145,10 @@ type InternalState struct {
 	LastMempoolSync       time.Time `json:"lastMempoolSync"`
 
 	DbColumns []InternalStateColumn `json:"dbColumns"`
+	// progress of the running migration of a column, nil if no migration is in progress
+	Migration *MigrationState `json:"migration,omitempty"`
+	// progress of the running reindex of a column, nil if no reindex is in progress
+	Reindex *ReindexState `json:"reindex,omitempty"`
 
 	UtxoChecked bool `json:"utxoChecked"`
 
@@ -125,6 +195,20 @@ func (is *InternalState) FinishedSyncNoChange() {
 	is.IsSynchronized = true
 }
 
+// SetReorgDepthExceeded sets or with nil clears the state of the fork which could not be disconnected
+func (is *InternalState) SetReorgDepthExceeded(r *ReorgDepthExceeded) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	is.ReorgDepthExceeded = r
+}
+
+// GetReorgDepthExceeded returns the state of the fork which could not be disconnected, nil if there is no such fork
+func (is *InternalState) GetReorgDepthExceeded() *ReorgDepthExceeded {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	return is.ReorgDepthExceeded
+}
+
 // GetSyncState gets the state of synchronization
 func (is *InternalState) GetSyncState() (bool, uint32, time.Time, time.Time) {
 	is.mux.Lock()
@@ -177,6 +261,17 @@ func (is *InternalState) SetDBColumnStats(c int, rows int64, keyBytes int64, val
 	dc.Updated = time.Now()
 }
 
+// SetDBColumnCompacted sets the time of the last compaction of the column and its size on disk after the compaction
+func (is *InternalState) SetDBColumnCompacted(c int, sizeOnDisk int64) {
+	is.mux.Lock()
+	defer is.mux.Unlock()
+	if c < len(is.DbColumns) {
+		dc := &is.DbColumns[c]
+		dc.SizeOnDisk = sizeOnDisk
+		dc.Compacted = time.Now()
+	}
+}
+
 // GetDBColumnStatValues gets stat values for given column
 func (is *InternalState) GetDBColumnStatValues(c int) (int64, int64, int64) {
 	is.mux.Lock()
@@ -35,6 +35,7 @@ type Metrics struct {
 	WebsocketPendingRequests *prometheus.GaugeVec
 	SocketIOPendingRequests  *prometheus.GaugeVec
 	XPubCacheSize            prometheus.Gauge
+	ReorgDepthExceeded       prometheus.Gauge
 }
 
 // Labels represents a collection of label name -> value mappings.
@@ -255,6 +256,13 @@ func GetMetrics(coin string) (*Metrics, error) {
 			ConstLabels: Labels{"coin": coin},
 		},
 	)
+	metrics.ReorgDepthExceeded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name:        "blockbook_reorg_depth_exceeded",
+			Help:        "Set to 1 if the index is forked deeper than it is possible to disconnect",
+			ConstLabels: Labels{"coin": coin},
+		},
+	)
 
 	v := reflect.ValueOf(metrics)
 	for i := 0; i < v.NumField(); i++ {
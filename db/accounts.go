@@ -0,0 +1,251 @@
+package db
+
+import (
+	"math/big"
+
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// ErrAccountsNotSupported is returned by the registry of accounts of other than Bitcoin type coins
+var ErrAccountsNotSupported = errors.New("Accounts are supported only by Bitcoin type coins")
+
+// Account is a watch-only account registered for the continuous tracking of its addresses
+// The discovery state of a registered account is kept in the xpubCache column and it is never evicted.
+type Account struct {
+	// Descriptor is the xpub or the output descriptor of the account in the canonical form returned by ParseXpub
+	Descriptor string `json:"descriptor"`
+	Gap        int    `json:"gap"`
+	// Registered is the unix time of the registration
+	Registered int64 `json:"registered"`
+}
+
+// maxAccountChangesBlocks is the number of the last connected blocks for which the changes of the accounts are kept
+const maxAccountChangesBlocks = 16
+
+// AccountChange is the change of a registered account by a connected block
+type AccountChange struct {
+	Descriptor string
+	// Txids are the transactions of the account in the order of the block
+	Txids []string
+	// BalanceSat is the change of the confirmed balance of the account
+	BalanceSat big.Int
+	// NewUsedAddresses is the number of the addresses of the account used for the first time
+	NewUsedAddresses int
+}
+
+func packAccount(a *Account) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := make([]byte, 0, 16+len(a.Descriptor))
+	l := packVaruint(uint(a.Gap), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(a.Registered), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	return append(buf, a.Descriptor...)
+}
+
+func unpackAccount(buf []byte) (*Account, error) {
+	gap, l := unpackVaruint(buf)
+	if l <= 0 {
+		return nil, errors.New("Invalid account")
+	}
+	buf = buf[l:]
+	registered, l := unpackVaruint(buf)
+	if l <= 0 || l == len(buf) {
+		return nil, errors.New("Invalid account")
+	}
+	return &Account{
+		Descriptor: string(buf[l:]),
+		Gap:        int(gap),
+		Registered: int64(registered),
+	}, nil
+}
+
+func (d *RocksDB) getAccountByKey(key []byte) (*Account, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfAccounts], key)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return unpackAccount(buf)
+}
+
+// GetAccount returns the registered account of the xpub descriptor or nil if the account is not registered
+func (d *RocksDB) GetAccount(descriptor string) (*Account, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, ErrAccountsNotSupported
+	}
+	return d.getAccountByKey(xpubCacheKey(descriptor))
+}
+
+// GetAccounts returns all registered accounts
+func (d *RocksDB) GetAccounts() ([]Account, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, ErrAccountsNotSupported
+	}
+	accounts := make([]Account, 0)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAccounts])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		a, err := unpackAccount(it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *a)
+	}
+	return accounts, nil
+}
+
+// StoreAccount registers the account or updates the registered account
+func (d *RocksDB) StoreAccount(a *Account) error {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return ErrAccountsNotSupported
+	}
+	d.connectMux.RLock()
+	defer d.connectMux.RUnlock()
+	return d.db.PutCF(d.wo, d.cfh[cfAccounts], xpubCacheKey(a.Descriptor), packAccount(a))
+}
+
+// DeleteAccount unregisters the account, its xpub cache is then evicted as any other cached xpub
+func (d *RocksDB) DeleteAccount(descriptor string) error {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return ErrAccountsNotSupported
+	}
+	d.connectMux.RLock()
+	defer d.connectMux.RUnlock()
+	return d.db.DeleteCF(d.wo, d.cfh[cfAccounts], xpubCacheKey(descriptor))
+}
+
+// deriveAccountAddresses derives the addresses of the registered account of the cached xpub so that after the last used address
+// of each change index there is the gap of unused addresses, the same as the api does when the xpub is requested
+// The balances of the new addresses are taken from the balances of the connected block or from the db.
+// Returns the derived addresses with the balances changed by the connected block. It must be called with the xpubCacheMux locked.
+func (d *RocksDB) deriveAccountAddresses(a *Account, key []byte, xc *XpubCache, balances map[string]*AddrBalance, refs map[string][]xpubCacheRef) ([]bchain.AddressDescriptor, error) {
+	var err error
+	var xd *bchain.XpubDescriptor
+	var changed []bchain.AddressDescriptor
+	for i := range xc.Addresses {
+		for {
+			lastUsed := xc.LastUsed[i]
+			if lastUsed < 0 {
+				lastUsed = 0
+			}
+			from, to := len(xc.Addresses[i]), lastUsed+a.Gap+1
+			if from >= to {
+				break
+			}
+			if xd == nil {
+				if xd, err = d.chainParser.ParseXpub(a.Descriptor); err != nil {
+					return nil, err
+				}
+				if len(xd.ChangeIndexes) != len(xc.Addresses) {
+					return nil, errors.Errorf("Account %s does not match its xpub cache", a.Descriptor)
+				}
+			}
+			derived, err := d.chainParser.DeriveAddressDescriptorsFromTo(xd, xd.ChangeIndexes[i], uint32(from), uint32(to))
+			if err != nil {
+				return nil, err
+			}
+			for j, addrDesc := range derived {
+				ab, found := balances[string(addrDesc)]
+				if found {
+					changed = append(changed, addrDesc)
+				} else if ab, err = d.GetAddrDescBalance(addrDesc, AddressBalanceDetailNoUTXO); err != nil {
+					return nil, err
+				}
+				xc.SetAddress(i, from+j, addrDesc, ab)
+			}
+		}
+		if err := d.updateXpubCacheRefs(refs, key, xc.Addresses[i], i, xc.indexed[i], false); err != nil {
+			return nil, err
+		}
+		xc.indexed[i] = len(xc.Addresses[i])
+	}
+	return changed, nil
+}
+
+// computeAccountChanges returns the changes of the registered accounts by the connected block from their addresses changed by the block
+// It must be called before the block is written, the balances of the addresses before the block are read from the db.
+func (d *RocksDB) computeAccountChanges(block *bchain.Block, accounts map[string][]bchain.AddressDescriptor, addresses addressesMap, balances map[string]*AddrBalance) ([]AccountChange, error) {
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+	btxIDs := make([][]byte, len(block.Txs))
+	for i := range block.Txs {
+		btxID, err := d.chainParser.PackTxid(block.Txs[i].Txid)
+		if err != nil {
+			return nil, err
+		}
+		btxIDs[i] = btxID
+	}
+	changes := make([]AccountChange, 0, len(accounts))
+	for descriptor, addrDescs := range accounts {
+		ac := AccountChange{Descriptor: descriptor}
+		seen := make(map[string]struct{}, len(addrDescs))
+		txs := make(map[string]struct{})
+		for _, addrDesc := range addrDescs {
+			if _, found := seen[string(addrDesc)]; found {
+				continue
+			}
+			seen[string(addrDesc)] = struct{}{}
+			ab, found := balances[string(addrDesc)]
+			if !found {
+				continue
+			}
+			old, err := d.GetAddrDescBalance(addrDesc, AddressBalanceDetailNoUTXO)
+			if err != nil {
+				return nil, err
+			}
+			ac.BalanceSat.Add(&ac.BalanceSat, &ab.BalanceSat)
+			if old != nil {
+				ac.BalanceSat.Sub(&ac.BalanceSat, &old.BalanceSat)
+			}
+			if (old == nil || old.Txs == 0) && ab.Txs > 0 {
+				ac.NewUsedAddresses++
+			}
+			for _, t := range addresses[string(addrDesc)] {
+				txs[string(t.btxID)] = struct{}{}
+			}
+		}
+		for i, btxID := range btxIDs {
+			if _, found := txs[string(btxID)]; found {
+				ac.Txids = append(ac.Txids, block.Txs[i].Txid)
+			}
+		}
+		changes = append(changes, ac)
+	}
+	return changes, nil
+}
+
+// setAccountChanges keeps the changes of the accounts by the connected block,
+// the changes of the old blocks and of the blocks replaced by the connected block are dropped
+func (d *RocksDB) setAccountChanges(height uint32, changes []AccountChange) {
+	d.accountChangesMux.Lock()
+	defer d.accountChangesMux.Unlock()
+	for h := range d.accountChanges {
+		if h >= height || h+maxAccountChangesBlocks <= height {
+			delete(d.accountChanges, h)
+		}
+	}
+	if len(changes) > 0 {
+		if d.accountChanges == nil {
+			d.accountChanges = make(map[uint32][]AccountChange)
+		}
+		d.accountChanges[height] = changes
+	}
+}
+
+// GetAccountChanges returns the changes of the registered accounts by the connected block at the height,
+// the changes are kept only for the last connected blocks
+func (d *RocksDB) GetAccountChanges(height uint32) ([]AccountChange, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, ErrAccountsNotSupported
+	}
+	d.accountChangesMux.Lock()
+	defer d.accountChangesMux.Unlock()
+	return d.accountChanges[height], nil
+}
@@ -0,0 +1,140 @@
+//go:build unittest
+
+package db
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trezor/blockbook/bchain/coins/btc"
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func TestRocksDB_Accounts(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: btc.NewBitcoinParser(
+		btc.GetChainParams("test"),
+		&btc.Configuration{BlockAddressesToKeep: 1, XPubMagic: 70617039, XPubMagicSegwitP2sh: 71979618, XPubMagicSegwitNative: 73342198})})
+	defer closeAndDestroyRocksDB(t, d)
+	d.is.DbState = common.DbStateOpen
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	a := Account{Descriptor: dbtestdata.Xpub, Gap: 3, Registered: 1600000000}
+	if err := d.StoreAccount(&a); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.GetAccount(dbtestdata.Xpub); err != nil || !reflect.DeepEqual(got, &a) {
+		t.Errorf("GetAccount() = %+v, %v, want %+v", got, err, a)
+	}
+	if got, err := d.GetAccounts(); err != nil || !reflect.DeepEqual(got, []Account{a}) {
+		t.Errorf("GetAccounts() = %+v, %v, want %+v", got, err, a)
+	}
+
+	// the cache of the registered account discovered as by the api, the address m/49'/1'/33'/0/0 is used
+	xd, err := d.chainParser.ParseXpub(dbtestdata.Xpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xc := NewXpubCache(len(xd.ChangeIndexes))
+	for i, change := range xd.ChangeIndexes {
+		derived, err := d.chainParser.DeriveAddressDescriptorsFromTo(xd, change, 0, uint32(a.Gap+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for j, addrDesc := range derived {
+			ab, err := d.GetAddrDescBalance(addrDesc, AddressBalanceDetailNoUTXO)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xc.SetAddress(i, j, addrDesc, ab)
+		}
+	}
+	if err := d.StoreXpubCache(dbtestdata.Xpub, xc, 225493); err != nil {
+		t.Fatal(err)
+	}
+
+	// block2 uses the address m/49'/1'/33'/1/3, the last of the derived change addresses, the gap after it is derived
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	xc, err = d.GetXpubCache(dbtestdata.Xpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xc == nil {
+		t.Fatal("GetXpubCache() = nil")
+	}
+	if want := []int{0, 3}; !reflect.DeepEqual(xc.LastUsed, want) {
+		t.Errorf("LastUsed = %v, want %v", xc.LastUsed, want)
+	}
+	if len(xc.Addresses[0]) != 4 || len(xc.Addresses[1]) != 7 {
+		t.Fatalf("derived %d and %d addresses, want 4 and 7", len(xc.Addresses[0]), len(xc.Addresses[1]))
+	}
+	derived, err := d.chainParser.DeriveAddressDescriptorsFromTo(xd, 1, 6, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(xc.Addresses[1][6].AddrDesc, derived[0]) {
+		t.Errorf("address 1/6 = %v, want %v", xc.Addresses[1][6].AddrDesc, derived[0])
+	}
+
+	// block2 spends the output of m/49'/1'/33'/0/0 and sends to m/49'/1'/33'/1/3 in the same transaction
+	changes, err := d.GetAccountChanges(225494)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("GetAccountChanges() = %+v, want 1 change", changes)
+	}
+	var balance big.Int
+	balance.Sub(dbtestdata.SatB2T2A8, dbtestdata.SatB1T2A4)
+	if c := changes[0]; c.Descriptor != dbtestdata.Xpub || !reflect.DeepEqual(c.Txids, []string{dbtestdata.TxidB2T2}) ||
+		c.BalanceSat.Cmp(&balance) != 0 || c.NewUsedAddresses != 1 {
+		t.Errorf("GetAccountChanges() = %+v, want balance %v", c, balance.String())
+	}
+	if changes, err := d.GetAccountChanges(225493); err != nil || changes != nil {
+		t.Errorf("GetAccountChanges(225493) = %+v, %v, want nil", changes, err)
+	}
+	refs, err := d.getXpubCacheRefs(derived[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []xpubCacheRef{{key: xpubCacheKey(dbtestdata.Xpub), chain: 1, index: 6}}; !reflect.DeepEqual(refs, want) {
+		t.Errorf("getXpubCacheRefs() = %+v, want %+v", refs, want)
+	}
+
+	// the registered account is not evicted until it is unregistered
+	if n, err := d.EvictXpubCache(time.Now().Unix()+1, 0); err != nil || n != 0 {
+		t.Errorf("EvictXpubCache() = %d, %v, want 0", n, err)
+	}
+	if err := d.DeleteAccount(dbtestdata.Xpub); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.GetAccount(dbtestdata.Xpub); err != nil || got != nil {
+		t.Errorf("GetAccount() = %+v, %v, want nil", got, err)
+	}
+	if n, err := d.EvictXpubCache(time.Now().Unix()+1, 0); err != nil || n != 1 {
+		t.Errorf("EvictXpubCache() = %d, %v, want 1", n, err)
+	}
+}
+
+func Test_packAccount(t *testing.T) {
+	a := &Account{Descriptor: dbtestdata.Xpub, Gap: 20, Registered: 1600000000}
+	buf := packAccount(a)
+	got, err := unpackAccount(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, a) {
+		t.Errorf("unpackAccount() = %+v, want %+v", got, a)
+	}
+	for _, l := range []int{0, 1, 6} {
+		if _, err := unpackAccount(buf[:l]); err == nil {
+			t.Errorf("unpackAccount() of %d bytes did not fail", l)
+		}
+	}
+}
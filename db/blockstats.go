@@ -0,0 +1,145 @@
+package db
+
+import (
+	"math/big"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// BlockStats contains the aggregated statistics of the transactions and addresses of a block
+type BlockStats struct {
+	Height          uint32 // Height is not packed!
+	Time            int64
+	Txs             uint32
+	ActiveAddresses uint32
+	NewAddresses    uint32
+	// CoinsCreated is the amount of the outputs minus the amount of the inputs of all transactions in the block
+	CoinsCreated big.Int
+	// Fees is the sum of the fees of the transactions in the block, excluding coinbase and coinstake transactions
+	Fees big.Int
+}
+
+// computeBlockStats computes the statistics of the block from the data prepared by processAddressesBitcoinType
+func computeBlockStats(p bchain.BlockChainParser, block *bchain.Block, addresses addressesMap, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance) (*BlockStats, error) {
+	bs := &BlockStats{
+		Height:          block.Height,
+		Time:            block.Time,
+		Txs:             uint32(len(block.Txs)),
+		ActiveAddresses: uint32(len(addresses)),
+	}
+	for addrDesc := range addresses {
+		if ab := balances[addrDesc]; ab != nil && ab.FirstSeen == block.Height {
+			bs.NewAddresses++
+		}
+	}
+	var in, out, fee big.Int
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		btxID, err := p.PackTxid(tx.Txid)
+		if err != nil {
+			return nil, err
+		}
+		ta := txAddressesMap[string(btxID)]
+		if ta == nil {
+			return nil, errors.Errorf("computeBlockStats: height %d, tx %v not found", block.Height, tx.Txid)
+		}
+		in.SetInt64(0)
+		out.SetInt64(0)
+		for j := range ta.Inputs {
+			in.Add(&in, &ta.Inputs[j].ValueSat)
+		}
+		for j := range ta.Outputs {
+			out.Add(&out, &ta.Outputs[j].ValueSat)
+		}
+		bs.CoinsCreated.Add(&bs.CoinsCreated, &out)
+		bs.CoinsCreated.Sub(&bs.CoinsCreated, &in)
+		if len(tx.Vin) > 0 && tx.Vin[0].Coinbase == "" && !ta.IsCoinstake() {
+			fee.Sub(&in, &out)
+			if fee.Sign() > 0 {
+				bs.Fees.Add(&bs.Fees, &fee)
+			}
+		}
+	}
+	if bs.CoinsCreated.Sign() < 0 {
+		glog.Warningf("rocksdb: height %d, negative amount of created coins %v, resetting to 0", block.Height, bs.CoinsCreated.String())
+		bs.CoinsCreated.SetInt64(0)
+	}
+	return bs, nil
+}
+
+func packBlockStats(bs *BlockStats) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := make([]byte, 0, 64)
+	l := packVaruint(uint(bs.Time), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(bs.Txs), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(bs.ActiveAddresses), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(bs.NewAddresses), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packBigint(&bs.CoinsCreated, varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packBigint(&bs.Fees, varBuf)
+	return append(buf, varBuf[:l]...)
+}
+
+func unpackBlockStats(buf []byte) (*BlockStats, error) {
+	// 6 is minimum length of blockStats - 1 byte for each field
+	if len(buf) < 6 {
+		return nil, errors.New("Invalid blockStats")
+	}
+	bs := &BlockStats{}
+	t, l := unpackVaruint(buf)
+	bs.Time = int64(t)
+	txs, ll := unpackVaruint(buf[l:])
+	l += ll
+	bs.Txs = uint32(txs)
+	active, ll := unpackVaruint(buf[l:])
+	l += ll
+	bs.ActiveAddresses = uint32(active)
+	newAddresses, ll := unpackVaruint(buf[l:])
+	l += ll
+	bs.NewAddresses = uint32(newAddresses)
+	if len(buf) < l+2 {
+		return nil, errors.New("Invalid blockStats")
+	}
+	bs.CoinsCreated, ll = unpackBigint(buf[l:])
+	l += ll
+	if len(buf) <= l {
+		return nil, errors.New("Invalid blockStats")
+	}
+	bs.Fees, _ = unpackBigint(buf[l:])
+	return bs, nil
+}
+
+func (d *RocksDB) storeBlockStats(wb *grocksdb.WriteBatch, bs *BlockStats) {
+	wb.PutCF(d.cfh[cfBlockStats], packUint(bs.Height), packBlockStats(bs))
+}
+
+// GetBlockStats returns the statistics of the blocks in the range of heights from-to (inclusive)
+// The blocks connected before the blockStats column was created have no statistics and are skipped.
+func (d *RocksDB) GetBlockStats(from, to uint32) ([]BlockStats, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, errors.New("Block stats are supported only for bitcoin type chains")
+	}
+	var r []BlockStats
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBlockStats])
+	defer it.Close()
+	for it.Seek(packUint(from)); it.Valid(); it.Next() {
+		height := unpackUint(it.Key().Data())
+		if height > to {
+			break
+		}
+		bs, err := unpackBlockStats(it.Value().Data())
+		if err != nil {
+			return nil, errors.Annotatef(err, "height %d", height)
+		}
+		bs.Height = height
+		r = append(r, *bs)
+	}
+	return r, nil
+}
@@ -0,0 +1,122 @@
+//go:build unittest
+
+package db
+
+import (
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func Test_packBlockStats_unpackBlockStats(t *testing.T) {
+	bs := BlockStats{
+		Time:            1521595678,
+		Txs:             4,
+		ActiveAddresses: 9,
+		NewAddresses:    5,
+		CoinsCreated:    *big.NewInt(1360029047),
+		Fees:            *big.NewInt(1284),
+	}
+	want := "85d5c6ea1e0409050451106577020504"
+	buf := packBlockStats(&bs)
+	if got := hex.EncodeToString(buf); got != want {
+		t.Errorf("packBlockStats() = %v, want %v", got, want)
+	}
+	got, err := unpackBlockStats(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*got, bs) {
+		t.Errorf("unpackBlockStats() = %+v, want %+v", got, bs)
+	}
+	if _, err = unpackBlockStats(buf[:5]); err == nil {
+		t.Error("unpackBlockStats() of short data expected error")
+	}
+}
+
+// testBitcoinTypeBlockStats returns the expected statistics of the test blocks
+// the amounts are computed from the test data, the shared values may be modified by other tests
+func testBitcoinTypeBlockStats() (BlockStats, BlockStats) {
+	sum := func(a *big.Int, add []*big.Int, sub []*big.Int) {
+		for _, v := range add {
+			a.Add(a, v)
+		}
+		for _, v := range sub {
+			a.Sub(a, v)
+		}
+	}
+	block1 := BlockStats{
+		Height:          225493,
+		Time:            1521515026,
+		Txs:             2,
+		ActiveAddresses: 5,
+		NewAddresses:    5,
+	}
+	// the inputs of block1 are not in the index, all outputs are counted as created
+	sum(&block1.CoinsCreated, []*big.Int{dbtestdata.SatB1T1A1, dbtestdata.SatB1T1A2, dbtestdata.SatB1T1A2, dbtestdata.SatB1T2A3, dbtestdata.SatB1T2A4, dbtestdata.SatB1T2A5}, nil)
+	block2 := BlockStats{
+		Height:          225494,
+		Time:            1521595678,
+		Txs:             4,
+		ActiveAddresses: 9,
+		NewAddresses:    5,
+	}
+	// the spent outputs of block1 and block2 minus the outputs of the non coinbase transactions of block2
+	sum(&block2.Fees, []*big.Int{dbtestdata.SatB1T2A3, dbtestdata.SatB1T1A2, dbtestdata.SatB1T2A4, dbtestdata.SatB1T2A5},
+		[]*big.Int{dbtestdata.SatB2T1A7, dbtestdata.SatB2T2A8, dbtestdata.SatB2T2A9, dbtestdata.SatB2T3A5})
+	// the coinbase output minus the fees
+	sum(&block2.CoinsCreated, []*big.Int{dbtestdata.SatB2T4AA}, []*big.Int{&block2.Fees})
+	return block1, block2
+}
+
+func TestRocksDB_BlockStats(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	block1, block2 := testBitcoinTypeBlockStats()
+	tests := []struct {
+		name     string
+		from, to uint32
+		want     []BlockStats
+	}{
+		{name: "all", from: 0, to: 300000, want: []BlockStats{block1, block2}},
+		{name: "block1", from: 225493, to: 225493, want: []BlockStats{block1}},
+		{name: "block2", from: 225494, to: 225495, want: []BlockStats{block2}},
+		{name: "none", from: 225495, to: 300000, want: nil},
+	}
+	for _, tt := range tests {
+		got, err := d.GetBlockStats(tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: GetBlockStats() = %+v, want %+v", tt.name, got, tt.want)
+		}
+		for i := range got {
+			if got[i].Height != tt.want[i].Height || got[i].Time != tt.want[i].Time || got[i].Txs != tt.want[i].Txs ||
+				got[i].ActiveAddresses != tt.want[i].ActiveAddresses || got[i].NewAddresses != tt.want[i].NewAddresses ||
+				got[i].CoinsCreated.Cmp(&tt.want[i].CoinsCreated) != 0 || got[i].Fees.Cmp(&tt.want[i].Fees) != 0 {
+				t.Errorf("%s: GetBlockStats()[%d] = %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	if err := d.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	got, err := d.GetBlockStats(0, 300000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Height != 225493 {
+		t.Errorf("GetBlockStats() after disconnect = %+v, want only block1", got)
+	}
+}
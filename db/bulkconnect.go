@@ -1,11 +1,14 @@
 package db
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/juju/errors"
 	"github.com/linxGnu/grocksdb"
 	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
 )
 
 // bulk connect
@@ -13,10 +16,15 @@ import (
 // it speeds up the import in two ways:
 // 1) balances and txAddresses are modified several times during the import, there is a chance that the modifications are done before write to DB
 // 2) rocksdb seems to handle better fewer larger batches than continuous stream of smaller batches
+// the cached data are stored in checkpoints, in one batch together with the internal state recording the height of the last connected block
+// if the import is interrupted, the db is resumed from the last checkpoint by ResumeBulkConnect
 
 type bulkAddresses struct {
 	bi        BlockInfo
 	addresses addressesMap
+	stakes    stakesMap
+	spTweaks  *silentPaymentTweaks
+	stats     *BlockStats
 }
 
 // BulkConnect is used to connect blocks in bulk, faster but if interrupted inconsistent way
@@ -29,7 +37,18 @@ type BulkConnect struct {
 	txAddressesMap     map[string]*TxAddresses
 	balances           map[string]*AddrBalance
 	addressContracts   map[string]*AddrContracts
-	height             uint32
+	// keys of the cached data modified since the last checkpoint, only they are written by the next checkpoint
+	dirtyTxAddresses   map[string]struct{}
+	dirtyBalances      map[string]struct{}
+	dirtyAddrContracts map[string]struct{}
+	// cached data evicted by the checkpoint being written in the background by storeChan,
+	// they are removed from the cache once the write is done
+	storingTxAddresses   map[string]struct{}
+	storingBalances      map[string]struct{}
+	storingAddrContracts map[string]struct{}
+	storeChan            chan error
+	height               uint32
+	hash                 string
 }
 
 const (
@@ -45,11 +64,22 @@ const (
 // InitBulkConnect initializes bulk connect and switches DB to inconsistent state
 func (d *RocksDB) InitBulkConnect() (*BulkConnect, error) {
 	b := &BulkConnect{
-		d:                d,
-		chainType:        d.chainParser.GetChainType(),
-		txAddressesMap:   make(map[string]*TxAddresses),
-		balances:         make(map[string]*AddrBalance),
-		addressContracts: make(map[string]*AddrContracts),
+		d:                  d,
+		chainType:          d.chainParser.GetChainType(),
+		txAddressesMap:     make(map[string]*TxAddresses),
+		balances:           make(map[string]*AddrBalance),
+		addressContracts:   make(map[string]*AddrContracts),
+		dirtyTxAddresses:   make(map[string]struct{}),
+		dirtyBalances:      make(map[string]struct{}),
+		dirtyAddrContracts: make(map[string]struct{}),
+	}
+	if d.is != nil {
+		// the data stored before the bulk connect form the first checkpoint
+		height, hash, err := d.GetBestBlock()
+		if err != nil {
+			return nil, err
+		}
+		d.is.BulkCheckpoint = &common.BulkCheckpoint{Height: height, Hash: hash, Time: time.Now().UTC()}
 	}
 	if err := d.SetInconsistentState(true); err != nil {
 		return nil, err
@@ -58,102 +88,107 @@ func (d *RocksDB) InitBulkConnect() (*BulkConnect, error) {
 	return b, nil
 }
 
-func (b *BulkConnect) storeTxAddresses(wb *grocksdb.WriteBatch, all bool) (int, int, error) {
-	var txm map[string]*TxAddresses
-	var sp int
-	if all {
-		txm = b.txAddressesMap
-		b.txAddressesMap = make(map[string]*TxAddresses)
-	} else {
-		txm = make(map[string]*TxAddresses)
-		for k, a := range b.txAddressesMap {
-			// store all completely spent transactions, they will not be modified again
-			r := true
-			for _, o := range a.Outputs {
-				if o.Spent == false {
-					r = false
-					break
-				}
-			}
-			if r {
-				txm[k] = a
-				delete(b.txAddressesMap, k)
-			}
-		}
-		sp = len(txm)
-		// store some other random transactions if necessary
-		if len(txm) < partialStoreAddresses {
-			for k, a := range b.txAddressesMap {
-				txm[k] = a
-				delete(b.txAddressesMap, k)
-				if len(txm) >= partialStoreAddresses {
-					break
-				}
-			}
+// storeTxAddresses stores the txAddresses modified since the last checkpoint
+// if partial, it selects the txAddresses evicted from the cache after the write
+func (b *BulkConnect) storeTxAddresses(wb *grocksdb.WriteBatch, partial bool) (int, int, error) {
+	txm := make(map[string]*TxAddresses, len(b.dirtyTxAddresses))
+	for k := range b.dirtyTxAddresses {
+		if ta, found := b.txAddressesMap[k]; found {
+			txm[k] = ta
 		}
 	}
+	b.dirtyTxAddresses = make(map[string]struct{})
 	if err := b.d.storeTxAddresses(wb, txm); err != nil {
 		return 0, 0, err
 	}
-	return len(txm), sp, nil
-}
-
-func (b *BulkConnect) parallelStoreTxAddresses(c chan error, all bool) {
-	defer close(c)
-	start := time.Now()
-	wb := grocksdb.NewWriteBatch()
-	defer wb.Destroy()
-	count, sp, err := b.storeTxAddresses(wb, all)
-	if err != nil {
-		c <- err
-		return
+	if !partial || len(b.txAddressesMap)+partialStoreAddresses <= maxBulkTxAddresses {
+		return len(txm), 0, nil
 	}
-	if err := b.d.WriteBatch(wb); err != nil {
-		c <- err
-		return
+	b.storingTxAddresses = make(map[string]struct{})
+	for k, a := range b.txAddressesMap {
+		// evict all completely spent transactions, they will not be modified again
+		r := true
+		for _, o := range a.Outputs {
+			if !o.Spent {
+				r = false
+				break
+			}
+		}
+		if r {
+			b.storingTxAddresses[k] = struct{}{}
+		}
 	}
-	glog.Info("rocksdb: height ", b.height, ", stored ", count, " (", sp, " spent) txAddresses, ", len(b.txAddressesMap), " remaining, done in ", time.Since(start))
-	c <- nil
-}
-
-func (b *BulkConnect) storeBalances(wb *grocksdb.WriteBatch, all bool) (int, error) {
-	var bal map[string]*AddrBalance
-	if all {
-		bal = b.balances
-		b.balances = make(map[string]*AddrBalance)
-	} else {
-		bal = make(map[string]*AddrBalance)
-		// store some random balances
-		for k, a := range b.balances {
-			bal[k] = a
-			delete(b.balances, k)
-			if len(bal) >= partialStoreBalances {
+	// evict some other random transactions if necessary
+	if len(b.storingTxAddresses) < partialStoreAddresses {
+		for k := range b.txAddressesMap {
+			b.storingTxAddresses[k] = struct{}{}
+			if len(b.storingTxAddresses) >= partialStoreAddresses {
 				break
 			}
 		}
 	}
+	return len(txm), len(b.storingTxAddresses), nil
+}
+
+// storeBalances stores the balances modified since the last checkpoint
+// if partial, it selects the balances evicted from the cache after the write
+func (b *BulkConnect) storeBalances(wb *grocksdb.WriteBatch, partial bool) (int, int, error) {
+	bal := make(map[string]*AddrBalance, len(b.dirtyBalances))
+	for k := range b.dirtyBalances {
+		if ab, found := b.balances[k]; found {
+			bal[k] = ab
+		}
+	}
+	b.dirtyBalances = make(map[string]struct{})
 	if err := b.d.storeBalances(wb, bal); err != nil {
-		return 0, err
+		return 0, 0, err
+	}
+	// the api does not store the xpub cache in the inconsistent state of the bulk connect, the lock is not held until the write
+	b.d.xpubCacheMux.Lock()
+	_, err := b.d.updateXpubCache(wb, bal, false)
+	b.d.xpubCacheMux.Unlock()
+	if err != nil {
+		return 0, 0, err
 	}
-	return len(bal), nil
+	if !partial || len(b.balances)+partialStoreBalances <= maxBulkBalances {
+		return len(bal), 0, nil
+	}
+	// evict some random balances
+	b.storingBalances = make(map[string]struct{}, partialStoreBalances)
+	for k := range b.balances {
+		b.storingBalances[k] = struct{}{}
+		if len(b.storingBalances) >= partialStoreBalances {
+			break
+		}
+	}
+	return len(bal), len(b.storingBalances), nil
 }
 
-func (b *BulkConnect) parallelStoreBalances(c chan error, all bool) {
-	defer close(c)
-	start := time.Now()
-	wb := grocksdb.NewWriteBatch()
-	defer wb.Destroy()
-	count, err := b.storeBalances(wb, all)
-	if err != nil {
-		c <- err
-		return
+// storeAddressContracts stores the address contracts modified since the last checkpoint
+// if partial, it selects the address contracts evicted from the cache after the write
+func (b *BulkConnect) storeAddressContracts(wb *grocksdb.WriteBatch, partial bool) (int, int, error) {
+	ac := make(map[string]*AddrContracts, len(b.dirtyAddrContracts))
+	for k := range b.dirtyAddrContracts {
+		if c, found := b.addressContracts[k]; found {
+			ac[k] = c
+		}
 	}
-	if err := b.d.WriteBatch(wb); err != nil {
-		c <- err
-		return
+	b.dirtyAddrContracts = make(map[string]struct{})
+	if err := b.d.storeAddressContracts(wb, ac); err != nil {
+		return 0, 0, err
+	}
+	if !partial || len(b.addressContracts)+partialStoreAddrContracts <= maxBulkAddrContracts {
+		return len(ac), 0, nil
 	}
-	glog.Info("rocksdb: height ", b.height, ", stored ", count, " balances, ", len(b.balances), " remaining, done in ", time.Since(start))
-	c <- nil
+	// evict some random address contracts
+	b.storingAddrContracts = make(map[string]struct{}, partialStoreAddrContracts)
+	for k := range b.addressContracts {
+		b.storingAddrContracts[k] = struct{}{}
+		if len(b.storingAddrContracts) >= partialStoreAddrContracts {
+			break
+		}
+	}
+	return len(ac), len(b.storingAddrContracts), nil
 }
 
 func (b *BulkConnect) storeBulkAddresses(wb *grocksdb.WriteBatch) error {
@@ -161,33 +196,193 @@ func (b *BulkConnect) storeBulkAddresses(wb *grocksdb.WriteBatch) error {
 		if err := b.d.storeAddresses(wb, ba.bi.Height, ba.addresses); err != nil {
 			return err
 		}
+		if err := b.d.storeStakes(wb, ba.bi.Height, ba.stakes); err != nil {
+			return err
+		}
+		if ba.spTweaks != nil {
+			b.d.storeSilentPaymentTweaks(wb, ba.bi.Height, *ba.spTweaks)
+		}
 		if err := b.d.writeHeight(wb, ba.bi.Height, &ba.bi, opInsert); err != nil {
 			return err
 		}
+		if ba.stats != nil {
+			b.d.storeBlockStats(wb, ba.stats)
+		}
 	}
 	b.bulkAddressesCount = 0
 	b.bulkAddresses = b.bulkAddresses[:0]
 	return nil
 }
 
-func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs bool) error {
-	addresses := make(addressesMap)
-	if err := b.d.processAddressesBitcoinType(block, addresses, b.txAddressesMap, b.balances); err != nil {
+// storeCheckpoint stores the cached data modified since the last checkpoint and the internal state
+// with the checkpoint at the last connected block to the batch
+// The other cached data are already stored in db. If partial, some of the cached data are selected
+// for eviction, they stay in the cache until the batch is written, see finishStoreCheckpoint.
+func (b *BulkConnect) storeCheckpoint(wb *grocksdb.WriteBatch, partial bool) (string, error) {
+	bac := b.bulkAddressesCount
+	if err := b.storeBulkAddresses(wb); err != nil {
+		return "", err
+	}
+	var stored string
+	if b.chainType == bchain.ChainBitcoinType {
+		txs, etxs, err := b.storeTxAddresses(wb, partial)
+		if err != nil {
+			return "", err
+		}
+		bal, ebal, err := b.storeBalances(wb, partial)
+		if err != nil {
+			return "", err
+		}
+		stored = fmt.Sprint(bac, " addresses, ", txs, " txAddresses (", etxs, " evicted), ", bal, " balances (", ebal, " evicted)")
+	} else if b.chainType == bchain.ChainEthereumType {
+		if err := b.d.storeInternalDataEthereumType(wb, b.ethBlockTxs); err != nil {
+			return "", err
+		}
+		b.ethBlockTxs = b.ethBlockTxs[:0]
+		ac, eac, err := b.storeAddressContracts(wb, partial)
+		if err != nil {
+			return "", err
+		}
+		stored = fmt.Sprint(bac, " addresses, ", ac, " addressContracts (", eac, " evicted)")
+	}
+	if b.hash != "" {
+		b.d.is.BulkCheckpoint = &common.BulkCheckpoint{Height: b.height, Hash: b.hash, Time: time.Now().UTC()}
+	}
+	if err := b.d.storeStateToBatch(wb, b.d.is); err != nil {
+		return "", err
+	}
+	return stored, nil
+}
+
+// startStoreCheckpoint writes the checkpoint in the background, the connecting of the following blocks does not wait for the write
+// only one checkpoint is written at a time
+func (b *BulkConnect) startStoreCheckpoint(partial bool) error {
+	start := time.Now()
+	wb := grocksdb.NewWriteBatch()
+	stored, err := b.storeCheckpoint(wb, partial)
+	if err != nil {
+		wb.Destroy()
 		return err
 	}
-	var storeAddressesChan, storeBalancesChan chan error
-	var sa bool
-	if len(b.txAddressesMap) > maxBulkTxAddresses || len(b.balances) > maxBulkBalances {
-		sa = true
-		if len(b.txAddressesMap)+partialStoreAddresses > maxBulkTxAddresses {
-			storeAddressesChan = make(chan error)
-			go b.parallelStoreTxAddresses(storeAddressesChan, false)
+	height := b.height
+	c := make(chan error, 1)
+	go func() {
+		defer wb.Destroy()
+		err := b.d.WriteBatch(wb)
+		if err == nil {
+			glog.Info("rocksdb: height ", height, ", checkpoint stored ", stored, ", done in ", time.Since(start))
 		}
-		if len(b.balances)+partialStoreBalances > maxBulkBalances {
-			storeBalancesChan = make(chan error)
-			go b.parallelStoreBalances(storeBalancesChan, false)
+		c <- err
+	}()
+	b.storeChan = c
+	return nil
+}
+
+// finishStoreCheckpoint removes the data evicted by the checkpoint written in the background from the cache once the write is done
+// The data modified by the blocks connected during the write stay in the cache, the db contains their older version.
+func (b *BulkConnect) finishStoreCheckpoint(txids map[string]struct{}, addresses addressesMap, wait bool) error {
+	if b.storeChan == nil {
+		return nil
+	}
+	for k := range txids {
+		delete(b.storingTxAddresses, k)
+	}
+	for k := range addresses {
+		delete(b.storingBalances, k)
+		delete(b.storingAddrContracts, k)
+	}
+	var err error
+	if wait {
+		err = <-b.storeChan
+	} else {
+		select {
+		case err = <-b.storeChan:
+		default:
+			return nil
 		}
 	}
+	b.storeChan = nil
+	if err != nil {
+		return err
+	}
+	for k := range b.storingTxAddresses {
+		delete(b.txAddressesMap, k)
+	}
+	for k := range b.storingBalances {
+		delete(b.balances, k)
+	}
+	for k := range b.storingAddrContracts {
+		delete(b.addressContracts, k)
+	}
+	b.storingTxAddresses = nil
+	b.storingBalances = nil
+	b.storingAddrContracts = nil
+	return nil
+}
+
+// startStoreAddressContracts writes the checkpoint of Ethereum type chain in the background,
+// evicting some address contracts if the cache is full
+func (b *BulkConnect) startStoreAddressContracts(partial bool) error {
+	return b.startStoreCheckpoint(partial)
+}
+
+// finishStoreAddressContracts removes the address contracts evicted by the background write from the cache once the write is done
+func (b *BulkConnect) finishStoreAddressContracts(addresses addressesMap, wait bool) error {
+	return b.finishStoreCheckpoint(nil, addresses, wait)
+}
+
+// Checkpoint stores the cached data modified since the last checkpoint atomically with the height of the last connected block,
+// if the bulk connect is interrupted, it is resumed from the last checkpoint
+// The checkpoint is written in the background, the cached data stay in the cache.
+func (b *BulkConnect) Checkpoint() error {
+	if err := b.finishStoreCheckpoint(nil, nil, true); err != nil {
+		return err
+	}
+	return b.startStoreCheckpoint(false)
+}
+
+// markDirtyTxAddresses marks the txAddresses of the block transactions and of their inputs as modified
+func (b *BulkConnect) markDirtyTxAddresses(block *bchain.Block) map[string]struct{} {
+	p := b.d.chainParser
+	txids := make(map[string]struct{}, len(block.Txs))
+	for i := range block.Txs {
+		tx := &block.Txs[i]
+		if btxID, err := p.PackTxid(tx.Txid); err == nil {
+			txids[string(btxID)] = struct{}{}
+		}
+		for j := range tx.Vin {
+			if btxID, err := p.PackTxid(tx.Vin[j].Txid); err == nil {
+				txids[string(btxID)] = struct{}{}
+			}
+		}
+	}
+	for k := range txids {
+		b.dirtyTxAddresses[k] = struct{}{}
+	}
+	return txids
+}
+
+func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs bool) error {
+	addresses := make(addressesMap)
+	var stakes stakesMap
+	if b.d.chainParser.SupportsCoinstake() {
+		stakes = make(stakesMap)
+	}
+	spTweaks := b.d.newSilentPaymentTweaks()
+	if err := b.d.processAddressesBitcoinType(block, addresses, b.txAddressesMap, b.balances, stakes, spTweaks); err != nil {
+		return err
+	}
+	txids := b.markDirtyTxAddresses(block)
+	for k := range addresses {
+		b.dirtyBalances[k] = struct{}{}
+	}
+	if err := b.finishStoreCheckpoint(txids, addresses, false); err != nil {
+		return err
+	}
+	bs, err := computeBlockStats(b.d.chainParser, block, addresses, b.txAddressesMap, b.balances)
+	if err != nil {
+		return err
+	}
 	b.bulkAddresses = append(b.bulkAddresses, bulkAddresses{
 		bi: BlockInfo{
 			Hash:   block.Hash,
@@ -197,15 +392,19 @@ func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs
 			Height: block.Height,
 		},
 		addresses: addresses,
+		stakes:    stakes,
+		spTweaks:  spTweaks,
+		stats:     bs,
 	})
 	b.bulkAddressesCount += len(addresses)
-	// open WriteBatch only if going to write
-	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
+	// the addresses of the blocks can be stored between the checkpoints,
+	// they are stored again with the same value when the blocks after the checkpoint are connected again
+	if b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
 		start := time.Now()
 		wb := grocksdb.NewWriteBatch()
 		defer wb.Destroy()
 		bac := b.bulkAddressesCount
-		if sa || b.bulkAddressesCount > maxBulkAddresses {
+		if b.bulkAddressesCount > maxBulkAddresses {
 			if err := b.storeBulkAddresses(wb); err != nil {
 				return err
 			}
@@ -222,59 +421,14 @@ func (b *BulkConnect) connectBlockBitcoinType(block *bchain.Block, storeBlockTxs
 			glog.Info("rocksdb: height ", b.height, ", stored ", bac, " addresses, done in ", time.Since(start))
 		}
 	}
-	if storeAddressesChan != nil {
-		if err := <-storeAddressesChan; err != nil {
-			return err
-		}
-	}
-	if storeBalancesChan != nil {
-		if err := <-storeBalancesChan; err != nil {
-			return err
-		}
+	// txAddresses and balances are modified by the following blocks, they are stored only in the checkpoint,
+	// when the cache is full, the checkpoint evicts some of them, only one checkpoint is written in the background at a time
+	if b.storeChan == nil && (len(b.txAddressesMap) > maxBulkTxAddresses || len(b.balances) > maxBulkBalances) {
+		return b.startStoreCheckpoint(true)
 	}
 	return nil
 }
 
-func (b *BulkConnect) storeAddressContracts(wb *grocksdb.WriteBatch, all bool) (int, error) {
-	var ac map[string]*AddrContracts
-	if all {
-		ac = b.addressContracts
-		b.addressContracts = make(map[string]*AddrContracts)
-	} else {
-		ac = make(map[string]*AddrContracts)
-		// store some random address contracts
-		for k, a := range b.addressContracts {
-			ac[k] = a
-			delete(b.addressContracts, k)
-			if len(ac) >= partialStoreAddrContracts {
-				break
-			}
-		}
-	}
-	if err := b.d.storeAddressContracts(wb, ac); err != nil {
-		return 0, err
-	}
-	return len(ac), nil
-}
-
-func (b *BulkConnect) parallelStoreAddressContracts(c chan error, all bool) {
-	defer close(c)
-	start := time.Now()
-	wb := grocksdb.NewWriteBatch()
-	defer wb.Destroy()
-	count, err := b.storeAddressContracts(wb, all)
-	if err != nil {
-		c <- err
-		return
-	}
-	if err := b.d.WriteBatch(wb); err != nil {
-		c <- err
-		return
-	}
-	glog.Info("rocksdb: height ", b.height, ", stored ", count, " addressContracts, ", len(b.addressContracts), " remaining, done in ", time.Since(start))
-	c <- nil
-}
-
 func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTxs bool) error {
 	addresses := make(addressesMap)
 	blockTxs, err := b.d.processAddressesEthereumType(block, addresses, b.addressContracts)
@@ -282,12 +436,11 @@ func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTx
 		return err
 	}
 	b.ethBlockTxs = append(b.ethBlockTxs, blockTxs...)
-	var storeAddrContracts chan error
-	var sa bool
-	if len(b.addressContracts) > maxBulkAddrContracts {
-		sa = true
-		storeAddrContracts = make(chan error)
-		go b.parallelStoreAddressContracts(storeAddrContracts, false)
+	for k := range addresses {
+		b.dirtyAddrContracts[k] = struct{}{}
+	}
+	if err = b.finishStoreAddressContracts(addresses, false); err != nil {
+		return err
 	}
 	b.bulkAddresses = append(b.bulkAddresses, bulkAddresses{
 		bi: BlockInfo{
@@ -301,12 +454,12 @@ func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTx
 	})
 	b.bulkAddressesCount += len(addresses)
 	// open WriteBatch only if going to write
-	if sa || b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
+	if b.bulkAddressesCount > maxBulkAddresses || storeBlockTxs {
 		start := time.Now()
 		wb := grocksdb.NewWriteBatch()
 		defer wb.Destroy()
 		bac := b.bulkAddressesCount
-		if sa || b.bulkAddressesCount > maxBulkAddresses {
+		if b.bulkAddressesCount > maxBulkAddresses {
 			if err = b.storeBulkAddresses(wb); err != nil {
 				return err
 			}
@@ -343,10 +496,9 @@ func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTx
 			}
 		}
 	}
-	if storeAddrContracts != nil {
-		if err := <-storeAddrContracts; err != nil {
-			return err
-		}
+	// only one checkpoint is written in the background at a time
+	if b.storeChan == nil && len(b.addressContracts) > maxBulkAddrContracts {
+		return b.startStoreAddressContracts(true)
 	}
 	return nil
 }
@@ -354,6 +506,7 @@ func (b *BulkConnect) connectBlockEthereumType(block *bchain.Block, storeBlockTx
 // ConnectBlock connects block in bulk mode
 func (b *BulkConnect) ConnectBlock(block *bchain.Block, storeBlockTxs bool) error {
 	b.height = block.Height
+	b.hash = block.Hash
 	if b.chainType == bchain.ChainBitcoinType {
 		return b.connectBlockBitcoinType(block, storeBlockTxs)
 	} else if b.chainType == bchain.ChainEthereumType {
@@ -368,41 +521,19 @@ func (b *BulkConnect) ConnectBlock(block *bchain.Block, storeBlockTxs bool) erro
 func (b *BulkConnect) Close() error {
 	glog.Info("rocksdb: bulk connect closing")
 	start := time.Now()
-	var storeTxAddressesChan, storeBalancesChan, storeAddressContractsChan chan error
-	if b.chainType == bchain.ChainBitcoinType {
-		storeTxAddressesChan = make(chan error)
-		go b.parallelStoreTxAddresses(storeTxAddressesChan, true)
-		storeBalancesChan = make(chan error)
-		go b.parallelStoreBalances(storeBalancesChan, true)
-	} else if b.chainType == bchain.ChainEthereumType {
-		storeAddressContractsChan = make(chan error)
-		go b.parallelStoreAddressContracts(storeAddressContractsChan, true)
+	if err := b.finishStoreCheckpoint(nil, nil, true); err != nil {
+		return err
 	}
 	wb := grocksdb.NewWriteBatch()
 	defer wb.Destroy()
-	bac := b.bulkAddressesCount
-	if err := b.storeBulkAddresses(wb); err != nil {
+	stored, err := b.storeCheckpoint(wb, false)
+	if err != nil {
 		return err
 	}
 	if err := b.d.WriteBatch(wb); err != nil {
 		return err
 	}
-	glog.Info("rocksdb: height ", b.height, ", stored ", bac, " addresses, done in ", time.Since(start))
-	if storeTxAddressesChan != nil {
-		if err := <-storeTxAddressesChan; err != nil {
-			return err
-		}
-	}
-	if storeBalancesChan != nil {
-		if err := <-storeBalancesChan; err != nil {
-			return err
-		}
-	}
-	if storeAddressContractsChan != nil {
-		if err := <-storeAddressContractsChan; err != nil {
-			return err
-		}
-	}
+	glog.Info("rocksdb: height ", b.height, ", stored ", stored, ", done in ", time.Since(start))
 	bt, err := b.d.loadBlockTimes()
 	if err != nil {
 		return err
@@ -412,6 +543,7 @@ func (b *BulkConnect) Close() error {
 		b.d.metrics.AvgBlockPeriod.Set(float64(avg))
 	}
 
+	b.d.is.BulkCheckpoint = nil
 	if err := b.d.SetInconsistentState(false); err != nil {
 		return err
 	}
@@ -419,3 +551,103 @@ func (b *BulkConnect) Close() error {
 	b.d = nil
 	return nil
 }
+
+// ResumeBulkConnect removes the data of the blocks stored after the last checkpoint of the interrupted bulk connect
+// and switches DB from inconsistent state to open, the sync then continues from the block following the checkpoint
+// The addresses of the blocks after the checkpoint stay in db, they are overwritten when the blocks are connected again.
+// The balances, txAddresses, address contracts and the rich list are written only by the checkpoints, they match the checkpoint.
+// If the backend reorganized the stored blocks while the import was interrupted, the resume is refused,
+// the data of the orphaned blocks would not be overwritten.
+func (d *RocksDB) ResumeBulkConnect(chain bchain.BlockChain) error {
+	if d.is == nil {
+		return errors.New("Internal state not created")
+	}
+	cp := d.is.BulkCheckpoint
+	if d.is.DbState != common.DbStateInconsistent || cp == nil {
+		return errors.New("No checkpoint of bulk connect to resume from")
+	}
+	var from uint32
+	if cp.Hash != "" {
+		from = cp.Height + 1
+	}
+	glog.Info("rocksdb: resuming bulk connect from the checkpoint at height ", cp.Height, " ", cp.Hash, " stored at ", cp.Time)
+	if err := d.checkStoredBlocksFrom(chain, cp.Height); err != nil {
+		return err
+	}
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	// keys of the columns are the heights packed as uint32, the end of the range is behind the maximum height
+	end := []byte{0xff, 0xff, 0xff, 0xff, 0xff}
+	wb.DeleteRangeCF(d.cfh[cfHeight], packUint(from), end)
+	wb.DeleteRangeCF(d.cfh[cfBlockTxs], packUint(from), end)
+	if d.chainParser.GetChainType() == bchain.ChainBitcoinType {
+		wb.DeleteRangeCF(d.cfh[cfBlockStats], packUint(from), end)
+		wb.DeleteRangeCF(d.cfh[cfSilentPayments], packUint(from), end)
+		if d.chainParser.SupportsCoinstake() {
+			if err := d.deleteStakesFrom(wb, from); err != nil {
+				return err
+			}
+		}
+	} else if d.chainParser.GetChainType() == bchain.ChainEthereumType {
+		wb.DeleteRangeCF(d.cfh[cfBlockInternalDataErrors], packUint(from), end)
+	}
+	if err := d.WriteBatch(wb); err != nil {
+		return err
+	}
+	_, hash, err := d.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	if hash != cp.Hash {
+		return errors.Errorf("Best block %s does not match the checkpoint %s", hash, cp.Hash)
+	}
+	d.is.BulkCheckpoint = nil
+	return d.SetInconsistentState(false)
+}
+
+// checkStoredBlocksFrom checks that the blocks stored from the given height are in the main chain of the backend
+func (d *RocksDB) checkStoredBlocksFrom(chain bchain.BlockChain, from uint32) error {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeight])
+	defer it.Close()
+	for it.Seek(packUint(from)); it.Valid(); it.Next() {
+		height := unpackUint(it.Key().Data())
+		info, err := d.unpackBlockInfo(it.Value().Data())
+		if err != nil {
+			return err
+		}
+		hash, err := chain.GetBlockHash(height)
+		if err != nil && err != bchain.ErrBlockNotFound {
+			return err
+		}
+		if info == nil || hash != info.Hash {
+			return errors.Errorf("Stored block %d does not match the backend block %s, the bulk connect cannot be resumed, restart the initial sync", height, hash)
+		}
+	}
+	return it.Err()
+}
+
+// deleteStakesFrom deletes the stakes of the blocks from the given height
+// the stakes are keyed by address and height from the newest block, the stakes from the height
+// are the first keys of each address, the rest of the stakes of the address is skipped
+func (d *RocksDB) deleteStakesFrom(wb *grocksdb.WriteBatch, from uint32) error {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfStakes])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); {
+		addrDesc, height, err := unpackAddressKey(it.Key().Data())
+		if err != nil {
+			return err
+		}
+		addrDesc = append(bchain.AddressDescriptor(nil), addrDesc...)
+		// the key behind the last stake of the address
+		next := append(append(bchain.AddressDescriptor(nil), addrDesc...), 0xff, 0xff, 0xff, 0xff, 0xff)
+		if height >= from {
+			end := next
+			if from > 0 {
+				end = packAddressKey(addrDesc, from-1)
+			}
+			wb.DeleteRangeCF(d.cfh[cfStakes], packAddressKey(addrDesc, ^uint32(0)), end)
+		}
+		it.Seek(next)
+	}
+	return it.Err()
+}
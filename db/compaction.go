@@ -0,0 +1,289 @@
+package db
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+)
+
+// compactionSlices is the number of key ranges between the first and the last key in which a column is compacted
+const compactionSlices = 16
+
+// compactionCheckLoad is the period of the check if the load is low enough to compact the next slice
+var compactionCheckLoad = 10 * time.Second
+
+// compactAfterDisconnectBlocks is the number of disconnected blocks after which the compaction of the address columns is scheduled
+const compactAfterDisconnectBlocks = 10
+
+// CompactionStatus describes the progress of the compaction of the db columns
+type CompactionStatus struct {
+	Running  bool      `json:"running"`
+	Column   string    `json:"column,omitempty"`
+	Slice    int       `json:"slice,omitempty"`
+	Slices   int       `json:"slices,omitempty"`
+	Pending  []string  `json:"pending,omitempty"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+type compactionScheduler struct {
+	mux     sync.Mutex
+	status  CompactionStatus
+	pending []int
+	trigger chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newCompactionScheduler() *compactionScheduler {
+	return &compactionScheduler{trigger: make(chan struct{}, 1)}
+}
+
+// addPending adds the columns which are not already pending, the caller must hold the lock
+func (cs *compactionScheduler) addPending(cols []int) {
+	for _, c := range cols {
+		found := false
+		for _, p := range cs.pending {
+			if p == c {
+				found = true
+				break
+			}
+		}
+		if !found {
+			cs.pending = append(cs.pending, c)
+		}
+	}
+}
+
+func columnIndexes(columns []string) ([]int, error) {
+	r := make([]int, 0, len(columns))
+	for _, name := range columns {
+		c := -1
+		for i := range cfNames {
+			if cfNames[i] == name {
+				c = i
+				break
+			}
+		}
+		if c < 0 {
+			return nil, errors.Errorf("Unknown column '%v'", name)
+		}
+		r = append(r, c)
+	}
+	return r, nil
+}
+
+// ScheduleCompaction adds the columns to the queue of the compaction scheduler
+func (d *RocksDB) ScheduleCompaction(columns []string) error {
+	cols, err := columnIndexes(columns)
+	if err != nil {
+		return err
+	}
+	return d.scheduleCompaction(cols)
+}
+
+func (d *RocksDB) scheduleCompaction(cols []int) error {
+	cs := d.compaction
+	cs.mux.Lock()
+	if cs.stop == nil {
+		cs.mux.Unlock()
+		return errors.New("Compaction scheduler is not running")
+	}
+	cs.addPending(cols)
+	cs.mux.Unlock()
+	select {
+	case cs.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// GetCompactionStatus returns the status of the compaction scheduler
+func (d *RocksDB) GetCompactionStatus() CompactionStatus {
+	cs := d.compaction
+	cs.mux.Lock()
+	defer cs.mux.Unlock()
+	s := cs.status
+	s.Pending = make([]string, len(cs.pending))
+	for i, c := range cs.pending {
+		s.Pending[i] = cfNames[c]
+	}
+	return s
+}
+
+// StartCompactionScheduler starts the compaction of the scheduled columns in the background
+// If period is not zero, the columns are scheduled for compaction periodically.
+// The compaction of each slice of a column waits until the index is synchronized.
+func (d *RocksDB) StartCompactionScheduler(period time.Duration, columns []string) error {
+	cols, err := columnIndexes(columns)
+	if err != nil {
+		return err
+	}
+	cs := d.compaction
+	cs.mux.Lock()
+	if cs.stop != nil {
+		cs.mux.Unlock()
+		return errors.New("Compaction scheduler is already running")
+	}
+	cs.stop = make(chan struct{})
+	cs.done = make(chan struct{})
+	stop, done := cs.stop, cs.done
+	cs.mux.Unlock()
+	glog.Info("compaction: scheduler starting with period ", period, ", columns ", columns)
+	go d.compactionLoop(period, cols, stop, done)
+	return nil
+}
+
+func (d *RocksDB) stopCompactionScheduler() {
+	cs := d.compaction
+	cs.mux.Lock()
+	stop, done := cs.stop, cs.done
+	cs.stop = nil
+	cs.mux.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (d *RocksDB) compactionLoop(period time.Duration, cols []int, stop chan struct{}, done chan struct{}) {
+	cs := d.compaction
+	defer close(done)
+	var tick <-chan time.Time
+	if period > 0 {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-stop:
+			glog.Info("compaction: scheduler stopped")
+			return
+		case <-tick:
+			cs.mux.Lock()
+			cs.addPending(cols)
+			cs.mux.Unlock()
+		case <-cs.trigger:
+		}
+		for {
+			cs.mux.Lock()
+			if len(cs.pending) == 0 {
+				cs.mux.Unlock()
+				break
+			}
+			c := cs.pending[0]
+			cs.pending = cs.pending[1:]
+			cs.mux.Unlock()
+			if !d.compactColumn(c, stop) {
+				return
+			}
+		}
+	}
+}
+
+// isLowLoad returns true if the index is synchronized, the compaction would slow down the sync
+func (d *RocksDB) isLowLoad() bool {
+	if d.is == nil || d.is.InitialSync {
+		return false
+	}
+	synchronized, _, _, _ := d.is.GetSyncState()
+	return synchronized
+}
+
+// compactColumn compacts the column in slices, returns false if the scheduler was stopped
+func (d *RocksDB) compactColumn(c int, stop chan struct{}) bool {
+	cs := d.compaction
+	start := time.Now()
+	bounds := d.compactionBounds(c)
+	slices := len(bounds) + 1
+	cs.mux.Lock()
+	cs.status = CompactionStatus{Running: true, Column: cfNames[c], Slices: slices, Started: start}
+	cs.mux.Unlock()
+	sizeBefore, _ := d.db.GetIntPropertyCF("rocksdb.total-sst-files-size", d.cfh[c])
+	glog.Info("compaction: column ", cfNames[c], " starting, size ", sizeBefore)
+	for i := 0; i < slices; i++ {
+		for !d.isLowLoad() {
+			select {
+			case <-stop:
+				return false
+			case <-time.After(compactionCheckLoad):
+			}
+		}
+		select {
+		case <-stop:
+			return false
+		default:
+		}
+		cs.mux.Lock()
+		cs.status.Slice = i + 1
+		cs.mux.Unlock()
+		var r grocksdb.Range
+		if i > 0 {
+			r.Start = bounds[i-1]
+		}
+		if i < slices-1 {
+			r.Limit = bounds[i]
+		}
+		d.db.CompactRangeCF(d.cfh[c], r)
+	}
+	sizeAfter, _ := d.db.GetIntPropertyCF("rocksdb.total-sst-files-size", d.cfh[c])
+	if d.is != nil {
+		d.is.SetDBColumnCompacted(c, int64(sizeAfter))
+	}
+	cs.mux.Lock()
+	cs.status.Running = false
+	cs.status.Finished = time.Now()
+	cs.mux.Unlock()
+	glog.Info("compaction: column ", cfNames[c], " finished in ", time.Since(start), ", size ", sizeBefore, " -> ", sizeAfter)
+	return true
+}
+
+// compactionBounds returns the keys splitting the column to the slices of the compaction
+// The slices are taken by the size of the sst files of the column, the keys of the addresses are not distributed evenly.
+func (d *RocksDB) compactionBounds(c int) [][]byte {
+	var files []grocksdb.LiveFileMetadata
+	for _, f := range d.db.GetLiveFilesMetaData() {
+		if f.ColumnFamilyName == cfNames[c] {
+			files = append(files, f)
+		}
+	}
+	return splitSstFiles(files, compactionSlices)
+}
+
+// splitSstFiles returns at most n-1 increasing keys splitting the sst files ordered by their smallest keys to n parts of similar size
+// The bounds are the smallest keys of the files. The files overlap, especially in the level 0,
+// each file is counted in the part of its smallest key.
+func splitSstFiles(files []grocksdb.LiveFileMetadata, n int) [][]byte {
+	if n < 2 || len(files) < 2 {
+		return nil
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return bytes.Compare(files[i].SmallestKey, files[j].SmallestKey) < 0
+	})
+	var total int64
+	for i := range files {
+		total += files[i].Size
+	}
+	var r [][]byte
+	var size int64
+	for i := 1; i < len(files) && len(r) < n-1; i++ {
+		size += files[i-1].Size
+		if size*int64(n) < total*int64(len(r)+1) {
+			continue
+		}
+		last := files[0].SmallestKey
+		if len(r) > 0 {
+			last = r[len(r)-1]
+		}
+		if bytes.Compare(files[i].SmallestKey, last) > 0 {
+			r = append(r, files[i].SmallestKey)
+		}
+	}
+	return r
+}
@@ -0,0 +1,118 @@
+//go:build unittest
+
+package db
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func TestRocksDB_Compaction(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.ScheduleCompaction([]string{"addresses"}); err == nil {
+		t.Error("ScheduleCompaction() without running scheduler expected error")
+	}
+	if err := d.StartCompactionScheduler(0, []string{"addresses", "txAddresses"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ScheduleCompaction([]string{"unknown"}); err == nil {
+		t.Error("ScheduleCompaction(unknown) expected error")
+	}
+	// the compaction waits until the index is synchronized
+	compactionCheckLoad = 10 * time.Millisecond
+	d.is.StartedSync()
+	if err := d.ScheduleCompaction([]string{"txAddresses", "txAddresses"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	s := d.GetCompactionStatus()
+	if !s.Running || s.Column != "txAddresses" || s.Slice != 0 || len(s.Pending) != 0 {
+		t.Errorf("GetCompactionStatus() = %+v, want waiting txAddresses", s)
+	}
+	d.is.FinishedSyncNoChange()
+	for i := 0; ; i++ {
+		s = d.GetCompactionStatus()
+		if !s.Running {
+			break
+		}
+		if i > 200 {
+			t.Fatalf("compaction not finished, status %+v", s)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if s.Column != "txAddresses" || s.Slices == 0 || s.Slice != s.Slices || s.Finished.IsZero() {
+		t.Errorf("GetCompactionStatus() = %+v", s)
+	}
+	columns := d.is.GetAllDBColumnStats()
+	if columns[cfTxAddresses].Compacted.IsZero() {
+		t.Error("the time of the compaction was not stored to the internal state")
+	}
+	if !columns[cfAddresses].Compacted.IsZero() {
+		t.Error("addresses were not scheduled for compaction")
+	}
+}
+
+func Test_splitSstFiles(t *testing.T) {
+	file := func(key uint32, size int64) grocksdb.LiveFileMetadata {
+		return grocksdb.LiveFileMetadata{SmallestKey: packUint(key), LargestKey: packUint(key + 99), Size: size}
+	}
+	tests := []struct {
+		name  string
+		files []grocksdb.LiveFileMetadata
+		n     int
+		want  [][]byte
+	}{
+		{
+			name:  "same size",
+			files: []grocksdb.LiveFileMetadata{file(300, 10), file(0, 10), file(200, 10), file(100, 10)},
+			n:     2,
+			want:  [][]byte{packUint(200)},
+		},
+		{
+			name:  "by size",
+			files: []grocksdb.LiveFileMetadata{file(0, 10), file(100, 20), file(200, 30), file(300, 10), file(400, 20), file(500, 30)},
+			n:     4,
+			want:  [][]byte{packUint(200), packUint(300), packUint(500)},
+		},
+		{
+			name:  "large first file",
+			files: []grocksdb.LiveFileMetadata{file(0, 100), file(100, 1), file(200, 1), file(300, 1)},
+			n:     16,
+			want:  [][]byte{packUint(100), packUint(200), packUint(300)},
+		},
+		{
+			name:  "overlapping files",
+			files: []grocksdb.LiveFileMetadata{file(0, 10), file(0, 10), file(100, 10), file(100, 10), file(200, 10), file(200, 10)},
+			n:     6,
+			want:  [][]byte{packUint(100), packUint(200)},
+		},
+		{
+			name:  "single file",
+			files: []grocksdb.LiveFileMetadata{file(0, 10)},
+			n:     16,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSstFiles(tt.files, tt.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSstFiles() = %x, want %x", got, tt.want)
+			}
+			for i := range got {
+				if i > 0 && bytes.Compare(got[i], got[i-1]) <= 0 {
+					t.Errorf("splitSstFiles() key %x out of order", got[i])
+				}
+			}
+		})
+	}
+}
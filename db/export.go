@@ -0,0 +1,459 @@
+package db
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+)
+
+const exportStateFile = "export.json"
+const exportTmpSuffix = ".tmp"
+
+var exportHeaders = map[string][]string{
+	"blocks":   {"height", "hash", "time", "txs", "size"},
+	"inputs":   {"height", "txid", "index", "address", "addr_desc", "value", "prev_txid", "prev_vout"},
+	"outputs":  {"height", "txid", "index", "address", "addr_desc", "value", "spent", "spent_txid", "spent_index", "spent_height"},
+	"balances": {"address", "addr_desc", "txs", "sent", "received", "balance", "utxos"},
+}
+
+// exportState is stored in the export directory so that the next export continues where the previous one finished
+type exportState struct {
+	Coin       string    `json:"coin"`
+	NextHeight uint32    `json:"nextHeight"`
+	Updated    time.Time `json:"updated"`
+}
+
+type exportFile struct {
+	f *os.File
+	b *bufio.Writer
+	w *csv.Writer
+}
+
+// exportPartition are the csv files of one partition of the exported blocks
+type exportPartition struct {
+	dir        string
+	start, end uint32
+	files      map[string]*exportFile
+}
+
+func createExportFile(dir, name string, header []string) (*exportFile, error) {
+	f, err := os.Create(filepath.Join(dir, name+exportTmpSuffix))
+	if err != nil {
+		return nil, err
+	}
+	b := bufio.NewWriterSize(f, 1<<20)
+	ef := &exportFile{f: f, b: b, w: csv.NewWriter(b)}
+	return ef, ef.w.Write(header)
+}
+
+// close flushes and closes the file, if commit is true, the temporary file is renamed to its final name
+func (ef *exportFile) close(dir, name string, commit bool) error {
+	ef.w.Flush()
+	err := ef.w.Error()
+	if err == nil {
+		err = ef.b.Flush()
+	}
+	if cerr := ef.f.Close(); err == nil {
+		err = cerr
+	}
+	tmp := filepath.Join(dir, name+exportTmpSuffix)
+	if commit && err == nil {
+		return os.Rename(tmp, filepath.Join(dir, name))
+	}
+	os.Remove(tmp)
+	return err
+}
+
+// write writes the record to the file of the table in the partition
+func (e *exportPartition) write(table string, record []string) error {
+	name := fmt.Sprintf("%s_%010d-%010d.csv", table, e.start, e.end)
+	ef, found := e.files[name]
+	if !found {
+		var err error
+		if ef, err = createExportFile(e.dir, name, exportHeaders[table]); err != nil {
+			return err
+		}
+		e.files[name] = ef
+	}
+	return ef.w.Write(record)
+}
+
+// close closes the files of the partition, if commit is true, the files are renamed to their final names
+func (e *exportPartition) close(commit bool) error {
+	var rerr error
+	for name, ef := range e.files {
+		if err := ef.close(e.dir, name, commit); err != nil && rerr == nil {
+			rerr = err
+		}
+	}
+	return rerr
+}
+
+func (d *RocksDB) exportAddress(addrDesc bchain.AddressDescriptor) (string, string) {
+	if len(addrDesc) == 0 {
+		return "", ""
+	}
+	addrs, _, err := d.chainParser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil {
+		addrs = nil
+	}
+	return strings.Join(addrs, " "), hex.EncodeToString(addrDesc)
+}
+
+func loadExportState(dir string) (*exportState, error) {
+	var s exportState
+	buf, err := os.ReadFile(filepath.Join(dir, exportStateFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &s, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(buf, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func storeExportState(dir string, s *exportState) error {
+	buf, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, exportStateFile+exportTmpSuffix)
+	if err = os.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, exportStateFile))
+}
+
+// Export writes blocks, transaction inputs and outputs and address balances to csv files in the directory dir
+// Blocks, inputs and outputs are exported in partitions of partitionSize blocks from the index, the backend is not used.
+// Balances are exported as of the best block.
+// The export continues from the height following the previous export to the best block or to the height until, if until>=0.
+// Each finished partition is committed, the files of an interrupted partition are removed, the next export starts again from the partition.
+func (d *RocksDB) Export(dir string, partitionSize uint32, until int, stop chan os.Signal) error {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return errors.New("Export is supported only for bitcoin type coins")
+	}
+	if partitionSize == 0 {
+		return errors.New("Invalid partition size")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// remove the files of a previous unfinished export
+	tmps, err := filepath.Glob(filepath.Join(dir, "*"+exportTmpSuffix))
+	if err != nil {
+		return err
+	}
+	for _, f := range tmps {
+		os.Remove(f)
+	}
+	state, err := loadExportState(dir)
+	if err != nil {
+		return err
+	}
+	if state.Coin != "" && state.Coin != d.is.Coin {
+		return errors.Errorf("Coins do not match. Export coin %v, DB coin %v", state.Coin, d.is.Coin)
+	}
+	bestHeight, _, err := d.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	to := bestHeight
+	if until >= 0 && uint32(until) < to {
+		to = uint32(until)
+	}
+	start := time.Now()
+	from := state.NextHeight
+	if state.Coin == "" {
+		// the first export starts from the first block in the index
+		it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeight])
+		it.SeekToFirst()
+		if it.Valid() {
+			from = unpackUint(it.Key().Data())
+		}
+		it.Close()
+	}
+	if from <= to && from < d.is.PruneHeight {
+		return errors.Errorf("The transactions of the blocks below the prune height %d are not in the index", d.is.PruneHeight)
+	}
+	if from <= to {
+		glog.Info("export: exporting blocks ", from, "-", to, " to ", dir)
+	}
+	// the blockTxs column contains the txids of the last blocks only, the transactions of the older blocks
+	// are found by a single scan of the txAddresses column
+	scanTo, err := d.firstBlockTxsHeight()
+	if err != nil {
+		return err
+	}
+	var partitions []*exportPartition
+	for h := from; h <= to; {
+		end := h - h%partitionSize + partitionSize - 1
+		if end > to || end < h {
+			end = to
+		}
+		partitions = append(partitions, &exportPartition{
+			dir:   dir,
+			start: h,
+			end:   end,
+			files: make(map[string]*exportFile),
+		})
+		if end == to {
+			break
+		}
+		h = end + 1
+	}
+	var scanned []*exportPartition
+	for len(scanned) < len(partitions) && partitions[len(scanned)].start < scanTo {
+		scanned = append(scanned, partitions[len(scanned)])
+	}
+	if len(scanned) > 0 {
+		glog.Info("export: scanning the transactions of blocks ", scanned[0].start, "-", scanned[len(scanned)-1].end)
+		if err = d.exportScannedTxs(scanned, stop); err != nil {
+			for _, e := range scanned {
+				e.close(false)
+			}
+			return err
+		}
+	}
+	for i, e := range partitions {
+		if err = d.exportPartition(e, i < len(scanned), stop); err != nil {
+			for _, e := range partitions[i:] {
+				e.close(false)
+			}
+			return err
+		}
+		if err = e.close(true); err != nil {
+			return err
+		}
+		state.Coin = d.is.Coin
+		state.NextHeight = e.end + 1
+		state.Updated = time.Now().UTC()
+		if err = storeExportState(dir, state); err != nil {
+			return err
+		}
+		glog.Info("export: exported blocks ", e.start, "-", e.end)
+	}
+	if to == bestHeight {
+		if err = d.exportBalances(dir, bestHeight, stop); err != nil {
+			return err
+		}
+	}
+	glog.Info("export: finished in ", time.Since(start))
+	return nil
+}
+
+// firstBlockTxsHeight returns the height of the oldest block in the blockTxs column or the maximum height if the column is empty
+func (d *RocksDB) firstBlockTxsHeight() (uint32, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBlockTxs])
+	defer it.Close()
+	it.SeekToFirst()
+	if !it.Valid() {
+		return ^uint32(0), it.Err()
+	}
+	return unpackUint(it.Key().Data()), nil
+}
+
+// exportScannedTxs exports the transactions of the blocks of the partitions, which are not in the blockTxs column,
+// by a single scan of the txAddresses column, the transactions are written in the order of their txids
+func (d *RocksDB) exportScannedTxs(partitions []*exportPartition, stop chan os.Signal) error {
+	from, to := partitions[0].start, partitions[len(partitions)-1].end
+	// do not use cache
+	ro := grocksdb.NewDefaultReadOptions()
+	ro.SetFillCache(false)
+	defer ro.Destroy()
+	it := d.db.NewIteratorCF(ro, d.cfh[cfTxAddresses])
+	defer it.Close()
+	var rows int64
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		rows++
+		if rows%100000 == 0 {
+			select {
+			case <-stop:
+				return ErrOperationInterrupted
+			default:
+			}
+		}
+		buf := it.Value().Data()
+		if len(buf) < 3 {
+			continue
+		}
+		// the height is the first field of the packed TxAddresses, the transactions of other blocks are not unpacked
+		height, l := unpackVaruint(buf)
+		if l <= 0 || uint32(height) < from || uint32(height) > to {
+			continue
+		}
+		ta, err := d.unpackTxAddresses(buf)
+		if err != nil {
+			return err
+		}
+		txid, err := d.chainParser.UnpackTxid(it.Key().Data())
+		if err != nil {
+			return err
+		}
+		// the partitions are consecutive, find the partition of the height
+		i := sort.Search(len(partitions), func(i int) bool { return partitions[i].end >= ta.Height })
+		if err = d.exportTx(partitions[i], txid, ta); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// exportPartition exports the blocks of the partition and, if the transactions were not scanned,
+// the inputs and outputs of their transactions in the order of the blockTxs column
+func (d *RocksDB) exportPartition(e *exportPartition, scanned bool, stop chan os.Signal) error {
+	for height := e.start; height <= e.end; height++ {
+		select {
+		case <-stop:
+			return ErrOperationInterrupted
+		default:
+		}
+		bi, err := d.GetBlockInfo(height)
+		if err != nil {
+			return err
+		}
+		if bi == nil {
+			return errors.Errorf("Block %d not found in the index", height)
+		}
+		if err = e.write("blocks", []string{
+			strconv.FormatUint(uint64(height), 10),
+			bi.Hash,
+			strconv.FormatInt(bi.Time, 10),
+			strconv.FormatUint(uint64(bi.Txs), 10),
+			strconv.FormatUint(uint64(bi.Size), 10),
+		}); err != nil {
+			return err
+		}
+		if !scanned {
+			bt, err := d.getBlockTxs(height)
+			if err != nil {
+				return err
+			}
+			for i := range bt {
+				ta, err := d.getTxAddresses(bt[i].btxID)
+				if err != nil {
+					return err
+				}
+				txid, err := d.chainParser.UnpackTxid(bt[i].btxID)
+				if err != nil {
+					return err
+				}
+				if ta == nil {
+					return errors.Errorf("Transaction %s of block %d not found in the index", txid, height)
+				}
+				if err = d.exportTx(e, txid, ta); err != nil {
+					return err
+				}
+			}
+		}
+		// do not overflow the height after the last block
+		if height == e.end {
+			break
+		}
+	}
+	return nil
+}
+
+func (d *RocksDB) exportTx(e *exportPartition, txid string, ta *TxAddresses) error {
+	height := strconv.FormatUint(uint64(ta.Height), 10)
+	for i := range ta.Inputs {
+		tai := &ta.Inputs[i]
+		address, addrDesc := d.exportAddress(tai.AddrDesc)
+		var prevVout string
+		if tai.Txid != "" {
+			prevVout = strconv.FormatUint(uint64(tai.Vout), 10)
+		}
+		if err := e.write("inputs", []string{
+			height, txid, strconv.Itoa(i), address, addrDesc, tai.ValueSat.String(), tai.Txid, prevVout,
+		}); err != nil {
+			return err
+		}
+	}
+	for i := range ta.Outputs {
+		tao := &ta.Outputs[i]
+		address, addrDesc := d.exportAddress(tao.AddrDesc)
+		var spentIndex, spentHeight string
+		if tao.SpentTxid != "" {
+			spentIndex = strconv.FormatUint(uint64(tao.SpentIndex), 10)
+			spentHeight = strconv.FormatUint(uint64(tao.SpentHeight), 10)
+		}
+		if err := e.write("outputs", []string{
+			height, txid, strconv.Itoa(i), address, addrDesc, tao.ValueSat.String(), strconv.FormatBool(tao.Spent), tao.SpentTxid, spentIndex, spentHeight,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportBalances exports the balances of all addresses to the file of the height, only the latest balances are kept
+func (d *RocksDB) exportBalances(dir string, height uint32, stop chan os.Signal) error {
+	name := fmt.Sprintf("balances_%010d.csv", height)
+	if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+		return nil
+	}
+	ef, err := createExportFile(dir, name, exportHeaders["balances"])
+	if err != nil {
+		return err
+	}
+	if err = d.writeBalances(ef, stop); err != nil {
+		ef.close(dir, name, false)
+		return err
+	}
+	if err = ef.close(dir, name, true); err != nil {
+		return err
+	}
+	balances, _ := filepath.Glob(filepath.Join(dir, "balances_*.csv"))
+	for _, f := range balances {
+		if filepath.Base(f) != name {
+			os.Remove(f)
+		}
+	}
+	return nil
+}
+
+func (d *RocksDB) writeBalances(ef *exportFile, stop chan os.Signal) error {
+	ro := grocksdb.NewDefaultReadOptions()
+	ro.SetFillCache(false)
+	defer ro.Destroy()
+	it := d.db.NewIteratorCF(ro, d.cfh[cfAddressBalance])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		select {
+		case <-stop:
+			return ErrOperationInterrupted
+		default:
+		}
+		buf := it.Value().Data()
+		if len(buf) < 5 {
+			continue
+		}
+		ab, err := unpackAddrBalance(buf, d.chainParser.PackedTxidLen(), AddressBalanceDetailUTXO)
+		if err != nil {
+			return err
+		}
+		address, addrDesc := d.exportAddress(it.Key().Data())
+		if err = ef.w.Write([]string{
+			address, addrDesc, strconv.FormatUint(uint64(ab.Txs), 10), ab.SentSat.String(), ab.ReceivedSat().String(), ab.BalanceSat.String(), strconv.Itoa(len(ab.Utxos)),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
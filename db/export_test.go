@@ -0,0 +1,214 @@
+//go:build unittest
+
+package db
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func readExportFile(t *testing.T, name string) [][]string {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func exportFileNames(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRocksDB_Export(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	dir, err := ioutil.TempDir("", "testexport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	// leftover of an interrupted export
+	if err := ioutil.WriteFile(filepath.Join(dir, "blocks_0000225493-0000225493.csv.tmp"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Export(dir, 1000, 225493, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"blocks_0000225493-0000225493.csv",
+		"export.json",
+		"outputs_0000225493-0000225493.csv",
+	}
+	// the transactions of block 1 have no inputs
+	if got := exportFileNames(t, dir); !equalStrings(got, want) {
+		t.Errorf("files after first export = %v, want %v", got, want)
+	}
+	blocks := readExportFile(t, filepath.Join(dir, "blocks_0000225493-0000225493.csv"))
+	if len(blocks) != 2 || blocks[1][0] != "225493" || blocks[1][1] != "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997" {
+		t.Errorf("blocks = %v", blocks)
+	}
+	outputs := readExportFile(t, filepath.Join(dir, "outputs_0000225493-0000225493.csv"))
+	// header and 2 transactions of block 1, each with 3 outputs
+	if len(outputs) != 7 {
+		t.Errorf("outputs = %v", outputs)
+	}
+	for _, o := range outputs[1:] {
+		if o[0] != "225493" || o[6] != "true" && o[6] != "false" {
+			t.Errorf("output = %v", o)
+		}
+	}
+
+	// the second export continues from the following block and exports the balances
+	if err := d.Export(dir, 1000, -1, nil); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"balances_0000225494.csv",
+		"blocks_0000225493-0000225493.csv",
+		"blocks_0000225494-0000225494.csv",
+		"export.json",
+		"inputs_0000225494-0000225494.csv",
+		"outputs_0000225493-0000225493.csv",
+		"outputs_0000225494-0000225494.csv",
+	}
+	if got := exportFileNames(t, dir); !equalStrings(got, want) {
+		t.Errorf("files after second export = %v, want %v", got, want)
+	}
+	balances := readExportFile(t, filepath.Join(dir, "balances_0000225494.csv"))
+	found := false
+	for _, b := range balances[1:] {
+		if b[0] == dbtestdata.Addr1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("balances do not contain %v: %v", dbtestdata.Addr1, balances)
+	}
+	state, err := loadExportState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Coin != "coin-unittest" || state.NextHeight != 225495 {
+		t.Errorf("export state = %+v", state)
+	}
+
+	// nothing new to export
+	if err := d.Export(dir, 1000, -1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := exportFileNames(t, dir); !equalStrings(got, want) {
+		t.Errorf("files after third export = %v, want %v", got, want)
+	}
+}
+
+func TestRocksDB_Export_Partitions(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	dir, err := ioutil.TempDir("", "testexport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+
+	// the transactions of block 1 are not in the blockTxs column, they are found by the scan of the txAddresses
+	if err := d.Export(dir, 1, 225493, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"blocks_0000225493-0000225493.csv",
+		"export.json",
+		"outputs_0000225493-0000225493.csv",
+	}
+	if got := exportFileNames(t, dir); !equalStrings(got, want) {
+		t.Errorf("files after first export = %v, want %v", got, want)
+	}
+	if outputs := readExportFile(t, filepath.Join(dir, "outputs_0000225493-0000225493.csv")); len(outputs) != 7 {
+		t.Errorf("outputs = %v", outputs)
+	}
+
+	// the interrupted partition is not committed
+	stop := make(chan os.Signal)
+	close(stop)
+	if err := d.Export(dir, 1, -1, stop); err != ErrOperationInterrupted {
+		t.Fatalf("Export() error = %v, want ErrOperationInterrupted", err)
+	}
+	if got := exportFileNames(t, dir); !equalStrings(got, want) {
+		t.Errorf("files after interrupted export = %v, want %v", got, want)
+	}
+	state, err := loadExportState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.NextHeight != 225494 {
+		t.Errorf("export state = %+v, want next height 225494", state)
+	}
+
+	// the next export continues from the interrupted partition
+	if err := d.Export(dir, 1, -1, nil); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"balances_0000225494.csv",
+		"blocks_0000225493-0000225493.csv",
+		"blocks_0000225494-0000225494.csv",
+		"export.json",
+		"inputs_0000225494-0000225494.csv",
+		"outputs_0000225493-0000225493.csv",
+		"outputs_0000225494-0000225494.csv",
+	}
+	if got := exportFileNames(t, dir); !equalStrings(got, want) {
+		t.Errorf("files after second export = %v, want %v", got, want)
+	}
+	// the outputs of the blocks in the blockTxs column are exported in the order of the transactions in the block
+	outputs := readExportFile(t, filepath.Join(dir, "outputs_0000225494-0000225494.csv"))
+	if len(outputs) < 2 || outputs[1][1] != block2.Txs[0].Txid {
+		t.Errorf("outputs = %v", outputs)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -110,6 +110,18 @@ func (d *RocksDB) FiatRatesStoreTicker(wb *grocksdb.WriteBatch, ticker *common.C
 	return nil
 }
 
+// FiatRatesStoreTickers stores the tickers in one write batch
+func (d *RocksDB) FiatRatesStoreTickers(tickers []*common.CurrencyRatesTicker) error {
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for _, t := range tickers {
+		if err := d.FiatRatesStoreTicker(wb, t); err != nil {
+			return err
+		}
+	}
+	return d.WriteBatch(wb)
+}
+
 func getTickerFromIterator(it *grocksdb.Iterator, vsCurrency string, token string) (*common.CurrencyRatesTicker, error) {
 	timeObj, err := time.Parse(FiatRatesTimeFormat, string(it.Key().Data()))
 	if err != nil {
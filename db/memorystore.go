@@ -0,0 +1,842 @@
+package db
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// memoryUndo holds the state of the index overwritten by a connected block, it is used to disconnect the block
+type memoryUndo struct {
+	btxIDs      []string
+	addrDescs   []string
+	balances    map[string]*AddrBalance
+	txAddresses map[string]*TxAddresses
+}
+
+// MemoryStore is an implementation of Store which keeps the whole index in memory
+// It is intended for tests and lightweight regtest instances, it can connect only bitcoin type blocks
+type MemoryStore struct {
+	mux           sync.RWMutex
+	chainParser   bchain.BlockChainParser
+	is            *common.InternalState
+	metrics       *common.Metrics
+	extendedIndex bool
+	cbs           connectBlockStats
+	bestHeight    uint32
+	blocks        map[uint32]*BlockInfo
+	blockStats    map[uint32]*BlockStats
+	undo          map[uint32]*memoryUndo
+	addresses     map[string]map[uint32][]txIndexes
+	stakes        map[string]map[uint32]*AddrStake
+	balances      map[string]*AddrBalance
+	txAddresses   map[string]*TxAddresses
+	txs           map[string][]byte
+	contracts     map[string]*bchain.ContractInfo
+	fourBytes     map[uint32]map[uint32]*bchain.FourByteSignature
+	tickers       []*common.CurrencyRatesTicker
+	accounts      map[string]Account
+}
+
+// NewMemoryStore creates an empty in-memory index
+func NewMemoryStore(parser bchain.BlockChainParser, metrics *common.Metrics, extendedIndex bool) (*MemoryStore, error) {
+	if parser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, errors.New("MemoryStore supports only bitcoin type chains")
+	}
+	return &MemoryStore{
+		chainParser:   parser,
+		metrics:       metrics,
+		extendedIndex: extendedIndex,
+		blocks:        make(map[uint32]*BlockInfo),
+		blockStats:    make(map[uint32]*BlockStats),
+		undo:          make(map[uint32]*memoryUndo),
+		addresses:     make(map[string]map[uint32][]txIndexes),
+		stakes:        make(map[string]map[uint32]*AddrStake),
+		balances:      make(map[string]*AddrBalance),
+		txAddresses:   make(map[string]*TxAddresses),
+		txs:           make(map[string][]byte),
+		contracts:     make(map[string]*bchain.ContractInfo),
+		fourBytes:     make(map[uint32]map[uint32]*bchain.FourByteSignature),
+		accounts:      make(map[string]Account),
+	}, nil
+}
+
+// LoadInternalState initializes a new internal state, there is nothing persisted in MemoryStore
+func (m *MemoryStore) LoadInternalState(rpcCoin string) (*common.InternalState, error) {
+	return &common.InternalState{
+		Coin:          rpcCoin,
+		UtxoChecked:   true,
+		ExtendedIndex: m.extendedIndex,
+		StakingIndex:  m.chainParser.SupportsCoinstake(),
+	}, nil
+}
+
+// SetInternalState sets the InternalState to be used by the store to collect internal state
+func (m *MemoryStore) SetInternalState(is *common.InternalState) {
+	m.is = is
+}
+
+// GetInternalState gets the InternalState
+func (m *MemoryStore) GetInternalState() *common.InternalState {
+	return m.is
+}
+
+// HasExtendedIndex returns true if the store indexes input txids and spending data
+func (m *MemoryStore) HasExtendedIndex() bool {
+	return m.extendedIndex
+}
+
+// HasStakingIndex returns true if the chain has coinstake transactions, MemoryStore indexes them from the first block
+func (m *MemoryStore) HasStakingIndex() bool {
+	return m.chainParser.SupportsCoinstake()
+}
+
+// DatabaseSizeOnDisk returns 0, MemoryStore does not use disk
+func (m *MemoryStore) DatabaseSizeOnDisk() int64 {
+	return 0
+}
+
+// Close marks the internal state as closed, the data are discarded together with the store
+func (m *MemoryStore) Close() error {
+	if m.is != nil && m.is.DbState == common.DbStateOpen {
+		m.is.DbState = common.DbStateClosed
+	}
+	return nil
+}
+
+// GetBestBlock returns the block hash of the block with highest height in the store
+func (m *MemoryStore) GetBestBlock() (uint32, string, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if bi, found := m.blocks[m.bestHeight]; found {
+		return m.bestHeight, bi.Hash, nil
+	}
+	return 0, "", nil
+}
+
+// GetBlockHash returns block hash at given height or empty string if not found
+func (m *MemoryStore) GetBlockHash(height uint32) (string, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if bi, found := m.blocks[height]; found {
+		return bi.Hash, nil
+	}
+	return "", nil
+}
+
+// GetBlockInfo returns block info stored in the store
+func (m *MemoryStore) GetBlockInfo(height uint32) (*BlockInfo, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if bi, found := m.blocks[height]; found {
+		r := *bi
+		return &r, nil
+	}
+	return nil, nil
+}
+
+// GetBlockStats returns the statistics of the blocks in the range of heights from-to (inclusive)
+func (m *MemoryStore) GetBlockStats(from, to uint32) ([]BlockStats, error) {
+	m.mux.RLock()
+	var r []BlockStats
+	for height, bs := range m.blockStats {
+		if height >= from && height <= to {
+			r = append(r, *bs)
+		}
+	}
+	m.mux.RUnlock()
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Height < r[j].Height
+	})
+	return r, nil
+}
+
+// GetOrphanedBlocks returns nil, MemoryStore is not synchronized with a backend and does not handle forks
+func (m *MemoryStore) GetOrphanedBlocks(from, to uint32) ([]OrphanedBlock, error) {
+	return nil, nil
+}
+
+// ConnectBlock indexes addresses in the block and stores them in the store
+func (m *MemoryStore) ConnectBlock(block *bchain.Block) error {
+	// the block is processed without the lock, the stored data are read through copies and updated only at the end
+	addresses := make(addressesMap)
+	txAddressesMap := make(map[string]*TxAddresses)
+	balances := make(map[string]*AddrBalance)
+	var stakes stakesMap
+	if m.chainParser.SupportsCoinstake() {
+		stakes = make(stakesMap)
+	}
+	if err := processAddressesBitcoinType(m, m.chainParser, m.extendedIndex, &m.cbs, block, addresses, txAddressesMap, balances, stakes, nil); err != nil {
+		return err
+	}
+	bs, err := computeBlockStats(m.chainParser, block, addresses, txAddressesMap, balances)
+	if err != nil {
+		return err
+	}
+
+	u := &memoryUndo{
+		btxIDs:      make([]string, 0, len(block.Txs)),
+		addrDescs:   make([]string, 0, len(addresses)),
+		balances:    make(map[string]*AddrBalance, len(balances)),
+		txAddresses: make(map[string]*TxAddresses, len(txAddressesMap)),
+	}
+	for i := range block.Txs {
+		btxID, err := m.chainParser.PackTxid(block.Txs[i].Txid)
+		if err != nil {
+			return err
+		}
+		u.btxIDs = append(u.btxIDs, string(btxID))
+	}
+	addrStakes := make(map[string]*AddrStake, len(stakes))
+	for k, as := range stakes {
+		txid, err := m.chainParser.UnpackTxid(as.btxID)
+		if err != nil {
+			return err
+		}
+		addrStakes[k] = &AddrStake{Txid: txid, Height: block.Height, ReceivedSat: as.receivedSat, SentSat: as.sentSat}
+	}
+
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for k, ta := range txAddressesMap {
+		u.txAddresses[k] = m.txAddresses[k]
+		m.txAddresses[k] = ta
+	}
+	for k, ab := range balances {
+		u.balances[k] = m.balances[k]
+		m.balances[k] = copyAddrBalance(ab, AddressBalanceDetailUTXO)
+	}
+	for k, txi := range addresses {
+		u.addrDescs = append(u.addrDescs, k)
+		a, found := m.addresses[k]
+		if !found {
+			a = make(map[uint32][]txIndexes)
+			m.addresses[k] = a
+		}
+		a[block.Height] = txi
+	}
+	for k, as := range addrStakes {
+		s, found := m.stakes[k]
+		if !found {
+			s = make(map[uint32]*AddrStake)
+			m.stakes[k] = s
+		}
+		s[block.Height] = as
+	}
+	m.undo[block.Height] = u
+	// keep the data for disconnect only for the same number of blocks as RocksDB
+	keep := m.chainParser.KeepBlockAddresses()
+	if block.Height > uint32(keep) {
+		for rh := block.Height - uint32(keep); rh > 0; rh-- {
+			if _, found := m.undo[rh]; !found {
+				break
+			}
+			delete(m.undo, rh)
+		}
+	}
+
+	m.blocks[block.Height] = &BlockInfo{
+		Hash:   block.Hash,
+		Time:   block.Time,
+		Txs:    uint32(len(block.Txs)),
+		Size:   uint32(block.Size),
+		Height: block.Height,
+	}
+	m.blockStats[block.Height] = bs
+	if block.Height >= m.bestHeight {
+		m.bestHeight = block.Height
+	}
+	if m.is != nil {
+		m.is.UpdateBestHeight(block.Height)
+		avg := m.is.AppendBlockTime(uint32(block.Time))
+		if m.metrics != nil {
+			m.metrics.AvgBlockPeriod.Set(float64(avg))
+		}
+	}
+	return nil
+}
+
+// DisconnectBlockRangeBitcoinType removes all data belonging to blocks in range lower-higher
+// it is able to disconnect only the blocks recently connected to the store
+func (m *MemoryStore) DisconnectBlockRangeBitcoinType(lower uint32, higher uint32) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for height := lower; height <= higher; height++ {
+		if _, found := m.undo[height]; !found {
+			return errors.Errorf("Cannot disconnect blocks with height %v and lower. It is necessary to rebuild index.", height)
+		}
+	}
+	for height := higher; height >= lower; height-- {
+		m.disconnectBlock(height)
+		if height == 0 {
+			break
+		}
+	}
+	if m.is != nil {
+		m.is.RemoveLastBlockTimes(int(higher-lower) + 1)
+	}
+	glog.Infof("memorystore: blocks %d-%d disconnected", lower, higher)
+	return nil
+}
+
+func (m *MemoryStore) disconnectBlock(height uint32) {
+	u := m.undo[height]
+	for k, ab := range u.balances {
+		if ab == nil {
+			delete(m.balances, k)
+		} else {
+			m.balances[k] = ab
+		}
+	}
+	for k, ta := range u.txAddresses {
+		if ta == nil {
+			delete(m.txAddresses, k)
+		} else {
+			m.txAddresses[k] = ta
+		}
+	}
+	for _, k := range u.addrDescs {
+		delete(m.addresses[k], height)
+		if len(m.addresses[k]) == 0 {
+			delete(m.addresses, k)
+		}
+		if s, found := m.stakes[k]; found {
+			delete(s, height)
+			if len(s) == 0 {
+				delete(m.stakes, k)
+			}
+		}
+	}
+	for _, k := range u.btxIDs {
+		delete(m.txs, k)
+	}
+	delete(m.undo, height)
+	delete(m.blocks, height)
+	delete(m.blockStats, height)
+	for m.bestHeight > 0 {
+		if _, found := m.blocks[m.bestHeight]; found {
+			break
+		}
+		m.bestHeight--
+	}
+	if m.is != nil {
+		m.is.UpdateBestHeight(height - 1)
+	}
+}
+
+// GetTx returns transaction stored in the store and height of the block containing it
+func (m *MemoryStore) GetTx(txid string) (*bchain.Tx, uint32, error) {
+	key, err := m.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, 0, err
+	}
+	m.mux.RLock()
+	buf, found := m.txs[string(key)]
+	m.mux.RUnlock()
+	if !found {
+		return nil, 0, nil
+	}
+	return m.chainParser.UnpackTx(buf)
+}
+
+// PutTx stores transactions in the store
+func (m *MemoryStore) PutTx(tx *bchain.Tx, height uint32, blockTime int64) error {
+	key, err := m.chainParser.PackTxid(tx.Txid)
+	if err != nil {
+		return nil
+	}
+	buf, err := m.chainParser.PackTx(tx, height, blockTime)
+	if err != nil {
+		return err
+	}
+	m.mux.Lock()
+	m.txs[string(key)] = buf
+	m.mux.Unlock()
+	return nil
+}
+
+func (m *MemoryStore) getTxAddresses(btxID []byte) (*TxAddresses, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if ta, found := m.txAddresses[string(btxID)]; found {
+		return copyTxAddresses(ta), nil
+	}
+	return nil, nil
+}
+
+// GetTxAddresses returns TxAddresses for given txid or nil if not found
+func (m *MemoryStore) GetTxAddresses(txid string) (*TxAddresses, error) {
+	btxID, err := m.chainParser.PackTxid(txid)
+	if err != nil {
+		return nil, err
+	}
+	return m.getTxAddresses(btxID)
+}
+
+// GetTransactions finds all input/output transactions for address
+// Transaction are passed to callback function.
+func (m *MemoryStore) GetTransactions(address string, lower uint32, higher uint32, fn GetTransactionsCallback) error {
+	addrDesc, err := m.chainParser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return err
+	}
+	return m.GetAddrDescTransactions(addrDesc, lower, higher, fn)
+}
+
+// heightsInRange returns the heights from the map in the range lower-higher, from the highest to the lowest
+func heightsInRange[V any](hm map[uint32]V, lower uint32, higher uint32) []uint32 {
+	heights := make([]uint32, 0, len(hm))
+	for h := range hm {
+		if h >= lower && h <= higher {
+			heights = append(heights, h)
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] > heights[j] })
+	return heights
+}
+
+// GetAddrDescTransactions finds all input/output transactions for address descriptor
+// Transaction are passed to callback function in the order from newest block to the oldest
+func (m *MemoryStore) GetAddrDescTransactions(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn GetTransactionsCallback) error {
+	type addrTx struct {
+		txid    string
+		height  uint32
+		indexes []int32
+	}
+	// collect the transactions first so that the callback can access the store
+	m.mux.RLock()
+	a := m.addresses[string(addrDesc)]
+	txs := make([]addrTx, 0, len(a))
+	for _, h := range heightsInRange(a, lower, higher) {
+		txi := a[h]
+		// the txs are returned in reverse order, from newest to oldest
+		for j := len(txi) - 1; j >= 0; j-- {
+			txid, err := m.chainParser.UnpackTxid(txi[j].btxID)
+			if err != nil {
+				m.mux.RUnlock()
+				return err
+			}
+			txs = append(txs, addrTx{txid, h, append([]int32(nil), txi[j].indexes...)})
+		}
+	}
+	m.mux.RUnlock()
+	for i := range txs {
+		if err := fn(txs[i].txid, txs[i].height, txs[i].indexes); err != nil {
+			if _, ok := err.(*StopIteration); ok {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAddrDescBalance returns AddrBalance for given addrDesc
+func (m *MemoryStore) GetAddrDescBalance(addrDesc bchain.AddressDescriptor, detail AddressBalanceDetail) (*AddrBalance, error) {
+	m.mux.RLock()
+	ab, found := m.balances[string(addrDesc)]
+	m.mux.RUnlock()
+	if !found {
+		return nil, nil
+	}
+	return copyAddrBalance(ab, detail), nil
+}
+
+// HasRichList returns true, MemoryStore sorts the balances on request
+func (m *MemoryStore) HasRichList() bool {
+	return true
+}
+
+// RichListSize returns the number of addresses with non zero balance
+func (m *MemoryStore) RichListSize() int {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	n := 0
+	for _, ab := range m.balances {
+		if ab.BalanceSat.Sign() > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// GetRichList returns the addresses from the position from to the position to (exclusive) of the addresses sorted by balance
+// The positions are limited by MaxRichListPosition as in RocksDB.
+func (m *MemoryStore) GetRichList(from, to int) ([]RichListItem, error) {
+	m.mux.RLock()
+	r := make([]RichListItem, 0, len(m.balances))
+	for addrDesc, ab := range m.balances {
+		if ab.BalanceSat.Sign() > 0 {
+			r = append(r, RichListItem{AddrDesc: bchain.AddressDescriptor(addrDesc), BalanceSat: *new(big.Int).Set(&ab.BalanceSat)})
+		}
+	}
+	m.mux.RUnlock()
+	// the same order as in the richList column of RocksDB
+	sort.Slice(r, func(i, j int) bool {
+		if c := r[i].BalanceSat.Cmp(&r[j].BalanceSat); c != 0 {
+			return c > 0
+		}
+		return bytes.Compare(r[i].AddrDesc, r[j].AddrDesc) < 0
+	})
+	if to > MaxRichListPosition {
+		to = MaxRichListPosition
+	}
+	if to > len(r) {
+		to = len(r)
+	}
+	if from >= to {
+		return nil, nil
+	}
+	return r[from:to], nil
+}
+
+// GetXpubCache returns nil, MemoryStore does not persist the xpub cache
+func (m *MemoryStore) GetXpubCache(xpub string) (*XpubCache, error) {
+	return nil, nil
+}
+
+// StoreXpubCache does nothing, MemoryStore does not persist the xpub cache
+func (m *MemoryStore) StoreXpubCache(xpub string, xc *XpubCache, height uint32) error {
+	return nil
+}
+
+// EvictXpubCache does nothing, MemoryStore does not persist the xpub cache
+func (m *MemoryStore) EvictXpubCache(accessedBefore int64, maxCount int) (int, error) {
+	return 0, nil
+}
+
+// GetAccount returns the registered account of the xpub descriptor or nil if the account is not registered
+func (m *MemoryStore) GetAccount(descriptor string) (*Account, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	a, found := m.accounts[descriptor]
+	if !found {
+		return nil, nil
+	}
+	return &a, nil
+}
+
+// GetAccounts returns all registered accounts
+func (m *MemoryStore) GetAccounts() ([]Account, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	accounts := make([]Account, 0, len(m.accounts))
+	for _, a := range m.accounts {
+		accounts = append(accounts, a)
+	}
+	return accounts, nil
+}
+
+// StoreAccount registers the account or updates the registered account
+// MemoryStore does not track the addresses of the accounts, they are derived by the api on request.
+func (m *MemoryStore) StoreAccount(a *Account) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.accounts[a.Descriptor] = *a
+	return nil
+}
+
+// DeleteAccount unregisters the account
+func (m *MemoryStore) DeleteAccount(descriptor string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.accounts, descriptor)
+	return nil
+}
+
+// GetAccountChanges returns nil, MemoryStore does not track the addresses of the accounts
+func (m *MemoryStore) GetAccountChanges(height uint32) ([]AccountChange, error) {
+	return nil, nil
+}
+
+// HasSilentPayments returns false, MemoryStore does not index the silent payment tweaks
+func (m *MemoryStore) HasSilentPayments() bool {
+	return false
+}
+
+// GetSilentPaymentTweaks returns error, MemoryStore does not index the silent payment tweaks
+func (m *MemoryStore) GetSilentPaymentTweaks(height uint32) ([]SilentPaymentTweak, error) {
+	return nil, errors.New("Silent payments index is not supported by MemoryStore")
+}
+
+// GetAddrDescStakes finds coinstake transactions of the address descriptor in the range of heights
+// Stakes are passed to callback function in the order from newest block to the oldest
+func (m *MemoryStore) GetAddrDescStakes(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn GetStakesCallback) error {
+	m.mux.RLock()
+	s := m.stakes[string(addrDesc)]
+	stakes := make([]AddrStake, 0, len(s))
+	for _, h := range heightsInRange(s, lower, higher) {
+		as := AddrStake{Txid: s[h].Txid, Height: h}
+		as.ReceivedSat.Set(&s[h].ReceivedSat)
+		as.SentSat.Set(&s[h].SentSat)
+		stakes = append(stakes, as)
+	}
+	m.mux.RUnlock()
+	for i := range stakes {
+		if err := fn(&stakes[i]); err != nil {
+			if _, ok := err.(*StopIteration); ok {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAddressAlias returns empty string, address aliases are used only by ethereum type chains
+func (m *MemoryStore) GetAddressAlias(address string) string {
+	return ""
+}
+
+// GetEthereumInternalData returns nil, ethereum type blocks are not indexed by MemoryStore
+func (m *MemoryStore) GetEthereumInternalData(txid string) (*bchain.EthereumInternalData, error) {
+	return nil, nil
+}
+
+// GetAddrDescContracts returns nil, ethereum type blocks are not indexed by MemoryStore
+func (m *MemoryStore) GetAddrDescContracts(addrDesc bchain.AddressDescriptor) (*AddrContracts, error) {
+	return nil, nil
+}
+
+// GetContractInfoForAddress gets the contract of the address
+func (m *MemoryStore) GetContractInfoForAddress(address string) (*bchain.ContractInfo, error) {
+	contract, err := m.chainParser.GetAddrDescFromAddress(address)
+	if err != nil || contract == nil {
+		return nil, err
+	}
+	return m.GetContractInfo(contract, "")
+}
+
+// GetContractInfo gets the contract and possibly updates the type from typeFromContext
+func (m *MemoryStore) GetContractInfo(contract bchain.AddressDescriptor, typeFromContext bchain.TokenTypeName) (*bchain.ContractInfo, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	contractInfo, found := m.contracts[string(contract)]
+	if !found {
+		return nil, nil
+	}
+	if typeFromContext != bchain.UnknownTokenType && contractInfo.Type == bchain.UnknownTokenType {
+		contractInfo.Type = typeFromContext
+	}
+	return contractInfo, nil
+}
+
+// StoreContractInfo stores contractInfo
+// if CreatedInBlock==0 and DestructedInBlock!=0, it is evaluated as a destruction of a contract, the contract info is updated
+func (m *MemoryStore) StoreContractInfo(contractInfo *bchain.ContractInfo) error {
+	if contractInfo.Contract == "" {
+		return nil
+	}
+	key, err := m.chainParser.GetAddrDescFromAddress(contractInfo.Contract)
+	if err != nil {
+		return err
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if contractInfo.CreatedInBlock == 0 && contractInfo.DestructedInBlock != 0 {
+		if stored, found := m.contracts[string(key)]; found {
+			stored.DestructedInBlock = contractInfo.DestructedInBlock
+		}
+		return nil
+	}
+	ci := *contractInfo
+	m.contracts[string(key)] = &ci
+	return nil
+}
+
+// GetFourByteSignature gets 4byte signature of given fourBytes and id
+func (m *MemoryStore) GetFourByteSignature(fourBytes uint32, id uint32) (*bchain.FourByteSignature, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return m.fourBytes[fourBytes][id], nil
+}
+
+// GetFourByteSignatures gets all 4byte signatures of given fourBytes, ordered by id
+func (m *MemoryStore) GetFourByteSignatures(fourBytes uint32) (*[]bchain.FourByteSignature, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	s := m.fourBytes[fourBytes]
+	ids := make([]uint32, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	r := make([]bchain.FourByteSignature, 0, len(ids))
+	for _, id := range ids {
+		r = append(r, *s[id])
+	}
+	return &r, nil
+}
+
+// StoreFourByteSignatures stores 4byte signatures
+func (m *MemoryStore) StoreFourByteSignatures(records []FourByteSignatureRecord) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for i := range records {
+		r := &records[i]
+		s, found := m.fourBytes[r.FourBytes]
+		if !found {
+			s = make(map[uint32]*bchain.FourByteSignature)
+			m.fourBytes[r.FourBytes] = s
+		}
+		s[r.ID] = r.Signature
+	}
+	return nil
+}
+
+// fiat rates are stored with the precision of FiatRatesTimeFormat, i.e. seconds
+func fiatRatesTime(t *time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// findTickerIndex returns index of the first stored ticker with timestamp not before t
+func (m *MemoryStore) findTickerIndex(t time.Time) int {
+	return sort.Search(len(m.tickers), func(i int) bool {
+		return !m.tickers[i].Timestamp.Before(t)
+	})
+}
+
+// FiatRatesGetTicker gets FiatRates ticker at the specified timestamp if it exist
+func (m *MemoryStore) FiatRatesGetTicker(tickerTime *time.Time) (*common.CurrencyRatesTicker, error) {
+	t := fiatRatesTime(tickerTime)
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	i := m.findTickerIndex(t)
+	if i == len(m.tickers) || !m.tickers[i].Timestamp.Equal(t) {
+		return nil, nil
+	}
+	ticker := copyTicker(m.tickers[i])
+	ticker.Timestamp = tickerTime.UTC()
+	return ticker, nil
+}
+
+// FiatRatesFindTicker gets FiatRates data closest to the specified timestamp, of the base currency, vsCurrency or the token if specified
+func (m *MemoryStore) FiatRatesFindTicker(tickerTime *time.Time, vsCurrency string, token string) (*common.CurrencyRatesTicker, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if m.is != nil {
+		if currentTicker := m.is.GetCurrentTicker("", ""); currentTicker != nil {
+			last := len(m.tickers) - 1
+			if !tickerTime.Before(currentTicker.Timestamp) || (last >= 0 && tickerTime.After(m.tickers[last].Timestamp)) {
+				f := true
+				if token != "" && currentTicker.TokenRates != nil {
+					_, f = currentTicker.TokenRates[token]
+				}
+				if f {
+					return currentTicker, nil
+				}
+			}
+		}
+	}
+	for i := m.findTickerIndex(fiatRatesTime(tickerTime)); i < len(m.tickers); i++ {
+		if common.IsSuitableTicker(m.tickers[i], vsCurrency, token) {
+			return copyTicker(m.tickers[i]), nil
+		}
+	}
+	return nil, nil
+}
+
+// FiatRatesFindLastTicker gets the last FiatRates record, of the base currency, vsCurrency or the token if specified
+func (m *MemoryStore) FiatRatesFindLastTicker(vsCurrency string, token string) (*common.CurrencyRatesTicker, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	for i := len(m.tickers) - 1; i >= 0; i-- {
+		if common.IsSuitableTicker(m.tickers[i], vsCurrency, token) {
+			return copyTicker(m.tickers[i]), nil
+		}
+	}
+	return nil, nil
+}
+
+// FiatRatesStoreTickers stores the tickers, a ticker replaces a stored ticker with the same timestamp
+func (m *MemoryStore) FiatRatesStoreTickers(tickers []*common.CurrencyRatesTicker) error {
+	for _, t := range tickers {
+		if len(t.Rates) == 0 {
+			return errors.New("Error storing ticker: empty rates")
+		}
+	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for _, t := range tickers {
+		ticker := copyTicker(t)
+		ticker.Timestamp = fiatRatesTime(&t.Timestamp)
+		i := m.findTickerIndex(ticker.Timestamp)
+		if i < len(m.tickers) && m.tickers[i].Timestamp.Equal(ticker.Timestamp) {
+			m.tickers[i] = ticker
+		} else {
+			m.tickers = append(m.tickers, nil)
+			copy(m.tickers[i+1:], m.tickers[i:])
+			m.tickers[i] = ticker
+		}
+	}
+	return nil
+}
+
+func copyTicker(t *common.CurrencyRatesTicker) *common.CurrencyRatesTicker {
+	c := common.CurrencyRatesTicker{Timestamp: t.Timestamp}
+	if t.Rates != nil {
+		c.Rates = make(map[string]float32, len(t.Rates))
+		for k, v := range t.Rates {
+			c.Rates[k] = v
+		}
+	}
+	if t.TokenRates != nil {
+		c.TokenRates = make(map[string]float32, len(t.TokenRates))
+		for k, v := range t.TokenRates {
+			c.TokenRates[k] = v
+		}
+	}
+	return &c
+}
+
+// copyTxAddresses returns a deep copy of ta, the amounts must not share memory with the stored data
+func copyTxAddresses(ta *TxAddresses) *TxAddresses {
+	c := &TxAddresses{
+		Height:  ta.Height,
+		VSize:   ta.VSize,
+		Inputs:  make([]TxInput, len(ta.Inputs)),
+		Outputs: make([]TxOutput, len(ta.Outputs)),
+	}
+	for i := range ta.Inputs {
+		ti := &ta.Inputs[i]
+		c.Inputs[i] = TxInput{AddrDesc: ti.AddrDesc, Txid: ti.Txid, Vout: ti.Vout}
+		c.Inputs[i].ValueSat.Set(&ti.ValueSat)
+	}
+	for i := range ta.Outputs {
+		to := &ta.Outputs[i]
+		c.Outputs[i] = TxOutput{AddrDesc: to.AddrDesc, Spent: to.Spent, SpentTxid: to.SpentTxid, SpentIndex: to.SpentIndex, SpentHeight: to.SpentHeight}
+		c.Outputs[i].ValueSat.Set(&to.ValueSat)
+	}
+	return c
+}
+
+// copyAddrBalance returns a deep copy of ab with the unspent utxos according to detail
+func copyAddrBalance(ab *AddrBalance, detail AddressBalanceDetail) *AddrBalance {
+	c := &AddrBalance{Txs: ab.Txs, FirstSeen: ab.FirstSeen, LastSeen: ab.LastSeen}
+	c.SentSat.Set(&ab.SentSat)
+	c.BalanceSat.Set(&ab.BalanceSat)
+	if detail != AddressBalanceDetailNoUTXO {
+		c.Utxos = make([]Utxo, 0, len(ab.Utxos))
+		for i := range ab.Utxos {
+			u := &ab.Utxos[i]
+			// utxos marked as spent are removed
+			if u.Vout < 0 {
+				continue
+			}
+			cu := Utxo{BtxID: u.BtxID, Vout: u.Vout, Height: u.Height, ValueSat: *new(big.Int).Set(&u.ValueSat)}
+			if detail == AddressBalanceDetailUTXO {
+				c.Utxos = append(c.Utxos, cu)
+			} else {
+				c.addUtxo(&cu)
+			}
+		}
+	}
+	return c
+}
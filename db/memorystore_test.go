@@ -0,0 +1,225 @@
+//go:build unittest
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+var memoryStoreTestAddresses = []string{
+	dbtestdata.Addr1, dbtestdata.Addr2, dbtestdata.Addr3, dbtestdata.Addr4, dbtestdata.Addr5,
+	dbtestdata.Addr6, dbtestdata.Addr7, dbtestdata.Addr8, dbtestdata.Addr9, dbtestdata.AddrA,
+}
+
+var memoryStoreTestTxids = []string{
+	dbtestdata.TxidB1T1, dbtestdata.TxidB1T2, dbtestdata.TxidB2T1, dbtestdata.TxidB2T2,
+	dbtestdata.TxidB2T3, dbtestdata.TxidB2T4, dbtestdata.TxidCoinstake,
+}
+
+func setupMemoryStore(t *testing.T, p bchain.BlockChainParser) *MemoryStore {
+	m, err := NewMemoryStore(p, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is, err := m.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetInternalState(is)
+	return m
+}
+
+// storeDump returns the content of the store visible through the Store interface
+// values are marshalled to json, it is not possible to compare big.Int using reflect.DeepEqual
+func storeDump(t *testing.T, s Store, p bchain.BlockChainParser) map[string]string {
+	r := make(map[string]string)
+	add := func(key string, v interface{}) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r[key] = string(b)
+	}
+	height, hash, err := s.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	add("bestBlock", []interface{}{height, hash})
+	for h := uint32(225493); h <= 225495; h++ {
+		bi, err := s.GetBlockInfo(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		add(fmt.Sprint("blockInfo ", h), bi)
+	}
+	bs, err := s.GetBlockStats(0, ^uint32(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	add("blockStats", bs)
+	for _, a := range memoryStoreTestAddresses {
+		addrDesc := addressToAddrDesc(a, p)
+		for _, detail := range []AddressBalanceDetail{AddressBalanceDetailNoUTXO, AddressBalanceDetailUTXO} {
+			ab, err := s.GetAddrDescBalance(addrDesc, detail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			add(fmt.Sprint("balance ", a, " ", detail), ab)
+		}
+		var txs []interface{}
+		if err = s.GetAddrDescTransactions(addrDesc, 0, ^uint32(0), func(txid string, height uint32, indexes []int32) error {
+			// RocksDB reuses the indexes slice in the following calls
+			txs = append(txs, []interface{}{txid, height, append([]int32(nil), indexes...)})
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		add("transactions "+a, txs)
+		var stakes []AddrStake
+		if err = s.GetAddrDescStakes(addrDesc, 0, ^uint32(0), func(s *AddrStake) error {
+			stakes = append(stakes, *s)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		add("stakes "+a, stakes)
+	}
+	for _, txid := range memoryStoreTestTxids {
+		ta, err := s.GetTxAddresses(txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		add("txAddresses "+txid, ta)
+	}
+	return r
+}
+
+func compareStores(t *testing.T, step string, d *RocksDB, m *MemoryStore) {
+	got := storeDump(t, m, m.chainParser)
+	want := storeDump(t, d, d.chainParser)
+	for k, w := range want {
+		if got[k] != w {
+			t.Errorf("%s: %s = %v, want %v", step, k, got[k], w)
+		}
+	}
+}
+
+func TestMemoryStore_BitcoinType(t *testing.T) {
+	tests := []struct {
+		name   string
+		parser bchain.BlockChainParser
+		blocks func(p bchain.BlockChainParser) []*bchain.Block
+	}{
+		{
+			name:   "spending",
+			parser: &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()},
+			blocks: func(p bchain.BlockChainParser) []*bchain.Block {
+				return []*bchain.Block{dbtestdata.GetTestBitcoinTypeBlock1(p), dbtestdata.GetTestBitcoinTypeBlock2(p)}
+			},
+		},
+		{
+			name:   "staking",
+			parser: &testStakingParser{BitcoinParser: bitcoinTestnetParser()},
+			blocks: func(p bchain.BlockChainParser) []*bchain.Block {
+				return []*bchain.Block{dbtestdata.GetTestBitcoinTypeBlock1(p), dbtestdata.GetTestBitcoinTypeCoinstakeBlock(p)}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := setupRocksDB(t, tt.parser)
+			defer closeAndDestroyRocksDB(t, d)
+			m := setupMemoryStore(t, tt.parser)
+			defer m.Close()
+
+			blocks := tt.blocks(tt.parser)
+			for _, b := range blocks {
+				for _, s := range []Store{d, m} {
+					if err := s.ConnectBlock(b); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			compareStores(t, "connect", d, m)
+
+			// the parser keeps data for disconnect of one block only
+			for _, s := range []Store{d, m} {
+				if err := s.DisconnectBlockRangeBitcoinType(225493, 225494); err == nil {
+					t.Errorf("%T: DisconnectBlockRangeBitcoinType(225493, 225494) expected error", s)
+				}
+				if err := s.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+					t.Fatal(err)
+				}
+			}
+			compareStores(t, "disconnect", d, m)
+			if bi, _ := m.GetBlockInfo(225494); bi != nil {
+				t.Errorf("GetBlockInfo(225494) after disconnect = %+v, want nil", bi)
+			}
+
+			if err := m.ConnectBlock(blocks[1]); err != nil {
+				t.Fatal(err)
+			}
+			if err := d.ConnectBlock(blocks[1]); err != nil {
+				t.Fatal(err)
+			}
+			compareStores(t, "reconnect", d, m)
+		})
+	}
+}
+
+func TestMemoryStore_Tickers(t *testing.T) {
+	m := setupMemoryStore(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+
+	ts1, _ := time.Parse(FiatRatesTimeFormat, "20190628000000")
+	ts2, _ := time.Parse(FiatRatesTimeFormat, "20190629000000")
+	ticker1 := &common.CurrencyRatesTicker{
+		Timestamp:  ts1,
+		Rates:      map[string]float32{"usd": 20000, "eur": 18000},
+		TokenRates: map[string]float32{"0x6B175474E89094C44Da98b954EedeAC495271d0F": 17.2},
+	}
+	ticker2 := &common.CurrencyRatesTicker{
+		Timestamp: ts2,
+		Rates:     map[string]float32{"usd": 30000},
+	}
+	if err := m.FiatRatesStoreTickers([]*common.CurrencyRatesTicker{ticker2, ticker1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.FiatRatesStoreTickers([]*common.CurrencyRatesTicker{{Timestamp: ts1}}); err == nil {
+		t.Error("FiatRatesStoreTickers() with empty rates expected error")
+	}
+
+	if got, err := m.FiatRatesGetTicker(&ts1); err != nil || !reflect.DeepEqual(got, ticker1) {
+		t.Errorf("FiatRatesGetTicker(ts1) = %+v, %v, want %+v", got, err, ticker1)
+	}
+	past := ts1.Add(-time.Hour)
+	if got, err := m.FiatRatesGetTicker(&past); err != nil || got != nil {
+		t.Errorf("FiatRatesGetTicker(past) = %+v, %v, want nil", got, err)
+	}
+	if got, err := m.FiatRatesFindTicker(&past, "", ""); err != nil || !reflect.DeepEqual(got, ticker1) {
+		t.Errorf("FiatRatesFindTicker(past) = %+v, %v, want %+v", got, err, ticker1)
+	}
+	middle := ts1.Add(time.Hour)
+	if got, err := m.FiatRatesFindTicker(&middle, "eur", ""); err != nil || got != nil {
+		t.Errorf("FiatRatesFindTicker(middle, eur) = %+v, %v, want nil", got, err)
+	}
+	if got, err := m.FiatRatesFindLastTicker("", ""); err != nil || !reflect.DeepEqual(got, ticker2) {
+		t.Errorf("FiatRatesFindLastTicker() = %+v, %v, want %+v", got, err, ticker2)
+	}
+	if got, err := m.FiatRatesFindLastTicker("eur", ""); err != nil || !reflect.DeepEqual(got, ticker1) {
+		t.Errorf("FiatRatesFindLastTicker(eur) = %+v, %v, want %+v", got, err, ticker1)
+	}
+	// the returned tickers must not share data with the store
+	got, _ := m.FiatRatesGetTicker(&ts2)
+	got.Rates["usd"] = 1
+	if got, _ = m.FiatRatesGetTicker(&ts2); got.Rates["usd"] != 30000 {
+		t.Errorf("FiatRatesGetTicker(ts2) usd = %v, want 30000", got.Rates["usd"])
+	}
+}
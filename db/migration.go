@@ -0,0 +1,304 @@
+package db
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"time"
+
+	vlq "github.com/bsm/go-vlq"
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// maxMigrationBatch is the number of rewritten rows stored together with the progress of the migration
+const maxMigrationBatch = 100000
+
+// dbMigration upgrades the db from the version fromVersion to the version fromVersion+1
+// The columns which are not listed in columns did not change their format, only their version is updated.
+type dbMigration struct {
+	fromVersion uint32
+	chainType   bchain.ChainType
+	columns     map[string]columnMigration
+}
+
+// columnMigration describes the change of the format of a column
+type columnMigration struct {
+	// clear deletes all rows of the column, usable for the columns which are rebuilt automatically
+	clear bool
+	// rewrite returns the new value of the row in the new format, the row is deleted if the returned value is nil
+	rewrite func(d *RocksDB, is *common.InternalState, key, value []byte) ([]byte, error)
+}
+
+// dbMigrations contains the registered migrations
+// To change the format of a column, increase dbVersion and register the migration from the previous version.
+var dbMigrations = []dbMigration{
+	{
+		// the format of the columns transactions and fiatRates of BitcoinType coins changed in v6
+		fromVersion: 5,
+		chainType:   bchain.ChainBitcoinType,
+		columns: map[string]columnMigration{
+			"transactions": {clear: true},
+			"fiatRates":    {clear: true},
+		},
+	},
+	{
+		// the heights of the first and the last transaction of the address were added in v7
+		fromVersion: 6,
+		chainType:   bchain.ChainBitcoinType,
+		columns: map[string]columnMigration{
+			"addressBalance": {rewrite: migrateAddrBalanceSeen},
+		},
+	},
+	{
+		fromVersion: 6,
+		chainType:   bchain.ChainEthereumType,
+		columns: map[string]columnMigration{
+			"addressContracts": {rewrite: migrateAddrContractsSeen},
+		},
+	},
+}
+
+// insertAddressSeen inserts the packed heights of the first and the last transaction of the address to the value at the position pos
+// If firstSeenUnknown, the first seen height is stored as 0, which means unknown.
+func (d *RocksDB) insertAddressSeen(addrDesc bchain.AddressDescriptor, value []byte, pos int, firstSeenUnknown bool) ([]byte, error) {
+	var firstSeen uint32
+	var err error
+	if !firstSeenUnknown {
+		if firstSeen, err = d.addressFirstSeen(addrDesc); err != nil {
+			return nil, err
+		}
+	}
+	lastSeen, err := d.addressLastSeen(addrDesc, ^uint32(0))
+	if err != nil {
+		return nil, err
+	}
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := make([]byte, 0, len(value)+2*vlq.MaxLen32)
+	buf = append(buf, value[:pos]...)
+	l := packVaruint(uint(firstSeen), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(lastSeen), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	return append(buf, value[pos:]...), nil
+}
+
+// migrateAddrBalanceSeen adds the first and the last seen height after the balance in the v6 format of addressBalance
+// In a pruned db the first seen height is unknown if the history of the address was pruned,
+// the last seen height is unknown if the whole history was pruned, unknown heights are stored as 0.
+func migrateAddrBalanceSeen(d *RocksDB, is *common.InternalState, key, value []byte) ([]byte, error) {
+	txs, l := unpackVaruint(value)
+	_, ll := unpackBigint(value[l:])
+	l += ll
+	_, ll = unpackBigint(value[l:])
+	var pruned bool
+	if is.PruneHeight > 0 {
+		retained, err := d.addressRetainedTxs(key)
+		if err != nil {
+			return nil, err
+		}
+		pruned = retained < txs
+	}
+	return d.insertAddressSeen(key, value, l+ll, pruned)
+}
+
+// addressRetainedTxs returns the number of transactions of the address in the addresses column
+func (d *RocksDB) addressRetainedTxs(addrDesc bchain.AddressDescriptor) (uint, error) {
+	txidLen := d.chainParser.PackedTxidLen()
+	var txs uint
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+	for it.Seek(addrDesc); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, addrDesc) {
+			break
+		}
+		// the keys of longer address descriptors with the same prefix can be mixed with the keys of the address
+		if len(key) != len(addrDesc)+packedHeightBytes {
+			continue
+		}
+		val := it.Value().Data()
+		for len(val) > txidLen {
+			val = val[txidLen:]
+			for {
+				index, l := unpackVarint32(val)
+				val = val[l:]
+				if index&1 == 1 {
+					break
+				} else if len(val) == 0 {
+					return 0, errors.New("addressRetainedTxs: inconsistent data")
+				}
+			}
+			txs++
+		}
+	}
+	return txs, nil
+}
+
+// migrateAddrContractsSeen adds the first and the last seen height after the counts of transactions in the v6 format of addressContracts
+// Ethereum type dbs are never pruned.
+func migrateAddrContractsSeen(d *RocksDB, is *common.InternalState, key, value []byte) ([]byte, error) {
+	l := 0
+	for i := 0; i < 3; i++ {
+		_, ll := unpackVaruint(value[l:])
+		l += ll
+	}
+	return d.insertAddressSeen(key, value, l, false)
+}
+
+func (d *RocksDB) findMigration(fromVersion uint32) *dbMigration {
+	chainType := d.chainParser.GetChainType()
+	for i := range dbMigrations {
+		if dbMigrations[i].fromVersion == fromVersion && dbMigrations[i].chainType == chainType {
+			return &dbMigrations[i]
+		}
+	}
+	return nil
+}
+
+// canMigrate checks that there are registered migrations from the version to the current dbVersion
+func (d *RocksDB) canMigrate(version uint32) bool {
+	for v := version; v < dbVersion; v++ {
+		if d.findMigration(v) == nil {
+			return false
+		}
+	}
+	return version < dbVersion
+}
+
+// MigrationPending returns true if some columns of the db must be migrated to the current version
+func MigrationPending(is *common.InternalState) bool {
+	for i := range is.DbColumns {
+		if is.DbColumns[i].Version != dbVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateColumns upgrades the columns of the db to the current version using the registered migrations
+// The columns are rewritten in batches, each batch is stored together with the progress of the migration in the internal state.
+// An interrupted migration continues from the last stored row.
+func (d *RocksDB) MigrateColumns(is *common.InternalState, stop chan os.Signal) error {
+	for MigrationPending(is) {
+		from := uint32(dbVersion)
+		for i := range is.DbColumns {
+			if is.DbColumns[i].Version < from {
+				from = is.DbColumns[i].Version
+			}
+		}
+		m := d.findMigration(from)
+		if m == nil {
+			return errors.Errorf("No migration of the db from version %v", from)
+		}
+		glog.Info("migration: upgrading db from v", from, " to v", from+1)
+		for i := range is.DbColumns {
+			if is.DbColumns[i].Version != from {
+				continue
+			}
+			var cm *columnMigration
+			if c, found := m.columns[is.DbColumns[i].Name]; found {
+				cm = &c
+			}
+			if err := d.migrateColumn(is, i, from, cm, stop); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateColumn rewrites the column col from the version from to from+1
+func (d *RocksDB) migrateColumn(is *common.InternalState, col int, from uint32, cm *columnMigration, stop chan os.Signal) error {
+	start := time.Now()
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	// commit stores the rewritten rows together with the progress of the migration
+	commit := func() error {
+		buf, err := is.Pack()
+		if err != nil {
+			return err
+		}
+		wb.PutCF(d.cfh[cfDefault], []byte(internalStateKey), buf)
+		d.connectMux.RLock()
+		err = d.db.Write(d.wo, wb)
+		d.connectMux.RUnlock()
+		if err != nil {
+			return err
+		}
+		wb.Clear()
+		return nil
+	}
+	if cm != nil && cm.clear {
+		glog.Info("migration: column ", cfNames[col], " cleared")
+		wb.DeleteRangeCF(d.cfh[col], []byte{0}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	} else if cm != nil {
+		ms := is.Migration
+		if ms == nil || ms.Column != cfNames[col] || ms.FromVersion != from {
+			ms = &common.MigrationState{Column: cfNames[col], FromVersion: from, Started: start.UTC()}
+			is.Migration = ms
+			glog.Info("migration: column ", ms.Column, " starting")
+		} else {
+			glog.Info("migration: column ", ms.Column, " resuming after ", ms.Rows, " rows")
+		}
+		// do not use cache
+		ro := grocksdb.NewDefaultReadOptions()
+		ro.SetFillCache(false)
+		defer ro.Destroy()
+		for {
+			it := d.db.NewIteratorCF(ro, d.cfh[col])
+			if ms.LastKey == nil {
+				it.SeekToFirst()
+			} else {
+				it.Seek(ms.LastKey)
+				if it.Valid() && bytes.Equal(it.Key().Data(), ms.LastKey) {
+					it.Next()
+				}
+			}
+			for count := 0; it.Valid() && count < refreshIterator; it.Next() {
+				select {
+				case <-stop:
+					it.Close()
+					if err := commit(); err != nil {
+						return err
+					}
+					return ErrOperationInterrupted
+				default:
+				}
+				key := it.Key().Data()
+				value, err := cm.rewrite(d, is, key, it.Value().Data())
+				if err != nil {
+					it.Close()
+					return errors.Annotatef(err, "migration of column %v, key %v", cfNames[col], hex.EncodeToString(key))
+				}
+				if value == nil {
+					wb.DeleteCF(d.cfh[col], key)
+				} else {
+					wb.PutCF(d.cfh[col], key, value)
+				}
+				ms.LastKey = append(ms.LastKey[:0], key...)
+				ms.Rows++
+				count++
+				if wb.Count() >= maxMigrationBatch {
+					if err = commit(); err != nil {
+						it.Close()
+						return err
+					}
+				}
+			}
+			valid := it.Valid()
+			it.Close()
+			if !valid {
+				break
+			}
+			glog.Info("migration: column ", ms.Column, ": rows ", ms.Rows, ", in progress...")
+		}
+		glog.Info("migration: column ", ms.Column, " finished, rewritten ", ms.Rows, " rows in ", time.Since(start))
+	}
+	is.DbColumns[col].Version = from + 1
+	is.Migration = nil
+	return commit()
+}
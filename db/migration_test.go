@@ -0,0 +1,207 @@
+//go:build unittest
+
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func columnRows(d *RocksDB, col int) map[string][]byte {
+	r := make(map[string][]byte)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[col])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		r[string(it.Key().Data())] = append([]byte{}, it.Value().Data()...)
+	}
+	return r
+}
+
+func TestRocksDB_MigrateColumns(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	txAddresses := columnRows(d, cfTxAddresses)
+	if len(txAddresses) < 2 || len(columnRows(d, cfBlockTxs)) == 0 {
+		t.Fatal("missing test data")
+	}
+
+	stop := make(chan os.Signal, 1)
+	rewritten := make(map[string]int)
+	defer func(m []dbMigration) { dbMigrations = m }(dbMigrations)
+	dbMigrations = []dbMigration{{
+		fromVersion: dbVersion - 1,
+		chainType:   bchain.ChainBitcoinType,
+		columns: map[string]columnMigration{
+			"txAddresses": {rewrite: func(d *RocksDB, is *common.InternalState, key, value []byte) ([]byte, error) {
+				rewritten[string(key)]++
+				// interrupt the migration after the first row
+				if len(rewritten) == 1 {
+					stop <- os.Interrupt
+				}
+				return append(append([]byte{}, value...), 0xab), nil
+			}},
+			"blockTxs": {clear: true},
+		},
+	}}
+
+	// store the db as if it was created by the previous version
+	for i := range d.is.DbColumns {
+		d.is.DbColumns[i].Version = dbVersion - 1
+	}
+	if err := d.StoreInternalState(d.is); err != nil {
+		t.Fatal(err)
+	}
+	is, err := d.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !MigrationPending(is) {
+		t.Fatal("MigrationPending() = false, want true")
+	}
+	if err = d.MigrateColumns(is, stop); err != ErrOperationInterrupted {
+		t.Fatalf("MigrateColumns() error = %v, want interrupted", err)
+	}
+
+	// the progress of the interrupted migration is stored in the internal state
+	if is, err = d.LoadInternalState("coin-unittest"); err != nil {
+		t.Fatal(err)
+	}
+	if is.Migration == nil || is.Migration.Column != "txAddresses" || is.Migration.Rows != 1 {
+		t.Fatalf("Migration = %+v, want progress of txAddresses", is.Migration)
+	}
+	if err = d.MigrateColumns(is, stop); err != nil {
+		t.Fatal(err)
+	}
+
+	if is, err = d.LoadInternalState("coin-unittest"); err != nil {
+		t.Fatal(err)
+	}
+	if MigrationPending(is) || is.Migration != nil {
+		t.Errorf("migration not finished, columns %+v, migration %+v", is.DbColumns, is.Migration)
+	}
+	migrated := columnRows(d, cfTxAddresses)
+	if len(migrated) != len(txAddresses) {
+		t.Fatalf("txAddresses rows = %d, want %d", len(migrated), len(txAddresses))
+	}
+	for k, v := range txAddresses {
+		if rewritten[k] != 1 {
+			t.Errorf("row %x rewritten %d times, want once", k, rewritten[k])
+		}
+		if string(migrated[k]) != string(append(v, 0xab)) {
+			t.Errorf("row %x = %x, want %x", k, migrated[k], append(v, 0xab))
+		}
+	}
+	if len(columnRows(d, cfBlockTxs)) != 0 {
+		t.Error("column blockTxs was not cleared")
+	}
+
+	// there is no migration from an older version
+	is.DbColumns[cfAddresses].Version = dbVersion - 2
+	if err = d.StoreInternalState(is); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.LoadInternalState("coin-unittest"); err == nil {
+		t.Error("LoadInternalState() of incompatible db expected error")
+	}
+}
+
+// storeAddrBalanceV6 stores the balances in the v6 format without the first and the last seen height
+func storeAddrBalanceV6(t *testing.T, d *RocksDB) {
+	for k, v := range columnRows(d, cfAddressBalance) {
+		_, l := unpackVaruint(v)
+		_, ll := unpackBigint(v[l:])
+		l += ll
+		_, ll = unpackBigint(v[l:])
+		l += ll
+		_, fl := unpackVaruint(v[l:])
+		_, sl := unpackVaruint(v[l+fl:])
+		old := append(append([]byte{}, v[:l]...), v[l+fl+sl:]...)
+		if err := d.db.PutCF(d.wo, d.cfh[cfAddressBalance], []byte(k), old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range d.is.DbColumns {
+		d.is.DbColumns[i].Version = 6
+	}
+}
+
+func TestRocksDB_MigrateAddressSeen(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	balances := columnRows(d, cfAddressBalance)
+	storeAddrBalanceV6(t, d)
+	if err := d.MigrateColumns(d.is, nil); err != nil {
+		t.Fatal(err)
+	}
+	migrated := columnRows(d, cfAddressBalance)
+	if len(migrated) != len(balances) {
+		t.Fatalf("addressBalance rows = %d, want %d", len(migrated), len(balances))
+	}
+	for k, v := range balances {
+		if string(migrated[k]) != string(v) {
+			t.Errorf("row %x = %x, want %x", k, migrated[k], v)
+		}
+	}
+}
+
+func TestRocksDB_MigrateAddressSeen_Pruned(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.pruneHistory(225494, nil); err != nil {
+		t.Fatal(err)
+	}
+	storeAddrBalanceV6(t, d)
+	if err := d.MigrateColumns(d.is, nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		address   string
+		firstSeen uint32
+		lastSeen  uint32
+	}{
+		// the whole history of Addr1 in block 1 was pruned
+		{dbtestdata.Addr1, 0, 0},
+		// Addr3 is in both blocks, the history in block 1 was pruned
+		{dbtestdata.Addr3, 0, 225494},
+		// Addr6 is only in block 2, the history is complete
+		{dbtestdata.Addr6, 225494, 225494},
+	}
+	for _, tt := range tests {
+		ab, err := d.GetAddrDescBalance(addressToAddrDesc(tt.address, d.chainParser), AddressBalanceDetailNoUTXO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ab.FirstSeen != tt.firstSeen || ab.LastSeen != tt.lastSeen {
+			t.Errorf("%v seen = %d-%d, want %d-%d", tt.address, ab.FirstSeen, ab.LastSeen, tt.firstSeen, tt.lastSeen)
+		}
+	}
+
+	// the unknown first seen height stays unknown with a new transaction of the address
+	ab := AddrBalance{Txs: 3, LastSeen: 225494}
+	ab.markSeen(225495)
+	if ab.FirstSeen != 0 || ab.LastSeen != 225495 {
+		t.Errorf("markSeen() seen = %d-%d, want 0-225495", ab.FirstSeen, ab.LastSeen)
+	}
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+)
+
+// orphanedBlocksToKeep is the number of heights below the connected block for which the orphaned blocks are kept
+const orphanedBlocksToKeep = 100000
+
+// OrphanedBlock is a block disconnected from the index because of a chain reorganization
+type OrphanedBlock struct {
+	Height uint32
+	Hash   string
+	Time   int64
+	Txs    uint32
+	Size   uint32
+	// OrphanedTime is the unix time when the block was disconnected from the index
+	OrphanedTime int64
+}
+
+// Reorg describes a chain reorganization, the blocks disconnected from the index and the tip of the index after the disconnect
+type Reorg struct {
+	Orphaned  []OrphanedBlock
+	TipHeight uint32
+	TipHash   string
+}
+
+// OnReorgFunc is used to send notification about a chain reorganization
+type OnReorgFunc func(reorg *Reorg)
+
+func (d *RocksDB) packOrphanedBlockKey(height uint32, hash string) ([]byte, error) {
+	b, err := d.chainParser.PackBlockHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return append(packUint(height), b...), nil
+}
+
+func packOrphanedBlock(ob *OrphanedBlock) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := make([]byte, 0, 32)
+	l := packVaruint(uint(ob.OrphanedTime), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(ob.Time), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(ob.Txs), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(ob.Size), varBuf)
+	return append(buf, varBuf[:l]...)
+}
+
+func (d *RocksDB) unpackOrphanedBlock(key []byte, buf []byte) (*OrphanedBlock, error) {
+	// 4 is minimum length of orphanedBlock - 1 byte for each field
+	if len(key) <= 4 || len(buf) < 4 {
+		return nil, errors.New("Invalid orphanedBlock")
+	}
+	hash, err := d.chainParser.UnpackBlockHash(key[4:])
+	if err != nil {
+		return nil, err
+	}
+	ob := &OrphanedBlock{
+		Height: unpackUint(key),
+		Hash:   hash,
+	}
+	t, l := unpackVaruint(buf)
+	ob.OrphanedTime = int64(t)
+	t, ll := unpackVaruint(buf[l:])
+	l += ll
+	ob.Time = int64(t)
+	txs, ll := unpackVaruint(buf[l:])
+	l += ll
+	ob.Txs = uint32(txs)
+	if len(buf) <= l {
+		return nil, errors.New("Invalid orphanedBlock")
+	}
+	size, _ := unpackVaruint(buf[l:])
+	ob.Size = uint32(size)
+	return ob, nil
+}
+
+func (d *RocksDB) storeOrphanedBlock(wb *grocksdb.WriteBatch, ob *OrphanedBlock) error {
+	key, err := d.packOrphanedBlockKey(ob.Height, ob.Hash)
+	if err != nil {
+		return errors.Annotatef(err, "height %d, hash %s", ob.Height, ob.Hash)
+	}
+	wb.PutCF(d.cfh[cfOrphanedBlocks], key, packOrphanedBlock(ob))
+	return nil
+}
+
+// pruneOrphanedBlocks removes the orphaned blocks older than orphanedBlocksToKeep heights below the given height
+func (d *RocksDB) pruneOrphanedBlocks(wb *grocksdb.WriteBatch, height uint32) {
+	if height <= orphanedBlocksToKeep {
+		return
+	}
+	below := height - orphanedBlocksToKeep
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfOrphanedBlocks])
+	defer it.Close()
+	// the reorganizations are rare, the column contains only a few records
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if unpackUint(key) >= below {
+			break
+		}
+		wb.DeleteCF(d.cfh[cfOrphanedBlocks], append([]byte(nil), key...))
+	}
+}
+
+// findOrphanedBlock returns the block of the given height from the list of orphaned blocks or nil
+func findOrphanedBlock(orphaned []OrphanedBlock, height uint32) *OrphanedBlock {
+	for i := range orphaned {
+		if orphaned[i].Height == height {
+			return &orphaned[i]
+		}
+	}
+	return nil
+}
+
+// GetOrphanedBlocks returns the orphaned blocks in the range of heights from-to (inclusive), ordered by height
+func (d *RocksDB) GetOrphanedBlocks(from, to uint32) ([]OrphanedBlock, error) {
+	var r []OrphanedBlock
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfOrphanedBlocks])
+	defer it.Close()
+	for it.Seek(packUint(from)); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if unpackUint(key) > to {
+			break
+		}
+		ob, err := d.unpackOrphanedBlock(key, it.Value().Data())
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, *ob)
+	}
+	return r, nil
+}
@@ -0,0 +1,117 @@
+//go:build unittest
+
+package db
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/linxGnu/grocksdb"
+)
+
+func storeTestOrphanedBlocks(t *testing.T, d *RocksDB, blocks []OrphanedBlock) {
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for i := range blocks {
+		if err := d.storeOrphanedBlock(wb, &blocks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.WriteBatch(wb); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRocksDB_OrphanedBlocks(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+
+	ob1 := OrphanedBlock{
+		Height:       225494,
+		Hash:         "0000000000000000000a2a8f2dd3c6b5c5ea42b2b0c7bc26a7d7e3c4e37bb1fe",
+		Time:         1521595600,
+		Txs:          2,
+		Size:         1234,
+		OrphanedTime: 1521595700,
+	}
+	ob2 := OrphanedBlock{
+		Height:       225494,
+		Hash:         "00000000000000000016d4b6a7d4fb5bd7f7dbe5fd3e2c1a0b8b2e5fb3b3c0a1",
+		Time:         1521595610,
+		Txs:          1,
+		Size:         250,
+		OrphanedTime: 1521595800,
+	}
+	ob3 := OrphanedBlock{
+		Height:       225495,
+		Hash:         "000000000000000000049a7c2d0a3f1cbf8e7e6c0fd4e6a0ed9c3e0a8f8b6d2c",
+		Time:         1521595700,
+		Txs:          3,
+		Size:         4321,
+		OrphanedTime: 1521595800,
+	}
+	if got, want := hex.EncodeToString(packOrphanedBlock(&ob1)), "85d5c6ea3485d5c6e950028952"; got != want {
+		t.Errorf("packOrphanedBlock() = %v, want %v", got, want)
+	}
+	storeTestOrphanedBlocks(t, d, []OrphanedBlock{ob3, ob1})
+	storeTestOrphanedBlocks(t, d, []OrphanedBlock{ob2})
+	tests := []struct {
+		name     string
+		from, to uint32
+		want     []OrphanedBlock
+	}{
+		// the blocks are ordered by height and packed hash
+		{name: "all", from: 0, to: 300000, want: []OrphanedBlock{ob1, ob2, ob3}},
+		{name: "height 225494", from: 225494, to: 225494, want: []OrphanedBlock{ob1, ob2}},
+		{name: "height 225495", from: 225495, to: 225496, want: []OrphanedBlock{ob3}},
+		{name: "none", from: 225496, to: 300000, want: nil},
+	}
+	for _, tt := range tests {
+		got, err := d.GetOrphanedBlocks(tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: GetOrphanedBlocks() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRocksDB_pruneOrphanedBlocks(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+
+	obs := []OrphanedBlock{
+		{Height: 100, Hash: "0000000000000000000a2a8f2dd3c6b5c5ea42b2b0c7bc26a7d7e3c4e37bb1fe", Time: 1521595600, Txs: 2, Size: 1234, OrphanedTime: 1521595700},
+		{Height: 200, Hash: "00000000000000000016d4b6a7d4fb5bd7f7dbe5fd3e2c1a0b8b2e5fb3b3c0a1", Time: 1521595610, Txs: 1, Size: 250, OrphanedTime: 1521595800},
+		{Height: 300, Hash: "000000000000000000049a7c2d0a3f1cbf8e7e6c0fd4e6a0ed9c3e0a8f8b6d2c", Time: 1521595700, Txs: 3, Size: 4321, OrphanedTime: 1521595800},
+	}
+	storeTestOrphanedBlocks(t, d, obs)
+	tests := []struct {
+		name   string
+		height uint32
+		want   []OrphanedBlock
+	}{
+		{name: "below retention", height: orphanedBlocksToKeep, want: obs},
+		{name: "nothing older", height: orphanedBlocksToKeep + 100, want: obs},
+		{name: "prune one", height: orphanedBlocksToKeep + 101, want: obs[1:]},
+		{name: "prune two", height: orphanedBlocksToKeep + 300, want: obs[2:]},
+		{name: "prune all", height: orphanedBlocksToKeep + 301, want: nil},
+	}
+	for _, tt := range tests {
+		wb := grocksdb.NewWriteBatch()
+		d.pruneOrphanedBlocks(wb, tt.height)
+		if err := d.WriteBatch(wb); err != nil {
+			t.Fatal(err)
+		}
+		wb.Destroy()
+		got, err := d.GetOrphanedBlocks(0, ^uint32(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: GetOrphanedBlocks() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// pruneInterval is the minimal number of blocks between two prunes, each prune scans the whole addresses and txAddresses columns
+const pruneInterval = 1000
+
+// maxPruneBatch is the number of deletes after which the write batch is written
+const maxPruneBatch = 100000
+
+// PruneHistory deletes the history of the addresses older than keepBlocks blocks from the best block
+// The prune runs only after at least pruneInterval blocks were connected since the previous one.
+// It scans the whole addresses and txAddresses columns, it is run in the background, the blocks are connected meanwhile.
+// Balances and utxos of the addresses are kept, transaction data are kept for the transactions with unspent outputs.
+func (d *RocksDB) PruneHistory(keepBlocks uint32, stop chan os.Signal) error {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return errors.New("Pruning is supported only for bitcoin type coins")
+	}
+	if keepBlocks < uint32(d.chainParser.KeepBlockAddresses()) {
+		return errors.Errorf("The number of kept blocks must be at least %d", d.chainParser.KeepBlockAddresses())
+	}
+	if d.is == nil || d.is.InitialSync {
+		return nil
+	}
+	bestHeight, _, err := d.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	if bestHeight < keepBlocks || bestHeight-keepBlocks < d.is.PruneHeight+pruneInterval {
+		return nil
+	}
+	return d.pruneHistory(bestHeight-keepBlocks, stop)
+}
+
+// pruneHistory deletes the addresses and stakes entries and the fully spent txAddresses of the blocks below height
+func (d *RocksDB) pruneHistory(height uint32, stop chan os.Signal) error {
+	start := time.Now()
+	glog.Info("prune: pruning history below height ", height)
+	// the prune height is stored first, the history is incomplete as soon as the first entry is deleted
+	// an interrupted prune is finished by the next one
+	d.connectMux.RLock()
+	d.is.PruneHeight = height
+	err := d.storeState(d.is)
+	d.connectMux.RUnlock()
+	if err != nil {
+		return err
+	}
+	addresses, err := d.pruneColumn(cfAddresses, stop, func(key, value []byte) (bool, error) {
+		_, h, err := unpackAddressKey(key)
+		if err != nil {
+			return false, err
+		}
+		return h < height, nil
+	})
+	if err != nil {
+		return err
+	}
+	// the staking rewards are reported from the same heights as the history of the address
+	var stakes int64
+	if d.chainParser.SupportsCoinstake() {
+		stakes, err = d.pruneColumn(cfStakes, stop, func(key, value []byte) (bool, error) {
+			_, h, err := unpackAddressKey(key)
+			if err != nil {
+				return false, err
+			}
+			return h < height, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// the transactions spent in the blocks which can be disconnected must be kept
+	// the disconnect reads them to restore the spent outputs, the blocks connected during the prune add their transactions
+	d.connectMux.Lock()
+	spentInKeptBlocks, err := d.getBlockTxsInputs()
+	if err == nil {
+		d.pruneMux.Lock()
+		d.pruneKeep = spentInKeptBlocks
+		d.pruneMux.Unlock()
+	}
+	d.connectMux.Unlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		d.pruneMux.Lock()
+		d.pruneKeep = nil
+		d.pruneMux.Unlock()
+	}()
+	txs, err := d.pruneColumn(cfTxAddresses, stop, func(key, value []byte) (bool, error) {
+		ta, err := d.unpackTxAddresses(value)
+		if err != nil {
+			return false, err
+		}
+		if ta.Height >= height {
+			return false, nil
+		}
+		d.pruneMux.Lock()
+		_, found := d.pruneKeep[string(key)]
+		d.pruneMux.Unlock()
+		if found {
+			return false, nil
+		}
+		return d.txAddressesSpent(ta), nil
+	})
+	if err != nil {
+		return err
+	}
+	glog.Info("prune: deleted ", addresses, " addresses entries, ", stakes, " stakes and ", txs, " transactions below height ", height, " in ", time.Since(start))
+	return nil
+}
+
+// txAddressesSpent returns true if all outputs of the transaction which can be spent are spent
+func (d *RocksDB) txAddressesSpent(ta *TxAddresses) bool {
+	for i := range ta.Outputs {
+		o := &ta.Outputs[i]
+		// outputs like OP_RETURN are never spent, outputs with unknown address descriptor can still be spent
+		if !o.Spent && (len(o.AddrDesc) == 0 || d.chainParser.IsAddrDescIndexable(o.AddrDesc)) {
+			return false
+		}
+	}
+	return true
+}
+
+// keepFromPrune records the transactions read by the connected block if a prune is running, they must not be pruned
+// The transaction spent by the block can become fully spent after the prune read the set of the kept transactions.
+func (d *RocksDB) keepFromPrune(txAddressesMap map[string]*TxAddresses) {
+	d.pruneMux.Lock()
+	defer d.pruneMux.Unlock()
+	if d.pruneKeep == nil {
+		return
+	}
+	for k := range txAddressesMap {
+		d.pruneKeep[k] = struct{}{}
+	}
+}
+
+// getBlockTxsInputs returns the set of transactions spent by the inputs stored in the blockTxs column
+func (d *RocksDB) getBlockTxsInputs() (map[string]struct{}, error) {
+	r := make(map[string]struct{})
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfBlockTxs])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		bt, err := d.getBlockTxs(unpackUint(it.Key().Data()))
+		if err != nil {
+			return nil, err
+		}
+		for i := range bt {
+			for j := range bt[i].inputs {
+				r[string(bt[i].inputs[j].btxID)] = struct{}{}
+			}
+		}
+	}
+	return r, nil
+}
+
+// pruneColumn deletes the rows of the column for which the function del returns true
+func (d *RocksDB) pruneColumn(col int, stop chan os.Signal, del func(key, value []byte) (bool, error)) (int64, error) {
+	var rows, deleted int64
+	var seekKey []byte
+	// do not use cache
+	ro := grocksdb.NewDefaultReadOptions()
+	ro.SetFillCache(false)
+	defer ro.Destroy()
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for {
+		var key []byte
+		it := d.db.NewIteratorCF(ro, d.cfh[col])
+		if rows == 0 {
+			it.SeekToFirst()
+		} else {
+			glog.Info("prune: column ", cfNames[col], ": rows ", rows, ", deleted ", deleted, ", in progress...")
+			it.Seek(seekKey)
+			it.Next()
+		}
+		for count := 0; it.Valid() && count < refreshIterator; it.Next() {
+			select {
+			case <-stop:
+				it.Close()
+				return 0, ErrOperationInterrupted
+			default:
+			}
+			key = it.Key().Data()
+			count++
+			rows++
+			ok, err := del(key, it.Value().Data())
+			if err != nil {
+				it.Close()
+				return 0, err
+			}
+			if ok {
+				wb.DeleteCF(d.cfh[col], key)
+				deleted++
+				if wb.Count() >= maxPruneBatch {
+					if err = d.writePruneBatch(wb); err != nil {
+						it.Close()
+						return 0, err
+					}
+					wb.Clear()
+				}
+			}
+		}
+		seekKey = append([]byte{}, key...)
+		valid := it.Valid()
+		it.Close()
+		if !valid {
+			break
+		}
+	}
+	if err := d.writePruneBatch(wb); err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+func (d *RocksDB) writePruneBatch(wb *grocksdb.WriteBatch) error {
+	d.connectMux.RLock()
+	defer d.connectMux.RUnlock()
+	return d.db.Write(d.wo, wb)
+}
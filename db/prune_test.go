@@ -0,0 +1,122 @@
+//go:build unittest
+
+package db
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func balancesJSON(t *testing.T, d *RocksDB) map[string]string {
+	r := make(map[string]string)
+	for _, a := range memoryStoreTestAddresses {
+		ab, err := d.GetAddrDescBalance(addressToAddrDesc(a, d.chainParser), AddressBalanceDetailUTXO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(ab)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r[a] = string(b)
+	}
+	return r
+}
+
+func addressHeights(t *testing.T, d *RocksDB, address string) []uint32 {
+	var heights []uint32
+	if err := d.GetTransactions(address, 0, ^uint32(0), func(txid string, height uint32, indexes []int32) error {
+		heights = append(heights, height)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return heights
+}
+
+func TestRocksDB_PruneHistory(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	balances := balancesJSON(t, d)
+
+	if err := d.PruneHistory(0, nil); err == nil {
+		t.Error("PruneHistory(0) expected error, fewer blocks than KeepBlockAddresses")
+	}
+	// fewer than pruneInterval blocks to prune
+	if err := d.PruneHistory(225000, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d.is.PruneHeight != 0 {
+		t.Errorf("PruneHeight = %d, want 0", d.is.PruneHeight)
+	}
+
+	if err := d.pruneHistory(225494, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d.is.PruneHeight != 225494 {
+		t.Errorf("PruneHeight = %d, want 225494", d.is.PruneHeight)
+	}
+	// Addr1 has only the output in block 1, Addr3 is in both blocks
+	if got := addressHeights(t, d, dbtestdata.Addr1); len(got) != 0 {
+		t.Errorf("Addr1 heights = %v, want none", got)
+	}
+	if got := addressHeights(t, d, dbtestdata.Addr3); len(got) != 1 || got[0] != 225494 {
+		t.Errorf("Addr3 heights = %v, want [225494]", got)
+	}
+	// TxidB1T1 has unspent outputs, TxidB1T2 is spent by block 2 which can be disconnected
+	for _, txid := range []string{dbtestdata.TxidB1T1, dbtestdata.TxidB1T2, dbtestdata.TxidB2T1} {
+		if ta, err := d.GetTxAddresses(txid); err != nil || ta == nil {
+			t.Errorf("GetTxAddresses(%v) = %v, %v, want kept", txid, ta, err)
+		}
+	}
+
+	// block 2 can no longer be disconnected, TxidB1T2 can be deleted by the next prune
+	if err := d.db.DeleteCF(d.wo, d.cfh[cfBlockTxs], packUint(225494)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.pruneHistory(225494, nil); err != nil {
+		t.Fatal(err)
+	}
+	if ta, err := d.GetTxAddresses(dbtestdata.TxidB1T2); err != nil || ta != nil {
+		t.Errorf("GetTxAddresses(TxidB1T2) = %+v, %v, want nil", ta, err)
+	}
+	if ta, err := d.GetTxAddresses(dbtestdata.TxidB1T1); err != nil || ta == nil {
+		t.Errorf("GetTxAddresses(TxidB1T1) = %v, %v, want kept", ta, err)
+	}
+
+	if d.pruneKeep != nil {
+		t.Error("pruneKeep not reset after the prune")
+	}
+
+	// balances and utxos are not affected by the prune
+	got := balancesJSON(t, d)
+	for a, want := range balances {
+		if got[a] != want {
+			t.Errorf("balance %v = %v, want %v", a, got[a], want)
+		}
+	}
+}
+
+func TestRocksDB_keepFromPrune(t *testing.T) {
+	d := &RocksDB{}
+	txs := map[string]*TxAddresses{"tx1": {}, "tx2": {}}
+	// no prune is running
+	d.keepFromPrune(txs)
+	if d.pruneKeep != nil {
+		t.Errorf("pruneKeep = %v, want nil", d.pruneKeep)
+	}
+	d.pruneKeep = map[string]struct{}{"tx0": {}}
+	d.keepFromPrune(txs)
+	if len(d.pruneKeep) != 3 {
+		t.Errorf("pruneKeep = %v, want tx0, tx1, tx2", d.pruneKeep)
+	}
+}
@@ -0,0 +1,438 @@
+package db
+
+import (
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// reindexCommitBlocks is the number of reindexed blocks stored together with the progress of the reindex
+const reindexCommitBlocks = 100
+
+// columnReindex describes how a column is rebuilt from the blocks of the backend
+type columnReindex struct {
+	chainType bchain.ChainType
+	// wholeChain is set if the column cannot be rebuilt only for a part of the chain
+	wholeChain bool
+	// clear deletes all rows of the column before the first block is reindexed
+	clear bool
+	// check verifies that the column can be reindexed
+	check func(d *RocksDB) error
+	// newReindexer returns the reindexer of the column, it is created again when an interrupted reindex continues
+	newReindexer func(d *RocksDB, rs *common.ReindexState) columnReindexer
+	// finish is called after the last block of the range rs was reindexed
+	finish func(d *RocksDB, rs *common.ReindexState)
+}
+
+// columnReindexer rebuilds the rows of a column from the blocks
+type columnReindexer interface {
+	// connect processes the block, the rows may be kept in memory until flush
+	connect(wb *grocksdb.WriteBatch, block *bchain.Block) error
+	// flush stores all rows kept in memory to the write batch
+	flush(wb *grocksdb.WriteBatch) error
+	// pending returns the number of rows waiting to be written
+	pending(wb *grocksdb.WriteBatch) int
+}
+
+// reindexColumns contains the columns which can be rebuilt by ReindexColumn
+var reindexColumns = map[string]columnReindex{
+	"internalData": {
+		chainType: bchain.ChainEthereumType,
+		newReindexer: func(d *RocksDB, rs *common.ReindexState) columnReindexer {
+			return &internalDataReindexer{d: d}
+		},
+	},
+	"addressContracts": {
+		chainType:  bchain.ChainEthereumType,
+		wholeChain: true,
+		clear:      true,
+		newReindexer: func(d *RocksDB, rs *common.ReindexState) columnReindexer {
+			return &addressContractsReindexer{d: d, contracts: make(map[string]*AddrContracts)}
+		},
+	},
+	// reindex of txAddresses converts the column to the format of the extended index
+	"txAddresses": {
+		chainType:  bchain.ChainBitcoinType,
+		wholeChain: true,
+		check: func(d *RocksDB) error {
+			if d.is.ExtendedIndex {
+				return errors.New("The db already contains the extended index")
+			}
+			return nil
+		},
+		newReindexer: func(d *RocksDB, rs *common.ReindexState) columnReindexer {
+			return &txAddressesReindexer{d: d, rs: rs, txAddresses: make(map[string]*TxAddresses)}
+		},
+		finish: func(d *RocksDB, rs *common.ReindexState) {
+			d.is.ExtendedIndex = true
+			d.extendedIndex = true
+		},
+	},
+	// reindex of silentPayments computes the tweaks of the blocks connected before the index was enabled
+	"silentPayments": {
+		chainType: bchain.ChainBitcoinType,
+		check: func(d *RocksDB) error {
+			if !d.HasSilentPayments() {
+				return errors.New("The silent payments index is not enabled, run blockbook with -silentpayments first")
+			}
+			return nil
+		},
+		newReindexer: func(d *RocksDB, rs *common.ReindexState) columnReindexer {
+			return &silentPaymentsReindexer{d: d}
+		},
+		finish: func(d *RocksDB, rs *common.ReindexState) {
+			// extend the indexed range if the reindexed blocks adjoin it
+			if rs.From < d.is.SilentPaymentsHeight && rs.To+1 >= d.is.SilentPaymentsHeight {
+				d.is.SilentPaymentsHeight = rs.From
+			}
+		},
+	},
+}
+
+// internalDataReindexer rewrites the internal data of the transactions and the internal data errors of the blocks
+type internalDataReindexer struct {
+	d *RocksDB
+}
+
+func (r *internalDataReindexer) connect(wb *grocksdb.WriteBatch, block *bchain.Block) error {
+	blockTxs, err := r.d.processAddressesEthereumType(block, make(addressesMap), make(map[string]*AddrContracts))
+	if err != nil {
+		return err
+	}
+	for i := range blockTxs {
+		blockTx := &blockTxs[i]
+		if blockTx.internalData != nil {
+			wb.PutCF(r.d.cfh[cfInternalData], blockTx.btxID, packEthInternalData(blockTx.internalData))
+		} else {
+			wb.DeleteCF(r.d.cfh[cfInternalData], blockTx.btxID)
+		}
+	}
+	wb.DeleteCF(r.d.cfh[cfBlockInternalDataErrors], packUint(block.Height))
+	if blockSpecificData, _ := block.CoinSpecificData.(*bchain.EthereumBlockSpecificData); blockSpecificData != nil && blockSpecificData.InternalDataError != "" {
+		return r.d.storeBlockInternalDataErrorEthereumType(wb, block, blockSpecificData.InternalDataError)
+	}
+	return nil
+}
+
+func (r *internalDataReindexer) flush(wb *grocksdb.WriteBatch) error {
+	return nil
+}
+
+func (r *internalDataReindexer) pending(wb *grocksdb.WriteBatch) int {
+	return wb.Count()
+}
+
+// addressContractsReindexer accumulates the contracts of the addresses, the column is cleared before the first block
+type addressContractsReindexer struct {
+	d         *RocksDB
+	contracts map[string]*AddrContracts
+}
+
+func (r *addressContractsReindexer) connect(wb *grocksdb.WriteBatch, block *bchain.Block) error {
+	_, err := r.d.processAddressesEthereumType(block, make(addressesMap), r.contracts)
+	return err
+}
+
+func (r *addressContractsReindexer) flush(wb *grocksdb.WriteBatch) error {
+	if err := r.d.storeAddressContracts(wb, r.contracts); err != nil {
+		return err
+	}
+	r.contracts = make(map[string]*AddrContracts)
+	return nil
+}
+
+func (r *addressContractsReindexer) pending(wb *grocksdb.WriteBatch) int {
+	return len(r.contracts)
+}
+
+// txAddressesReindexer adds the vsize, the input txids and the spending transactions to the rows of txAddresses
+// The rows of the transactions in the blocks lower than rs.Height are already converted to the extended format.
+type txAddressesReindexer struct {
+	d           *RocksDB
+	rs          *common.ReindexState
+	txAddresses map[string]*TxAddresses
+}
+
+// getTxAddresses returns the row of the transaction, it is decoded in the format given by the height of the transaction
+func (r *txAddressesReindexer) getTxAddresses(btxID []byte) (*TxAddresses, error) {
+	if ta, found := r.txAddresses[string(btxID)]; found {
+		return ta, nil
+	}
+	val, err := r.d.db.GetCF(r.d.ro, r.d.cfh[cfTxAddresses], btxID)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) < 3 {
+		return nil, nil
+	}
+	height, _ := unpackVaruint(buf)
+	var ta *TxAddresses
+	r.d.withExtendedIndex(uint32(height) < r.rs.Height, func() {
+		ta, err = r.d.unpackTxAddresses(buf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.txAddresses[string(btxID)] = ta
+	return ta, nil
+}
+
+func (r *txAddressesReindexer) connect(wb *grocksdb.WriteBatch, block *bchain.Block) error {
+	p := r.d.chainParser
+	blockTxAddresses := make([]*TxAddresses, len(block.Txs))
+	// first load all transactions so that inputs can refer to txs in this block
+	for txi := range block.Txs {
+		tx := &block.Txs[txi]
+		btxID, err := p.PackTxid(tx.Txid)
+		if err != nil {
+			return err
+		}
+		ta, err := r.getTxAddresses(btxID)
+		if err != nil {
+			return err
+		}
+		if ta == nil {
+			glog.Warningf("reindex: height %d, tx %v not found in txAddresses", block.Height, tx.Txid)
+			continue
+		}
+		if tx.VSize > 0 {
+			ta.VSize = uint32(tx.VSize)
+		} else {
+			ta.VSize = uint32(len(tx.Hex))
+		}
+		blockTxAddresses[txi] = ta
+	}
+	for txi := range block.Txs {
+		tx := &block.Txs[txi]
+		ta := blockTxAddresses[txi]
+		if ta == nil {
+			continue
+		}
+		for i := range tx.Vin {
+			if i >= len(ta.Inputs) {
+				break
+			}
+			input := &tx.Vin[i]
+			btxID, err := p.PackTxid(input.Txid)
+			if err != nil {
+				// coinbase inputs are stored without input txid
+				if err == bchain.ErrTxidMissing {
+					continue
+				}
+				return err
+			}
+			ita, err := r.getTxAddresses(btxID)
+			if err != nil {
+				return err
+			}
+			if ita == nil || len(ita.Outputs) <= int(input.Vout) {
+				continue
+			}
+			tai := &ta.Inputs[i]
+			tai.Txid = input.Txid
+			tai.Vout = input.Vout
+			spentOutput := &ita.Outputs[int(input.Vout)]
+			spentOutput.SpentTxid = tx.Txid
+			spentOutput.SpentIndex = uint32(i)
+			spentOutput.SpentHeight = block.Height
+		}
+	}
+	return nil
+}
+
+func (r *txAddressesReindexer) flush(wb *grocksdb.WriteBatch) error {
+	var err error
+	r.d.withExtendedIndex(true, func() {
+		err = r.d.storeTxAddresses(wb, r.txAddresses)
+	})
+	if err != nil {
+		return err
+	}
+	r.txAddresses = make(map[string]*TxAddresses)
+	return nil
+}
+
+func (r *txAddressesReindexer) pending(wb *grocksdb.WriteBatch) int {
+	return len(r.txAddresses)
+}
+
+// withExtendedIndex runs f with the format of txAddresses switched to the extended or the basic format
+// It must not run concurrently with other access to the db, it is used only by the reindex.
+func (d *RocksDB) withExtendedIndex(extendedIndex bool, f func()) {
+	e := d.extendedIndex
+	d.extendedIndex = extendedIndex
+	defer func() { d.extendedIndex = e }()
+	f()
+}
+
+type reindexBlock struct {
+	block *bchain.Block
+	err   error
+}
+
+// getReindexBlocks fetches the blocks in the range from-to from the backend in advance of the reindex
+// The heights which are not in the index are skipped, a block with a different hash than in the index is an error.
+func (d *RocksDB) getReindexBlocks(chain bchain.BlockChain, from, to uint32, done chan struct{}) chan reindexBlock {
+	blocks := make(chan reindexBlock, 8)
+	go func() {
+		defer close(blocks)
+		for height := from; height <= to; height++ {
+			var rb reindexBlock
+			hash, err := d.GetBlockHash(height)
+			if err != nil {
+				rb.err = err
+			} else if hash == "" {
+				continue
+			} else if rb.block, err = chain.GetBlock(hash, height); err != nil {
+				rb.err = errors.Annotatef(err, "GetBlock %d %s", height, hash)
+			} else if rb.block.Hash != hash {
+				rb.err = errors.Errorf("Block %d in the backend %s differs from the index %s", height, rb.block.Hash, hash)
+			}
+			select {
+			case blocks <- rb:
+			case <-done:
+				return
+			}
+			if rb.err != nil {
+				return
+			}
+		}
+	}()
+	return blocks
+}
+
+// ReindexColumn rebuilds the column from the blocks of the backend in the range of heights from-to (inclusive), -1 means the whole chain
+// The other columns are not modified. The progress is stored together with the reindexed rows in the internal state,
+// an interrupted reindex continues from the last stored block and no other reindex can start until it is finished.
+func (d *RocksDB) ReindexColumn(chain bchain.BlockChain, column string, from, to int, stop chan os.Signal) error {
+	if d.is == nil {
+		return errors.New("Internal state not created")
+	}
+	cr, found := reindexColumns[column]
+	if !found || cr.chainType != d.chainParser.GetChainType() {
+		return errors.Errorf("Column %v cannot be reindexed", column)
+	}
+	col := -1
+	for i := range cfNames {
+		if cfNames[i] == column {
+			col = i
+			break
+		}
+	}
+	start := time.Now()
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	// commit stores the reindexed rows together with the progress of the reindex
+	commit := func() error {
+		d.connectMux.RLock()
+		defer d.connectMux.RUnlock()
+		if err := d.storeStateToBatch(wb, d.is); err != nil {
+			return err
+		}
+		if err := d.WriteBatch(wb); err != nil {
+			return err
+		}
+		wb.Clear()
+		return nil
+	}
+	rs := d.is.Reindex
+	if rs != nil {
+		if rs.Column != column {
+			return errors.Errorf("Reindex of column %v is not finished", rs.Column)
+		}
+		glog.Infof("reindex: column %v resuming at block %d of %d-%d", column, rs.Height, rs.From, rs.To)
+	} else {
+		if cr.check != nil {
+			if err := cr.check(d); err != nil {
+				return err
+			}
+		}
+		bestHeight, _, err := d.GetBestBlock()
+		if err != nil {
+			return err
+		}
+		lower, higher := uint32(0), bestHeight
+		if from >= 0 {
+			lower = uint32(from)
+		}
+		if to >= 0 && uint32(to) < bestHeight {
+			higher = uint32(to)
+		}
+		if cr.wholeChain && (lower != 0 || higher != bestHeight) {
+			return errors.Errorf("Column %v can be reindexed only for the whole chain", column)
+		}
+		if lower > higher {
+			return errors.Errorf("Invalid range of blocks %d-%d", lower, higher)
+		}
+		rs = &common.ReindexState{Column: column, From: lower, To: higher, Height: lower, Started: start.UTC()}
+		d.is.Reindex = rs
+		if cr.clear {
+			wb.DeleteRangeCF(d.cfh[col], []byte{0}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+			glog.Info("reindex: column ", column, " cleared")
+		}
+		if err = commit(); err != nil {
+			return err
+		}
+		glog.Infof("reindex: column %v starting, blocks %d-%d", column, rs.From, rs.To)
+	}
+	r := cr.newReindexer(d, rs)
+	done := make(chan struct{})
+	defer close(done)
+	blocks := d.getReindexBlocks(chain, rs.Height, rs.To, done)
+	// store stores the rows and moves the progress to the block following height
+	store := func(height uint32) error {
+		if err := r.flush(wb); err != nil {
+			return err
+		}
+		rs.Height = height + 1
+		return commit()
+	}
+	var height uint32
+	connected := 0
+	for rb := range blocks {
+		if rb.err != nil {
+			return rb.err
+		}
+		select {
+		case <-stop:
+			if connected > 0 {
+				if err := store(height); err != nil {
+					return err
+				}
+			}
+			return ErrOperationInterrupted
+		default:
+		}
+		height = rb.block.Height
+		if err := r.connect(wb, rb.block); err != nil {
+			return errors.Annotatef(err, "reindex of column %v, block %d", column, height)
+		}
+		connected++
+		if connected >= reindexCommitBlocks || r.pending(wb) >= maxMigrationBatch {
+			if err := store(height); err != nil {
+				return err
+			}
+			connected = 0
+			glog.Infof("reindex: column %v, block %d of %d, in progress...", column, height, rs.To)
+		}
+	}
+	if err := r.flush(wb); err != nil {
+		return err
+	}
+	if cr.finish != nil {
+		cr.finish(d, rs)
+	}
+	d.is.Reindex = nil
+	if err := commit(); err != nil {
+		return err
+	}
+	glog.Infof("reindex: column %v finished, blocks %d-%d in %v", column, rs.From, rs.To, time.Since(start))
+	return nil
+}
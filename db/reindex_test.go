@@ -0,0 +1,82 @@
+//go:build unittest
+
+package db
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func getColumnRows(t *testing.T, d *RocksDB, col int) map[string]string {
+	rows := make(map[string]string)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[col])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		rows[hex.EncodeToString(it.Key().Data())] = hex.EncodeToString(it.Value().Data())
+	}
+	return rows
+}
+
+func TestRocksDB_ReindexColumn_TxAddresses(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	// the reference db is indexed with the extended index from the beginning
+	e := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, e)
+	e.extendedIndex = true
+	e.is.ExtendedIndex = true
+	for _, db := range []*RocksDB{d, e} {
+		if err := db.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(db.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(db.chainParser)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	balances := getColumnRows(t, d, cfAddressBalance)
+
+	chain, err := dbtestdata.NewFakeBlockChain(d.chainParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.ReindexColumn(chain, "txAddresses", 225493, -1, nil); err == nil {
+		t.Error("ReindexColumn() of a part of the chain did not fail")
+	}
+	if err = d.ReindexColumn(chain, "addressContracts", -1, -1, nil); err == nil {
+		t.Error("ReindexColumn() of an ethereum type column did not fail")
+	}
+	if err = d.ReindexColumn(chain, "txAddresses", -1, -1, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !d.HasExtendedIndex() || !d.is.ExtendedIndex || d.is.Reindex != nil {
+		t.Errorf("ReindexColumn() state extendedIndex %v, is.ExtendedIndex %v, is.Reindex %+v", d.HasExtendedIndex(), d.is.ExtendedIndex, d.is.Reindex)
+	}
+	got, want := getColumnRows(t, d, cfTxAddresses), getColumnRows(t, e, cfTxAddresses)
+	if len(got) != len(want) {
+		t.Fatalf("txAddresses has %d rows, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("txAddresses %s = %s, want %s", k, got[k], v)
+		}
+	}
+	// other columns are not modified
+	for k, v := range getColumnRows(t, d, cfAddressBalance) {
+		if balances[k] != v {
+			t.Errorf("addressBalance %s = %s, want %s", k, v, balances[k])
+		}
+	}
+	ta, err := d.GetTxAddresses(dbtestdata.TxidB2T1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ta == nil || len(ta.Inputs) == 0 || ta.Inputs[0].Txid == "" {
+		t.Errorf("GetTxAddresses() = %+v, want input txid", ta)
+	}
+	if err = d.ReindexColumn(chain, "txAddresses", -1, -1, nil); err == nil || !strings.Contains(err.Error(), "extended index") {
+		t.Errorf("ReindexColumn() of the extended index = %v, want error", err)
+	}
+}
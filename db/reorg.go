@@ -0,0 +1,84 @@
+package db
+
+import (
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// ErrReorgDepthExceeded is returned if the blocks cannot be disconnected because the data needed to disconnect them
+// are neither in the blockTxs column nor can be reconstructed from the backend
+var ErrReorgDepthExceeded = errors.New("Max reorg depth exceeded")
+
+// GetBlockFunc returns the block of the given hash and height from the backend
+type GetBlockFunc func(hash string, height uint32) (*bchain.Block, error)
+
+// DisconnectDeepBlockRange removes all data belonging to blocks in range lower-higher
+// The blocks older than block_addresses_to_keep do not have data in the blockTxs column, their transactions are
+// taken from the blocks returned by getBlock and disconnected using the txAddresses column.
+// ErrReorgDepthExceeded is returned if the data of a block cannot be reconstructed.
+// The orphaned blocks are stored in the same write batch as the disconnect of the block of their height.
+func (d *RocksDB) DisconnectDeepBlockRange(lower uint32, higher uint32, getBlock GetBlockFunc, orphaned []OrphanedBlock) error {
+	switch d.chainParser.GetChainType() {
+	case bchain.ChainBitcoinType:
+		return d.disconnectBlockRangeBitcoinType(lower, higher, getBlock, orphaned)
+	case bchain.ChainEthereumType:
+		return d.disconnectBlockRangeEthereumType(lower, higher, getBlock, orphaned)
+	}
+	return errors.New("Unknown chain type")
+}
+
+// getDisconnectedBlock returns the block of the index at the given height from the backend
+func (d *RocksDB) getDisconnectedBlock(height uint32, getBlock GetBlockFunc) (*bchain.Block, error) {
+	hash, err := d.GetBlockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	if hash == "" {
+		return nil, errors.Annotatef(ErrReorgDepthExceeded, "height %d, block not found in index", height)
+	}
+	block, err := getBlock(hash, height)
+	if err != nil {
+		return nil, errors.Annotatef(ErrReorgDepthExceeded, "height %d, block %s not available in backend: %v", height, hash, err)
+	}
+	if block.Hash != hash {
+		return nil, errors.Annotatef(ErrReorgDepthExceeded, "height %d, backend returned block %s instead of %s", height, block.Hash, hash)
+	}
+	glog.Info("rocksdb: reconstructing disconnect data of block ", height, " ", hash, " from backend")
+	return block, nil
+}
+
+// reconstructBlockTxs returns the data of the blockTxs column of the block at the given height,
+// which is older than the blocks kept in the column
+func (d *RocksDB) reconstructBlockTxs(height uint32, getBlock GetBlockFunc) ([]blockTxs, error) {
+	block, err := d.getDisconnectedBlock(height, getBlock)
+	if err != nil {
+		return nil, err
+	}
+	bt, err := d.blockTxsFromBlock(block)
+	if err != nil {
+		return nil, err
+	}
+	// without txAddresses (for example in a pruned index) it is not possible to revert the balances
+	for i := range bt {
+		ta, err := d.getTxAddresses(bt[i].btxID)
+		if err != nil {
+			return nil, err
+		}
+		if ta == nil {
+			return nil, errors.Annotatef(ErrReorgDepthExceeded, "height %d, tx %s not found in txAddresses", height, block.Txs[i].Txid)
+		}
+	}
+	return bt, nil
+}
+
+// reconstructBlockTxsEthereumType returns the data of the blockTxs column of the block at the given height,
+// which is older than the blocks kept in the column
+func (d *RocksDB) reconstructBlockTxsEthereumType(height uint32, getBlock GetBlockFunc) ([]ethBlockTx, error) {
+	block, err := d.getDisconnectedBlock(height, getBlock)
+	if err != nil {
+		return nil, err
+	}
+	// the addresses and contracts are processed only to get the data of the transactions, they are not stored
+	return d.processAddressesEthereumType(block, make(addressesMap), make(map[string]*AddrContracts))
+}
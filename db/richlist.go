@@ -0,0 +1,188 @@
+package db
+
+import (
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// MaxRichListPosition is the number of the addresses with the highest balance which can be listed
+// The rich list is iterated from the top to the requested position, deeper positions would be too expensive to reach.
+const MaxRichListPosition = 10000
+
+// RichListItem is an address with non zero balance in the rich list
+type RichListItem struct {
+	AddrDesc   bchain.AddressDescriptor
+	BalanceSat big.Int
+}
+
+// packRichListKey packs the balance so that the keys are sorted by the balance in descending order
+// The key consists of the inverted length of the balance, the inverted big endian balance and the address descriptor.
+func packRichListKey(addrDesc bchain.AddressDescriptor, balance *big.Int) []byte {
+	b := balance.Bytes()
+	key := make([]byte, 0, 1+len(b)+len(addrDesc))
+	key = append(key, ^byte(len(b)))
+	for _, v := range b {
+		key = append(key, ^v)
+	}
+	return append(key, addrDesc...)
+}
+
+func unpackRichListKey(key []byte) (bchain.AddressDescriptor, *big.Int, error) {
+	if len(key) == 0 {
+		return nil, nil, errors.New("Invalid rich list key")
+	}
+	l := int(^key[0])
+	if len(key) < 1+l {
+		return nil, nil, errors.New("Invalid rich list key")
+	}
+	b := make([]byte, l)
+	for i := range b {
+		b[i] = ^key[1+i]
+	}
+	var balance big.Int
+	balance.SetBytes(b)
+	return append(bchain.AddressDescriptor(nil), key[1+l:]...), &balance, nil
+}
+
+// markRichListBalance records the balance loaded from the index as the balance of the address in the rich list
+func (d *RocksDB) markRichListBalance(ab *AddrBalance) {
+	if d.HasRichList() {
+		ab.richListSat.Set(&ab.BalanceSat)
+	}
+}
+
+// updateRichList moves the address in the rich list from the balance stored in the index to the new balance
+func (d *RocksDB) updateRichList(wb *grocksdb.WriteBatch, addrDesc bchain.AddressDescriptor, ab *AddrBalance, balance *big.Int) {
+	if ab.richListSat.Cmp(balance) == 0 {
+		return
+	}
+	if ab.richListSat.Sign() > 0 {
+		key := packRichListKey(addrDesc, &ab.richListSat)
+		wb.DeleteCF(d.cfh[cfRichList], key)
+		d.is.AddDBColumnStats(cfRichList, -1, -int64(len(key)), 0)
+	}
+	if balance.Sign() > 0 {
+		key := packRichListKey(addrDesc, balance)
+		wb.PutCF(d.cfh[cfRichList], key, []byte{})
+		d.is.AddDBColumnStats(cfRichList, 1, int64(len(key)), 0)
+	}
+	ab.richListSat.Set(balance)
+}
+
+// HasRichList returns true if the DB contains the index of addresses sorted by balance
+func (d *RocksDB) HasRichList() bool {
+	return d.is != nil && d.is.RichList
+}
+
+// RichListSize returns the number of addresses with non zero balance in the rich list
+func (d *RocksDB) RichListSize() int {
+	if !d.HasRichList() {
+		return 0
+	}
+	rows, _, _ := d.is.GetDBColumnStatValues(cfRichList)
+	return int(rows)
+}
+
+// GetRichList returns the addresses from the position from to the position to (exclusive) of the rich list
+// The positions are limited by MaxRichListPosition.
+func (d *RocksDB) GetRichList(from, to int) ([]RichListItem, error) {
+	if !d.HasRichList() {
+		return nil, errors.New("Rich list is not enabled")
+	}
+	if to > MaxRichListPosition {
+		to = MaxRichListPosition
+	}
+	if to <= from {
+		return nil, nil
+	}
+	r := make([]RichListItem, 0, to-from)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfRichList])
+	defer it.Close()
+	i := 0
+	for it.SeekToFirst(); it.Valid() && i < to; it.Next() {
+		if i >= from {
+			addrDesc, balance, err := unpackRichListKey(it.Key().Data())
+			if err != nil {
+				return nil, err
+			}
+			r = append(r, RichListItem{AddrDesc: addrDesc, BalanceSat: *balance})
+		}
+		i++
+	}
+	return r, nil
+}
+
+// SetRichList builds the rich list from the addressBalance column if enabled, or deletes it if not enabled
+// The rich list is kept in sync with the balances from the moment it is built.
+func (d *RocksDB) SetRichList(enabled bool, stop chan os.Signal) error {
+	if d.is == nil {
+		return errors.New("Internal state not created")
+	}
+	if d.is.RichList == enabled {
+		return nil
+	}
+	if enabled && d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return errors.New("Rich list is supported only for bitcoin type chains")
+	}
+	start := time.Now()
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	wb.DeleteRangeCF(d.cfh[cfRichList], []byte{0}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if err := d.WriteBatch(wb); err != nil {
+		return err
+	}
+	wb.Clear()
+	d.is.SetDBColumnStats(cfRichList, 0, 0, 0)
+	if !enabled {
+		d.is.RichList = false
+		glog.Info("richList: deleted")
+		return d.storeState(d.is)
+	}
+	glog.Info("richList: building")
+	var rows int64
+	// do not use cache
+	ro := grocksdb.NewDefaultReadOptions()
+	ro.SetFillCache(false)
+	defer ro.Destroy()
+	it := d.db.NewIteratorCF(ro, d.cfh[cfAddressBalance])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		select {
+		case <-stop:
+			d.is.SetDBColumnStats(cfRichList, 0, 0, 0)
+			return ErrOperationInterrupted
+		default:
+		}
+		buf := it.Value().Data()
+		if len(buf) < 5 {
+			continue
+		}
+		ab, err := unpackAddrBalance(buf, d.chainParser.PackedTxidLen(), AddressBalanceDetailNoUTXO)
+		if err != nil {
+			return err
+		}
+		if ab.BalanceSat.Sign() > 0 {
+			d.updateRichList(wb, it.Key().Data(), ab, &ab.BalanceSat)
+			rows++
+		}
+		if wb.Count() >= maxMigrationBatch {
+			if err := d.WriteBatch(wb); err != nil {
+				return err
+			}
+			wb.Clear()
+			glog.Info("richList: ", rows, " addresses, in progress...")
+		}
+	}
+	if err := d.WriteBatch(wb); err != nil {
+		return err
+	}
+	d.is.RichList = true
+	glog.Info("richList: built with ", rows, " addresses in ", time.Since(start))
+	return d.storeState(d.is)
+}
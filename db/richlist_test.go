@@ -0,0 +1,129 @@
+//go:build unittest
+
+package db
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+// expectedRichList returns the addresses with non zero balance from the addressBalance column sorted by balance
+func expectedRichList(t *testing.T, d *RocksDB) []RichListItem {
+	var r []RichListItem
+	for k, v := range columnRows(d, cfAddressBalance) {
+		ab, err := unpackAddrBalance(v, d.chainParser.PackedTxidLen(), AddressBalanceDetailNoUTXO)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ab.BalanceSat.Sign() > 0 {
+			r = append(r, RichListItem{AddrDesc: bchain.AddressDescriptor(k), BalanceSat: ab.BalanceSat})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if c := r[i].BalanceSat.Cmp(&r[j].BalanceSat); c != 0 {
+			return c > 0
+		}
+		return bytes.Compare(r[i].AddrDesc, r[j].AddrDesc) < 0
+	})
+	return r
+}
+
+func verifyRichList(t *testing.T, d *RocksDB, name string) {
+	want := expectedRichList(t, d)
+	if got := d.RichListSize(); got != len(want) {
+		t.Errorf("%s: RichListSize() = %d, want %d", name, got, len(want))
+	}
+	got, err := d.GetRichList(0, len(want)+10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%s: GetRichList() returned %d addresses, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i].AddrDesc, want[i].AddrDesc) || got[i].BalanceSat.Cmp(&want[i].BalanceSat) != 0 {
+			t.Errorf("%s: GetRichList()[%d] = %s %v, want %s %v", name, i, hex.EncodeToString(got[i].AddrDesc), got[i].BalanceSat.String(), hex.EncodeToString(want[i].AddrDesc), want[i].BalanceSat.String())
+		}
+	}
+	// paging returns the same addresses
+	if len(want) > 3 {
+		page, err := d.GetRichList(2, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 2 || !bytes.Equal(page[0].AddrDesc, want[2].AddrDesc) || !bytes.Equal(page[1].AddrDesc, want[3].AddrDesc) {
+			t.Errorf("%s: GetRichList(2, 4) does not match", name)
+		}
+	}
+}
+
+func TestRocksDB_RichList(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.GetRichList(0, 10); err == nil {
+		t.Error("GetRichList() of not enabled rich list expected error")
+	}
+
+	// the rich list is built from the existing balances
+	if err := d.SetRichList(true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !d.HasRichList() {
+		t.Fatal("HasRichList() = false, want true")
+	}
+	verifyRichList(t, d, "block1")
+
+	// and maintained by connect and disconnect of the blocks
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyRichList(t, d, "block2")
+	// the positions beyond MaxRichListPosition are not listed
+	if got, err := d.GetRichList(MaxRichListPosition, MaxRichListPosition+10); err != nil || got != nil {
+		t.Errorf("GetRichList(MaxRichListPosition) = %v, %v, want nil", got, err)
+	}
+	if err := d.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	verifyRichList(t, d, "disconnect block2")
+
+	if err := d.SetRichList(false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d.HasRichList() || d.RichListSize() != 0 || len(columnRows(d, cfRichList)) != 0 {
+		t.Error("rich list not deleted")
+	}
+}
+
+func Test_packRichListKey(t *testing.T) {
+	addrDesc := bchain.AddressDescriptor{0x76, 0xa9, 0x14}
+	amounts := []int64{0, 1, 255, 256, 1000000, 1000001, 2100000000000000}
+	var keys [][]byte
+	for _, a := range amounts {
+		b := *big.NewInt(a)
+		key := packRichListKey(addrDesc, &b)
+		ad, balance, err := unpackRichListKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ad, addrDesc) || balance.Cmp(&b) != 0 {
+			t.Errorf("unpackRichListKey(%x) = %x %v, want %x %v", key, ad, balance, addrDesc, a)
+		}
+		keys = append(keys, key)
+	}
+	// higher balance sorts first
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i], keys[i-1]) >= 0 {
+			t.Errorf("key of %d does not sort before key of %d", amounts[i], amounts[i-1])
+		}
+	}
+}
@@ -22,7 +22,7 @@ import (
 	"github.com/trezor/blockbook/common"
 )
 
-const dbVersion = 6
+const dbVersion = 7
 
 const packedHeightBytes = 4
 const maxAddrDescLen = 1024
@@ -71,6 +71,20 @@ type RocksDB struct {
 	maxOpenFiles  int
 	cbs           connectBlockStats
 	extendedIndex bool
+	// connectMux is held for reading by all writers, the block connects and disconnects, prune, migrations, reindex,
+	// xpub cache and account stores, and for writing by snapshots and by the prune reading the transactions kept for the disconnect
+	connectMux sync.RWMutex
+	compaction *compactionScheduler
+	// xpubCacheMux serializes the updates of the xpub cache by the connected blocks and the stores by the api
+	xpubCacheMux     sync.Mutex
+	xpubCacheChecked bool
+	xpubCacheFound   bool
+	// pruneKeep collects the transactions read by the blocks connected during a prune, the prune does not delete them
+	pruneMux  sync.Mutex
+	pruneKeep map[string]struct{}
+	// accountChanges are the changes of the registered accounts by the last connected blocks, by the heights of the blocks
+	accountChangesMux sync.Mutex
+	accountChanges    map[uint32][]AccountChange
 }
 
 const (
@@ -80,9 +94,18 @@ const (
 	cfBlockTxs
 	cfTransactions
 	cfFiatRates
+	cfOrphanedBlocks
 	// BitcoinType
 	cfAddressBalance
 	cfTxAddresses
+	cfRichList
+	cfBlockStats
+	cfXpubCache
+	cfXpubCacheAddresses
+	cfAccounts
+	cfSilentPayments
+	// only proof of stake coins with coinstake transactions
+	cfStakes
 
 	__break__
 
@@ -99,20 +122,23 @@ const (
 
 // common columns
 var cfNames []string
-var cfBaseNames = []string{"default", "height", "addresses", "blockTxs", "transactions", "fiatRates"}
+var cfBaseNames = []string{"default", "height", "addresses", "blockTxs", "transactions", "fiatRates", "orphanedBlocks"}
 
 // type specific columns
-var cfNamesBitcoinType = []string{"addressBalance", "txAddresses"}
+var cfNamesBitcoinType = []string{"addressBalance", "txAddresses", "richList", "blockStats", "xpubCache", "xpubCacheAddresses", "accounts", "silentPayments"}
 var cfNamesEthereumType = []string{"addressContracts", "internalData", "contracts", "functionSignatures", "blockInternalDataErrors", "addressAliases"}
 
+// columns of the bitcoin type coins with coinstake transactions
+var cfNamesCoinstake = []string{"stakes"}
+
 func openDB(path string, c *grocksdb.Cache, openFiles int) (*grocksdb.DB, []*grocksdb.ColumnFamilyHandle, error) {
 	// opts with bloom filter
 	opts := createAndSetDBOptions(10, c, openFiles)
 	// opts for addresses without bloom filter
 	// from documentation: if most of your queries are executed using iterators, you shouldn't set bloom filter
 	optsAddresses := createAndSetDBOptions(0, c, openFiles)
-	// default, height, addresses, blockTxids, transactions
-	cfOptions := []*grocksdb.Options{opts, opts, optsAddresses, opts, opts, opts}
+	// default, height, addresses, blockTxids, transactions, fiatRates, orphanedBlocks
+	cfOptions := []*grocksdb.Options{opts, opts, optsAddresses, opts, opts, opts, opts}
 	// append type specific options
 	count := len(cfNames) - len(cfOptions)
 	for i := 0; i < count; i++ {
@@ -134,6 +160,9 @@ func NewRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockCha
 	chainType := parser.GetChainType()
 	if chainType == bchain.ChainBitcoinType {
 		cfNames = append(cfNames, cfNamesBitcoinType...)
+		if parser.SupportsCoinstake() {
+			cfNames = append(cfNames, cfNamesCoinstake...)
+		}
 	} else if chainType == bchain.ChainEthereumType {
 		cfNames = append(cfNames, cfNamesEthereumType...)
 		extendedIndex = false
@@ -148,7 +177,19 @@ func NewRocksDB(path string, cacheSize, maxOpenFiles int, parser bchain.BlockCha
 	}
 	wo := grocksdb.NewDefaultWriteOptions()
 	ro := grocksdb.NewDefaultReadOptions()
-	return &RocksDB{path, db, wo, ro, cfh, parser, nil, metrics, c, maxOpenFiles, connectBlockStats{}, extendedIndex}, nil
+	return &RocksDB{
+		path:          path,
+		db:            db,
+		wo:            wo,
+		ro:            ro,
+		cfh:           cfh,
+		chainParser:   parser,
+		metrics:       metrics,
+		cache:         c,
+		maxOpenFiles:  maxOpenFiles,
+		extendedIndex: extendedIndex,
+		compaction:    newCompactionScheduler(),
+	}, nil
 }
 
 func (d *RocksDB) closeDB() error {
@@ -171,6 +212,7 @@ func (d *RocksDB) Close() error {
 			}
 		}
 		glog.Infof("rocksdb: close")
+		d.stopCompactionScheduler()
 		d.closeDB()
 		d.wo.Destroy()
 		d.ro.Destroy()
@@ -211,6 +253,11 @@ func (d *RocksDB) HasExtendedIndex() bool {
 	return d.extendedIndex
 }
 
+// HasStakingIndex returns true if the DB contains complete index of coinstake transactions
+func (d *RocksDB) HasStakingIndex() bool {
+	return d.is != nil && d.is.StakingIndex
+}
+
 // GetMemoryStats returns memory usage statistics as reported by RocksDB
 func (d *RocksDB) GetMemoryStats() string {
 	var total, indexAndFilter, memtable uint64
@@ -332,6 +379,8 @@ const (
 
 // ConnectBlock indexes addresses in the block and stores them in db
 func (d *RocksDB) ConnectBlock(block *bchain.Block) error {
+	d.connectMux.RLock()
+	defer d.connectMux.RUnlock()
 	wb := grocksdb.NewWriteBatch()
 	defer wb.Destroy()
 
@@ -345,18 +394,46 @@ func (d *RocksDB) ConnectBlock(block *bchain.Block) error {
 		return err
 	}
 	addresses := make(addressesMap)
+	var accountChanges []AccountChange
 	if chainType == bchain.ChainBitcoinType {
+		// the xpub cache is locked until the block is written so that the api does not overwrite its updates
+		d.xpubCacheMux.Lock()
+		defer d.xpubCacheMux.Unlock()
 		txAddressesMap := make(map[string]*TxAddresses)
 		balances := make(map[string]*AddrBalance)
-		if err := d.processAddressesBitcoinType(block, addresses, txAddressesMap, balances); err != nil {
+		var stakes stakesMap
+		if d.chainParser.SupportsCoinstake() {
+			stakes = make(stakesMap)
+		}
+		spTweaks := d.newSilentPaymentTweaks()
+		if err := d.processAddressesBitcoinType(block, addresses, txAddressesMap, balances, stakes, spTweaks); err != nil {
+			return err
+		}
+		if spTweaks != nil {
+			d.storeSilentPaymentTweaks(wb, block.Height, *spTweaks)
+		}
+		bs, err := computeBlockStats(d.chainParser, block, addresses, txAddressesMap, balances)
+		if err != nil {
 			return err
 		}
+		d.keepFromPrune(txAddressesMap)
+		d.storeBlockStats(wb, bs)
 		if err := d.storeTxAddresses(wb, txAddressesMap); err != nil {
 			return err
 		}
+		if err := d.storeStakes(wb, block.Height, stakes); err != nil {
+			return err
+		}
 		if err := d.storeBalances(wb, balances); err != nil {
 			return err
 		}
+		accounts, err := d.updateXpubCache(wb, balances, false)
+		if err != nil {
+			return err
+		}
+		if accountChanges, err = d.computeAccountChanges(block, accounts, addresses, balances); err != nil {
+			return err
+		}
 		if err := d.storeAndCleanupBlockTxs(wb, block); err != nil {
 			return err
 		}
@@ -384,9 +461,13 @@ func (d *RocksDB) ConnectBlock(block *bchain.Block) error {
 	if err := d.storeAddresses(wb, block.Height, addresses); err != nil {
 		return err
 	}
+	d.pruneOrphanedBlocks(wb, block.Height)
 	if err := d.WriteBatch(wb); err != nil {
 		return err
 	}
+	if chainType == bchain.ChainBitcoinType {
+		d.setAccountChanges(block.Height, accountChanges)
+	}
 	avg := d.is.AppendBlockTime(uint32(block.Time))
 	if d.metrics != nil {
 		d.metrics.AvgBlockPeriod.Set(float64(avg))
@@ -450,6 +531,30 @@ type TxAddresses struct {
 	VSize uint32
 }
 
+// IsCoinstake returns true if the transaction has the form of a proof of stake coinstake transaction,
+// it spends existing outputs and its first output is empty
+func (ta *TxAddresses) IsCoinstake() bool {
+	return len(ta.Inputs) > 0 && ta.Inputs[0].ValueSat.Sign() > 0 &&
+		len(ta.Outputs) > 1 && len(ta.Outputs[0].AddrDesc) == 0 && ta.Outputs[0].ValueSat.Sign() == 0
+}
+
+// StakingReward returns the net amount received by the address in the coinstake transaction,
+// i.e. the value of the outputs to the address minus the value of the inputs from the address
+func (ta *TxAddresses) StakingReward(addrDesc bchain.AddressDescriptor) *big.Int {
+	var r big.Int
+	for i := range ta.Outputs {
+		if bytes.Equal(addrDesc, ta.Outputs[i].AddrDesc) {
+			r.Add(&r, &ta.Outputs[i].ValueSat)
+		}
+	}
+	for i := range ta.Inputs {
+		if bytes.Equal(addrDesc, ta.Inputs[i].AddrDesc) {
+			r.Sub(&r, &ta.Inputs[i].ValueSat)
+		}
+	}
+	return &r
+}
+
 // Utxo holds information about unspent transaction output
 type Utxo struct {
 	BtxID    []byte
@@ -463,8 +568,12 @@ type AddrBalance struct {
 	Txs        uint32
 	SentSat    big.Int
 	BalanceSat big.Int
+	FirstSeen  uint32
+	LastSeen   uint32
 	Utxos      []Utxo
 	utxosMap   map[string]int
+	// balance of the address in the rich list index
+	richListSat big.Int
 }
 
 // ReceivedSat computes received amount from total balance and sent amount
@@ -474,6 +583,15 @@ func (ab *AddrBalance) ReceivedSat() *big.Int {
 	return &r
 }
 
+// markSeen sets the heights of the first and the last block with a transaction of the address
+// The first seen height 0 of an address with older transactions is unknown (migrated pruned db), it stays unknown.
+func (ab *AddrBalance) markSeen(height uint32) {
+	if ab.FirstSeen == 0 && ab.Txs <= 1 {
+		ab.FirstSeen = height
+	}
+	ab.LastSeen = height
+}
+
 // addUtxo
 func (ab *AddrBalance) addUtxo(u *Utxo) {
 	ab.Utxos = append(ab.Utxos, *u)
@@ -573,8 +691,8 @@ type blockTxs struct {
 	inputs []outpoint
 }
 
-func (d *RocksDB) resetValueSatToZero(valueSat *big.Int, addrDesc bchain.AddressDescriptor, logText string) {
-	ad, _, err := d.chainParser.GetAddressesFromAddrDesc(addrDesc)
+func resetValueSatToZero(p bchain.BlockChainParser, valueSat *big.Int, addrDesc bchain.AddressDescriptor, logText string) {
+	ad, _, err := p.GetAddressesFromAddrDesc(addrDesc)
 	if err != nil {
 		glog.Warningf("rocksdb: unparsable address hex '%v' reached negative %s %v, resetting to 0. Parser error %v", addrDesc, logText, valueSat.String(), err)
 	} else {
@@ -590,19 +708,32 @@ func (d *RocksDB) GetAndResetConnectBlockStats() string {
 	return s
 }
 
-func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses addressesMap, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance) error {
+func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses addressesMap, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance, stakes stakesMap, spTweaks *silentPaymentTweaks) error {
+	return processAddressesBitcoinType(d, d.chainParser, d.extendedIndex, &d.cbs, block, addresses, txAddressesMap, balances, stakes, spTweaks)
+}
+
+// addressIndex gives access to the stored balances and transaction addresses needed to connect a block
+type addressIndex interface {
+	GetAddrDescBalance(addrDesc bchain.AddressDescriptor, detail AddressBalanceDetail) (*AddrBalance, error)
+	getTxAddresses(btxID []byte) (*TxAddresses, error)
+}
+
+// processAddressesBitcoinType computes the changes of the addresses, balances and transaction addresses made by the block
+// the balances and transaction addresses returned by idx are modified, idx must not return its stored instances
+// the silent payment tweaks of the transactions are collected to spTweaks, if it is not nil
+func processAddressesBitcoinType(idx addressIndex, p bchain.BlockChainParser, extendedIndex bool, cbs *connectBlockStats, block *bchain.Block, addresses addressesMap, txAddressesMap map[string]*TxAddresses, balances map[string]*AddrBalance, stakes stakesMap, spTweaks *silentPaymentTweaks) error {
 	blockTxIDs := make([][]byte, len(block.Txs))
 	blockTxAddresses := make([]*TxAddresses, len(block.Txs))
 	// first process all outputs so that inputs can refer to txs in this block
 	for txi := range block.Txs {
 		tx := &block.Txs[txi]
-		btxID, err := d.chainParser.PackTxid(tx.Txid)
+		btxID, err := p.PackTxid(tx.Txid)
 		if err != nil {
 			return err
 		}
 		blockTxIDs[txi] = btxID
 		ta := TxAddresses{Height: block.Height}
-		if d.extendedIndex {
+		if extendedIndex {
 			if tx.VSize > 0 {
 				ta.VSize = uint32(tx.VSize)
 			} else {
@@ -616,7 +747,7 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 			output := &tx.Vout[i]
 			tao := &ta.Outputs[i]
 			tao.ValueSat = output.ValueSat
-			addrDesc, err := d.chainParser.GetAddrDescFromVout(output)
+			addrDesc, err := p.GetAddrDescFromVout(output)
 			if err != nil || len(addrDesc) == 0 || len(addrDesc) > maxAddrDescLen {
 				if err != nil {
 					// do not log ErrAddressMissing, transactions can be without to address (for example eth contracts)
@@ -629,11 +760,11 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 				continue
 			}
 			tao.AddrDesc = addrDesc
-			if d.chainParser.IsAddrDescIndexable(addrDesc) {
+			if p.IsAddrDescIndexable(addrDesc) {
 				strAddrDesc := string(addrDesc)
 				balance, e := balances[strAddrDesc]
 				if !e {
-					balance, err = d.GetAddrDescBalance(addrDesc, addressBalanceDetailUTXOIndexed)
+					balance, err = idx.GetAddrDescBalance(addrDesc, addressBalanceDetailUTXOIndexed)
 					if err != nil {
 						return err
 					}
@@ -641,9 +772,9 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 						balance = &AddrBalance{}
 					}
 					balances[strAddrDesc] = balance
-					d.cbs.balancesMiss++
+					cbs.balancesMiss++
 				} else {
-					d.cbs.balancesHit++
+					cbs.balancesHit++
 				}
 				balance.BalanceSat.Add(&balance.BalanceSat, &output.ValueSat)
 				balance.addUtxo(&Utxo{
@@ -655,6 +786,7 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 				counted := addToAddressesMap(addresses, strAddrDesc, btxID, int32(i))
 				if !counted {
 					balance.Txs++
+					balance.markSeen(block.Height)
 				}
 			}
 		}
@@ -669,14 +801,14 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 		for i := range tx.Vin {
 			input := &tx.Vin[i]
 			tai := &ta.Inputs[i]
-			btxID, err := d.chainParser.PackTxid(input.Txid)
+			btxID, err := p.PackTxid(input.Txid)
 			if err != nil {
 				// do not process inputs without input txid
 				if err == bchain.ErrTxidMissing {
 					if tx.Vin[i].ScriptSig.Hex == "" {
 						tx.Vin[i].ScriptSig.Hex = tx.Vin[i].Coinbase
 					}
-					tai.AddrDesc = d.chainParser.GetAddrDescForUnknownInput(tx, i)
+					tai.AddrDesc = p.GetAddrDescForUnknownInput(tx, i)
 					continue
 				}
 				return err
@@ -684,19 +816,19 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 			stxID := string(btxID)
 			ita, e := txAddressesMap[stxID]
 			if !e {
-				ita, err = d.getTxAddresses(btxID)
+				ita, err = idx.getTxAddresses(btxID)
 				if err != nil {
 					return err
 				}
 				if ita == nil {
 					// allow parser to process unknown input, some coins may implement special handling, default is to log warning
-					tai.AddrDesc = d.chainParser.GetAddrDescForUnknownInput(tx, i)
+					tai.AddrDesc = p.GetAddrDescForUnknownInput(tx, i)
 					continue
 				}
 				txAddressesMap[stxID] = ita
-				d.cbs.txAddressesMiss++
+				cbs.txAddressesMiss++
 			} else {
-				d.cbs.txAddressesHit++
+				cbs.txAddressesHit++
 			}
 			if len(ita.Outputs) <= int(input.Vout) {
 				glog.Warningf("rocksdb: height %d, tx %v, input tx %v vout %v is out of bounds of stored tx", block.Height, tx.Txid, input.Txid, input.Vout)
@@ -710,7 +842,7 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 			tai.ValueSat = spentOutput.ValueSat
 			// mark the output as spent in tx
 			spentOutput.Spent = true
-			if d.extendedIndex {
+			if extendedIndex {
 				spentOutput.SpentTxid = tx.Txid
 				spentOutput.SpentIndex = uint32(i)
 				spentOutput.SpentHeight = block.Height
@@ -724,11 +856,11 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 				}
 				continue
 			}
-			if d.chainParser.IsAddrDescIndexable(spentOutput.AddrDesc) {
+			if p.IsAddrDescIndexable(spentOutput.AddrDesc) {
 				strAddrDesc := string(spentOutput.AddrDesc)
 				balance, e := balances[strAddrDesc]
 				if !e {
-					balance, err = d.GetAddrDescBalance(spentOutput.AddrDesc, addressBalanceDetailUTXOIndexed)
+					balance, err = idx.GetAddrDescBalance(spentOutput.AddrDesc, addressBalanceDetailUTXOIndexed)
 					if err != nil {
 						return err
 					}
@@ -736,22 +868,30 @@ func (d *RocksDB) processAddressesBitcoinType(block *bchain.Block, addresses add
 						balance = &AddrBalance{}
 					}
 					balances[strAddrDesc] = balance
-					d.cbs.balancesMiss++
+					cbs.balancesMiss++
 				} else {
-					d.cbs.balancesHit++
+					cbs.balancesHit++
 				}
 				counted := addToAddressesMap(addresses, strAddrDesc, spendingTxid, ^int32(i))
 				if !counted {
 					balance.Txs++
+					balance.markSeen(block.Height)
 				}
 				balance.BalanceSat.Sub(&balance.BalanceSat, &spentOutput.ValueSat)
 				balance.markUtxoAsSpent(btxID, int32(input.Vout))
 				if balance.BalanceSat.Sign() < 0 {
-					d.resetValueSatToZero(&balance.BalanceSat, spentOutput.AddrDesc, "balance")
+					resetValueSatToZero(p, &balance.BalanceSat, spentOutput.AddrDesc, "balance")
 				}
 				balance.SentSat.Add(&balance.SentSat, &spentOutput.ValueSat)
 			}
 		}
+		// index coinstake transactions, if requested
+		if stakes != nil && ta.IsCoinstake() {
+			stakes.addCoinstake(p, spendingTxid, ta)
+		}
+		if spTweaks != nil {
+			spTweaks.addTx(tx, spendingTxid, ta)
+		}
 	}
 	return nil
 }
@@ -789,6 +929,42 @@ func (d *RocksDB) storeAddresses(wb *grocksdb.WriteBatch, height uint32, address
 	return nil
 }
 
+// addressLastSeen returns the height of the last block not higher than maxHeight with a transaction of the address, 0 if there is none
+func (d *RocksDB) addressLastSeen(addrDesc bchain.AddressDescriptor, maxHeight uint32) (uint32, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+	// the keys of longer address descriptors with the same prefix can be mixed with the keys of the address
+	for it.Seek(packAddressKey(addrDesc, maxHeight)); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, addrDesc) {
+			break
+		}
+		if len(key) == len(addrDesc)+packedHeightBytes {
+			_, height, err := unpackAddressKey(key)
+			return height, err
+		}
+	}
+	return 0, nil
+}
+
+// addressFirstSeen returns the height of the first block with a transaction of the address, 0 if there is none
+func (d *RocksDB) addressFirstSeen(addrDesc bchain.AddressDescriptor) (uint32, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfAddresses])
+	defer it.Close()
+	// the heights are stored in binary complement, the oldest block is the last key of the address
+	for it.SeekForPrev(packAddressKey(addrDesc, 0)); it.Valid(); it.Prev() {
+		key := it.Key().Data()
+		if !bytes.HasPrefix(key, addrDesc) {
+			break
+		}
+		if len(key) == len(addrDesc)+packedHeightBytes {
+			_, height, err := unpackAddressKey(key)
+			return height, err
+		}
+	}
+	return 0, nil
+}
+
 func (d *RocksDB) storeTxAddresses(wb *grocksdb.WriteBatch, am map[string]*TxAddresses) error {
 	varBuf := make([]byte, maxPackedBigintBytes)
 	buf := make([]byte, 1024)
@@ -803,13 +979,21 @@ func (d *RocksDB) storeBalances(wb *grocksdb.WriteBatch, abm map[string]*AddrBal
 	// allocate buffer initial buffer
 	buf := make([]byte, 1024)
 	varBuf := make([]byte, maxPackedBigintBytes)
+	richList := d.HasRichList()
+	var zero big.Int
 	for addrDesc, ab := range abm {
 		// balance with 0 transactions is removed from db - happens on disconnect
 		if ab == nil || ab.Txs <= 0 {
 			wb.DeleteCF(d.cfh[cfAddressBalance], bchain.AddressDescriptor(addrDesc))
+			if richList && ab != nil {
+				d.updateRichList(wb, bchain.AddressDescriptor(addrDesc), ab, &zero)
+			}
 		} else {
 			buf = packAddrBalance(ab, buf, varBuf)
 			wb.PutCF(d.cfh[cfAddressBalance], bchain.AddressDescriptor(addrDesc), buf)
+			if richList {
+				d.updateRichList(wb, bchain.AddressDescriptor(addrDesc), ab, &ab.BalanceSat)
+			}
 		}
 	}
 	return nil
@@ -836,11 +1020,11 @@ func (d *RocksDB) cleanupBlockTxs(wb *grocksdb.WriteBatch, block *bchain.Block)
 	return nil
 }
 
-func (d *RocksDB) storeAndCleanupBlockTxs(wb *grocksdb.WriteBatch, block *bchain.Block) error {
+// blockTxsFromBlock returns the transactions of the block and the outpoints spent by them
+func (d *RocksDB) blockTxsFromBlock(block *bchain.Block) ([]blockTxs, error) {
 	pl := d.chainParser.PackedTxidLen()
-	buf := make([]byte, 0, pl*len(block.Txs))
-	varBuf := make([]byte, vlq.MaxLen64)
 	zeroTx := make([]byte, pl)
+	bt := make([]blockTxs, len(block.Txs))
 	for i := range block.Txs {
 		tx := &block.Txs[i]
 		o := make([]outpoint, len(tx.Vin))
@@ -852,7 +1036,7 @@ func (d *RocksDB) storeAndCleanupBlockTxs(wb *grocksdb.WriteBatch, block *bchain
 				if err == bchain.ErrTxidMissing {
 					btxID = zeroTx
 				} else {
-					return err
+					return nil, err
 				}
 			}
 			o[v].btxID = btxID
@@ -860,12 +1044,26 @@ func (d *RocksDB) storeAndCleanupBlockTxs(wb *grocksdb.WriteBatch, block *bchain
 		}
 		btxID, err := d.chainParser.PackTxid(tx.Txid)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		buf = append(buf, btxID...)
-		l := packVaruint(uint(len(o)), varBuf)
+		bt[i] = blockTxs{btxID: btxID, inputs: o}
+	}
+	return bt, nil
+}
+
+func (d *RocksDB) storeAndCleanupBlockTxs(wb *grocksdb.WriteBatch, block *bchain.Block) error {
+	pl := d.chainParser.PackedTxidLen()
+	buf := make([]byte, 0, pl*len(block.Txs))
+	varBuf := make([]byte, vlq.MaxLen64)
+	bt, err := d.blockTxsFromBlock(block)
+	if err != nil {
+		return err
+	}
+	for i := range bt {
+		buf = append(buf, bt[i].btxID...)
+		l := packVaruint(uint(len(bt[i].inputs)), varBuf)
 		buf = append(buf, varBuf[:l]...)
-		buf = append(buf, d.packOutpoints(o)...)
+		buf = append(buf, d.packOutpoints(bt[i].inputs)...)
 	}
 	key := packUint(block.Height)
 	wb.PutCF(d.cfh[cfBlockTxs], key, buf)
@@ -910,11 +1108,16 @@ func (d *RocksDB) GetAddrDescBalance(addrDesc bchain.AddressDescriptor, detail A
 	}
 	defer val.Free()
 	buf := val.Data()
-	// 3 is minimum length of addrBalance - 1 byte txs, 1 byte sent, 1 byte balance
-	if len(buf) < 3 {
+	// 5 is minimum length of addrBalance - 1 byte txs, 1 byte sent, 1 byte balance, 1 byte first seen, 1 byte last seen
+	if len(buf) < 5 {
 		return nil, nil
 	}
-	return unpackAddrBalance(buf, d.chainParser.PackedTxidLen(), detail)
+	ab, err := unpackAddrBalance(buf, d.chainParser.PackedTxidLen(), detail)
+	if err != nil {
+		return nil, err
+	}
+	d.markRichListBalance(ab)
+	return ab, nil
 }
 
 // GetAddressBalance returns address balance for an address or nil if address not found
@@ -1056,10 +1259,16 @@ func unpackAddrBalance(buf []byte, txidUnpackedLen int, detail AddressBalanceDet
 	sentSat, sl := unpackBigint(buf[l:])
 	balanceSat, bl := unpackBigint(buf[l+sl:])
 	l = l + sl + bl
+	firstSeen, fl := unpackVaruint(buf[l:])
+	l += fl
+	lastSeen, ll := unpackVaruint(buf[l:])
+	l += ll
 	ab := &AddrBalance{
 		Txs:        uint32(txs),
 		SentSat:    sentSat,
 		BalanceSat: balanceSat,
+		FirstSeen:  uint32(firstSeen),
+		LastSeen:   uint32(lastSeen),
 	}
 	if detail != AddressBalanceDetailNoUTXO {
 		// estimate the size of utxos to avoid reallocation
@@ -1098,6 +1307,10 @@ func packAddrBalance(ab *AddrBalance, buf, varBuf []byte) []byte {
 	buf = append(buf, varBuf[:l]...)
 	l = packBigint(&ab.BalanceSat, varBuf)
 	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(ab.FirstSeen), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(ab.LastSeen), varBuf)
+	buf = append(buf, varBuf[:l]...)
 	for _, utxo := range ab.Utxos {
 		// if Vout < 0, utxo is marked as spent and removed from the entry
 		if utxo.Vout >= 0 {
@@ -1458,7 +1671,7 @@ func (d *RocksDB) disconnectTxAddressesInputs(wb *grocksdb.WriteBatch, btxID []b
 					}
 					balance.SentSat.Sub(&balance.SentSat, &t.ValueSat)
 					if balance.SentSat.Sign() < 0 {
-						d.resetValueSatToZero(&balance.SentSat, t.AddrDesc, "sent amount")
+						resetValueSatToZero(d.chainParser, &balance.SentSat, t.AddrDesc, "sent amount")
 					}
 					balance.BalanceSat.Add(&balance.BalanceSat, &t.ValueSat)
 					balance.addUtxoInDisconnect(&Utxo{
@@ -1495,7 +1708,7 @@ func (d *RocksDB) disconnectTxAddressesOutputs(wb *grocksdb.WriteBatch, btxID []
 					}
 					balance.BalanceSat.Sub(&balance.BalanceSat, &t.ValueSat)
 					if balance.BalanceSat.Sign() < 0 {
-						d.resetValueSatToZero(&balance.BalanceSat, t.AddrDesc, "balance")
+						resetValueSatToZero(d.chainParser, &balance.BalanceSat, t.AddrDesc, "balance")
 					}
 					balance.markUtxoAsSpent(btxID, int32(i))
 				} else {
@@ -1508,7 +1721,7 @@ func (d *RocksDB) disconnectTxAddressesOutputs(wb *grocksdb.WriteBatch, btxID []
 	return nil
 }
 
-func (d *RocksDB) disconnectBlock(height uint32, blockTxs []blockTxs) error {
+func (d *RocksDB) disconnectBlock(height uint32, blockTxs []blockTxs, orphaned *OrphanedBlock) error {
 	wb := grocksdb.NewWriteBatch()
 	defer wb.Destroy()
 	txAddressesToUpdate := make(map[string]*TxAddresses)
@@ -1579,15 +1792,40 @@ func (d *RocksDB) disconnectBlock(height uint32, blockTxs []blockTxs) error {
 			return err
 		}
 	}
+	stakes := d.chainParser.SupportsCoinstake()
 	for a := range blockAddressesTxs {
+		// the last activity of the address moves to an older block
+		if b := balances[a]; b != nil && b.Txs > 0 && b.LastSeen >= height && height > 0 {
+			lastSeen, err := d.addressLastSeen([]byte(a), height-1)
+			if err != nil {
+				return err
+			}
+			b.LastSeen = lastSeen
+		}
 		key := packAddressKey([]byte(a), height)
 		wb.DeleteCF(d.cfh[cfAddresses], key)
+		// stakes use the same key as addresses, delete the possible stake of the address in the block
+		if stakes {
+			wb.DeleteCF(d.cfh[cfStakes], key)
+		}
 	}
 	key := packUint(height)
 	wb.DeleteCF(d.cfh[cfBlockTxs], key)
 	wb.DeleteCF(d.cfh[cfHeight], key)
+	wb.DeleteCF(d.cfh[cfBlockStats], key)
+	wb.DeleteCF(d.cfh[cfSilentPayments], key)
+	if orphaned != nil {
+		if err := d.storeOrphanedBlock(wb, orphaned); err != nil {
+			return err
+		}
+	}
 	d.storeTxAddresses(wb, txAddressesToUpdate)
 	d.storeBalancesDisconnect(wb, balances)
+	d.xpubCacheMux.Lock()
+	defer d.xpubCacheMux.Unlock()
+	if _, err := d.updateXpubCache(wb, balances, true); err != nil {
+		return err
+	}
 	for s := range txsToDelete {
 		b := []byte(s)
 		wb.DeleteCF(d.cfh[cfTransactions], b)
@@ -1599,6 +1837,12 @@ func (d *RocksDB) disconnectBlock(height uint32, blockTxs []blockTxs) error {
 // DisconnectBlockRangeBitcoinType removes all data belonging to blocks in range lower-higher
 // it is able to disconnect only blocks for which there are data in the blockTxs column
 func (d *RocksDB) DisconnectBlockRangeBitcoinType(lower uint32, higher uint32) error {
+	return d.disconnectBlockRangeBitcoinType(lower, higher, nil, nil)
+}
+
+func (d *RocksDB) disconnectBlockRangeBitcoinType(lower uint32, higher uint32, getBlock GetBlockFunc, orphaned []OrphanedBlock) error {
+	d.connectMux.RLock()
+	defer d.connectMux.RUnlock()
 	blocks := make([][]blockTxs, higher-lower+1)
 	for height := lower; height <= higher; height++ {
 		blockTxs, err := d.getBlockTxs(height)
@@ -1606,18 +1850,29 @@ func (d *RocksDB) DisconnectBlockRangeBitcoinType(lower uint32, higher uint32) e
 			return err
 		}
 		if len(blockTxs) == 0 {
-			return errors.Errorf("Cannot disconnect blocks with height %v and lower. It is necessary to rebuild index.", height)
+			if getBlock == nil {
+				return errors.Errorf("Cannot disconnect blocks with height %v and lower. It is necessary to rebuild index.", height)
+			}
+			if blockTxs, err = d.reconstructBlockTxs(height, getBlock); err != nil {
+				return err
+			}
 		}
 		blocks[height-lower] = blockTxs
 	}
 	for height := higher; height >= lower; height-- {
-		err := d.disconnectBlock(height, blocks[height-lower])
+		err := d.disconnectBlock(height, blocks[height-lower], findOrphanedBlock(orphaned, height))
 		if err != nil {
 			return err
 		}
 	}
 	d.is.RemoveLastBlockTimes(int(higher-lower) + 1)
 	glog.Infof("rocksdb: blocks %d-%d disconnected", lower, higher)
+	// the deletes leave tombstones in the address columns until they are compacted
+	if higher-lower+1 >= compactAfterDisconnectBlocks {
+		if err := d.scheduleCompaction([]int{cfAddresses, cfTxAddresses}); err != nil {
+			glog.Info("rocksdb: compaction after disconnect not scheduled: ", err)
+		}
+	}
 	return nil
 }
 
@@ -1780,24 +2035,20 @@ func (d *RocksDB) checkColumns(is *common.InternalState) ([]common.InternalState
 		for j := 0; j < len(sc); j++ {
 			if sc[j].Name == nc[i].Name {
 				// check the version of the column, if it does not match, the db is not compatible
+				// unless there are registered migrations of the column to the current version
 				if sc[j].Version != dbVersion {
-					// upgrade of DB 5 to 6 for BitcoinType coins is possible
-					// columns transactions and fiatRates must be cleared as they are not compatible
-					if sc[j].Version == 5 && dbVersion == 6 && d.chainParser.GetChainType() == bchain.ChainBitcoinType {
-						if nc[i].Name == "transactions" {
-							d.db.DeleteRangeCF(d.wo, d.cfh[cfTransactions], []byte{0}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
-						} else if nc[i].Name == "fiatRates" {
-							d.db.DeleteRangeCF(d.wo, d.cfh[cfFiatRates], []byte{0}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
-						}
-						glog.Infof("Column %s upgraded from v%d to v%d", nc[i].Name, sc[j].Version, dbVersion)
-					} else {
+					if !d.canMigrate(sc[j].Version) {
 						return nil, errors.Errorf("DB version %v of column '%v' does not match the required version %v. DB is not compatible.", sc[j].Version, sc[j].Name, dbVersion)
 					}
+					glog.Infof("Column %s will be migrated from v%d to v%d", nc[i].Name, sc[j].Version, dbVersion)
+					nc[i].Version = sc[j].Version
 				}
 				nc[i].Rows = sc[j].Rows
 				nc[i].KeyBytes = sc[j].KeyBytes
 				nc[i].ValueBytes = sc[j].ValueBytes
 				nc[i].Updated = sc[j].Updated
+				nc[i].SizeOnDisk = sc[j].SizeOnDisk
+				nc[i].Compacted = sc[j].Compacted
 				break
 			}
 		}
@@ -1815,7 +2066,8 @@ func (d *RocksDB) LoadInternalState(rpcCoin string) (*common.InternalState, erro
 	data := val.Data()
 	var is *common.InternalState
 	if len(data) == 0 {
-		is = &common.InternalState{Coin: rpcCoin, UtxoChecked: true, ExtendedIndex: d.extendedIndex}
+		// stakes are indexed from the beginning only in a new db
+		is = &common.InternalState{Coin: rpcCoin, UtxoChecked: true, ExtendedIndex: d.extendedIndex, StakingIndex: d.chainParser.SupportsCoinstake()}
 	} else {
 		is, err = common.UnpackInternalState(data)
 		if err != nil {
@@ -1908,6 +2160,16 @@ func (d *RocksDB) storeState(is *common.InternalState) error {
 	return d.db.PutCF(d.wo, d.cfh[cfDefault], []byte(internalStateKey), buf)
 }
 
+// storeStateToBatch stores the internal state in the batch, together with the data it describes
+func (d *RocksDB) storeStateToBatch(wb *grocksdb.WriteBatch, is *common.InternalState) error {
+	buf, err := is.Pack()
+	if err != nil {
+		return err
+	}
+	wb.PutCF(d.cfh[cfDefault], []byte(internalStateKey), buf)
+	return nil
+}
+
 func (d *RocksDB) computeColumnSize(col int, stopCompute chan os.Signal) (int64, int64, int64, error) {
 	var rows, keysSum, valuesSum int64
 	var seekKey []byte
@@ -2115,7 +2377,7 @@ func (d *RocksDB) FixUtxos(stop chan os.Signal) error {
 			buf := it.Value().Data()
 			count++
 			row++
-			if len(buf) < 3 {
+			if len(buf) < 5 {
 				glog.Error("FixUtxos: row ", row, ", addrDesc ", addrDesc, ", empty data")
 				errorsCount++
 				continue
@@ -2126,6 +2388,7 @@ func (d *RocksDB) FixUtxos(stop chan os.Signal) error {
 				errorsCount++
 				continue
 			}
+			d.markRichListBalance(ba)
 			fixed, reordered, err := d.fixUtxo(addrDesc, ba)
 			if err != nil {
 				errorsCount++
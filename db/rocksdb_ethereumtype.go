@@ -32,9 +32,19 @@ type AddrContracts struct {
 	TotalTxs       uint
 	NonContractTxs uint
 	InternalTxs    uint
+	FirstSeen      uint32
+	LastSeen       uint32
 	Contracts      []AddrContract
 }
 
+// markSeen sets the heights of the first and the last block with a transaction of the address
+func (acs *AddrContracts) markSeen(height uint32) {
+	if acs.FirstSeen == 0 {
+		acs.FirstSeen = height
+	}
+	acs.LastSeen = height
+}
+
 // packAddrContract packs AddrContracts into a byte buffer
 func packAddrContracts(acs *AddrContracts) []byte {
 	buf := make([]byte, 0, 128)
@@ -45,6 +55,10 @@ func packAddrContracts(acs *AddrContracts) []byte {
 	buf = append(buf, varBuf[:l]...)
 	l = packVaruint(acs.InternalTxs, varBuf)
 	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(acs.FirstSeen), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(acs.LastSeen), varBuf)
+	buf = append(buf, varBuf[:l]...)
 	for _, ac := range acs.Contracts {
 		buf = append(buf, ac.Contract...)
 		l = packVaruint(uint(ac.Type)+ac.Txs<<2, varBuf)
@@ -80,6 +94,10 @@ func unpackAddrContracts(buf []byte, addrDesc bchain.AddressDescriptor) (*AddrCo
 	buf = buf[l:]
 	ict, l := unpackVaruint(buf)
 	buf = buf[l:]
+	fs, l := unpackVaruint(buf)
+	buf = buf[l:]
+	ls, l := unpackVaruint(buf)
+	buf = buf[l:]
 	c := make([]AddrContract, 0, 4)
 	for len(buf) > 0 {
 		if len(buf) < eth.EthereumTypeAddressDescriptorLen {
@@ -127,6 +145,8 @@ func unpackAddrContracts(buf []byte, addrDesc bchain.AddressDescriptor) (*AddrCo
 		TotalTxs:       tt,
 		NonContractTxs: nct,
 		InternalTxs:    ict,
+		FirstSeen:      uint32(fs),
+		LastSeen:       uint32(ls),
 		Contracts:      c,
 	}, nil
 }
@@ -507,6 +527,11 @@ func (d *RocksDB) processAddressesEthereumType(block *bchain.Block, addresses ad
 			return nil, err
 		}
 	}
+	for addrDesc := range addresses {
+		if ac := addressContracts[addrDesc]; ac != nil {
+			ac.markSeen(block.Height)
+		}
+	}
 	return blockTxs, nil
 }
 
@@ -668,6 +693,19 @@ func (d *RocksDB) StoreFourByteSignature(wb *grocksdb.WriteBatch, fourBytes uint
 	return nil
 }
 
+// StoreFourByteSignatures stores 4byte signatures in DB in one write batch
+func (d *RocksDB) StoreFourByteSignatures(records []FourByteSignatureRecord) error {
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for i := range records {
+		r := &records[i]
+		if err := d.StoreFourByteSignature(wb, r.FourBytes, r.ID, r.Signature); err != nil {
+			return err
+		}
+	}
+	return d.WriteBatch(wb)
+}
+
 // GetEthereumInternalData gets transaction internal data from DB
 func (d *RocksDB) GetEthereumInternalData(txid string) (*bchain.EthereumInternalData, error) {
 	btxID, err := d.chainParser.PackTxid(txid)
@@ -1161,6 +1199,14 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *grocksdb.WriteBatch, height
 		wb.DeleteCF(d.cfh[cfInternalData], blockTx.btxID)
 	}
 	for a := range addresses {
+		// the last activity of the address moves to an older block
+		if ac := contracts[a]; ac != nil && ac.LastSeen >= height && height > 0 {
+			lastSeen, err := d.addressLastSeen([]byte(a), height-1)
+			if err != nil {
+				return err
+			}
+			ac.LastSeen = lastSeen
+		}
 		key := packAddressKey([]byte(a), height)
 		wb.DeleteCF(d.cfh[cfAddresses], key)
 	}
@@ -1170,6 +1216,12 @@ func (d *RocksDB) disconnectBlockTxsEthereumType(wb *grocksdb.WriteBatch, height
 // DisconnectBlockRangeEthereumType removes all data belonging to blocks in range lower-higher
 // it is able to disconnect only blocks for which there are data in the blockTxs column
 func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32) error {
+	return d.disconnectBlockRangeEthereumType(lower, higher, nil, nil)
+}
+
+func (d *RocksDB) disconnectBlockRangeEthereumType(lower uint32, higher uint32, getBlock GetBlockFunc, orphaned []OrphanedBlock) error {
+	d.connectMux.RLock()
+	defer d.connectMux.RUnlock()
 	blocks := make([][]ethBlockTx, higher-lower+1)
 	for height := lower; height <= higher; height++ {
 		blockTxs, err := d.getBlockTxsEthereumType(height)
@@ -1178,7 +1230,12 @@ func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32)
 		}
 		// nil blockTxs means blockTxs were not found in db
 		if blockTxs == nil {
-			return errors.Errorf("Cannot disconnect blocks with height %v and lower. It is necessary to rebuild index.", height)
+			if getBlock == nil {
+				return errors.Errorf("Cannot disconnect blocks with height %v and lower. It is necessary to rebuild index.", height)
+			}
+			if blockTxs, err = d.reconstructBlockTxsEthereumType(height, getBlock); err != nil {
+				return err
+			}
 		}
 		blocks[height-lower] = blockTxs
 	}
@@ -1194,6 +1251,11 @@ func (d *RocksDB) DisconnectBlockRangeEthereumType(lower uint32, higher uint32)
 		wb.DeleteCF(d.cfh[cfHeight], key)
 		wb.DeleteCF(d.cfh[cfBlockInternalDataErrors], key)
 	}
+	for i := range orphaned {
+		if err := d.storeOrphanedBlock(wb, &orphaned[i]); err != nil {
+			return err
+		}
+	}
 	d.storeAddressContracts(wb, contracts)
 	err := d.WriteBatch(wb)
 	if err == nil {
@@ -55,17 +55,17 @@ func verifyAfterEthereumTypeBlock1(t *testing.T, d *RocksDB, afterDisconnect boo
 	}
 
 	if err := checkColumn(d, cfAddressContracts, []keyPair{
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser), "020102", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser), "020102" + varuintToHex(4321000) + varuintToHex(4321000), nil},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser),
-			"020100" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("10000000000000000000000"), nil,
+			"020100" + varuintToHex(4321000) + varuintToHex(4321000) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("10000000000000000000000"), nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser),
-			"010100" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintToHex(big.NewInt(0)), nil,
+			"010100" + varuintToHex(4321000) + varuintToHex(4321000) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintToHex(big.NewInt(0)), nil,
 		},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser), "010002", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "010101", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser), "010002" + varuintToHex(4321000) + varuintToHex(4321000), nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "010101" + varuintToHex(4321000) + varuintToHex(4321000), nil},
 	}); err != nil {
 		{
 			t.Fatal(err)
@@ -177,51 +177,51 @@ func verifyAfterEthereumTypeBlock2(t *testing.T, d *RocksDB, wantBlockInternalDa
 	if err := checkColumn(d, cfAddressContracts, []keyPair{
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr20, d.chainParser),
-			"010100" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintToHex(big.NewInt(0)), nil,
+			"010100" + varuintToHex(4321000) + varuintToHex(4321000) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintToHex(big.NewInt(0)), nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr3e, d.chainParser),
-			"030202" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + varuintToHex(1<<2+uint(bchain.MultiToken)) + varuintToHex(1) + bigintFromStringToHex("150") + bigintFromStringToHex("1"), nil,
+			"030202" + varuintToHex(4321000) + varuintToHex(4321001) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + varuintToHex(1<<2+uint(bchain.MultiToken)) + varuintToHex(1) + bigintFromStringToHex("150") + bigintFromStringToHex("1"), nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr4b, d.chainParser),
-			"010101" +
+			"010101" + varuintToHex(4321001) + varuintToHex(4321001) +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + varuintToHex(2<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("8086") +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(2<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("871180000950184"), nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser),
-			"050300" +
+			"050300" + varuintToHex(4321000) + varuintToHex(4321001) +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(2<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("10000000854307892726464") +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("0") +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr55, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("0"), nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr5d, d.chainParser),
-			"010100" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + varuintToHex(1<<2+uint(bchain.MultiToken)) + varuintToHex(2) + bigintFromStringToHex("1776") + bigintFromStringToHex("1") + bigintFromStringToHex("1898") + bigintFromStringToHex("10"), nil,
+			"010100" + varuintToHex(4321001) + varuintToHex(4321001) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + varuintToHex(1<<2+uint(bchain.MultiToken)) + varuintToHex(2) + bigintFromStringToHex("1776") + bigintFromStringToHex("1") + bigintFromStringToHex("1898") + bigintFromStringToHex("10"), nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr7b, d.chainParser),
-			"020000" +
+			"020000" + varuintToHex(4321001) + varuintToHex(4321001) +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("0") +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser) + varuintToHex(1<<2+uint(bchain.FungibleToken)) + bigintFromStringToHex("7674999999999991915") +
 				dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + varuintToHex(1<<2+uint(bchain.NonFungibleToken)) + varuintToHex(1) + bigintFromStringToHex("1"), nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr83, d.chainParser),
-			"010100" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + varuintToHex(1<<2+uint(bchain.NonFungibleToken)) + varuintToHex(0), nil,
+			"010100" + varuintToHex(4321001) + varuintToHex(4321001) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser) + varuintToHex(1<<2+uint(bchain.NonFungibleToken)) + varuintToHex(0), nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrA3, d.chainParser),
-			"010000" + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + varuintToHex(1<<2+uint(bchain.MultiToken)) + varuintToHex(0), nil,
+			"010000" + varuintToHex(4321001) + varuintToHex(4321001) + dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser) + varuintToHex(1<<2+uint(bchain.MultiToken)) + varuintToHex(0), nil,
 		},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr92, d.chainParser), "010100", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser), "030104", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser), "010001", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser), "010100", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "020102", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser), "010100", nil},
-		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser), "010100", nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr92, d.chainParser), "010100" + varuintToHex(4321001) + varuintToHex(4321001), nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddr9f, d.chainParser), "030104" + varuintToHex(4321000) + varuintToHex(4321001), nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract0d, d.chainParser), "010001" + varuintToHex(4321001) + varuintToHex(4321001), nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract47, d.chainParser), "010100" + varuintToHex(4321001) + varuintToHex(4321001), nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract4a, d.chainParser), "020102" + varuintToHex(4321000) + varuintToHex(4321001), nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContract6f, d.chainParser), "010100" + varuintToHex(4321001) + varuintToHex(4321001), nil},
+		{dbtestdata.AddressToPubKeyHex(dbtestdata.EthAddrContractCd, d.chainParser), "010100" + varuintToHex(4321001) + varuintToHex(4321001), nil},
 	}); err != nil {
 		{
 			t.Fatal(err)
@@ -567,6 +567,51 @@ func TestRocksDB_Index_EthereumType(t *testing.T) {
 
 }
 
+func Test_DisconnectDeepBlockRange_EthereumType(t *testing.T) {
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: ethereumTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	block1 := dbtestdata.GetTestEthereumTypeBlock1(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestEthereumTypeBlock2(d.chainParser)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blockTxs of the 1st block are not kept, they are reconstructed from the block returned by the backend
+	err := d.DisconnectDeepBlockRange(block1.Height, block2.Height, func(hash string, height uint32) (*bchain.Block, error) {
+		if hash != block1.Hash || height != block1.Height {
+			t.Fatalf("Unexpected request of block %d %s", height, hash)
+		}
+		return dbtestdata.GetTestEthereumTypeBlock1(d.chainParser), nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 0 || hash != "" {
+		t.Fatalf("Expecting empty db, got best block %d %s", height, hash)
+	}
+	for _, col := range []int{cfHeight, cfAddresses, cfBlockTxs, cfInternalData} {
+		if err := checkColumn(d, col, []keyPair{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the index can be synchronized again
+	if err := d.ConnectBlock(dbtestdata.GetTestEthereumTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterEthereumTypeBlock1(t, d, false)
+}
+
 func Test_BulkConnect_EthereumType(t *testing.T) {
 	d := setupRocksDB(t, &testEthereumParser{
 		EthereumParser: ethereumTestnetParser(),
@@ -617,6 +662,83 @@ func Test_BulkConnect_EthereumType(t *testing.T) {
 	}
 }
 
+func Test_BulkConnect_EthereumType_Checkpoint(t *testing.T) {
+	d := setupRocksDB(t, &testEthereumParser{
+		EthereumParser: ethereumTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	bc, err := d.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block1 := dbtestdata.GetTestEthereumTypeBlock1(d.chainParser)
+	if err := bc.ConnectBlock(block1, false); err != nil {
+		t.Fatal(err)
+	}
+	// the checkpoint writes the modified address contracts, they stay in the cache
+	cached := len(bc.addressContracts)
+	if err := bc.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.finishStoreAddressContracts(nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.addressContracts) != cached || len(bc.dirtyAddrContracts) != 0 {
+		t.Fatalf("Expecting %d address contracts in the cache and none modified, got %d and %d", cached, len(bc.addressContracts), len(bc.dirtyAddrContracts))
+	}
+	if rows := len(columnRows(d, cfAddressContracts)); rows != cached {
+		t.Fatalf("Expecting %d address contracts in db, got %d", cached, rows)
+	}
+	is, err := d.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.BulkCheckpoint == nil || is.BulkCheckpoint.Height != block1.Height || is.BulkCheckpoint.Hash != block1.Hash {
+		t.Fatalf("Expecting checkpoint at %d %s, got %+v", block1.Height, block1.Hash, is.BulkCheckpoint)
+	}
+
+	// only the address contracts modified by the second block are written by the next checkpoint
+	block2 := dbtestdata.GetTestEthereumTypeBlock2(d.chainParser)
+	if err := bc.ConnectBlock(block2, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.dirtyAddrContracts) == 0 || len(bc.dirtyAddrContracts) != len(bc.bulkAddresses[len(bc.bulkAddresses)-1].addresses) {
+		t.Fatalf("Expecting the addresses of block2 modified, got %d", len(bc.dirtyAddrContracts))
+	}
+	cached = len(bc.addressContracts)
+	if err := bc.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	// simulate eviction of all cached address contracts, the address modified during the background write stays in the cache
+	bc.storingAddrContracts = make(map[string]struct{}, cached)
+	for k := range bc.addressContracts {
+		bc.storingAddrContracts[k] = struct{}{}
+	}
+	var modified string
+	for k := range bc.addressContracts {
+		modified = k
+		break
+	}
+	if err := bc.finishStoreAddressContracts(addressesMap{modified: nil}, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(bc.addressContracts) != 1 || bc.addressContracts[modified] == nil {
+		t.Fatalf("Expecting only the modified address in the cache of %d address contracts, got %d", cached, len(bc.addressContracts))
+	}
+	if rows := len(columnRows(d, cfAddressContracts)); rows != cached {
+		t.Fatalf("Expecting %d address contracts in db, got %d", cached, rows)
+	}
+
+	if err := bc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d.is.DbState != common.DbStateOpen || d.is.BulkCheckpoint != nil {
+		t.Fatal("DB not in DbStateOpen")
+	}
+	verifyAfterEthereumTypeBlock2(t, d, true)
+}
+
 func Test_packUnpackEthInternalData(t *testing.T) {
 	parser := ethereumTestnetParser()
 	db := &RocksDB{chainParser: parser}
@@ -754,6 +876,8 @@ func Test_packUnpackAddrContracts(t *testing.T) {
 				TotalTxs:       12345,
 				NonContractTxs: 444,
 				InternalTxs:    8873,
+				FirstSeen:      1234567,
+				LastSeen:       4321001,
 				Contracts: []AddrContract{
 					{
 						Type:     bchain.FungibleToken,
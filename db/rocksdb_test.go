@@ -15,6 +15,7 @@ import (
 
 	vlq "github.com/bsm/go-vlq"
 	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
 	"github.com/martinboehm/btcutil/chaincfg"
 	"github.com/trezor/blockbook/bchain"
 	"github.com/trezor/blockbook/bchain/coins/btc"
@@ -229,32 +230,32 @@ func verifyAfterBitcoinTypeBlock1(t *testing.T, d *RocksDB, afterDisconnect bool
 	if err := checkColumn(d, cfAddressBalance, []keyPair{
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T1A1) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T1A1) + varuintToHex(225493) + varuintToHex(225493) +
 				dbtestdata.TxidB1T1 + varuintToHex(0) + varuintToHex(225493) + bigintToHex(dbtestdata.SatB1T1A1),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T1A2Double) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T1A2Double) + varuintToHex(225493) + varuintToHex(225493) +
 				dbtestdata.TxidB1T1 + varuintToHex(1) + varuintToHex(225493) + bigintToHex(dbtestdata.SatB1T1A2) +
 				dbtestdata.TxidB1T1 + varuintToHex(2) + varuintToHex(225493) + bigintToHex(dbtestdata.SatB1T1A2),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T2A3) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T2A3) + varuintToHex(225493) + varuintToHex(225493) +
 				dbtestdata.TxidB1T2 + varuintToHex(0) + varuintToHex(225493) + bigintToHex(dbtestdata.SatB1T2A3),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T2A4) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T2A4) + varuintToHex(225493) + varuintToHex(225493) +
 				dbtestdata.TxidB1T2 + varuintToHex(1) + varuintToHex(225493) + bigintToHex(dbtestdata.SatB1T2A4),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T2A5) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T2A5) + varuintToHex(225493) + varuintToHex(225493) +
 				dbtestdata.TxidB1T2 + varuintToHex(2) + varuintToHex(225493) + bigintToHex(dbtestdata.SatB1T2A5),
 			nil,
 		},
@@ -301,6 +302,23 @@ func verifyAfterBitcoinTypeBlock2(t *testing.T, d *RocksDB) {
 			t.Fatal(err)
 		}
 	}
+	bs1, bs2 := testBitcoinTypeBlockStats()
+	if err := checkColumn(d, cfBlockStats, []keyPair{
+		{
+			"000370d5",
+			hex.EncodeToString(packBlockStats(&bs1)),
+			nil,
+		},
+		{
+			"000370d6",
+			hex.EncodeToString(packBlockStats(&bs2)),
+			nil,
+		},
+	}); err != nil {
+		{
+			t.Fatal(err)
+		}
+	}
 	if err := checkColumn(d, cfAddresses, []keyPair{
 		{addressKeyHex(dbtestdata.Addr1, 225493, d), txIndexesHex(dbtestdata.TxidB1T1, []int32{0}), nil},
 		{addressKeyHex(dbtestdata.Addr2, 225493, d), txIndexesHex(dbtestdata.TxidB1T1, []int32{1, 2}), nil},
@@ -391,58 +409,58 @@ func verifyAfterBitcoinTypeBlock2(t *testing.T, d *RocksDB) {
 	if err := checkColumn(d, cfAddressBalance, []keyPair{
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr1, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T1A1) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB1T1A1) + varuintToHex(225493) + varuintToHex(225493) +
 				dbtestdata.TxidB1T1 + varuintToHex(0) + varuintToHex(225493) + bigintToHex(dbtestdata.SatB1T1A1),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr2, d.chainParser),
-			"02" + bigintToHex(dbtestdata.SatB1T1A2) + bigintToHex(dbtestdata.SatB1T1A2) +
+			"02" + bigintToHex(dbtestdata.SatB1T1A2) + bigintToHex(dbtestdata.SatB1T1A2) + varuintToHex(225493) + varuintToHex(225494) +
 				dbtestdata.TxidB1T1 + varuintToHex(2) + varuintToHex(225493) + bigintToHex(dbtestdata.SatB1T1A2),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr3, d.chainParser),
-			"02" + bigintToHex(dbtestdata.SatB1T2A3) + bigintToHex(dbtestdata.SatZero),
+			"02" + bigintToHex(dbtestdata.SatB1T2A3) + bigintToHex(dbtestdata.SatZero) + varuintToHex(225493) + varuintToHex(225494),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr4, d.chainParser),
-			"02" + bigintToHex(dbtestdata.SatB1T2A4) + bigintToHex(dbtestdata.SatZero),
+			"02" + bigintToHex(dbtestdata.SatB1T2A4) + bigintToHex(dbtestdata.SatZero) + varuintToHex(225493) + varuintToHex(225494),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr5, d.chainParser),
-			"02" + bigintToHex(dbtestdata.SatB1T2A5) + bigintToHex(dbtestdata.SatB2T3A5) +
+			"02" + bigintToHex(dbtestdata.SatB1T2A5) + bigintToHex(dbtestdata.SatB2T3A5) + varuintToHex(225493) + varuintToHex(225494) +
 				dbtestdata.TxidB2T3 + varuintToHex(0) + varuintToHex(225494) + bigintToHex(dbtestdata.SatB2T3A5),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr6, d.chainParser),
-			"02" + bigintToHex(dbtestdata.SatB2T1A6) + bigintToHex(dbtestdata.SatZero),
+			"02" + bigintToHex(dbtestdata.SatB2T1A6) + bigintToHex(dbtestdata.SatZero) + varuintToHex(225494) + varuintToHex(225494),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr7, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB2T1A7) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB2T1A7) + varuintToHex(225494) + varuintToHex(225494) +
 				dbtestdata.TxidB2T1 + varuintToHex(1) + varuintToHex(225494) + bigintToHex(dbtestdata.SatB2T1A7),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr8, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB2T2A8) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB2T2A8) + varuintToHex(225494) + varuintToHex(225494) +
 				dbtestdata.TxidB2T2 + varuintToHex(0) + varuintToHex(225494) + bigintToHex(dbtestdata.SatB2T2A8),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.Addr9, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB2T2A9) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB2T2A9) + varuintToHex(225494) + varuintToHex(225494) +
 				dbtestdata.TxidB2T2 + varuintToHex(1) + varuintToHex(225494) + bigintToHex(dbtestdata.SatB2T2A9),
 			nil,
 		},
 		{
 			dbtestdata.AddressToPubKeyHex(dbtestdata.AddrA, d.chainParser),
-			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB2T4AA) +
+			"01" + bigintToHex(dbtestdata.SatZero) + bigintToHex(dbtestdata.SatB2T4AA) + varuintToHex(225494) + varuintToHex(225494) +
 				dbtestdata.TxidB2T4 + varuintToHex(0) + varuintToHex(225494) + bigintToHex(dbtestdata.SatB2T4AA),
 			nil,
 		},
@@ -690,6 +708,8 @@ func TestRocksDB_Index_BitcoinType(t *testing.T) {
 		Txs:        2,
 		SentSat:    *dbtestdata.SatB1T2A5,
 		BalanceSat: *dbtestdata.SatB2T3A5,
+		FirstSeen:  225493,
+		LastSeen:   225494,
 		Utxos: []Utxo{
 			{
 				BtxID:    hexToBytes(dbtestdata.TxidB2T3),
@@ -755,6 +775,77 @@ func TestRocksDB_Index_BitcoinType(t *testing.T) {
 
 }
 
+func Test_DisconnectDeepBlockRange_BitcoinType(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)
+	if err := d.ConnectBlock(block1); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterBitcoinTypeBlock2(t, d)
+
+	// the blockTxs of the 1st block are not kept and the backend does not have the block
+	var requested []string
+	err := d.DisconnectDeepBlockRange(block1.Height, block2.Height, func(hash string, height uint32) (*bchain.Block, error) {
+		requested = append(requested, hash)
+		return nil, bchain.ErrBlockNotFound
+	}, nil)
+	if errors.Cause(err) != ErrReorgDepthExceeded {
+		t.Fatal("Expecting ErrReorgDepthExceeded, got ", err)
+	}
+	if len(requested) != 1 || requested[0] != block1.Hash {
+		t.Fatal("Expecting request of block ", block1.Hash, ", got ", requested)
+	}
+	verifyAfterBitcoinTypeBlock2(t, d)
+
+	// the data of the 1st block are reconstructed from the block returned by the backend
+	orphaned := []OrphanedBlock{
+		{Height: block2.Height, Hash: block2.Hash, Time: block2.Time, Txs: uint32(len(block2.Txs)), Size: uint32(block2.Size), OrphanedTime: 1521595700},
+	}
+	err = d.DisconnectDeepBlockRange(block1.Height, block2.Height, func(hash string, height uint32) (*bchain.Block, error) {
+		if hash != block1.Hash || height != block1.Height {
+			t.Fatalf("Unexpected request of block %d %s", height, hash)
+		}
+		return dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser), nil
+	}, orphaned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the orphaned block is stored together with the disconnect of its height
+	gotOrphaned, err := d.GetOrphanedBlocks(0, ^uint32(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotOrphaned, orphaned) {
+		t.Errorf("GetOrphanedBlocks() = %+v, want %+v", gotOrphaned, orphaned)
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 0 || hash != "" {
+		t.Fatalf("Expecting empty db, got best block %d %s", height, hash)
+	}
+	for _, col := range []int{cfHeight, cfAddresses, cfTxAddresses, cfBlockTxs} {
+		if err := checkColumn(d, col, []keyPair{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the index can be synchronized again
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterBitcoinTypeBlock1(t, d, false)
+}
+
 func Test_BulkConnect_BitcoinType(t *testing.T) {
 	d := setupRocksDB(t, &testBitcoinParser{
 		BitcoinParser: bitcoinTestnetParser(),
@@ -802,6 +893,94 @@ func Test_BulkConnect_BitcoinType(t *testing.T) {
 	}
 }
 
+func Test_BulkConnect_BitcoinType_Resume(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	bc, err := d.InitBulkConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)
+	if err := bc.ConnectBlock(block1, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.finishStoreCheckpoint(nil, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	// the written data stay in the cache and are not written again by the next checkpoint
+	if len(bc.txAddressesMap) == 0 || len(bc.balances) == 0 || len(bc.dirtyTxAddresses) != 0 || len(bc.dirtyBalances) != 0 {
+		t.Fatalf("Expecting cached and not modified data, got %d txAddresses (%d modified), %d balances (%d modified)",
+			len(bc.txAddressesMap), len(bc.dirtyTxAddresses), len(bc.balances), len(bc.dirtyBalances))
+	}
+	if rows := len(columnRows(d, cfAddressBalance)); rows != len(bc.balances) {
+		t.Fatalf("Expecting %d balances in db, got %d", len(bc.balances), rows)
+	}
+	// connect the next block and store its addresses and block txs, then simulate crash without Close
+	if err := bc.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser), true); err != nil {
+		t.Fatal(err)
+	}
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	if err := bc.storeBulkAddresses(wb); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteBatch(wb); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stored internal state contains the checkpoint
+	is, err := d.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.DbState != common.DbStateInconsistent {
+		t.Fatal("DB not in DbStateInconsistent")
+	}
+	if is.BulkCheckpoint == nil || is.BulkCheckpoint.Height != block1.Height || is.BulkCheckpoint.Hash != block1.Hash {
+		t.Fatalf("Expecting checkpoint at %d %s, got %+v", block1.Height, block1.Hash, is.BulkCheckpoint)
+	}
+	d.SetInternalState(is)
+	fake, err := dbtestdata.NewFakeBlockChain(d.chainParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the block stored after the checkpoint was orphaned in the backend, the resume is refused
+	if err := d.ResumeBulkConnect(&utxoSetTestChain{BlockChain: fake, hashes: map[uint32]string{225494: "orphaned"}}); err == nil {
+		t.Fatal("Expecting error resuming db with an orphaned block")
+	}
+	if d.is.DbState != common.DbStateInconsistent || d.is.BulkCheckpoint == nil {
+		t.Fatal("DB not left in DbStateInconsistent")
+	}
+	if err := d.ResumeBulkConnect(fake); err != nil {
+		t.Fatal(err)
+	}
+	if d.is.DbState != common.DbStateOpen || d.is.BulkCheckpoint != nil {
+		t.Fatal("DB not resumed to DbStateOpen")
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != block1.Height || hash != block1.Hash {
+		t.Fatalf("Expecting best block %d %s, got %d %s", block1.Height, block1.Hash, height, hash)
+	}
+	if err := d.ResumeBulkConnect(fake); err == nil {
+		t.Fatal("Expecting error resuming db in open state")
+	}
+
+	// the sync continues from the checkpoint
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verifyAfterBitcoinTypeBlock2(t, d)
+}
+
 func Test_packBigint_unpackBigint(t *testing.T) {
 	bigbig1, _ := big.NewInt(0).SetString("123456789123456789012345", 10)
 	bigbig2, _ := big.NewInt(0).SetString("12345678912345678901234512389012345123456789123456789012345123456789123456789012345", 10)
@@ -1137,7 +1316,7 @@ func Test_packAddrBalance_unpackAddrBalance(t *testing.T) {
 	}{
 		{
 			name: "no utxos",
-			hex:  "7b060b44cc1af8520514faf980ac",
+			hex:  "7b060b44cc1af8520514faf980ac0000",
 			data: &AddrBalance{
 				BalanceSat: *big.NewInt(90110001324),
 				SentSat:    *big.NewInt(12390110001234),
@@ -1147,11 +1326,13 @@ func Test_packAddrBalance_unpackAddrBalance(t *testing.T) {
 		},
 		{
 			name: "utxos",
-			hex:  "7b060b44cc1af8520514faf980ac00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa38400c87c440060b2fd12177a6effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac750098faf659010105e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b0782c6df6d84ccd88552087e9cba87a275ffff",
+			hex:  "7b060b44cc1af8520514faf980ac87c4408de15600b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa38400c87c440060b2fd12177a6effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac750098faf659010105e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b0782c6df6d84ccd88552087e9cba87a275ffff",
 			data: &AddrBalance{
 				BalanceSat: *big.NewInt(90110001324),
 				SentSat:    *big.NewInt(12390110001234),
 				Txs:        123,
+				FirstSeen:  123456,
+				LastSeen:   225494,
 				Utxos: []Utxo{
 					{
 						BtxID:    hexToBytes(dbtestdata.TxidB1T1),
@@ -1176,7 +1357,7 @@ func Test_packAddrBalance_unpackAddrBalance(t *testing.T) {
 		},
 		{
 			name: "empty",
-			hex:  "000000",
+			hex:  "0000000000",
 			data: &AddrBalance{
 				Utxos: []Utxo{},
 			},
@@ -0,0 +1,345 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/martinboehm/btcd/btcec"
+	"github.com/martinboehm/btcutil"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// silentPaymentsTweakLen is the length of the tweak, a compressed public key
+const silentPaymentsTweakLen = 33
+
+// silentPaymentsNUMS is the x coordinate of the point H from BIP-341,
+// the inputs spending the taproot outputs by the script path with this internal key are not eligible
+var silentPaymentsNUMS, _ = hex.DecodeString("50929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0")
+
+var silentPaymentsInputsTag = sha256.Sum256([]byte("BIP0352/Inputs"))
+
+// SilentPaymentTweak is the tweak of a taproot-eligible transaction as defined by BIP-352,
+// the sum of the public keys of the eligible inputs of the transaction multiplied by the input hash
+type SilentPaymentTweak struct {
+	Txid  string
+	Tweak []byte
+}
+
+type silentPaymentTweak struct {
+	btxID []byte
+	tweak []byte
+}
+
+// silentPaymentTweaks collects the tweaks of the transactions in a block, it is nil if the index is not enabled
+type silentPaymentTweaks []silentPaymentTweak
+
+// addTx computes the tweak of the transaction and adds it to the tweaks of the block if the transaction is eligible
+func (s *silentPaymentTweaks) addTx(tx *bchain.Tx, btxID []byte, ta *TxAddresses) {
+	if tweak := computeSilentPaymentTweak(tx, ta); tweak != nil {
+		*s = append(*s, silentPaymentTweak{btxID: btxID, tweak: tweak})
+	}
+}
+
+func isP2TR(addrDesc bchain.AddressDescriptor) bool {
+	return len(addrDesc) == 34 && addrDesc[0] == 0x51 && addrDesc[1] == 0x20
+}
+
+// isWitnessV2Plus returns true for the outputs of the segwit versions higher than 1
+func isWitnessV2Plus(addrDesc bchain.AddressDescriptor) bool {
+	return len(addrDesc) >= 4 && len(addrDesc) <= 42 && addrDesc[0] >= 0x52 && addrDesc[0] <= 0x60 && int(addrDesc[1]) == len(addrDesc)-2
+}
+
+// silentPaymentInputKey returns the public key of the input used by the silent payments, nil if the input is not eligible
+// If skip is returned, the transaction cannot be used for the silent payments.
+func silentPaymentInputKey(vin *bchain.Vin, spent bchain.AddressDescriptor) (key []byte, skip bool) {
+	witnessKey := func() ([]byte, bool) {
+		// the witness of a segwit spend is never empty, it is missing if the backend did not provide it
+		if len(vin.Witness) == 0 {
+			return nil, true
+		}
+		k := vin.Witness[len(vin.Witness)-1]
+		if len(k) == 33 && (k[0] == 0x02 || k[0] == 0x03) {
+			return k, false
+		}
+		return nil, false
+	}
+	switch {
+	case len(spent) == 0:
+		// the spent output is not known
+		return nil, true
+	case isP2TR(spent):
+		w := vin.Witness
+		if len(w) == 0 {
+			return nil, true
+		}
+		// remove the annex
+		if len(w) > 1 && len(w[len(w)-1]) > 0 && w[len(w)-1][0] == 0x50 {
+			w = w[:len(w)-1]
+		}
+		if len(w) > 1 {
+			// script path spend, the last element is the control block with the internal key
+			if c := w[len(w)-1]; len(c) >= 33 && bytes.Equal(c[1:33], silentPaymentsNUMS) {
+				return nil, false
+			}
+		}
+		// the taproot output key is always the key with the even y coordinate
+		return append([]byte{0x02}, spent[2:]...), false
+	case len(spent) == 22 && spent[0] == 0x00 && spent[1] == 0x14:
+		// P2WPKH
+		return witnessKey()
+	case len(spent) == 23 && spent[0] == 0xa9 && spent[1] == 0x14 && spent[22] == 0x87:
+		// P2SH, only P2SH-P2WPKH is eligible
+		scriptSig, err := hex.DecodeString(vin.ScriptSig.Hex)
+		if err != nil || len(scriptSig) != 23 || scriptSig[0] != 0x16 || scriptSig[1] != 0x00 || scriptSig[2] != 0x14 {
+			return nil, false
+		}
+		return witnessKey()
+	case len(spent) == 25 && spent[0] == 0x76 && spent[1] == 0xa9 && spent[2] == 0x14 && spent[23] == 0x88 && spent[24] == 0xac:
+		// P2PKH, the key is searched from the end of the scriptSig to handle the malleated scripts
+		scriptSig, err := hex.DecodeString(vin.ScriptSig.Hex)
+		if err != nil {
+			return nil, false
+		}
+		for i := len(scriptSig); i >= 33; i-- {
+			k := scriptSig[i-33 : i]
+			if bytes.Equal(btcutil.Hash160(k), spent[3:23]) {
+				if k[0] == 0x02 || k[0] == 0x03 {
+					return k, false
+				}
+				return nil, false
+			}
+		}
+		return nil, false
+	case isWitnessV2Plus(spent):
+		return nil, true
+	}
+	return nil, false
+}
+
+// silentPaymentsOutpoint serializes the outpoint spent by the input in the same way as in the transaction
+func silentPaymentsOutpoint(vin *bchain.Vin) ([]byte, error) {
+	txid, err := hex.DecodeString(vin.Txid)
+	if err != nil || len(txid) != 32 {
+		return nil, errors.New("Invalid txid")
+	}
+	outpoint := make([]byte, 36)
+	for i := range txid {
+		outpoint[31-i] = txid[i]
+	}
+	binary.LittleEndian.PutUint32(outpoint[32:], vin.Vout)
+	return outpoint, nil
+}
+
+func silentPaymentsInputHash(outpoint []byte, a []byte) []byte {
+	h := sha256.New()
+	h.Write(silentPaymentsInputsTag[:])
+	h.Write(silentPaymentsInputsTag[:])
+	h.Write(outpoint)
+	h.Write(a)
+	return h.Sum(nil)
+}
+
+// computeSilentPaymentTweak returns the tweak of the transaction with a taproot output, nil if the transaction is not eligible
+// The inputs of the transaction must be already resolved in ta.
+func computeSilentPaymentTweak(tx *bchain.Tx, ta *TxAddresses) []byte {
+	if len(tx.Vin) == 0 || tx.Vin[0].Coinbase != "" || len(ta.Inputs) != len(tx.Vin) {
+		return nil
+	}
+	taproot := false
+	for i := range ta.Outputs {
+		if isP2TR(ta.Outputs[i].AddrDesc) {
+			taproot = true
+			break
+		}
+	}
+	if !taproot {
+		return nil
+	}
+	curve := btcec.S256()
+	var ax, ay *big.Int
+	var smallest []byte
+	for i := range tx.Vin {
+		vin := &tx.Vin[i]
+		outpoint, err := silentPaymentsOutpoint(vin)
+		if err != nil {
+			return nil
+		}
+		if smallest == nil || bytes.Compare(outpoint, smallest) < 0 {
+			smallest = outpoint
+		}
+		key, skip := silentPaymentInputKey(vin, ta.Inputs[i].AddrDesc)
+		if skip {
+			if glog.V(1) {
+				glog.Infof("rocksdb: tx %v, input %d, silent payment tweak cannot be computed", tx.Txid, i)
+			}
+			return nil
+		}
+		if key == nil {
+			continue
+		}
+		pk, err := btcec.ParsePubKey(key, curve)
+		if err != nil {
+			continue
+		}
+		if ax == nil {
+			ax, ay = pk.X, pk.Y
+		} else {
+			ax, ay = curve.Add(ax, ay, pk.X, pk.Y)
+		}
+	}
+	// no eligible input or the keys sum to the point at infinity
+	if ax == nil || (ax.Sign() == 0 && ay.Sign() == 0) {
+		return nil
+	}
+	a := (&btcec.PublicKey{Curve: curve, X: ax, Y: ay}).SerializeCompressed()
+	inputHash := silentPaymentsInputHash(smallest, a)
+	if h := new(big.Int).SetBytes(inputHash); h.Sign() == 0 || h.Cmp(curve.N) >= 0 {
+		return nil
+	}
+	tx1, ty1 := curve.ScalarMult(ax, ay, inputHash)
+	return (&btcec.PublicKey{Curve: curve, X: tx1, Y: ty1}).SerializeCompressed()
+}
+
+func packSilentPaymentTweaks(tweaks silentPaymentTweaks) []byte {
+	buf := make([]byte, 0, len(tweaks)*(32+silentPaymentsTweakLen))
+	for i := range tweaks {
+		buf = append(buf, tweaks[i].btxID...)
+		buf = append(buf, tweaks[i].tweak...)
+	}
+	return buf
+}
+
+func (d *RocksDB) unpackSilentPaymentTweaks(buf []byte) ([]SilentPaymentTweak, error) {
+	txidLen := d.chainParser.PackedTxidLen()
+	l := txidLen + silentPaymentsTweakLen
+	if len(buf)%l != 0 {
+		return nil, errors.New("Invalid silent payment tweaks")
+	}
+	tweaks := make([]SilentPaymentTweak, 0, len(buf)/l)
+	for ; len(buf) > 0; buf = buf[l:] {
+		txid, err := d.chainParser.UnpackTxid(buf[:txidLen])
+		if err != nil {
+			return nil, err
+		}
+		tweaks = append(tweaks, SilentPaymentTweak{
+			Txid:  txid,
+			Tweak: append([]byte(nil), buf[txidLen:l]...),
+		})
+	}
+	return tweaks, nil
+}
+
+// storeSilentPaymentTweaks stores the tweaks of the block, the key is the height of the block
+func (d *RocksDB) storeSilentPaymentTweaks(wb *grocksdb.WriteBatch, height uint32, tweaks silentPaymentTweaks) {
+	if len(tweaks) == 0 {
+		wb.DeleteCF(d.cfh[cfSilentPayments], packUint(height))
+		return
+	}
+	wb.PutCF(d.cfh[cfSilentPayments], packUint(height), packSilentPaymentTweaks(tweaks))
+}
+
+// HasSilentPayments returns true if the DB contains the index of the silent payment tweaks
+func (d *RocksDB) HasSilentPayments() bool {
+	return d.is != nil && d.is.SilentPayments
+}
+
+// newSilentPaymentTweaks returns the collector of the tweaks of a connected block, nil if the index is not enabled
+func (d *RocksDB) newSilentPaymentTweaks() *silentPaymentTweaks {
+	if !d.HasSilentPayments() {
+		return nil
+	}
+	return &silentPaymentTweaks{}
+}
+
+// GetSilentPaymentTweaks returns the silent payment tweaks of the transactions in the block
+// The caller must check that the block is indexed, see InternalState.SilentPaymentsHeight.
+func (d *RocksDB) GetSilentPaymentTweaks(height uint32) ([]SilentPaymentTweak, error) {
+	if !d.HasSilentPayments() {
+		return nil, errors.New("Silent payments index is not enabled")
+	}
+	val, err := d.db.GetCF(d.ro, d.cfh[cfSilentPayments], packUint(height))
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	return d.unpackSilentPaymentTweaks(val.Data())
+}
+
+// SetSilentPayments enables the index of the silent payment tweaks from the next connected block, or deletes it if not enabled
+// The tweaks of the blocks connected before the index was enabled can be computed by the reindex of the silentPayments column.
+func (d *RocksDB) SetSilentPayments(enabled bool) error {
+	if d.is == nil {
+		return errors.New("Internal state not created")
+	}
+	if d.is.SilentPayments == enabled {
+		return nil
+	}
+	if !enabled {
+		wb := grocksdb.NewWriteBatch()
+		defer wb.Destroy()
+		wb.DeleteRangeCF(d.cfh[cfSilentPayments], []byte{0}, []byte{0xff, 0xff, 0xff, 0xff, 0xff})
+		if err := d.WriteBatch(wb); err != nil {
+			return err
+		}
+		d.is.SilentPayments = false
+		d.is.SilentPaymentsHeight = 0
+		glog.Info("silentPayments: deleted")
+		return d.storeState(d.is)
+	}
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return errors.New("Silent payments are supported only for bitcoin type chains")
+	}
+	height, hash, err := d.GetBestBlock()
+	if err != nil {
+		return err
+	}
+	if hash != "" {
+		height++
+	}
+	d.is.SilentPayments = true
+	d.is.SilentPaymentsHeight = height
+	glog.Info("silentPayments: indexed from block ", height)
+	return d.storeState(d.is)
+}
+
+// silentPaymentsReindexer computes the tweaks of the blocks from the transaction addresses stored in the index
+type silentPaymentsReindexer struct {
+	d *RocksDB
+}
+
+func (r *silentPaymentsReindexer) connect(wb *grocksdb.WriteBatch, block *bchain.Block) error {
+	p := r.d.chainParser
+	var tweaks silentPaymentTweaks
+	for txi := range block.Txs {
+		tx := &block.Txs[txi]
+		btxID, err := p.PackTxid(tx.Txid)
+		if err != nil {
+			return err
+		}
+		ta, err := r.d.getTxAddresses(btxID)
+		if err != nil {
+			return err
+		}
+		if ta == nil {
+			glog.Warningf("reindex: height %d, tx %v not found in txAddresses", block.Height, tx.Txid)
+			continue
+		}
+		tweaks.addTx(tx, btxID, ta)
+	}
+	r.d.storeSilentPaymentTweaks(wb, block.Height, tweaks)
+	return nil
+}
+
+func (r *silentPaymentsReindexer) flush(wb *grocksdb.WriteBatch) error {
+	return nil
+}
+
+func (r *silentPaymentsReindexer) pending(wb *grocksdb.WriteBatch) int {
+	return wb.Count()
+}
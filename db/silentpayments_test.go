@@ -0,0 +1,237 @@
+//go:build unittest
+
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/martinboehm/btcd/btcec"
+	"github.com/martinboehm/btcutil"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// silentPaymentsTestInput is an input of the BIP-352 test vectors,
+// the scriptSig and witness are built from the private key with a placeholder signature
+type silentPaymentsTestInput struct {
+	txid    string
+	vout    uint32
+	priv    string
+	taproot bool
+}
+
+func (in *silentPaymentsTestInput) vin(t *testing.T) (bchain.Vin, bchain.AddressDescriptor) {
+	b, err := hex.DecodeString(in.priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pub := btcec.PrivKeyFromBytes(btcec.S256(), b)
+	sig := bytes.Repeat([]byte{0x30}, 71)
+	vin := bchain.Vin{Txid: in.txid, Vout: in.vout}
+	if in.taproot {
+		vin.Witness = [][]byte{bytes.Repeat([]byte{1}, 64)}
+		return vin, append(bchain.AddressDescriptor{0x51, 0x20}, pub.X.FillBytes(make([]byte, 32))...)
+	}
+	vin.ScriptSig.Hex = hex.EncodeToString(append(append([]byte{71}, sig...), append([]byte{33}, pub.SerializeCompressed()...)...))
+	return vin, append(append(bchain.AddressDescriptor{0x76, 0xa9, 0x14}, btcutil.Hash160(pub.SerializeCompressed())...), 0x88, 0xac)
+}
+
+// silentPaymentsTestOutput derives the first output of the recipient from the tweak as the receiving wallet does in BIP-352
+func silentPaymentsTestOutput(t *testing.T, tweak []byte, scan, spend string) string {
+	curve := btcec.S256()
+	tw, err := btcec.ParsePubKey(tweak, curve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bScan, _ := hex.DecodeString(scan)
+	bSpend, _ := hex.DecodeString(spend)
+	ex, ey := curve.ScalarMult(tw.X, tw.Y, bScan)
+	tag := sha256.Sum256([]byte("BIP0352/SharedSecret"))
+	h := sha256.New()
+	h.Write(tag[:])
+	h.Write(tag[:])
+	h.Write((&btcec.PublicKey{Curve: curve, X: ex, Y: ey}).SerializeCompressed())
+	h.Write([]byte{0, 0, 0, 0})
+	tx, ty := curve.ScalarBaseMult(h.Sum(nil))
+	sx, sy := curve.ScalarBaseMult(bSpend)
+	px, _ := curve.Add(sx, sy, tx, ty)
+	return hex.EncodeToString(px.FillBytes(make([]byte, 32)))
+}
+
+func Test_computeSilentPaymentTweak(t *testing.T) {
+	// the keys, outpoints and expected outputs are from the test vectors of BIP-352
+	const (
+		scan   = "0f694e068028a717f8af6b9411f9a133dd3565258714cc226594b34db90c1f2c"
+		spend  = "9d6ad855ce3417ef84e836892e5a56392bfba05fa5d97ccea30e266f540e08b3"
+		txid1  = "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+		txid2  = "a1075db55d416d3ca199f55b6084e2115b9345e16c5cf302fc80e9d5fbf5d48d"
+		priv1  = "eadc78165ff1f8ea94ad7cfdc54990738a4c53f6e0507b42154201b8e5dff3b1"
+		priv2  = "93f5ed907ad5b2bdbbdcb5d9116ebc0a4e1f92f910d5260237fa45a9408aad16"
+		privTr = "fc8716a97a48ba9a05a98ae47b5cd201a25a7fd5d8b73c203c5f7b6b6b3b6ad7"
+		privTo = "1d37787c2b7116ee983e9f9c13269df29091b391c04db94239e0d2bc2182c3bf"
+		privPk = "8d4751f6e8a3586880fb66c19ae277969bd5aa06f61c4ee2f1e2486efdf666d3"
+		// the serialized outpoint of txidLast is greater than of the others, so it does not change the input hash
+		txidLast = "00000000000000000000000000000000000000000000000000000000000000ff"
+	)
+	p2tr := append(bchain.AddressDescriptor{0x51, 0x20}, make([]byte, 32)...)
+	p2wpkh := append(bchain.AddressDescriptor{0x00, 0x14}, make([]byte, 20)...)
+	p2wsh := append(bchain.AddressDescriptor{0x00, 0x20}, make([]byte, 32)...)
+	witnessV2 := bchain.AddressDescriptor{0x52, 0x02, 0x01, 0x02}
+	sig := bytes.Repeat([]byte{0x30}, 71)
+	nums := append([]byte{0xc0}, silentPaymentsNUMS...)
+
+	tests := []struct {
+		name   string
+		inputs []silentPaymentsTestInput
+		// extra inputs with the spent outputs, which are not eligible
+		extra  []bchain.Vin
+		spent  []bchain.AddressDescriptor
+		output bchain.AddressDescriptor
+		want   string
+	}{
+		{
+			name:   "simple send: two inputs",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1}, {txid: txid2, priv: priv2}},
+			want:   "3e9fce73d4e77a4809908e3c3a2e54ee147b9312dc5044a193d1fc85de46e3c1",
+		},
+		{
+			name:   "simple send: two inputs, order reversed",
+			inputs: []silentPaymentsTestInput{{txid: txid2, priv: priv2}, {txid: txid1, priv: priv1}},
+			want:   "3e9fce73d4e77a4809908e3c3a2e54ee147b9312dc5044a193d1fc85de46e3c1",
+		},
+		{
+			name:   "simple send: two inputs from the same transaction",
+			inputs: []silentPaymentsTestInput{{txid: txid1, vout: 3, priv: priv1}, {txid: txid1, vout: 7, priv: priv2}},
+			want:   "79e71baa2ba3fc66396de3a04f168c7bf24d6870ec88ca877754790c1db357b6",
+		},
+		{
+			name:   "outpoint ordering byte-lexicographically vs. vout integer",
+			inputs: []silentPaymentsTestInput{{txid: txid1, vout: 1, priv: priv1}, {txid: txid1, vout: 256, priv: priv2}},
+			want:   "a85ef8701394b517a4b35217c4bd37ac01ebeed4b008f8d0879f9e09ba95319c",
+		},
+		{
+			name:   "single recipient: multiple UTXOs from the same public key",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1}, {txid: txid2, priv: priv1}},
+			want:   "548ae55c8eec1e736e8d3e520f011f1f42a56d166116ad210b3937599f87f566",
+		},
+		{
+			name:   "single recipient: taproot only inputs with even y-values",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1, taproot: true}, {txid: txid2, priv: privTr, taproot: true}},
+			want:   "de88bea8e7ffc9ce1af30d1132f910323c505185aec8eae361670421e749a1fb",
+		},
+		{
+			name:   "single recipient: taproot only with mixed even/odd y-values",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1, taproot: true}, {txid: txid2, priv: privTo, taproot: true}},
+			want:   "77cab7dd12b10259ee82c6ea4b509774e33e7078e7138f568092241bf26b99f1",
+		},
+		{
+			name:   "single recipient: taproot input with even y-value and non-taproot input",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1, taproot: true}, {txid: txid2, priv: privPk}},
+			want:   "30523cca96b2a9ae3c98beb5e60f7d190ec5bc79b2d11a0b2d4d09a608c448f0",
+		},
+		{
+			name:   "p2tr script path with the NUMS internal key is not eligible",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1, taproot: true}, {txid: txid2, priv: privPk}},
+			extra:  []bchain.Vin{{Txid: txidLast, Witness: [][]byte{{0x51}, nums}}},
+			spent:  []bchain.AddressDescriptor{p2tr},
+			want:   "30523cca96b2a9ae3c98beb5e60f7d190ec5bc79b2d11a0b2d4d09a608c448f0",
+		},
+		{
+			name:   "p2wsh input is not eligible",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1}, {txid: txid2, priv: priv2}},
+			extra:  []bchain.Vin{{Txid: txidLast, Vout: 5, Witness: [][]byte{{}, sig, {0x51}}}},
+			spent:  []bchain.AddressDescriptor{p2wsh},
+			want:   "3e9fce73d4e77a4809908e3c3a2e54ee147b9312dc5044a193d1fc85de46e3c1",
+		},
+		{
+			name:  "missing witness",
+			extra: []bchain.Vin{{Txid: txid1, Vout: 1}},
+			spent: []bchain.AddressDescriptor{p2wpkh},
+		},
+		{
+			name:   "no taproot output",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1}, {txid: txid2, priv: priv2}},
+			output: p2wpkh,
+		},
+		{
+			name:   "witness v2 input",
+			inputs: []silentPaymentsTestInput{{txid: txid1, priv: priv1}, {txid: txid2, priv: priv2}},
+			extra:  []bchain.Vin{{Txid: txidLast, Witness: [][]byte{sig}}},
+			spent:  []bchain.AddressDescriptor{witnessV2},
+		},
+		{
+			name:  "no eligible input",
+			extra: []bchain.Vin{{Txid: txidLast, Vout: 5, Witness: [][]byte{{}, sig, {0x51}}}},
+			spent: []bchain.AddressDescriptor{p2wsh},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := tt.output
+			if output == nil {
+				output = p2tr
+			}
+			tx := &bchain.Tx{Txid: "test"}
+			ta := &TxAddresses{Outputs: []TxOutput{{AddrDesc: output}}}
+			for i := range tt.inputs {
+				vin, ad := tt.inputs[i].vin(t)
+				tx.Vin = append(tx.Vin, vin)
+				ta.Inputs = append(ta.Inputs, TxInput{AddrDesc: ad})
+			}
+			for i := range tt.extra {
+				tx.Vin = append(tx.Vin, tt.extra[i])
+				ta.Inputs = append(ta.Inputs, TxInput{AddrDesc: tt.spent[i]})
+			}
+			got := computeSilentPaymentTweak(tx, ta)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("computeSilentPaymentTweak() = %x, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("computeSilentPaymentTweak() = nil")
+			}
+			if output := silentPaymentsTestOutput(t, got, scan, spend); output != tt.want {
+				t.Errorf("computeSilentPaymentTweak() = %x, derived output %v, want %v", got, output, tt.want)
+			}
+		})
+	}
+}
+
+func Test_packSilentPaymentTweaks(t *testing.T) {
+	parser := bitcoinTestnetParser()
+	d := &RocksDB{chainParser: parser}
+	txids := []string{
+		"fdc7f4c9ab2ea8a3f8bc58ffd4b1bce3f4b1b1e9a4c9e8f8c2a1a8d7b6e5f4c3",
+		"00e5e4b5a6f7d8c9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3",
+	}
+	var tweaks silentPaymentTweaks
+	want := make([]SilentPaymentTweak, 0, len(txids))
+	for i, txid := range txids {
+		btxID, err := parser.PackTxid(txid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweak := append([]byte{0x02}, bytes.Repeat([]byte{byte(i + 1)}, 32)...)
+		tweaks = append(tweaks, silentPaymentTweak{btxID: btxID, tweak: tweak})
+		want = append(want, SilentPaymentTweak{Txid: txid, Tweak: tweak})
+	}
+	buf := packSilentPaymentTweaks(tweaks)
+	if len(buf) != 2*(32+silentPaymentsTweakLen) {
+		t.Fatalf("packSilentPaymentTweaks() length %d", len(buf))
+	}
+	got, err := d.unpackSilentPaymentTweaks(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unpackSilentPaymentTweaks() = %+v, want %+v", got, want)
+	}
+	if _, err := d.unpackSilentPaymentTweaks(buf[:40]); err == nil {
+		t.Error("unpackSilentPaymentTweaks() of truncated data expected error")
+	}
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// SnapshotInfo describes a snapshot of the database
+type SnapshotInfo struct {
+	Dir        string    `json:"dir"`
+	Coin       string    `json:"coin"`
+	BestHeight uint32    `json:"bestHeight"`
+	BestHash   string    `json:"bestHash"`
+	Created    time.Time `json:"created"`
+}
+
+// CreateSnapshot creates a consistent snapshot of the database in the directory dir, which must not exist
+// The snapshot is a RocksDB checkpoint, the files are hard linked if dir is on the same filesystem as the database.
+// Blocks cannot be connected or disconnected while the checkpoint is being created, otherwise the sync keeps running.
+func (d *RocksDB) CreateSnapshot(dir string) (*SnapshotInfo, error) {
+	if d.is == nil {
+		return nil, errors.New("Internal state not created")
+	}
+	if d.is.DbState == common.DbStateInconsistent {
+		return nil, errors.New("Database is in inconsistent state")
+	}
+	// bulk connect keeps the data in memory and stores them in parts, the db is not consistent until it finishes
+	if d.is.InitialSync {
+		return nil, errors.New("Snapshot cannot be created during the initial synchronization")
+	}
+	start := time.Now()
+	d.connectMux.Lock()
+	// the internal state must be taken together with the checkpoint so that it matches the data
+	buf, err := d.is.Pack()
+	if err != nil {
+		d.connectMux.Unlock()
+		return nil, err
+	}
+	bestHeight, bestHash, err := d.GetBestBlock()
+	if err != nil {
+		d.connectMux.Unlock()
+		return nil, err
+	}
+	cp, err := d.db.NewCheckpoint()
+	if err != nil {
+		d.connectMux.Unlock()
+		return nil, err
+	}
+	// logSizeForFlush 0 forces flush of memtables, the snapshot does not need WAL
+	err = cp.CreateCheckpoint(dir, 0)
+	cp.Destroy()
+	d.connectMux.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	// store the internal state to the snapshot as cleanly closed
+	is, err := common.UnpackInternalState(buf)
+	if err != nil {
+		return nil, err
+	}
+	is.DbState = common.DbStateClosed
+	if buf, err = is.Pack(); err != nil {
+		return nil, err
+	}
+	sdb, cfh, err := openDB(dir, d.cache, d.maxOpenFiles)
+	if err != nil {
+		return nil, err
+	}
+	err = sdb.PutCF(d.wo, cfh[cfDefault], []byte(internalStateKey), buf)
+	for _, h := range cfh {
+		h.Destroy()
+	}
+	sdb.Close()
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("rocksdb: snapshot of block %d created in %s, %v", bestHeight, dir, time.Since(start))
+	return &SnapshotInfo{
+		Dir:        dir,
+		Coin:       is.Coin,
+		BestHeight: bestHeight,
+		BestHash:   bestHash,
+		Created:    start.UTC(),
+	}, nil
+}
+
+// checkSnapshotColumns verifies that the snapshot contains exactly the columns of the database
+func (d *RocksDB) checkSnapshotColumns(is *common.InternalState) error {
+	nc, err := d.checkColumns(is)
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]struct{}, len(is.DbColumns))
+	for i := range is.DbColumns {
+		stored[is.DbColumns[i].Name] = struct{}{}
+	}
+	for i := range nc {
+		if _, found := stored[nc[i].Name]; !found {
+			return errors.Errorf("Snapshot does not contain column '%v'", nc[i].Name)
+		}
+		delete(stored, nc[i].Name)
+	}
+	for name := range stored {
+		return errors.Errorf("Snapshot contains unknown column '%v'", name)
+	}
+	return nil
+}
+
+// RestoreSnapshot validates the snapshot in snapshotDir and restores it to the database directory path
+// The snapshot must be of the same coin and must contain the columns required for the chain type.
+// The directory path must not exist or must be empty.
+func RestoreSnapshot(snapshotDir string, path string, parser bchain.BlockChainParser, rpcCoin string) (*SnapshotInfo, error) {
+	if entries, err := os.ReadDir(path); err == nil {
+		if len(entries) > 0 {
+			return nil, errors.Errorf("Directory %s is not empty", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if _, err := os.Stat(snapshotDir); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	s, err := NewRocksDB(snapshotDir, 1<<24, -1, parser, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		s.closeDB()
+		s.wo.Destroy()
+		s.ro.Destroy()
+	}()
+	val, err := s.db.GetCF(s.ro, s.cfh[cfDefault], []byte(internalStateKey))
+	if err != nil {
+		return nil, err
+	}
+	data := append([]byte(nil), val.Data()...)
+	val.Free()
+	if len(data) == 0 {
+		return nil, errors.New("Snapshot does not contain internal state")
+	}
+	is, err := common.UnpackInternalState(data)
+	if err != nil {
+		return nil, err
+	}
+	if is.Coin != rpcCoin {
+		return nil, errors.Errorf("Coins do not match. Snapshot coin %v, RPC coin %v", is.Coin, rpcCoin)
+	}
+	if is.DbState == common.DbStateInconsistent {
+		return nil, errors.New("Snapshot is in inconsistent state")
+	}
+	if err = s.checkSnapshotColumns(is); err != nil {
+		return nil, err
+	}
+	bestHeight, bestHash, err := s.GetBestBlock()
+	if err != nil {
+		return nil, err
+	}
+	cp, err := s.db.NewCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	err = cp.CreateCheckpoint(path, 0)
+	cp.Destroy()
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("rocksdb: snapshot %s of block %d restored to %s, %v", snapshotDir, bestHeight, path, time.Since(start))
+	return &SnapshotInfo{
+		Dir:        path,
+		Coin:       is.Coin,
+		BestHeight: bestHeight,
+		BestHash:   bestHash,
+		Created:    is.LastStore,
+	}, nil
+}
@@ -0,0 +1,83 @@
+//go:build unittest
+
+package db
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func TestRocksDB_Snapshot(t *testing.T) {
+	parser := &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()}
+	d := setupRocksDB(t, parser)
+	defer closeAndDestroyRocksDB(t, d)
+	tmp, err := ioutil.TempDir("", "testsnapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	d.is.DbState = common.DbStateOpen
+	d.is.InitialSync = true
+	snapshotDir := filepath.Join(tmp, "snapshot")
+	if _, err := d.CreateSnapshot(snapshotDir); err == nil {
+		t.Fatal("CreateSnapshot() during initial sync expected error")
+	}
+	d.is.InitialSync = false
+	si, err := d.CreateSnapshot(snapshotDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.Coin != "coin-unittest" || si.BestHeight != 225493 || si.BestHash != "0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997" {
+		t.Errorf("CreateSnapshot() = %+v", si)
+	}
+	// the index keeps running after the snapshot
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RestoreSnapshot(snapshotDir, filepath.Join(tmp, "other"), parser, "other-coin"); err == nil {
+		t.Error("RestoreSnapshot() of a different coin expected error")
+	}
+	if _, err := RestoreSnapshot(snapshotDir, tmp, parser, "coin-unittest"); err == nil {
+		t.Error("RestoreSnapshot() to not empty directory expected error")
+	}
+	restoredDir := filepath.Join(tmp, "restored")
+	si, err = RestoreSnapshot(snapshotDir, restoredDir, parser, "coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if si.Dir != restoredDir || si.BestHeight != 225493 {
+		t.Errorf("RestoreSnapshot() = %+v", si)
+	}
+
+	r, err := NewRocksDB(restoredDir, 100000, -1, parser, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	is, err := r.LoadInternalState("coin-unittest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if is.DbState != common.DbStateClosed {
+		t.Errorf("DbState of the restored db = %v, want %v", is.DbState, common.DbStateClosed)
+	}
+	r.SetInternalState(is)
+	height, hash, err := r.GetBestBlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 225493 || hash != si.BestHash {
+		t.Errorf("GetBestBlock() of the restored db = %v %v, want 225493 %v", height, hash, si.BestHash)
+	}
+	verifyAfterBitcoinTypeBlock1(t, r, false)
+}
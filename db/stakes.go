@@ -0,0 +1,149 @@
+package db
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+)
+
+// addrStake holds the values of the outputs to and the inputs from an address in a coinstake transaction
+type addrStake struct {
+	btxID       []byte
+	receivedSat big.Int
+	sentSat     big.Int
+}
+
+// stakesMap is a map of address descriptors to their stakes in a block
+// by consensus rules there is at most one coinstake transaction in a block
+type stakesMap map[string]*addrStake
+
+// AddrStake is a coinstake transaction of an address together with the amounts the address received and sent in it
+type AddrStake struct {
+	Txid        string
+	Height      uint32
+	ReceivedSat big.Int
+	SentSat     big.Int
+}
+
+// RewardSat returns the net staking reward of the address, i.e. ReceivedSat - SentSat
+func (s *AddrStake) RewardSat() *big.Int {
+	var r big.Int
+	return r.Sub(&s.ReceivedSat, &s.SentSat)
+}
+
+// GetStakesCallback is called by GetAddrDescStakes for each coinstake transaction of the address
+type GetStakesCallback func(stake *AddrStake) error
+
+func (s stakesMap) get(addrDesc bchain.AddressDescriptor, btxID []byte) *addrStake {
+	as, found := s[string(addrDesc)]
+	if !found {
+		as = &addrStake{btxID: btxID}
+		s[string(addrDesc)] = as
+	}
+	return as
+}
+
+// addCoinstake adds the indexable addresses of the coinstake transaction to the map
+func (s stakesMap) addCoinstake(p bchain.BlockChainParser, btxID []byte, ta *TxAddresses) {
+	for i := range ta.Outputs {
+		tao := &ta.Outputs[i]
+		if len(tao.AddrDesc) > 0 && p.IsAddrDescIndexable(tao.AddrDesc) {
+			as := s.get(tao.AddrDesc, btxID)
+			as.receivedSat.Add(&as.receivedSat, &tao.ValueSat)
+		}
+	}
+	for i := range ta.Inputs {
+		tai := &ta.Inputs[i]
+		if len(tai.AddrDesc) > 0 && p.IsAddrDescIndexable(tai.AddrDesc) {
+			as := s.get(tai.AddrDesc, btxID)
+			as.sentSat.Add(&as.sentSat, &tai.ValueSat)
+		}
+	}
+}
+
+// storeStakes stores the stakes of addresses in the block
+// the key is the same as in the addresses column, value is packed txid, received and sent amounts
+func (d *RocksDB) storeStakes(wb *grocksdb.WriteBatch, height uint32, stakes stakesMap) error {
+	if len(stakes) == 0 {
+		return nil
+	}
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := make([]byte, 0, 64)
+	for addrDesc, as := range stakes {
+		buf = append(buf[:0], as.btxID...)
+		l := packBigint(&as.receivedSat, varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packBigint(&as.sentSat, varBuf)
+		buf = append(buf, varBuf[:l]...)
+		wb.PutCF(d.cfh[cfStakes], packAddressKey(bchain.AddressDescriptor(addrDesc), height), buf)
+	}
+	return nil
+}
+
+func (d *RocksDB) unpackStake(buf []byte, height uint32) (*AddrStake, error) {
+	txidUnpackedLen := d.chainParser.PackedTxidLen()
+	if len(buf) < txidUnpackedLen+2 {
+		return nil, errors.New("Invalid stake data")
+	}
+	txid, err := d.chainParser.UnpackTxid(buf[:txidUnpackedLen])
+	if err != nil {
+		return nil, err
+	}
+	s := AddrStake{
+		Txid:   txid,
+		Height: height,
+	}
+	buf = buf[txidUnpackedLen:]
+	var l int
+	s.ReceivedSat, l = unpackBigint(buf)
+	if l >= len(buf) {
+		return nil, errors.New("Invalid stake data")
+	}
+	s.SentSat, _ = unpackBigint(buf[l:])
+	return &s, nil
+}
+
+// GetAddrDescStakes finds coinstake transactions of the address descriptor in the range of heights
+// Stakes are passed to callback function in the order from newest block to the oldest
+func (d *RocksDB) GetAddrDescStakes(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn GetStakesCallback) error {
+	// the column of stakes exists only for the coins with coinstake transactions
+	if !d.chainParser.SupportsCoinstake() {
+		return nil
+	}
+	addrDescLen := len(addrDesc)
+	startKey := packAddressKey(addrDesc, higher)
+	stopKey := packAddressKey(addrDesc, lower)
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfStakes])
+	defer it.Close()
+	for it.Seek(startKey); it.Valid(); it.Next() {
+		key := it.Key().Data()
+		if bytes.Compare(key, stopKey) > 0 {
+			break
+		}
+		if len(key) != addrDescLen+packedHeightBytes {
+			continue
+		}
+		_, height, err := unpackAddressKey(key)
+		if err != nil {
+			return err
+		}
+		val := it.Value().Data()
+		s, err := d.unpackStake(val, height)
+		if err != nil {
+			glog.Warningf("rocksdb: stakes contain incorrect data %s: %s", hex.EncodeToString(key), hex.EncodeToString(val))
+			continue
+		}
+		if err := fn(s); err != nil {
+			if _, ok := err.(*StopIteration); ok {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+//go:build unittest
+
+package db
+
+import (
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/bchain/coins/btc"
+	"github.com/trezor/blockbook/bchain/coins/rdd"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+type testStakingParser struct {
+	*btc.BitcoinParser
+}
+
+func (p *testStakingParser) SupportsCoinstake() bool {
+	return true
+}
+
+func getStakes(t *testing.T, d *RocksDB, addr string) []AddrStake {
+	stakes := []AddrStake{}
+	err := d.GetAddrDescStakes(addressToAddrDesc(addr, d.chainParser), 0, ^uint32(0), func(s *AddrStake) error {
+		stakes = append(stakes, *s)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stakes
+}
+
+func TestRocksDB_Stakes(t *testing.T) {
+	d := setupRocksDB(t, &testStakingParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	if !d.HasStakingIndex() {
+		t.Fatal("Expecting staking index in a new db")
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeCoinstakeBlock(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+
+	ta, err := d.GetTxAddresses(dbtestdata.TxidCoinstake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ta == nil || !ta.IsCoinstake() {
+		t.Fatal("Expecting coinstake transaction")
+	}
+	if got := ta.StakingReward(addressToAddrDesc(dbtestdata.Addr1, d.chainParser)); got.Cmp(big.NewInt(50000000)) != 0 {
+		t.Errorf("StakingReward() = %v, want 50000000", got)
+	}
+
+	want := []AddrStake{
+		{
+			Txid:        dbtestdata.TxidCoinstake,
+			Height:      225494,
+			ReceivedSat: *big.NewInt(150000000),
+			SentSat:     *dbtestdata.SatB1T1A1,
+		},
+	}
+	if got := getStakes(t, d, dbtestdata.Addr1); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAddrDescStakes(Addr1) = %+v, want %+v", got, want)
+	}
+	if got := want[0].RewardSat(); got.Cmp(big.NewInt(50000000)) != 0 {
+		t.Errorf("RewardSat() = %v, want 50000000", got)
+	}
+	want = []AddrStake{
+		{
+			Txid:        dbtestdata.TxidCoinstake,
+			Height:      225494,
+			ReceivedSat: *big.NewInt(10000000),
+		},
+	}
+	if got := getStakes(t, d, dbtestdata.Addr2); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAddrDescStakes(Addr2) = %+v, want %+v", got, want)
+	}
+	if got := getStakes(t, d, dbtestdata.Addr3); len(got) != 0 {
+		t.Errorf("GetAddrDescStakes(Addr3) = %+v, want none", got)
+	}
+
+	// disconnect the coinstake block, the stakes must be removed
+	if err := d.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if got := getStakes(t, d, dbtestdata.Addr1); len(got) != 0 {
+		t.Errorf("GetAddrDescStakes(Addr1) after disconnect = %+v, want none", got)
+	}
+	if got := getStakes(t, d, dbtestdata.Addr2); len(got) != 0 {
+		t.Errorf("GetAddrDescStakes(Addr2) after disconnect = %+v, want none", got)
+	}
+}
+
+// storeTestStakes stores a stake of each of the addresses in each of the blocks of the given heights
+func storeTestStakes(t *testing.T, d *RocksDB, addrs []string, heights []uint32) {
+	btxID, err := d.chainParser.PackTxid(dbtestdata.TxidCoinstake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	for _, height := range heights {
+		stakes := make(stakesMap)
+		for _, a := range addrs {
+			stakes[string(addressToAddrDesc(a, d.chainParser))] = &addrStake{btxID: btxID, receivedSat: *big.NewInt(int64(height))}
+		}
+		if err := d.storeStakes(wb, height, stakes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.WriteBatch(wb); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func stakeHeights(t *testing.T, d *RocksDB, addr string) []uint32 {
+	var h []uint32
+	for _, s := range getStakes(t, d, addr) {
+		h = append(h, s.Height)
+	}
+	return h
+}
+
+func TestRocksDB_deleteStakesFrom(t *testing.T) {
+	d := setupRocksDB(t, &testStakingParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	addrs := []string{dbtestdata.Addr1, dbtestdata.Addr2, dbtestdata.Addr3}
+	storeTestStakes(t, d, addrs, []uint32{0, 10, 20, 30})
+	heights := func(addr string) []uint32 {
+		return stakeHeights(t, d, addr)
+	}
+
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	if err := d.deleteStakesFrom(wb, 20); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteBatch(wb); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range addrs {
+		if got, want := heights(a), []uint32{10, 0}; !reflect.DeepEqual(got, want) {
+			t.Errorf("stakes of %s after deleteStakesFrom(20) = %v, want %v", a, got, want)
+		}
+	}
+
+	wb.Clear()
+	if err := d.deleteStakesFrom(wb, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteBatch(wb); err != nil {
+		t.Fatal(err)
+	}
+	if rows := len(columnRows(d, cfStakes)); rows != 0 {
+		t.Errorf("stakes after deleteStakesFrom(0) = %d rows, want none", rows)
+	}
+}
+
+// coinstakeTestTxAddresses parses the raw reddcoin transaction and builds its TxAddresses,
+// the inputs are given as the spent outputs are not part of the transaction
+func coinstakeTestTxAddresses(t *testing.T, parser bchain.BlockChainParser, txHex string, inputs []TxInput) *TxAddresses {
+	b, err := hex.DecodeString(txHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := parser.ParseTx(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != len(tx.Vin) {
+		t.Fatalf("%d inputs given for %d vins", len(inputs), len(tx.Vin))
+	}
+	ta := &TxAddresses{Inputs: inputs}
+	for i := range tx.Vout {
+		ad, err := parser.GetAddrDescFromVout(&tx.Vout[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ta.Outputs = append(ta.Outputs, TxOutput{AddrDesc: ad, ValueSat: tx.Vout[i].ValueSat})
+	}
+	return ta
+}
+
+func Test_TxAddresses_IsCoinstake(t *testing.T) {
+	parser := rdd.NewReddParser(rdd.GetChainParams("main"), &btc.Configuration{})
+	staker, _ := hex.DecodeString("76a914d44b295c41dd43cf041d88718320357fd346e8cc88ac")
+	payer, _ := hex.DecodeString("76a9142bd806c97f0e00af1a1fc3328fa763a9269723c888ac")
+	opReturn, _ := hex.DecodeString("6a0401020304")
+	// PoSV coinstake of the reddcoin parser tests, version 2 with nTime, the stake is split to two outputs
+	posvCoinstake := "02000000018c6b4a2f0e8d6c4b2a1f9e7d5c3b1a0f8d6e4c2a1b3f7d8e9a4c2b0e5f1c6a5d010000006b4830303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303021020202020202020202020202020202020202020202020202020202020202020202ffffffff0300000000000000000000a89c13460200001976a914d44b295c41dd43cf041d88718320357fd346e8cc88ac80a8d66b4c0200001976a914d44b295c41dd43cf041d88718320357fd346e8cc88ac00000000f0e65d66"
+	tests := []struct {
+		name      string
+		ta        *TxAddresses
+		coinstake bool
+		addrDesc  bchain.AddressDescriptor
+		reward    int64
+	}{
+		{
+			name: "PoSV coinstake",
+			ta: coinstakeTestTxAddresses(t, parser, posvCoinstake,
+				[]TxInput{{AddrDesc: staker, ValueSat: *big.NewInt(5000000000000)}}),
+			coinstake: true,
+			addrDesc:  staker,
+			reward:    27250000000,
+		},
+		{
+			name: "PoSV coinstake, reward of an address not in the transaction",
+			ta: coinstakeTestTxAddresses(t, parser, posvCoinstake,
+				[]TxInput{{AddrDesc: staker, ValueSat: *big.NewInt(5000000000000)}}),
+			coinstake: true,
+			addrDesc:  payer,
+			reward:    0,
+		},
+		{
+			// coinbase of the reddcoin mainnet genesis block
+			name: "genesis coinbase",
+			ta: coinstakeTestTxAddresses(t, parser, "01000000010000000000000000000000000000000000000000000000000000000000000000ffffffff3004ffff001d0104284a616e75617279203231737420323031342077617320737563682061206e696365206461792e2e2effffffff010010a5d4e80000004341040184710fa689ad5023690c80f3a49c8f13f8d45b8c857fbcbc8bc4a8e4d3eb4b10f4d4604fa08dce601aaf0f470216fe1b51850b4acf21b179c45070ac7b03a9ac00000000",
+				[]TxInput{{}}),
+			coinstake: false,
+		},
+		{
+			name: "legacy payment",
+			ta: coinstakeTestTxAddresses(t, parser, "01000000012b0e9c7a5f3d1b8e6c4a2f0d9b7e5c3a1f8d6b4e2c0a9f7d5b3e1c8a6f4d2e9b000000006b4830303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303030303021020202020202020202020202020202020202020202020202020202020202020202feffffff0200a2941a1d0000001976a9142bd806c97f0e00af1a1fc3328fa763a9269723c888ac40a12905090000001976a91481b637d8fcd2c6da6359e6963113a1170de795e488ac670c4000",
+				[]TxInput{{AddrDesc: payer, ValueSat: *big.NewInt(163741330000)}}),
+			coinstake: false,
+		},
+		{
+			name: "empty first output only",
+			ta: &TxAddresses{
+				Inputs:  []TxInput{{AddrDesc: staker, ValueSat: *big.NewInt(5000000000000)}},
+				Outputs: []TxOutput{{}},
+			},
+			coinstake: false,
+		},
+		{
+			name: "first output with value",
+			ta: &TxAddresses{
+				Inputs: []TxInput{{AddrDesc: staker, ValueSat: *big.NewInt(5000000000000)}},
+				Outputs: []TxOutput{
+					{ValueSat: *big.NewInt(1)},
+					{AddrDesc: staker, ValueSat: *big.NewInt(5027249999999)},
+				},
+			},
+			coinstake: false,
+		},
+		{
+			name: "OP_RETURN first output",
+			ta: &TxAddresses{
+				Inputs: []TxInput{{AddrDesc: staker, ValueSat: *big.NewInt(5000000000000)}},
+				Outputs: []TxOutput{
+					{AddrDesc: opReturn},
+					{AddrDesc: staker, ValueSat: *big.NewInt(4999990000000)},
+				},
+			},
+			coinstake: false,
+		},
+		{
+			name: "first input without value",
+			ta: &TxAddresses{
+				Inputs: []TxInput{{AddrDesc: staker}},
+				Outputs: []TxOutput{
+					{},
+					{AddrDesc: staker, ValueSat: *big.NewInt(5027250000000)},
+				},
+			},
+			coinstake: false,
+		},
+		{
+			name:      "no inputs",
+			ta:        &TxAddresses{Outputs: []TxOutput{{}, {AddrDesc: staker, ValueSat: *big.NewInt(1)}}},
+			coinstake: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.ta.IsCoinstake(); got != tt.coinstake {
+				t.Errorf("IsCoinstake() = %v, want %v", got, tt.coinstake)
+			}
+			if !tt.coinstake {
+				return
+			}
+			if got := tt.ta.StakingReward(tt.addrDesc); got.Cmp(big.NewInt(tt.reward)) != 0 {
+				t.Errorf("StakingReward() = %v, want %v", got, tt.reward)
+			}
+		})
+	}
+}
+
+func TestRocksDB_pruneHistoryStakes(t *testing.T) {
+	d := setupRocksDB(t, &testStakingParser{
+		BitcoinParser: bitcoinTestnetParser(),
+	})
+	defer closeAndDestroyRocksDB(t, d)
+
+	addrs := []string{dbtestdata.Addr1, dbtestdata.Addr2}
+	storeTestStakes(t, d, addrs, []uint32{0, 10, 20, 30})
+	if err := d.pruneHistory(20, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range addrs {
+		if got, want := stakeHeights(t, d, a), []uint32{30, 20}; !reflect.DeepEqual(got, want) {
+			t.Errorf("stakes of %s after pruneHistory(20) = %v, want %v", a, got, want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"time"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// Store is the read and write surface of the index used by the api, the servers and the downloaders
+// RocksDB is the persistent implementation, MemoryStore keeps the whole index in memory
+type Store interface {
+	// chain state
+	GetBestBlock() (uint32, string, error)
+	GetBlockHash(height uint32) (string, error)
+	GetBlockInfo(height uint32) (*BlockInfo, error)
+	GetBlockStats(from, to uint32) ([]BlockStats, error)
+	GetOrphanedBlocks(from, to uint32) ([]OrphanedBlock, error)
+	ConnectBlock(block *bchain.Block) error
+	DisconnectBlockRangeBitcoinType(lower uint32, higher uint32) error
+	SetInternalState(is *common.InternalState)
+	GetInternalState() *common.InternalState
+	HasExtendedIndex() bool
+	HasStakingIndex() bool
+	DatabaseSizeOnDisk() int64
+	Close() error
+
+	// transactions and addresses
+	GetTx(txid string) (*bchain.Tx, uint32, error)
+	PutTx(tx *bchain.Tx, height uint32, blockTime int64) error
+	GetTxAddresses(txid string) (*TxAddresses, error)
+	GetTransactions(address string, lower uint32, higher uint32, fn GetTransactionsCallback) error
+	GetAddrDescTransactions(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn GetTransactionsCallback) error
+	GetAddrDescBalance(addrDesc bchain.AddressDescriptor, detail AddressBalanceDetail) (*AddrBalance, error)
+	GetAddrDescStakes(addrDesc bchain.AddressDescriptor, lower uint32, higher uint32, fn GetStakesCallback) error
+	GetAddressAlias(address string) string
+
+	// rich list
+	HasRichList() bool
+	RichListSize() int
+	GetRichList(from, to int) ([]RichListItem, error)
+
+	// xpub cache
+	GetXpubCache(xpub string) (*XpubCache, error)
+	StoreXpubCache(xpub string, xc *XpubCache, height uint32) error
+	EvictXpubCache(accessedBefore int64, maxCount int) (int, error)
+
+	// registered accounts
+	GetAccount(descriptor string) (*Account, error)
+	GetAccounts() ([]Account, error)
+	StoreAccount(a *Account) error
+	DeleteAccount(descriptor string) error
+	GetAccountChanges(height uint32) ([]AccountChange, error)
+
+	// silent payments
+	HasSilentPayments() bool
+	GetSilentPaymentTweaks(height uint32) ([]SilentPaymentTweak, error)
+
+	// ethereum type
+	GetEthereumInternalData(txid string) (*bchain.EthereumInternalData, error)
+	GetAddrDescContracts(addrDesc bchain.AddressDescriptor) (*AddrContracts, error)
+	GetContractInfo(contract bchain.AddressDescriptor, typeFromContext bchain.TokenTypeName) (*bchain.ContractInfo, error)
+	GetContractInfoForAddress(address string) (*bchain.ContractInfo, error)
+	StoreContractInfo(contractInfo *bchain.ContractInfo) error
+	GetFourByteSignature(fourBytes uint32, id uint32) (*bchain.FourByteSignature, error)
+	GetFourByteSignatures(fourBytes uint32) (*[]bchain.FourByteSignature, error)
+	StoreFourByteSignatures(records []FourByteSignatureRecord) error
+
+	// fiat rates
+	FiatRatesGetTicker(tickerTime *time.Time) (*common.CurrencyRatesTicker, error)
+	FiatRatesFindTicker(tickerTime *time.Time, vsCurrency string, token string) (*common.CurrencyRatesTicker, error)
+	FiatRatesFindLastTicker(vsCurrency string, token string) (*common.CurrencyRatesTicker, error)
+	FiatRatesStoreTickers(tickers []*common.CurrencyRatesTicker) error
+}
+
+var _ Store = (*RocksDB)(nil)
+var _ Store = (*MemoryStore)(nil)
+
+// FourByteSignatureRecord is a 4byte signature together with its four bytes and id
+type FourByteSignatureRecord struct {
+	FourBytes uint32
+	ID        uint32
+	Signature *bchain.FourByteSignature
+}
@@ -72,20 +72,27 @@ func (w *SyncWorker) updateBackendInfo() {
 		Warnings:         ci.Warnings,
 		ConsensusVersion: ci.ConsensusVersion,
 		Consensus:        ci.Consensus,
+		ActiveBackend:    ci.ActiveBackend,
+		Backends:         ci.Backends,
 	})
 }
 
 // ResyncIndex synchronizes index to the top of the blockchain
 // onNewBlock is called when new block is connected, but not in initial parallel sync
-func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+// onReorg is called after the blocks orphaned by a chain reorganization are disconnected, before the index is synchronized
+func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, onReorg OnReorgFunc, initialSync bool) error {
 	start := time.Now()
 	w.is.StartedSync()
 
-	err := w.resyncIndex(onNewBlock, initialSync)
+	err := w.resyncIndex(onNewBlock, onReorg, initialSync)
 
 	// update backend info after each resync
 	w.updateBackendInfo()
 
+	if err == nil || err == errSynced {
+		w.clearReorgDepthExceeded()
+	}
+
 	switch err {
 	case nil:
 		d := time.Since(start)
@@ -110,12 +117,16 @@ func (w *SyncWorker) ResyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 		return nil
 	}
 
-	w.metrics.IndexResyncErrors.With(common.Labels{"error": "failure"}).Inc()
+	if errors.Cause(err) == ErrReorgDepthExceeded {
+		w.metrics.IndexResyncErrors.With(common.Labels{"error": "reorg_depth_exceeded"}).Inc()
+	} else {
+		w.metrics.IndexResyncErrors.With(common.Labels{"error": "failure"}).Inc()
+	}
 
 	return err
 }
 
-func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, onReorg OnReorgFunc, initialSync bool) error {
 	remoteBestHash, err := w.chain.GetBestBlockHash()
 	if err != nil {
 		return err
@@ -138,7 +149,7 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 		if remoteHash != localBestHash {
 			// forked - the remote hash differs from the local hash at the same height
 			glog.Info("resync: local is forked at height ", localBestHeight, ", local hash ", localBestHash, ", remote hash ", remoteHash)
-			return w.handleFork(localBestHeight, localBestHash, onNewBlock, initialSync)
+			return w.handleFork(localBestHeight, localBestHash, onNewBlock, onReorg, initialSync)
 		}
 		glog.Info("resync: local at ", localBestHeight, " is behind")
 		w.startHeight = localBestHeight + 1
@@ -170,20 +181,19 @@ func (w *SyncWorker) resyncIndex(onNewBlock bchain.OnNewBlockFunc, initialSync b
 			}
 			// after parallel load finish the sync using standard way,
 			// new blocks may have been created in the meantime
-			return w.resyncIndex(onNewBlock, initialSync)
+			return w.resyncIndex(onNewBlock, onReorg, initialSync)
 		}
 	}
 	err = w.connectBlocks(onNewBlock, initialSync)
 	if err == errFork {
-		return w.resyncIndex(onNewBlock, initialSync)
+		return w.resyncIndex(onNewBlock, onReorg, initialSync)
 	}
 	return err
 }
 
-func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
+func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, onNewBlock bchain.OnNewBlockFunc, onReorg OnReorgFunc, initialSync bool) error {
 	// find forked blocks, disconnect them and then synchronize again
 	var height uint32
-	hashes := []string{localBestHash}
 	for height = localBestHeight - 1; height >= 0; height-- {
 		local, err := w.db.GetBlockHash(height)
 		if err != nil {
@@ -200,12 +210,72 @@ func (w *SyncWorker) handleFork(localBestHeight uint32, localBestHash string, on
 		if local == remote {
 			break
 		}
-		hashes = append(hashes, local)
 	}
-	if err := w.DisconnectBlocks(height+1, localBestHeight, hashes); err != nil {
+	orphaned, err := w.getOrphanedBlocks(height+1, localBestHeight)
+	if err != nil {
+		return err
+	}
+	if err := w.disconnectBlocks(height+1, localBestHeight, orphaned); err != nil {
+		if errors.Cause(err) == ErrReorgDepthExceeded {
+			w.setReorgDepthExceeded(height+1, localBestHeight, err)
+		}
 		return err
 	}
-	return w.resyncIndex(onNewBlock, initialSync)
+	if onReorg != nil {
+		tipHeight, tipHash, err := w.db.GetBestBlock()
+		if err != nil {
+			return err
+		}
+		onReorg(&Reorg{Orphaned: orphaned, TipHeight: tipHeight, TipHash: tipHash})
+	}
+	return w.resyncIndex(onNewBlock, onReorg, initialSync)
+}
+
+// getOrphanedBlocks returns the info about the blocks in range lower-higher, which are going to be disconnected because of a fork
+func (w *SyncWorker) getOrphanedBlocks(lower uint32, higher uint32) ([]OrphanedBlock, error) {
+	now := time.Now().Unix()
+	orphaned := make([]OrphanedBlock, 0, higher-lower+1)
+	for height := lower; height <= higher; height++ {
+		bi, err := w.db.GetBlockInfo(height)
+		if err != nil {
+			return nil, err
+		}
+		if bi == nil {
+			continue
+		}
+		orphaned = append(orphaned, OrphanedBlock{
+			Height:       height,
+			Hash:         bi.Hash,
+			Time:         bi.Time,
+			Txs:          bi.Txs,
+			Size:         bi.Size,
+			OrphanedTime: now,
+		})
+	}
+	return orphaned, nil
+}
+
+// setReorgDepthExceeded records that the fork starting at the height forkHeight could not be disconnected
+func (w *SyncWorker) setReorgDepthExceeded(forkHeight uint32, bestHeight uint32, err error) {
+	hash, _ := w.db.GetBlockHash(forkHeight)
+	glog.Error("resync: cannot disconnect blocks ", forkHeight, "-", bestHeight, ", the index does not synchronize until the fork is resolved or the index is rebuilt: ", err)
+	w.is.SetReorgDepthExceeded(&common.ReorgDepthExceeded{
+		Height:     forkHeight,
+		Hash:       hash,
+		BestHeight: bestHeight,
+		Error:      err.Error(),
+		Time:       time.Now().UTC(),
+	})
+	w.metrics.ReorgDepthExceeded.Set(1)
+}
+
+// clearReorgDepthExceeded clears the state of the fork which could not be disconnected after the index is synchronized
+func (w *SyncWorker) clearReorgDepthExceeded() {
+	if w.is.GetReorgDepthExceeded() != nil {
+		glog.Info("resync: the fork which could not be disconnected is resolved")
+		w.is.SetReorgDepthExceeded(nil)
+		w.metrics.ReorgDepthExceeded.Set(0)
+	}
 }
 
 func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync bool) error {
@@ -271,7 +341,16 @@ func (w *SyncWorker) connectBlocks(onNewBlock bchain.OnNewBlockFunc, initialSync
 	return nil
 }
 
+// syncReorderBlocksPerWorker is the number of blocks per sync worker that can be fetched ahead of the last connected block
+// A block which takes long to fetch (e.g. because of debug traces of a large EVM block) does not stop the other workers
+// until the reorder buffer is full.
+const syncReorderBlocksPerWorker = 8
+
+// syncCheckpointPeriod is the period of the checkpoints of the bulk connect, the interrupted sync is resumed from the last checkpoint
+const syncCheckpointPeriod = 15 * time.Minute
+
 // ConnectBlocksParallel uses parallel goroutines to get data from blockchain daemon
+// The blocks are received in random order, they are reordered in a bounded buffer and connected in the order of height.
 func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 	type hashHeight struct {
 		hash   string
@@ -279,13 +358,12 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 	}
 	var err error
 	var wg sync.WaitGroup
-	bch := make([]chan *bchain.Block, w.syncWorkers)
-	for i := 0; i < w.syncWorkers; i++ {
-		bch[i] = make(chan *bchain.Block)
-	}
+	bch := make(chan *bchain.Block, w.syncWorkers)
 	hch := make(chan hashHeight, w.syncWorkers)
 	hchClosed := atomic.Value{}
 	hchClosed.Store(false)
+	// a slot in the window is taken for each requested block and released when the block is connected
+	window := make(chan struct{}, w.syncWorkers*syncReorderBlocksPerWorker)
 	writeBlockDone := make(chan struct{})
 	terminating := make(chan struct{})
 	writeBlockWorker := func() {
@@ -296,26 +374,46 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 		}
 		lastBlock := lower - 1
 		keep := uint32(w.chain.GetChainParser().KeepBlockAddresses())
+		pending := make(map[uint32]*bchain.Block)
+		lastCheckpoint := time.Now()
 	WriteBlockLoop:
 		for {
 			select {
-			case b := <-bch[(lastBlock+1)%uint32(w.syncWorkers)]:
+			case b := <-bch:
 				if b == nil {
 					// channel is closed and empty - work is done
 					break WriteBlockLoop
 				}
-				if b.Height != lastBlock+1 {
-					glog.Fatal("writeBlockWorker skipped block, expected block ", lastBlock+1, ", new block ", b.Height)
+				if b.Height <= lastBlock || b.Height > higher {
+					glog.Fatal("writeBlockWorker unexpected block ", b.Height, ", last connected block ", lastBlock)
 				}
-				err := bc.ConnectBlock(b, b.Height+keep > higher)
-				if err != nil {
-					glog.Fatal("writeBlockWorker ", b.Height, " ", b.Hash, " error ", err)
+				pending[b.Height] = b
+				for {
+					b, ok := pending[lastBlock+1]
+					if !ok {
+						break
+					}
+					delete(pending, b.Height)
+					err := bc.ConnectBlock(b, b.Height+keep > higher)
+					if err != nil {
+						glog.Fatal("writeBlockWorker ", b.Height, " ", b.Hash, " error ", err)
+					}
+					lastBlock = b.Height
+					<-window
+					if time.Since(lastCheckpoint) > syncCheckpointPeriod {
+						if err := bc.Checkpoint(); err != nil {
+							glog.Fatal("writeBlockWorker ", b.Height, " checkpoint error ", err)
+						}
+						lastCheckpoint = time.Now()
+					}
 				}
-				lastBlock = b.Height
 			case <-terminating:
 				break WriteBlockLoop
 			}
 		}
+		if len(pending) > 0 {
+			glog.Info("writeBlockWorker discarded ", len(pending), " blocks after block ", lastBlock)
+		}
 		err = bc.Close()
 		if err != nil {
 			glog.Error("sync: bulkconnect.Close error ", err)
@@ -344,10 +442,11 @@ func (w *SyncWorker) ConnectBlocksParallel(lower, higher uint32) error {
 				}
 			}
 			if w.dryRun {
+				<-window
 				continue
 			}
 			select {
-			case bch[hh.height%uint32(w.syncWorkers)] <- block:
+			case bch <- block:
 			case <-terminating:
 				break GetBlockLoop
 			}
@@ -371,9 +470,10 @@ ConnectLoop:
 			// signal all workers to terminate their loops (error loops are interrupted below)
 			close(terminating)
 			break ConnectLoop
-		default:
+		case window <- struct{}{}:
 			hash, err = w.chain.GetBlockHash(h)
 			if err != nil {
+				<-window
 				glog.Error("GetBlockHash error ", err)
 				w.metrics.IndexResyncErrors.With(common.Labels{"error": "failure"}).Inc()
 				time.Sleep(time.Millisecond * 500)
@@ -400,9 +500,7 @@ ConnectLoop:
 	hchClosed.Store(true)
 	// wait for workers and close bch that will stop writer loop
 	wg.Wait()
-	for i := 0; i < w.syncWorkers; i++ {
-		close(bch[i])
-	}
+	close(bch)
 	<-writeBlockDone
 	return err
 }
@@ -447,13 +545,13 @@ func (w *SyncWorker) getBlockChain(out chan blockResult, done chan struct{}) {
 }
 
 // DisconnectBlocks removes all data belonging to blocks in range lower-higher,
+// the data of the blocks older than block_addresses_to_keep are reconstructed using the blocks from the backend
 func (w *SyncWorker) DisconnectBlocks(lower uint32, higher uint32, hashes []string) error {
+	return w.disconnectBlocks(lower, higher, nil)
+}
+
+// disconnectBlocks removes the blocks in range lower-higher and stores the orphaned blocks in the same write batches
+func (w *SyncWorker) disconnectBlocks(lower uint32, higher uint32, orphaned []OrphanedBlock) error {
 	glog.Infof("sync: disconnecting blocks %d-%d", lower, higher)
-	ct := w.chain.GetChainParser().GetChainType()
-	if ct == bchain.ChainBitcoinType {
-		return w.db.DisconnectBlockRangeBitcoinType(lower, higher)
-	} else if ct == bchain.ChainEthereumType {
-		return w.db.DisconnectBlockRangeEthereumType(lower, higher)
-	}
-	return errors.New("Unknown chain type")
+	return w.db.DisconnectDeepBlockRange(lower, higher, w.chain.GetBlock, orphaned)
 }
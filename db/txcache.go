@@ -10,7 +10,7 @@ import (
 
 // TxCache is handle to TxCacheServer
 type TxCache struct {
-	db        *RocksDB
+	db        Store
 	chain     bchain.BlockChain
 	metrics   *common.Metrics
 	is        *common.InternalState
@@ -19,7 +19,7 @@ type TxCache struct {
 }
 
 // NewTxCache creates new TxCache interface and returns its handle
-func NewTxCache(db *RocksDB, chain bchain.BlockChain, metrics *common.Metrics, is *common.InternalState, enabled bool) (*TxCache, error) {
+func NewTxCache(db Store, chain bchain.BlockChain, metrics *common.Metrics, is *common.InternalState, enabled bool) (*TxCache, error) {
 	if !enabled {
 		glog.Info("txcache: disabled")
 	}
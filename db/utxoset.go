@@ -0,0 +1,336 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+	"golang.org/x/crypto/chacha20"
+)
+
+// UtxoSetInfo contains statistics of the unspent outputs in the addressBalance column
+type UtxoSetInfo struct {
+	Height      uint32
+	BestBlock   string
+	TxOuts      int64
+	TotalAmount big.Int
+	MuHash      string
+}
+
+// UtxoSetVerification is the result of the comparison of the unspent outputs of the index and of the backend
+type UtxoSetVerification struct {
+	Index   *UtxoSetInfo
+	Backend *bchain.TxOutSetInfo
+	// DivergedHeight is the first height where the block in the index differs from the backend, 0 if the blocks match
+	DivergedHeight uint32
+	// HashCompared is true if the backend returned muhash and it was compared
+	HashCompared bool
+	// HashMismatch is true if the best block matches the backend but the muhash differs,
+	// the index contains different unspent outputs and the different block cannot be found by the block hashes
+	HashMismatch bool
+	Match        bool
+}
+
+// muHash3072 is the rolling set hash used by the backend in gettxoutsetinfo muhash
+type muHash3072 struct {
+	num big.Int
+}
+
+var muHashPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072), big.NewInt(1103717))
+
+func newMuHash3072() *muHash3072 {
+	m := &muHash3072{}
+	m.num.SetInt64(1)
+	return m
+}
+
+// muHashNum maps the data to a 3072 bit number by the ChaCha20 keystream keyed by sha256 of the data
+func muHashNum(data []byte) *big.Int {
+	key := sha256.Sum256(data)
+	c, err := chacha20.NewUnauthenticatedCipher(key[:], make([]byte, chacha20.NonceSize))
+	if err != nil {
+		// cannot happen, the key and nonce have correct sizes
+		panic(err)
+	}
+	buf := make([]byte, 384)
+	c.XORKeyStream(buf, buf)
+	// the number is little endian
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return new(big.Int).SetBytes(buf)
+}
+
+func (m *muHash3072) insert(data []byte) {
+	m.num.Mul(&m.num, muHashNum(data))
+	m.num.Mod(&m.num, muHashPrime)
+}
+
+// finalize returns the hash in the form returned by the backend
+func (m *muHash3072) finalize() string {
+	buf := make([]byte, 384)
+	m.num.FillBytes(buf)
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	h := sha256.Sum256(buf)
+	// uint256 is displayed in reversed byte order
+	for i, j := 0, len(h)-1; i < j; i, j = i+1, j-1 {
+		h[i], h[j] = h[j], h[i]
+	}
+	return hex.EncodeToString(h[:])
+}
+
+// serializeUtxo serializes the unspent output in the format used by the backend for muhash
+func serializeUtxo(buf *bytes.Buffer, btxID []byte, vout int32, height uint32, coinbase bool, value int64, script []byte) {
+	var b [8]byte
+	buf.Reset()
+	// txid is stored in internal byte order, reversed to the hex form
+	for i := len(btxID) - 1; i >= 0; i-- {
+		buf.WriteByte(btxID[i])
+	}
+	binary.LittleEndian.PutUint32(b[:4], uint32(vout))
+	buf.Write(b[:4])
+	code := height * 2
+	if coinbase {
+		code++
+	}
+	binary.LittleEndian.PutUint32(b[:4], code)
+	buf.Write(b[:4])
+	binary.LittleEndian.PutUint64(b[:], uint64(value))
+	buf.Write(b[:])
+	writeCompactSize(buf, uint64(len(script)))
+	buf.Write(script)
+}
+
+func writeCompactSize(buf *bytes.Buffer, n uint64) {
+	var b [8]byte
+	switch {
+	case n < 253:
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(253)
+		binary.LittleEndian.PutUint16(b[:2], uint16(n))
+		buf.Write(b[:2])
+	case n <= 0xffffffff:
+		buf.WriteByte(254)
+		binary.LittleEndian.PutUint32(b[:4], uint32(n))
+		buf.Write(b[:4])
+	default:
+		buf.WriteByte(255)
+		binary.LittleEndian.PutUint64(b[:], n)
+		buf.Write(b[:])
+	}
+}
+
+// isCoinbaseTx returns true if the transaction has the single input without the previous output
+func isCoinbaseTx(ta *TxAddresses) bool {
+	return len(ta.Inputs) == 1 && len(ta.Inputs[0].AddrDesc) == 0 && ta.Inputs[0].ValueSat.Sign() == 0
+}
+
+// ComputeUtxoSetInfo computes the number, the total amount and the muhash of the unspent outputs in the addressBalance column
+// The outputs of the genesis block are skipped, the backend does not include them in the unspent outputs set.
+// Can be very slow operation, the transaction of each unspent output is read to find out if it is a coinbase.
+func (d *RocksDB) ComputeUtxoSetInfo(stop chan os.Signal) (*UtxoSetInfo, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return nil, errors.New("ComputeUtxoSetInfo is supported only for bitcoin type coins")
+	}
+	bestHeight, bestHash, err := d.GetBestBlock()
+	if err != nil {
+		return nil, err
+	}
+	r := &UtxoSetInfo{Height: bestHeight, BestBlock: bestHash}
+	mh := newMuHash3072()
+	coinbase := make(map[string]bool)
+	var buf bytes.Buffer
+	var rows int64
+	var seekKey []byte
+	// do not use cache
+	ro := grocksdb.NewDefaultReadOptions()
+	ro.SetFillCache(false)
+	defer ro.Destroy()
+	for {
+		var addrDesc bchain.AddressDescriptor
+		it := d.db.NewIteratorCF(ro, d.cfh[cfAddressBalance])
+		if rows == 0 {
+			it.SeekToFirst()
+		} else {
+			glog.Info("ComputeUtxoSetInfo: rows ", rows, ", txouts ", r.TxOuts, ", in progress...")
+			it.Seek(seekKey)
+			it.Next()
+		}
+		for count := 0; it.Valid() && count < refreshIterator; it.Next() {
+			select {
+			case <-stop:
+				it.Close()
+				return nil, ErrOperationInterrupted
+			default:
+			}
+			addrDesc = it.Key().Data()
+			count++
+			rows++
+			val := it.Value().Data()
+			if len(val) < 5 {
+				continue
+			}
+			ab, err := unpackAddrBalance(val, d.chainParser.PackedTxidLen(), AddressBalanceDetailUTXO)
+			if err != nil {
+				it.Close()
+				return nil, err
+			}
+			script, err := d.chainParser.GetScriptFromAddrDesc(addrDesc)
+			if err != nil {
+				it.Close()
+				return nil, err
+			}
+			// duplicate coinbase transactions (BIP30) are stored as two utxos of the same outpoint
+			type utxoOutpoint struct {
+				btxID string
+				vout  int32
+			}
+			seen := make(map[utxoOutpoint]struct{}, len(ab.Utxos))
+			for i := range ab.Utxos {
+				u := &ab.Utxos[i]
+				if u.Height == 0 {
+					continue
+				}
+				op := utxoOutpoint{string(u.BtxID), u.Vout}
+				if _, found := seen[op]; found {
+					continue
+				}
+				seen[op] = struct{}{}
+				cb, found := coinbase[string(u.BtxID)]
+				if !found {
+					ta, err := d.getTxAddresses(u.BtxID)
+					if err != nil {
+						it.Close()
+						return nil, err
+					}
+					cb = ta != nil && isCoinbaseTx(ta)
+					// only the coinbases are cached, other transactions have usually few outputs
+					if cb {
+						coinbase[string(u.BtxID)] = cb
+					}
+				}
+				r.TxOuts++
+				r.TotalAmount.Add(&r.TotalAmount, &u.ValueSat)
+				serializeUtxo(&buf, u.BtxID, u.Vout, u.Height, cb, u.ValueSat.Int64(), script)
+				mh.insert(buf.Bytes())
+			}
+		}
+		seekKey = append([]byte{}, addrDesc...)
+		valid := it.Valid()
+		it.Close()
+		if !valid {
+			break
+		}
+	}
+	r.MuHash = mh.finalize()
+	return r, nil
+}
+
+func (d *RocksDB) blockMatches(chain bchain.BlockChain, height uint32) (bool, error) {
+	bi, err := d.GetBlockInfo(height)
+	if err != nil || bi == nil {
+		return false, err
+	}
+	hash, err := chain.GetBlockHash(height)
+	if err != nil {
+		if err == bchain.ErrBlockNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return bi.Hash == hash, nil
+}
+
+// findDivergedHeight finds by bisection the first height where the block in the index differs from the backend
+// the block at height high must differ
+func (d *RocksDB) findDivergedHeight(chain bchain.BlockChain, high uint32) (uint32, error) {
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfHeight])
+	it.SeekToFirst()
+	if !it.Valid() {
+		it.Close()
+		return 0, errors.New("The index is empty")
+	}
+	low := unpackUint(it.Key().Data())
+	it.Close()
+	ok, err := d.blockMatches(chain, low)
+	if err != nil || !ok {
+		return low, err
+	}
+	for low+1 < high {
+		mid := low + (high-low)/2
+		ok, err := d.blockMatches(chain, mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+	return high, nil
+}
+
+// VerifyUtxoSet compares the unspent outputs in the index with the unspent outputs set of the backend
+// If the best block of the index is not in the backend chain, the first different block is found instead.
+func (d *RocksDB) VerifyUtxoSet(chain bchain.BlockChain, stop chan os.Signal) (*UtxoSetVerification, error) {
+	start := time.Now()
+	bestHeight, bestHash, err := d.GetBestBlock()
+	if err != nil {
+		return nil, err
+	}
+	r := &UtxoSetVerification{}
+	ok, err := d.blockMatches(chain, bestHeight)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if r.DivergedHeight, err = d.findDivergedHeight(chain, bestHeight); err != nil {
+			return nil, err
+		}
+		glog.Errorf("VerifyUtxoSet: index diverged from the backend at height %d", r.DivergedHeight)
+		return r, nil
+	}
+	glog.Info("VerifyUtxoSet: computing unspent outputs of block ", bestHeight, " ", bestHash)
+	if r.Index, err = d.ComputeUtxoSetInfo(stop); err != nil {
+		return nil, err
+	}
+	if r.Index.BestBlock != bestHash {
+		return nil, errors.New("The index changed during the verification")
+	}
+	// older backends support neither the hash type nor the height
+	r.Backend, err = chain.GetTxOutSetInfo("muhash", int(bestHeight))
+	if err != nil {
+		glog.Warning("VerifyUtxoSet: gettxoutsetinfo muhash at height ", bestHeight, ": ", err)
+		if r.Backend, err = chain.GetTxOutSetInfo("", -1); err != nil {
+			return nil, err
+		}
+	}
+	if r.Backend.BestBlock != bestHash {
+		return nil, errors.Errorf("The backend is at block %d %s, the index at block %d %s", r.Backend.Height, r.Backend.BestBlock, bestHeight, bestHash)
+	}
+	r.Match = r.Index.TxOuts == r.Backend.TxOuts && r.Index.TotalAmount.Cmp(&r.Backend.TotalAmount) == 0
+	if r.Backend.MuHash != "" {
+		r.HashCompared = true
+		r.HashMismatch = r.Index.MuHash != r.Backend.MuHash
+		r.Match = r.Match && !r.HashMismatch
+	}
+	glog.Infof("VerifyUtxoSet: index txouts %d, amount %s, muhash %s", r.Index.TxOuts, r.Index.TotalAmount.String(), r.Index.MuHash)
+	glog.Infof("VerifyUtxoSet: backend txouts %d, amount %s, muhash %s", r.Backend.TxOuts, r.Backend.TotalAmount.String(), r.Backend.MuHash)
+	if r.HashMismatch {
+		glog.Errorf("VerifyUtxoSet: the best block %d %s matches the backend, but the muhash of the unspent outputs differs", bestHeight, bestHash)
+	}
+	glog.Info("VerifyUtxoSet: finished in ", time.Since(start), ", match ", r.Match)
+	return r, nil
+}
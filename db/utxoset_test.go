@@ -0,0 +1,145 @@
+//go:build unittest
+
+package db
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func TestMuHash3072(t *testing.T) {
+	num := func(i byte) *big.Int {
+		b := make([]byte, 32)
+		b[0] = i
+		return muHashNum(b)
+	}
+	// test vector of bitcoin core, FromInt(0) * FromInt(1) / FromInt(2)
+	m := newMuHash3072()
+	m.num.Mul(num(0), num(1))
+	m.num.Mul(&m.num, new(big.Int).ModInverse(num(2), muHashPrime))
+	m.num.Mod(&m.num, muHashPrime)
+	if got, want := m.finalize(), "10d312b100cbd32ada024a6646e40d3482fcff103668d2625f10002a607d5863"; got != want {
+		t.Errorf("muhash = %v, want %v", got, want)
+	}
+	// the hash does not depend on the order of inserts
+	m1, m2 := newMuHash3072(), newMuHash3072()
+	m1.insert([]byte{1})
+	m1.insert([]byte{2})
+	m2.insert([]byte{2})
+	m2.insert([]byte{1})
+	if m1.finalize() != m2.finalize() {
+		t.Error("muhash depends on the order of inserts")
+	}
+}
+
+type utxoSetTestChain struct {
+	bchain.BlockChain
+	info   *bchain.TxOutSetInfo
+	hashes map[uint32]string
+}
+
+func (c *utxoSetTestChain) GetBlockHash(height uint32) (string, error) {
+	if h, found := c.hashes[height]; found {
+		return h, nil
+	}
+	return c.BlockChain.GetBlockHash(height)
+}
+
+func (c *utxoSetTestChain) GetTxOutSetInfo(hashType string, height int) (*bchain.TxOutSetInfo, error) {
+	return c.info, nil
+}
+
+func Test_serializeUtxo(t *testing.T) {
+	// the coinbase output of the block 1 of bitcoin mainnet
+	btxID, _ := hex.DecodeString("0e3e2357e806b6cdb1f70b54c3a3a17b6714ee1f0e68bebb44a74b1efd512098")
+	script, _ := hex.DecodeString("410496b538e853519c726a2c91e61ec11600ae1390813a627c66fb8be7947be63c52da7589379515d4e0a604f8141781e62294721166bf621e73a82cbf2342c858eeac")
+	var buf bytes.Buffer
+	serializeUtxo(&buf, btxID, 0, 1, true, 5000000000, script)
+	// the outpoint, the height*2+coinbase and the output as serialized by the backend for muhash
+	want := "982051fd1e4ba744bbbe680e1fee14677ba1a3c3540bf7b1cdb606e857233e0e" + "00000000" +
+		"03000000" +
+		"00f2052a01000000" + "43" + hex.EncodeToString(script)
+	if got := hex.EncodeToString(buf.Bytes()); got != want {
+		t.Errorf("serializeUtxo() = %v, want %v", got, want)
+	}
+}
+
+// the unspent outputs after the test blocks 1 and 2, the coinbase output of the block 2 is marked by the height code
+const (
+	utxoSetTestTxOuts = 7
+	utxoSetTestAmount = 1236027953737
+	utxoSetTestMuHash = "a2cb94d9d1a84ca59e057eedb5d436a507e88eeb72193b89f18bb4adf94e8863"
+)
+
+func TestRocksDB_VerifyUtxoSet(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	block2 := dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)
+	if err := d.ConnectBlock(block2); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := d.ComputeUtxoSetInfo(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Height != 225494 || info.TxOuts != utxoSetTestTxOuts || info.TotalAmount.Cmp(big.NewInt(utxoSetTestAmount)) != 0 || info.MuHash != utxoSetTestMuHash {
+		t.Errorf("ComputeUtxoSetInfo() = %+v, want %d txouts, amount %d, muhash %s", info, utxoSetTestTxOuts, utxoSetTestAmount, utxoSetTestMuHash)
+	}
+
+	fake, err := dbtestdata.NewFakeBlockChain(d.chainParser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := &utxoSetTestChain{
+		BlockChain: fake,
+		info: &bchain.TxOutSetInfo{
+			Height:      225494,
+			BestBlock:   block2.Hash,
+			TxOuts:      utxoSetTestTxOuts,
+			TotalAmount: *big.NewInt(utxoSetTestAmount),
+			MuHash:      utxoSetTestMuHash,
+		},
+	}
+	r, err := d.VerifyUtxoSet(chain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Match || !r.HashCompared || r.HashMismatch || r.DivergedHeight != 0 {
+		t.Errorf("VerifyUtxoSet() = %+v, want match", r)
+	}
+
+	// the same number and amount of the outputs, but different outputs
+	chain.info.MuHash = "0000000000000000000000000000000000000000000000000000000000000001"
+	if r, err = d.VerifyUtxoSet(chain, nil); err != nil {
+		t.Fatal(err)
+	}
+	if r.Match || !r.HashMismatch || r.DivergedHeight != 0 {
+		t.Errorf("VerifyUtxoSet() with different muhash = %+v, want hash mismatch", r)
+	}
+
+	chain.info.TotalAmount.Add(&chain.info.TotalAmount, big.NewInt(1))
+	chain.info.MuHash = ""
+	if r, err = d.VerifyUtxoSet(chain, nil); err != nil {
+		t.Fatal(err)
+	}
+	if r.Match || r.HashCompared || r.HashMismatch {
+		t.Errorf("VerifyUtxoSet() with different amount = %+v, want mismatch", r)
+	}
+
+	chain.hashes = map[uint32]string{225494: "0000000000000000000000000000000000000000000000000000000000000001"}
+	if r, err = d.VerifyUtxoSet(chain, nil); err != nil {
+		t.Fatal(err)
+	}
+	if r.Match || r.DivergedHeight != 225494 || r.Index != nil {
+		t.Errorf("VerifyUtxoSet() with different block = %+v, want diverged at 225494", r)
+	}
+}
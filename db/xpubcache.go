@@ -0,0 +1,504 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"github.com/juju/errors"
+	"github.com/linxGnu/grocksdb"
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+)
+
+// the access time of a not modified xpub cache is stored at most once in this interval (in seconds)
+const xpubCacheAccessUpdate = 24 * 3600
+
+const xpubCacheKeyLen = sha256.Size
+
+// XpubCacheAddress is an address derived from a cached xpub
+type XpubCacheAddress struct {
+	AddrDesc bchain.AddressDescriptor
+	// BalanceHeight is the height of the last block changing the balance of the address, 0 if the address was not used
+	BalanceHeight uint32
+}
+
+// XpubCache is the persisted state of the discovery of the addresses of an xpub
+// The addresses are stored for each change index of the xpub descriptor in the order of derivation.
+type XpubCache struct {
+	// Valid is false if a disconnected block changed the balances of the addresses, the balances must be rescanned
+	Valid bool
+	// Accessed is the unix time of the last store of the cache
+	Accessed int64
+	// LastUsed is the index of the last used address of each change index, -1 if there is no used address
+	LastUsed  []int
+	Addresses [][]XpubCacheAddress
+	// number of addresses of each change index indexed in the xpubCacheAddresses column
+	indexed  []int
+	modified bool
+}
+
+// xpubCacheRef is a reference from an address to the cached xpub it was derived from
+type xpubCacheRef struct {
+	key   []byte
+	chain int
+	index int
+}
+
+// NewXpubCache returns an empty xpub cache for the number of change indexes of the xpub descriptor
+func NewXpubCache(changeIndexes int) *XpubCache {
+	xc := &XpubCache{
+		Valid:     true,
+		LastUsed:  make([]int, changeIndexes),
+		Addresses: make([][]XpubCacheAddress, changeIndexes),
+		indexed:   make([]int, changeIndexes),
+	}
+	for i := range xc.LastUsed {
+		xc.LastUsed[i] = -1
+	}
+	return xc
+}
+
+// xpubCacheBalanceHeight returns the height of the last change of the balance, 0 if the address is not used
+func xpubCacheBalanceHeight(ab *AddrBalance) uint32 {
+	if ab == nil || ab.Txs == 0 {
+		return 0
+	}
+	// an address used only in the genesis block must be distinguished from an unused address
+	if ab.LastSeen == 0 {
+		return 1
+	}
+	return ab.LastSeen
+}
+
+// SetAddress sets the address at the index of the change index and the height of its balance
+// New addresses must be set in the order of derivation.
+func (xc *XpubCache) SetAddress(chain, index int, addrDesc bchain.AddressDescriptor, ab *AddrBalance) {
+	height := xpubCacheBalanceHeight(ab)
+	addresses := xc.Addresses[chain]
+	if index >= len(addresses) {
+		xc.Addresses[chain] = append(addresses, XpubCacheAddress{AddrDesc: addrDesc, BalanceHeight: height})
+		xc.modified = true
+	} else if addresses[index].BalanceHeight != height {
+		addresses[index].BalanceHeight = height
+		xc.modified = true
+	}
+	if height != 0 && index > xc.LastUsed[chain] {
+		xc.LastUsed[chain] = index
+		xc.modified = true
+	} else if height == 0 && index == xc.LastUsed[chain] {
+		// possible only after a disconnect, find the previous used address
+		addresses = xc.Addresses[chain]
+		i := index - 1
+		for ; i >= 0 && addresses[i].BalanceHeight == 0; i-- {
+		}
+		xc.LastUsed[chain] = i
+		xc.modified = true
+	}
+}
+
+func xpubCacheKey(xpub string) []byte {
+	h := sha256.Sum256([]byte(xpub))
+	return h[:]
+}
+
+func packXpubCache(xc *XpubCache) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := make([]byte, 0, 64)
+	var flags byte
+	if xc.Valid {
+		flags = 1
+	}
+	buf = append(buf, flags)
+	l := packVaruint(uint(xc.Accessed), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	l = packVaruint(uint(len(xc.Addresses)), varBuf)
+	buf = append(buf, varBuf[:l]...)
+	for i, addresses := range xc.Addresses {
+		l = packVaruint(uint(xc.LastUsed[i]+1), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packVaruint(uint(len(addresses)), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		for j := range addresses {
+			a := &addresses[j]
+			l = packVaruint(uint(len(a.AddrDesc)), varBuf)
+			buf = append(buf, varBuf[:l]...)
+			buf = append(buf, a.AddrDesc...)
+			l = packVaruint(uint(a.BalanceHeight), varBuf)
+			buf = append(buf, varBuf[:l]...)
+		}
+	}
+	return buf
+}
+
+func unpackXpubCache(buf []byte) (*XpubCache, error) {
+	invalid := errors.New("Invalid xpubCache")
+	// readVaruint reads the next number checking the length of the buffer
+	pos := 1
+	readVaruint := func() (uint, error) {
+		if pos >= len(buf) {
+			return 0, invalid
+		}
+		v, l := unpackVaruint(buf[pos:])
+		if l <= 0 {
+			return 0, invalid
+		}
+		pos += l
+		return v, nil
+	}
+	if len(buf) == 0 {
+		return nil, invalid
+	}
+	accessed, err := readVaruint()
+	if err != nil {
+		return nil, err
+	}
+	chains, err := readVaruint()
+	if err != nil {
+		return nil, err
+	}
+	xc := NewXpubCache(int(chains))
+	xc.Valid = buf[0]&1 != 0
+	xc.Accessed = int64(accessed)
+	for i := range xc.Addresses {
+		lastUsed, err := readVaruint()
+		if err != nil {
+			return nil, err
+		}
+		xc.LastUsed[i] = int(lastUsed) - 1
+		n, err := readVaruint()
+		if err != nil {
+			return nil, err
+		}
+		addresses := make([]XpubCacheAddress, n)
+		for j := range addresses {
+			al, err := readVaruint()
+			if err != nil {
+				return nil, err
+			}
+			if pos+int(al) > len(buf) {
+				return nil, invalid
+			}
+			addresses[j].AddrDesc = append(bchain.AddressDescriptor(nil), buf[pos:pos+int(al)]...)
+			pos += int(al)
+			h, err := readVaruint()
+			if err != nil {
+				return nil, err
+			}
+			addresses[j].BalanceHeight = uint32(h)
+		}
+		xc.Addresses[i] = addresses
+		xc.indexed[i] = len(addresses)
+	}
+	return xc, nil
+}
+
+func packXpubCacheRefs(refs []xpubCacheRef) []byte {
+	varBuf := make([]byte, maxPackedBigintBytes)
+	buf := make([]byte, 0, len(refs)*(xpubCacheKeyLen+4))
+	for i := range refs {
+		buf = append(buf, refs[i].key...)
+		l := packVaruint(uint(refs[i].chain), varBuf)
+		buf = append(buf, varBuf[:l]...)
+		l = packVaruint(uint(refs[i].index), varBuf)
+		buf = append(buf, varBuf[:l]...)
+	}
+	return buf
+}
+
+func unpackXpubCacheRefs(buf []byte) ([]xpubCacheRef, error) {
+	var refs []xpubCacheRef
+	for len(buf) > 0 {
+		// the key is followed by at least one byte of each number
+		if len(buf) < xpubCacheKeyLen+2 {
+			return nil, errors.New("Invalid xpubCacheAddresses")
+		}
+		r := xpubCacheRef{key: append([]byte(nil), buf[:xpubCacheKeyLen]...)}
+		buf = buf[xpubCacheKeyLen:]
+		chain, l := unpackVaruint(buf)
+		if l <= 0 || l >= len(buf) {
+			return nil, errors.New("Invalid xpubCacheAddresses")
+		}
+		buf = buf[l:]
+		index, l := unpackVaruint(buf)
+		if l <= 0 {
+			return nil, errors.New("Invalid xpubCacheAddresses")
+		}
+		buf = buf[l:]
+		r.chain, r.index = int(chain), int(index)
+		refs = append(refs, r)
+	}
+	return refs, nil
+}
+
+func (d *RocksDB) getXpubCacheByKey(key []byte) (*XpubCache, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfXpubCache], key)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	buf := val.Data()
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	return unpackXpubCache(buf)
+}
+
+func (d *RocksDB) getXpubCacheRefs(addrDesc bchain.AddressDescriptor) ([]xpubCacheRef, error) {
+	val, err := d.db.GetCF(d.ro, d.cfh[cfXpubCacheAddresses], addrDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer val.Free()
+	return unpackXpubCacheRefs(val.Data())
+}
+
+// hasXpubCache returns true if there may be cached xpubs, it must be called with the xpubCacheMux locked
+func (d *RocksDB) hasXpubCache() bool {
+	if !d.xpubCacheChecked {
+		it := d.db.NewIteratorCF(d.ro, d.cfh[cfXpubCache])
+		it.SeekToFirst()
+		d.xpubCacheFound = it.Valid()
+		it.Close()
+		d.xpubCacheChecked = true
+	}
+	return d.xpubCacheFound
+}
+
+// GetXpubCache returns the persisted discovery state of the xpub descriptor or nil if the xpub is not cached
+func (d *RocksDB) GetXpubCache(xpub string) (*XpubCache, error) {
+	return d.getXpubCacheByKey(xpubCacheKey(xpub))
+}
+
+// updateXpubCacheRefs adds or removes the reference of the xpub key to the addresses, the loaded references are kept in the refs map
+func (d *RocksDB) updateXpubCacheRefs(refs map[string][]xpubCacheRef, key []byte, addresses []XpubCacheAddress, chain, from int, remove bool) error {
+	for i := from; i < len(addresses); i++ {
+		s := string(addresses[i].AddrDesc)
+		r, found := refs[s]
+		if !found {
+			var err error
+			if r, err = d.getXpubCacheRefs(addresses[i].AddrDesc); err != nil {
+				return err
+			}
+		}
+		// drop the existing reference of the xpub, the same address can be derived at most once by an xpub
+		for j := range r {
+			if bytes.Equal(r[j].key, key) {
+				r = append(r[:j], r[j+1:]...)
+				break
+			}
+		}
+		if !remove {
+			r = append(r, xpubCacheRef{key: key, chain: chain, index: i})
+		}
+		refs[s] = r
+	}
+	return nil
+}
+
+func (d *RocksDB) storeXpubCacheRefs(wb *grocksdb.WriteBatch, refs map[string][]xpubCacheRef) {
+	for addrDesc, r := range refs {
+		if len(r) == 0 {
+			wb.DeleteCF(d.cfh[cfXpubCacheAddresses], []byte(addrDesc))
+		} else {
+			wb.PutCF(d.cfh[cfXpubCacheAddresses], []byte(addrDesc), packXpubCacheRefs(r))
+		}
+	}
+}
+
+// StoreXpubCache stores the discovery state of the xpub descriptor computed at the best block height
+// The addresses must be set from the balances at the height, the stored cache is valid.
+// The cache is not stored if it was not modified and it was accessed recently, if the height is not the best block height
+// or if the db is not in the open state.
+func (d *RocksDB) StoreXpubCache(xpub string, xc *XpubCache, height uint32) error {
+	if d.is == nil || d.is.DbState != common.DbStateOpen {
+		return nil
+	}
+	now := time.Now().Unix()
+	if xc.Valid && !xc.modified && now-xc.Accessed < xpubCacheAccessUpdate {
+		return nil
+	}
+	d.connectMux.RLock()
+	defer d.connectMux.RUnlock()
+	d.xpubCacheMux.Lock()
+	defer d.xpubCacheMux.Unlock()
+	// the blocks connected since the computation of the cache updated the stored version
+	bestHeight, _, err := d.GetBestBlock()
+	if err != nil || bestHeight != height {
+		return err
+	}
+	key := xpubCacheKey(xpub)
+	stored, err := d.getXpubCacheByKey(key)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		// the cache was evicted together with the references of its addresses
+		for i := range xc.indexed {
+			xc.indexed[i] = 0
+		}
+	}
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	refs := make(map[string][]xpubCacheRef)
+	for i, addresses := range xc.Addresses {
+		if err := d.updateXpubCacheRefs(refs, key, addresses, i, xc.indexed[i], false); err != nil {
+			return err
+		}
+	}
+	d.storeXpubCacheRefs(wb, refs)
+	xc.Valid = true
+	xc.Accessed = now
+	wb.PutCF(d.cfh[cfXpubCache], key, packXpubCache(xc))
+	if err := d.WriteBatch(wb); err != nil {
+		return err
+	}
+	for i, addresses := range xc.Addresses {
+		xc.indexed[i] = len(addresses)
+	}
+	xc.modified = false
+	d.xpubCacheChecked, d.xpubCacheFound = true, true
+	return nil
+}
+
+// updateXpubCache applies the changed balances to the cached xpubs containing the addresses
+// If disconnect is true, the affected caches are invalidated. It must be called with the xpubCacheMux locked.
+// Returns the changed addresses of the registered accounts by the descriptors of the accounts.
+func (d *RocksDB) updateXpubCache(wb *grocksdb.WriteBatch, balances map[string]*AddrBalance, disconnect bool) (map[string][]bchain.AddressDescriptor, error) {
+	if !d.hasXpubCache() {
+		return nil, nil
+	}
+	caches := make(map[string]*XpubCache)
+	changed := make(map[string][]bchain.AddressDescriptor)
+	for addrDesc, ab := range balances {
+		refs, err := d.getXpubCacheRefs(bchain.AddressDescriptor(addrDesc))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range refs {
+			xc, found := caches[string(r.key)]
+			if !found {
+				if xc, err = d.getXpubCacheByKey(r.key); err != nil {
+					return nil, err
+				}
+				caches[string(r.key)] = xc
+			}
+			if xc == nil || r.chain >= len(xc.Addresses) || r.index >= len(xc.Addresses[r.chain]) {
+				continue
+			}
+			if disconnect {
+				if xc.Valid {
+					xc.Valid = false
+					xc.modified = true
+				}
+			} else {
+				xc.SetAddress(r.chain, r.index, xc.Addresses[r.chain][r.index].AddrDesc, ab)
+				changed[string(r.key)] = append(changed[string(r.key)], bchain.AddressDescriptor(addrDesc))
+			}
+		}
+	}
+	refs := make(map[string][]xpubCacheRef)
+	accounts := make(map[string][]bchain.AddressDescriptor)
+	for key, xc := range caches {
+		if xc != nil && xc.modified {
+			// the registered accounts derive the addresses after the newly used ones immediately so that they are tracked by the next blocks
+			if !disconnect {
+				a, err := d.getAccountByKey([]byte(key))
+				if err != nil {
+					return nil, err
+				}
+				if a != nil {
+					derived, err := d.deriveAccountAddresses(a, []byte(key), xc, balances, refs)
+					if err != nil {
+						return nil, err
+					}
+					accounts[a.Descriptor] = append(changed[key], derived...)
+				}
+			}
+			wb.PutCF(d.cfh[cfXpubCache], []byte(key), packXpubCache(xc))
+		}
+	}
+	d.storeXpubCacheRefs(wb, refs)
+	return accounts, nil
+}
+
+// EvictXpubCache deletes the cached xpubs which were not accessed since the unix time accessedBefore
+// and the least recently accessed xpubs over the maximum count of the cached xpubs, 0 means no limit.
+// Returns the number of deleted xpubs.
+// The xpubs of the registered accounts are not evicted and not counted.
+func (d *RocksDB) EvictXpubCache(accessedBefore int64, maxCount int) (int, error) {
+	if d.chainParser.GetChainType() != bchain.ChainBitcoinType {
+		return 0, nil
+	}
+	d.connectMux.RLock()
+	defer d.connectMux.RUnlock()
+	d.xpubCacheMux.Lock()
+	defer d.xpubCacheMux.Unlock()
+	if !d.hasXpubCache() {
+		return 0, nil
+	}
+	type cachedXpub struct {
+		key      []byte
+		accessed int64
+	}
+	var evict, kept []cachedXpub
+	rows := 0
+	it := d.db.NewIteratorCF(d.ro, d.cfh[cfXpubCache])
+	defer it.Close()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		rows++
+		xc, err := unpackXpubCache(it.Value().Data())
+		if err != nil {
+			return 0, err
+		}
+		key := append([]byte(nil), it.Key().Data()...)
+		a, err := d.getAccountByKey(key)
+		if err != nil {
+			return 0, err
+		}
+		if a != nil {
+			continue
+		}
+		if xc.Accessed < accessedBefore {
+			evict = append(evict, cachedXpub{key, xc.Accessed})
+		} else {
+			kept = append(kept, cachedXpub{key, xc.Accessed})
+		}
+	}
+	if err := it.Err(); err != nil {
+		return 0, err
+	}
+	if maxCount > 0 && len(kept) > maxCount {
+		sort.Slice(kept, func(i, j int) bool { return kept[i].accessed < kept[j].accessed })
+		evict = append(evict, kept[:len(kept)-maxCount]...)
+	}
+	if len(evict) == 0 {
+		return 0, nil
+	}
+	wb := grocksdb.NewWriteBatch()
+	defer wb.Destroy()
+	refs := make(map[string][]xpubCacheRef)
+	for _, e := range evict {
+		xc, err := d.getXpubCacheByKey(e.key)
+		if err != nil {
+			return 0, err
+		}
+		for i, addresses := range xc.Addresses {
+			if err := d.updateXpubCacheRefs(refs, e.key, addresses, i, 0, true); err != nil {
+				return 0, err
+			}
+		}
+		wb.DeleteCF(d.cfh[cfXpubCache], e.key)
+	}
+	d.storeXpubCacheRefs(wb, refs)
+	if err := d.WriteBatch(wb); err != nil {
+		return 0, err
+	}
+	if len(evict) == rows {
+		d.xpubCacheFound = false
+	}
+	glog.Info("rocksdb: evicted ", len(evict), " of ", rows, " cached xpubs")
+	return len(evict), nil
+}
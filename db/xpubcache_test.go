@@ -0,0 +1,172 @@
+//go:build unittest
+
+package db
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/trezor/blockbook/bchain"
+	"github.com/trezor/blockbook/common"
+	"github.com/trezor/blockbook/tests/dbtestdata"
+)
+
+func TestRocksDB_XpubCache(t *testing.T) {
+	d := setupRocksDB(t, &testBitcoinParser{BitcoinParser: bitcoinTestnetParser()})
+	defer closeAndDestroyRocksDB(t, d)
+	d.is.DbState = common.DbStateOpen
+	const xpub = "tpubDDKn3FtHc74CaRrRbi1WFdJNaaenZkDWqq9NsEhcafnDZ4VuKeuLG2aKHm5SuwuLgAhRkkfHqcCxpnVNSrs5kJYZXwa6Ud431VnevzzzK3U"
+
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock1(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	addresses := [][]string{
+		{dbtestdata.Addr1, dbtestdata.Addr2, dbtestdata.Addr6},
+		{dbtestdata.Addr3, dbtestdata.AddrA},
+	}
+	xc := NewXpubCache(len(addresses))
+	for i := range addresses {
+		for j, a := range addresses[i] {
+			addrDesc, err := d.chainParser.GetAddrDescFromAddress(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ab, err := d.GetAddrDescBalance(addrDesc, AddressBalanceDetailNoUTXO)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xc.SetAddress(i, j, addrDesc, ab)
+		}
+	}
+	// the cache computed at other than the best height is not stored
+	if err := d.StoreXpubCache(xpub, xc, 225494); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := d.GetXpubCache(xpub); err != nil || got != nil {
+		t.Fatalf("GetXpubCache() = %+v, %v, want nil", got, err)
+	}
+	if err := d.StoreXpubCache(xpub, xc, 225493); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(name string, valid bool, lastUsed []int, heights [][]uint32) {
+		got, err := d.GetXpubCache(xpub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil {
+			t.Fatalf("%s: GetXpubCache() = nil", name)
+		}
+		if got.Valid != valid || !reflect.DeepEqual(got.LastUsed, lastUsed) {
+			t.Errorf("%s: GetXpubCache() valid %v, lastUsed %v, want %v, %v", name, got.Valid, got.LastUsed, valid, lastUsed)
+		}
+		if len(got.Addresses) != len(heights) {
+			t.Fatalf("%s: GetXpubCache() has %d change indexes, want %d", name, len(got.Addresses), len(heights))
+		}
+		for i := range heights {
+			if len(got.Addresses[i]) != len(heights[i]) {
+				t.Fatalf("%s: GetXpubCache() has %d addresses of change index %d, want %d", name, len(got.Addresses[i]), i, len(heights[i]))
+			}
+			for j, h := range heights[i] {
+				a := &got.Addresses[i][j]
+				if a.BalanceHeight != h || hex.EncodeToString(a.AddrDesc) != dbtestdata.AddressToPubKeyHex(addresses[i][j], d.chainParser) {
+					t.Errorf("%s: address %d/%d = %s %d, want %s %d", name, i, j, hex.EncodeToString(a.AddrDesc), a.BalanceHeight, addresses[i][j], h)
+				}
+			}
+		}
+	}
+	verify("block1", true, []int{1, 0}, [][]uint32{{225493, 225493, 0}, {225493, 0}})
+	// the addresses point to the cached xpub
+	addrDesc, _ := d.chainParser.GetAddrDescFromAddress(dbtestdata.AddrA)
+	refs, err := d.getXpubCacheRefs(addrDesc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []xpubCacheRef{{key: xpubCacheKey(xpub), chain: 1, index: 1}}; !reflect.DeepEqual(refs, want) {
+		t.Errorf("getXpubCacheRefs() = %+v, want %+v", refs, want)
+	}
+
+	// the connected block updates the balance heights and the last used addresses
+	if err := d.ConnectBlock(dbtestdata.GetTestBitcoinTypeBlock2(d.chainParser)); err != nil {
+		t.Fatal(err)
+	}
+	verify("block2", true, []int{2, 1}, [][]uint32{{225493, 225494, 225494}, {225494, 225494}})
+
+	// the disconnected block invalidates the cache, the derived addresses are kept
+	if err := d.DisconnectBlockRangeBitcoinType(225494, 225494); err != nil {
+		t.Fatal(err)
+	}
+	verify("disconnect block2", false, []int{2, 1}, [][]uint32{{225493, 225494, 225494}, {225494, 225494}})
+
+	// the cache is rescanned from the balances and stored valid
+	xc, err = d.GetXpubCache(xpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range xc.Addresses {
+		for j := range xc.Addresses[i] {
+			ab, err := d.GetAddrDescBalance(xc.Addresses[i][j].AddrDesc, AddressBalanceDetailNoUTXO)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xc.SetAddress(i, j, xc.Addresses[i][j].AddrDesc, ab)
+		}
+	}
+	if err := d.StoreXpubCache(xpub, xc, 225493); err != nil {
+		t.Fatal(err)
+	}
+	verify("rescan", true, []int{1, 0}, [][]uint32{{225493, 225493, 0}, {225493, 0}})
+
+	// the least recently accessed xpubs over the maximum count are evicted
+	older := *xc
+	older.Accessed = xc.Accessed - 1
+	if err := d.db.PutCF(d.wo, d.cfh[cfXpubCache], xpubCacheKey("older"+xpub), packXpubCache(&older)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := d.EvictXpubCache(time.Now().Unix()-3600, 1); err != nil || n != 1 {
+		t.Errorf("EvictXpubCache() = %d, %v, want 1", n, err)
+	}
+	if got, err := d.GetXpubCache("older" + xpub); err != nil || got != nil {
+		t.Errorf("GetXpubCache(older) = %+v, %v, want nil", got, err)
+	}
+	verify("count limit", true, []int{1, 0}, [][]uint32{{225493, 225493, 0}, {225493, 0}})
+
+	// the recently accessed xpubs are kept
+	if n, err := d.EvictXpubCache(time.Now().Unix()-3600, 0); err != nil || n != 0 {
+		t.Errorf("EvictXpubCache() = %d, %v, want 0", n, err)
+	}
+	if n, err := d.EvictXpubCache(time.Now().Unix()+1, 0); err != nil || n != 1 {
+		t.Errorf("EvictXpubCache() = %d, %v, want 1", n, err)
+	}
+	if len(columnRows(d, cfXpubCache)) != 0 || len(columnRows(d, cfXpubCacheAddresses)) != 0 {
+		t.Error("xpub cache not evicted")
+	}
+}
+
+func Test_packXpubCache(t *testing.T) {
+	xc := NewXpubCache(2)
+	xc.Accessed = 1600000000
+	xc.SetAddress(0, 0, bchain.AddressDescriptor{0x76, 0xa9, 0x14}, &AddrBalance{Txs: 1, LastSeen: 100})
+	xc.SetAddress(0, 1, bchain.AddressDescriptor{0x00, 0x14}, nil)
+	xc.SetAddress(1, 0, bchain.AddressDescriptor{0x51}, &AddrBalance{Txs: 2})
+	buf := packXpubCache(xc)
+	if got, want := hex.EncodeToString(buf), "0185faf8a0000201020376a91464020014000101015101"; got != want {
+		t.Errorf("packXpubCache() = %v, want %v", got, want)
+	}
+	got, err := unpackXpubCache(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unpacked cache has all addresses indexed
+	got.indexed, got.modified = xc.indexed, xc.modified
+	if !reflect.DeepEqual(got, xc) {
+		t.Errorf("unpackXpubCache() = %+v, want %+v", got, xc)
+	}
+	for l := 0; l < len(buf); l++ {
+		if _, err := unpackXpubCache(buf[:l]); err == nil {
+			t.Errorf("unpackXpubCache() of %d bytes did not fail", l)
+		}
+	}
+}
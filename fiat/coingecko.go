@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/golang/glog"
-	"github.com/linxGnu/grocksdb"
 	"github.com/trezor/blockbook/common"
 	"github.com/trezor/blockbook/db"
 )
@@ -27,7 +26,7 @@ type Coingecko struct {
 	throttlingDelay     time.Duration
 	timeFormat          string
 	httpClient          *http.Client
-	db                  *db.RocksDB
+	db                  db.Store
 	updatingCurrent     bool
 	updatingTokens      bool
 }
@@ -51,7 +50,7 @@ type marketChartPrices struct {
 }
 
 // NewCoinGeckoDownloader creates a coingecko structure that implements the RatesDownloaderInterface
-func NewCoinGeckoDownloader(db *db.RocksDB, url string, coin string, platformIdentifier string, platformVsCurrency string, allowedVsCurrencies string, timeFormat string, throttleDown bool) RatesDownloaderInterface {
+func NewCoinGeckoDownloader(db db.Store, url string, coin string, platformIdentifier string, platformVsCurrency string, allowedVsCurrencies string, timeFormat string, throttleDown bool) RatesDownloaderInterface {
 	var throttlingDelayMs int
 	if throttleDown {
 		throttlingDelayMs = 100
@@ -364,14 +363,11 @@ func (cg *Coingecko) getHistoricalTicker(tickersToUpdate map[uint]*common.Curren
 
 func (cg *Coingecko) storeTickers(tickersToUpdate map[uint]*common.CurrencyRatesTicker) error {
 	if len(tickersToUpdate) > 0 {
-		wb := grocksdb.NewWriteBatch()
-		defer wb.Destroy()
+		tickers := make([]*common.CurrencyRatesTicker, 0, len(tickersToUpdate))
 		for _, v := range tickersToUpdate {
-			if err := cg.db.FiatRatesStoreTicker(wb, v); err != nil {
-				return err
-			}
+			tickers = append(tickers, v)
 		}
-		if err := cg.db.WriteBatch(wb); err != nil {
+		if err := cg.db.FiatRatesStoreTickers(tickers); err != nil {
 			return err
 		}
 	}
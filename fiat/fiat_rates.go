@@ -26,7 +26,7 @@ type RatesDownloaderInterface interface {
 // RatesDownloader stores FiatRates API parameters
 type RatesDownloader struct {
 	periodSeconds       int64
-	db                  *db.RocksDB
+	db                  db.Store
 	timeFormat          string
 	callbackOnNewTicker OnNewFiatRatesTicker
 	downloader          RatesDownloaderInterface
@@ -34,7 +34,7 @@ type RatesDownloader struct {
 }
 
 // NewFiatRatesDownloader initializes the downloader for FiatRates API.
-func NewFiatRatesDownloader(db *db.RocksDB, apiType string, params string, allowedVsCurrencies string, callback OnNewFiatRatesTicker) (*RatesDownloader, error) {
+func NewFiatRatesDownloader(db db.Store, apiType string, params string, allowedVsCurrencies string, callback OnNewFiatRatesTicker) (*RatesDownloader, error) {
 	var rd = &RatesDownloader{}
 	type fiatRatesParams struct {
 		URL                string `json:"url"`
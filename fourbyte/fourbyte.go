@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/golang/glog"
-	"github.com/linxGnu/grocksdb"
 	"github.com/trezor/blockbook/bchain"
 	"github.com/trezor/blockbook/db"
 )
@@ -19,11 +18,11 @@ import (
 type FourByteSignaturesDownloader struct {
 	url                string
 	httpTimeoutSeconds time.Duration
-	db                 *db.RocksDB
+	db                 db.Store
 }
 
 // NewFourByteSignaturesDownloader initializes the downloader for FourByteSignatures API.
-func NewFourByteSignaturesDownloader(db *db.RocksDB, url string) (*FourByteSignaturesDownloader, error) {
+func NewFourByteSignaturesDownloader(db db.Store, url string) (*FourByteSignaturesDownloader, error) {
 	return &FourByteSignaturesDownloader{
 		url:                url,
 		httpTimeoutSeconds: 15 * time.Second,
@@ -173,9 +172,7 @@ func (fd *FourByteSignaturesDownloader) downloadSignatures() {
 	}
 	if len(results) > 0 {
 		glog.Infof("FourByteSignaturesDownloader storing %d new signatures", len(results))
-		wb := grocksdb.NewWriteBatch()
-		defer wb.Destroy()
-
+		records := make([]db.FourByteSignatureRecord, 0, len(results))
 		for i := range results {
 			r := &results[i]
 			fourBytes, err := strconv.ParseUint(r.HexSignature, 0, 0)
@@ -185,13 +182,13 @@ func (fd *FourByteSignaturesDownloader) downloadSignatures() {
 			}
 			fbs := parseSignatureFromText(r.TextSignature)
 			if fbs != nil {
-				fd.db.StoreFourByteSignature(wb, uint32(fourBytes), uint32(r.Id), fbs)
+				records = append(records, db.FourByteSignatureRecord{FourBytes: uint32(fourBytes), ID: uint32(r.Id), Signature: fbs})
 			} else {
 				glog.Errorf("FourByteSignaturesDownloader invalid signature %s", r.TextSignature)
 			}
 		}
 
-		if err := fd.db.WriteBatch(wb); err != nil {
+		if err := fd.db.StoreFourByteSignatures(records); err != nil {
 			glog.Errorf("FourByteSignaturesDownloader failed to store signatures, %v", err)
 		}
 
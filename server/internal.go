@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -18,7 +20,7 @@ import (
 type InternalServer struct {
 	https       *http.Server
 	certFiles   string
-	db          *db.RocksDB
+	db          db.Store
 	txCache     *db.TxCache
 	chain       bchain.BlockChain
 	chainParser bchain.BlockChainParser
@@ -28,7 +30,7 @@ type InternalServer struct {
 }
 
 // NewInternalServer creates new internal http interface to blockbook and returns its handle
-func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*InternalServer, error) {
+func NewInternalServer(binding, certFiles string, db db.Store, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*InternalServer, error) {
 	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return nil, err
@@ -55,6 +57,9 @@ func NewInternalServer(binding, certFiles string, db *db.RocksDB, chain bchain.B
 	serveMux.Handle(path+"favicon.ico", http.FileServer(http.Dir("./static/")))
 	serveMux.Handle(path+"robots.txt", http.FileServer(http.Dir("./static/")))
 	serveMux.HandleFunc(path+"metrics", promhttp.Handler().ServeHTTP)
+	serveMux.HandleFunc(path+"snapshot", s.snapshot)
+	serveMux.HandleFunc(path+"compaction", s.compaction)
+	serveMux.HandleFunc(path+"accounts", s.accounts)
 	serveMux.HandleFunc(path, s.index)
 
 	return s, nil
@@ -98,3 +103,135 @@ func (s *InternalServer) index(w http.ResponseWriter, r *http.Request) {
 
 	w.Write(buf)
 }
+
+// snapshotCreator is implemented by the stores which can create a snapshot of the index
+type snapshotCreator interface {
+	CreateSnapshot(dir string) (*db.SnapshotInfo, error)
+}
+
+// snapshot creates a snapshot of the index in the directory specified by the dir parameter, the sync is not stopped
+func (s *InternalServer) snapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sc, ok := s.db.(snapshotCreator)
+	if !ok {
+		http.Error(w, "Snapshot not supported", http.StatusNotImplemented)
+		return
+	}
+	dir := r.URL.Query().Get("dir")
+	if dir == "" {
+		http.Error(w, "Missing parameter dir", http.StatusBadRequest)
+		return
+	}
+	si, err := sc.CreateSnapshot(dir)
+	if err != nil {
+		glog.Error("snapshot: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buf, err := json.MarshalIndent(si, "", "    ")
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(buf)
+}
+
+// columnCompactor is implemented by the stores which can compact their columns in the background
+type columnCompactor interface {
+	ScheduleCompaction(columns []string) error
+	GetCompactionStatus() db.CompactionStatus
+}
+
+// compaction returns the status of the compaction of the db columns
+// POST schedules the compaction of the comma separated list of columns in the columns parameter
+func (s *InternalServer) compaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cc, ok := s.db.(columnCompactor)
+	if !ok {
+		http.Error(w, "Compaction not supported", http.StatusNotImplemented)
+		return
+	}
+	if r.Method == http.MethodPost {
+		columns := r.URL.Query().Get("columns")
+		if columns == "" {
+			http.Error(w, "Missing parameter columns", http.StatusBadRequest)
+			return
+		}
+		if err := cc.ScheduleCompaction(strings.Split(columns, ",")); err != nil {
+			glog.Error("compaction: ", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	buf, err := json.MarshalIndent(cc.GetCompactionStatus(), "", "    ")
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(buf)
+}
+
+// accounts returns the registered watch-only accounts
+// POST registers the xpub or output descriptor in the descriptor parameter with the optional gap parameter,
+// DELETE unregisters the account of the descriptor parameter
+func (s *InternalServer) accounts(w http.ResponseWriter, r *http.Request) {
+	var (
+		rv  interface{}
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		rv, err = s.api.GetAccounts()
+	case http.MethodPost, http.MethodDelete:
+		descriptor := r.FormValue("descriptor")
+		if descriptor == "" {
+			http.Error(w, "Missing parameter descriptor", http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost {
+			var gap int
+			if g := r.FormValue("gap"); g != "" {
+				if gap, err = strconv.Atoi(g); err != nil {
+					http.Error(w, "Invalid parameter gap", http.StatusBadRequest)
+					return
+				}
+			}
+			rv, err = s.api.RegisterAccount(descriptor, gap)
+		} else {
+			err = s.api.UnregisterAccount(descriptor)
+			rv = struct {
+				Unregistered string `json:"unregistered"`
+			}{descriptor}
+		}
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost+", "+http.MethodDelete)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		glog.Error("accounts: ", err)
+		status := http.StatusInternalServerError
+		if apiErr, ok := err.(*api.APIError); ok && apiErr.Public || err == api.ErrUnsupportedXpub {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	buf, err := json.MarshalIndent(rv, "", "    ")
+	if err != nil {
+		glog.Error(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(buf)
+}
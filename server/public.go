@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -30,7 +31,9 @@ import (
 const txsOnPage = 25
 const blocksOnPage = 50
 const mempoolTxsOnPage = 50
+const richListAddressesOnPage = 50
 const txsInAPI = 1000
+const richListAddressesInAPI = 1000
 
 const secondaryCoinCookieName = "secondary_coin"
 
@@ -47,7 +50,7 @@ type PublicServer struct {
 	socketio         *SocketIoServer
 	websocket        *WebsocketServer
 	https            *http.Server
-	db               *db.RocksDB
+	db               db.Store
 	txCache          *db.TxCache
 	chain            bchain.BlockChain
 	chainParser      bchain.BlockChainParser
@@ -65,7 +68,7 @@ var hostURL string = ""
 
 // NewPublicServer creates new public server http interface to blockbook and returns its handle
 // only basic functionality is mapped, to map all functions, call
-func NewPublicServer(binding string, certFiles string, db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, explorerURL string, metrics *common.Metrics, is *common.InternalState, debugMode bool) (*PublicServer, error) {
+func NewPublicServer(binding string, certFiles string, db db.Store, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, explorerURL string, metrics *common.Metrics, is *common.InternalState, debugMode bool) (*PublicServer, error) {
 
 	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
@@ -149,6 +152,7 @@ func (s *PublicServer) ConnectFullPublicInterface() {
 		serveMux.HandleFunc(path+"spending/", s.htmlTemplateHandler(s.explorerSpendingTx))
 		serveMux.HandleFunc(path+"sendtx", s.htmlTemplateHandler(s.explorerSendTx))
 		serveMux.HandleFunc(path+"mempool", s.htmlTemplateHandler(s.explorerMempool))
+		serveMux.HandleFunc(path+"richlist", s.htmlTemplateHandler(s.explorerRichList))
 		if s.chainParser.GetChainType() == bchain.ChainEthereumType {
 			serveMux.HandleFunc(path+"nft/", s.htmlTemplateHandler(s.explorerNftDetail))
 		}
@@ -193,7 +197,7 @@ func (s *PublicServer) ConnectFullPublicInterface() {
 	serveMux.HandleFunc(path+"api/v2/tx-specific/", s.jsonHandler(s.apiTxSpecific, apiV2))
 	serveMux.HandleFunc(path+"api/v2/tx/", s.jsonHandler(s.apiTx, apiV2))
 	serveMux.HandleFunc(path+"api/v2/address/", s.jsonHandler(s.apiAddress, apiV2))
-	serveMux.HandleFunc(path+"api/v2/xpub/", s.jsonHandler(s.apiXpub, apiV2))
+	serveMux.HandleFunc(path+"api/v2/xpub/", s.xpubExportHandler(s.jsonHandler(s.apiXpub, apiV2)))
 	serveMux.HandleFunc(path+"api/v2/utxo/", s.jsonHandler(s.apiUtxo, apiV2))
 	serveMux.HandleFunc(path+"api/v2/block/", s.jsonHandler(s.apiBlock, apiV2))
 	serveMux.HandleFunc(path+"api/v2/rawblock/", s.jsonHandler(s.apiBlockRaw, apiDefault))
@@ -201,6 +205,11 @@ func (s *PublicServer) ConnectFullPublicInterface() {
 	serveMux.HandleFunc(path+"api/v2/estimatefee/", s.jsonHandler(s.apiEstimateFee, apiV2))
 	serveMux.HandleFunc(path+"api/v2/feestats/", s.jsonHandler(s.apiFeeStats, apiV2))
 	serveMux.HandleFunc(path+"api/v2/balancehistory/", s.jsonHandler(s.apiBalanceHistory, apiDefault))
+	serveMux.HandleFunc(path+"api/v2/staking/", s.jsonHandler(s.apiStaking, apiV2))
+	serveMux.HandleFunc(path+"api/v2/richlist", s.jsonHandler(s.apiRichList, apiV2))
+	serveMux.HandleFunc(path+"api/v2/chainstats", s.jsonHandler(s.apiChainStats, apiV2))
+	serveMux.HandleFunc(path+"api/v2/silentpayments/tweaks/", s.jsonHandler(s.apiSilentPaymentTweaks, apiV2))
+	serveMux.HandleFunc(path+"api/v2/orphans", s.jsonHandler(s.apiOrphans, apiV2))
 	serveMux.HandleFunc(path+"api/v2/tickers/", s.jsonHandler(s.apiTickers, apiV2))
 	serveMux.HandleFunc(path+"api/v2/multi-tickers/", s.jsonHandler(s.apiMultiTickers, apiV2))
 	serveMux.HandleFunc(path+"api/v2/tickers-list/", s.jsonHandler(s.apiAvailableVsCurrencies, apiV2))
@@ -228,6 +237,11 @@ func (s *PublicServer) OnNewBlock(hash string, height uint32) {
 	s.websocket.OnNewBlock(hash, height)
 }
 
+// OnReorg notifies users subscribed to notification about chain reorganizations
+func (s *PublicServer) OnReorg(reorg *db.Reorg) {
+	s.websocket.OnReorg(reorg)
+}
+
 // OnNewFiatRatesTicker notifies users subscribed to bitcoind/fiatrates about new ticker
 func (s *PublicServer) OnNewFiatRatesTicker(ticker *common.CurrencyRatesTicker) {
 	s.websocket.OnNewFiatRatesTicker(ticker)
@@ -243,6 +257,11 @@ func (s *PublicServer) OnNewTx(tx *bchain.MempoolTx) {
 	s.websocket.OnNewTx(tx)
 }
 
+// OnMempoolSync notifies users subscribed to accounts about balances changed by the new mempool txs
+func (s *PublicServer) OnMempoolSync() {
+	s.websocket.OnMempoolSync()
+}
+
 func (s *PublicServer) txRedirect(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, joinURL(s.explorerURL, r.URL.Path), http.StatusFound)
 	s.metrics.ExplorerViews.With(common.Labels{"action": "tx-redirect"}).Inc()
@@ -350,6 +369,7 @@ func (s *PublicServer) newTemplateData(r *http.Request) *TemplateData {
 		ChainType:        s.chainParser.GetChainType(),
 		InternalExplorer: s.internalExplorer && !s.is.InitialSync,
 		TOSLink:          api.Text.TOSLink,
+		HasRichList:      s.db.HasRichList(),
 	}
 	if t.ChainType == bchain.ChainEthereumType {
 		t.FungibleTokenName = bchain.EthereumTokenTypeMap[bchain.FungibleToken]
@@ -489,6 +509,7 @@ const (
 	sendTransactionTpl
 	mempoolTpl
 	nftDetailTpl
+	richListTpl
 
 	tplCount
 )
@@ -499,6 +520,7 @@ type TemplateData struct {
 	CoinShortcut             string
 	CoinLabel                string
 	InternalExplorer         bool
+	HasRichList              bool
 	ChainType                bchain.ChainType
 	FungibleTokenName        bchain.TokenTypeName
 	NonFungibleTokenName     bchain.TokenTypeName
@@ -508,6 +530,7 @@ type TemplateData struct {
 	Tx                       *api.Tx
 	Error                    *api.APIError
 	Blocks                   *api.Blocks
+	RichList                 *api.RichList
 	Block                    *api.Block
 	Info                     *api.SystemInfo
 	MempoolTxids             *api.MempoolTxids
@@ -622,6 +645,7 @@ func (s *PublicServer) parseTemplates() []*template.Template {
 	}
 	t[xpubTpl] = createTemplate("./static/templates/xpub.html", "./static/templates/txdetail.html", "./static/templates/paging.html", "./static/templates/base.html")
 	t[mempoolTpl] = createTemplate("./static/templates/mempool.html", "./static/templates/paging.html", "./static/templates/base.html")
+	t[richListTpl] = createTemplate("./static/templates/richlist.html", "./static/templates/paging.html", "./static/templates/base.html")
 	return t
 }
 
@@ -1079,6 +1103,7 @@ func tokenCount(tokens []api.Token, t bchain.TokenTypeName) int {
 
 func jsStr(s string) template.JSStr {
 	return template.JSStr(s)
+}
 
 func normalizeName(s string) string {
 	s = strings.ToLower(s)
@@ -1295,6 +1320,23 @@ func (s *PublicServer) explorerBlocks(w http.ResponseWriter, r *http.Request) (t
 	return blocksTpl, data, nil
 }
 
+func (s *PublicServer) explorerRichList(w http.ResponseWriter, r *http.Request) (tpl, *TemplateData, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "richlist"}).Inc()
+	page, ec := strconv.Atoi(r.URL.Query().Get("page"))
+	if ec != nil {
+		page = 0
+	}
+	richList, err := s.api.GetRichList(page, richListAddressesOnPage)
+	if err != nil {
+		return errorTpl, nil, err
+	}
+	data := s.newTemplateData(r)
+	data.RichList = richList
+	data.Page = richList.Page
+	data.PagingRange, data.PrevPage, data.NextPage = getPagingRange(richList.Page, richList.TotalPages)
+	return richListTpl, data, nil
+}
+
 func (s *PublicServer) explorerBlock(w http.ResponseWriter, r *http.Request) (tpl, *TemplateData, error) {
 	var block *api.Block
 	var err error
@@ -1582,6 +1624,176 @@ func (s *PublicServer) apiXpub(r *http.Request, apiVersion int) (interface{}, er
 	return address, err
 }
 
+// xpubExportHandler streams the export of the xpub transactions requested by the path xpub/<xpub>/export,
+// other xpub requests are passed to the handler next
+// The export is not buffered, an error after the start of the output only terminates it.
+func (s *PublicServer) xpubExportHandler(next func(w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	const exportSuffix = "/export"
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, exportSuffix) {
+			next(w, r)
+			return
+		}
+		var xpub string
+		path := strings.TrimSuffix(r.URL.Path, exportSuffix)
+		if i := strings.LastIndex(path, "xpub/"); i > 0 {
+			xpub = path[i+5:]
+		}
+		s.metrics.ExplorerPendingRequests.With((common.Labels{"method": "apiXpubExport"})).Inc()
+		defer s.metrics.ExplorerPendingRequests.With((common.Labels{"method": "apiXpubExport"})).Dec()
+		s.metrics.ExplorerViews.With(common.Labels{"action": "api-xpub-export"}).Inc()
+		writeError := func(err error) {
+			text, status := "Internal server error", http.StatusInternalServerError
+			if apiErr, ok := err.(*api.APIError); ok {
+				text = apiErr.Error()
+				if apiErr.Public {
+					status = http.StatusBadRequest
+				}
+			} else {
+				glog.Error("apiXpubExport error: ", err)
+				if s.debug {
+					text = fmt.Sprintf("Internal server error: %v", err)
+				}
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(status)
+			if err := json.NewEncoder(w).Encode(struct {
+				Text string `json:"error"`
+			}{text}); err != nil {
+				glog.Warning("json encode ", err)
+			}
+		}
+		if len(xpub) == 0 {
+			writeError(api.NewAPIError("Missing xpub", true))
+			return
+		}
+		q := r.URL.Query()
+		format := q.Get("format")
+		if format == "" {
+			format = "csv"
+		} else if format != "csv" && format != "json" {
+			writeError(api.NewAPIError("Unsupported format "+format, true))
+			return
+		}
+		from, ec := strconv.Atoi(q.Get("from"))
+		if ec != nil || from < 0 {
+			from = 0
+		}
+		to, ec := strconv.Atoi(q.Get("to"))
+		if ec != nil || to < 0 {
+			to = 0
+		}
+		gap, ec := strconv.Atoi(q.Get("gap"))
+		if ec != nil {
+			gap = 0
+		}
+		var cw *csv.Writer
+		decimals := s.chainParser.AmountDecimals()
+		rows := 0
+		started := false
+		// the headers are written with the first row so that the errors found before can be still returned as json
+		begin := func() error {
+			started = true
+			if format == "csv" {
+				w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+				w.Header().Set("Content-Disposition", `attachment; filename="xpub-export.csv"`)
+				cw = csv.NewWriter(w)
+				return cw.Write(xpubExportCsvHeader)
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			_, err := io.WriteString(w, "[")
+			return err
+		}
+		err := s.api.ExportXpubTransactions(xpub, uint32(from), uint32(to), q.Get("currency"), gap, func(tx *api.XpubExportTx) error {
+			if !started {
+				if err := begin(); err != nil {
+					return err
+				}
+			}
+			rows++
+			if format == "csv" {
+				if err := cw.Write(xpubExportCsvRecord(tx, decimals)); err != nil {
+					return err
+				}
+				if rows%xpubExportFlushRows == 0 {
+					cw.Flush()
+					return cw.Error()
+				}
+				return nil
+			}
+			b, err := json.Marshal(tx)
+			if err != nil {
+				return err
+			}
+			if rows > 1 {
+				b = append([]byte{','}, b...)
+			}
+			_, err = w.Write(b)
+			return err
+		})
+		if err == api.ErrUnsupportedXpub {
+			err = api.NewAPIError("XPUB functionality is not supported", true)
+		}
+		if err != nil {
+			if !started {
+				writeError(err)
+			} else {
+				glog.Error("apiXpubExport ", rows, " rows written, error: ", err)
+			}
+			return
+		}
+		if !started {
+			err = begin()
+		}
+		if err == nil {
+			if format == "csv" {
+				cw.Flush()
+				err = cw.Error()
+			} else {
+				_, err = io.WriteString(w, "]\n")
+			}
+		}
+		if err != nil {
+			glog.Warning("apiXpubExport write ", err)
+		}
+	}
+}
+
+// flush the csv export to the client after every xpubExportFlushRows rows
+const xpubExportFlushRows = 100
+
+var xpubExportCsvHeader = []string{"txid", "blockHeight", "blockTime", "type", "received", "change", "sent", "fee", "net", "currency", "fiatRate", "fiatNet", "fiatFee"}
+
+// xpubExportCsvRecord formats the exported transaction as the csv record, the amounts are in the coin units and the time in RFC3339
+func xpubExportCsvRecord(tx *api.XpubExportTx, decimals int) []string {
+	var fee, fiatRate, fiatNet, fiatFee string
+	if tx.FeeSat != nil {
+		fee = tx.FeeSat.DecimalString(decimals)
+	}
+	if tx.FiatRate != 0 {
+		fiatRate = strconv.FormatFloat(float64(tx.FiatRate), 'f', -1, 32)
+		fiatNet = strconv.FormatFloat(tx.FiatNet, 'f', 2, 64)
+		if tx.FeeSat != nil {
+			fiatFee = strconv.FormatFloat(tx.FiatFee, 'f', 2, 64)
+		}
+	}
+	return []string{
+		tx.Txid,
+		strconv.FormatUint(uint64(tx.BlockHeight), 10),
+		time.Unix(tx.BlockTime, 0).UTC().Format(time.RFC3339),
+		tx.Type,
+		tx.ReceivedSat.DecimalString(decimals),
+		tx.ChangeSat.DecimalString(decimals),
+		tx.SentSat.DecimalString(decimals),
+		fee,
+		tx.NetSat.DecimalString(decimals),
+		tx.Currency,
+		fiatRate,
+		fiatNet,
+		fiatFee,
+	}
+}
+
 func (s *PublicServer) apiUtxo(r *http.Request, apiVersion int) (interface{}, error) {
 	var utxo []api.Utxo
 	var err error
@@ -1657,6 +1869,78 @@ func (s *PublicServer) apiBalanceHistory(r *http.Request, apiVersion int) (inter
 	return history, err
 }
 
+func (s *PublicServer) apiStaking(r *http.Request, apiVersion int) (interface{}, error) {
+	var stakingInfo *api.StakingInfo
+	var err error
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		gap, ec := strconv.Atoi(r.URL.Query().Get("gap"))
+		if ec != nil {
+			gap = 0
+		}
+		var xpub bool
+		stakingInfo, xpub, err = s.api.GetDescriptorStakingInfo(r.URL.Path[i+1:], gap)
+		if xpub {
+			s.metrics.ExplorerViews.With(common.Labels{"action": "api-xpub-staking"}).Inc()
+		} else {
+			s.metrics.ExplorerViews.With(common.Labels{"action": "api-address-staking"}).Inc()
+		}
+	}
+	return stakingInfo, err
+}
+
+func (s *PublicServer) apiRichList(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-richlist"}).Inc()
+	page, ec := strconv.Atoi(r.URL.Query().Get("page"))
+	if ec != nil {
+		page = 0
+	}
+	pageSize, ec := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if ec != nil || pageSize <= 0 || pageSize > richListAddressesInAPI {
+		pageSize = richListAddressesInAPI
+	}
+	return s.api.GetRichList(page, pageSize)
+}
+
+func (s *PublicServer) apiSilentPaymentTweaks(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-silentpayments-tweaks"}).Inc()
+	height := -1
+	if i := strings.LastIndexByte(r.URL.Path, '/'); i > 0 {
+		if h, err := strconv.Atoi(r.URL.Path[i+1:]); err == nil {
+			height = h
+		}
+	}
+	if height < 0 {
+		return nil, api.NewAPIError("Missing or invalid block height", true)
+	}
+	return s.api.GetSilentPaymentTweaks(uint32(height))
+}
+
+func (s *PublicServer) apiChainStats(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-chainstats"}).Inc()
+	from, ec := strconv.Atoi(r.URL.Query().Get("from"))
+	if ec != nil {
+		from = -1
+	}
+	to, ec := strconv.Atoi(r.URL.Query().Get("to"))
+	if ec != nil {
+		to = -1
+	}
+	return s.api.GetChainStats(from, to)
+}
+
+func (s *PublicServer) apiOrphans(r *http.Request, apiVersion int) (interface{}, error) {
+	s.metrics.ExplorerViews.With(common.Labels{"action": "api-orphans"}).Inc()
+	from, ec := strconv.Atoi(r.URL.Query().Get("from"))
+	if ec != nil {
+		from = -1
+	}
+	to, ec := strconv.Atoi(r.URL.Query().Get("to"))
+	if ec != nil {
+		to = -1
+	}
+	return s.api.GetOrphanedBlocks(from, to)
+}
+
 func (s *PublicServer) apiBlock(r *http.Request, apiVersion int) (interface{}, error) {
 	var block *api.Block
 	var err error
@@ -89,6 +89,9 @@ func setupRocksDB(parser bchain.BlockChainParser, chain bchain.BlockChain, t *te
 		if err := initTestFiatRates(d); err != nil {
 			t.Fatal(err)
 		}
+		if err := initTestOrphanedBlocks(d, block2); err != nil {
+			t.Fatal(err)
+		}
 	}
 	return d, is, tmp
 }
@@ -98,7 +101,10 @@ var metrics *common.Metrics
 
 func setupPublicHTTPServer(parser bchain.BlockChainParser, chain bchain.BlockChain, t *testing.T, extendedIndex bool) (*PublicServer, string) {
 	d, is, path := setupRocksDB(parser, chain, t, extendedIndex)
+	return newTestPublicServer(d, is, chain, t, extendedIndex), path
+}
 
+func newTestPublicServer(d db.Store, is *common.InternalState, chain bchain.BlockChain, t *testing.T, extendedIndex bool) *PublicServer {
 	// setup internal state and match BestHeight to test data
 	is.Coin = "Fakecoin"
 	is.CoinLabel = "Fake Coin"
@@ -129,7 +135,7 @@ func setupPublicHTTPServer(parser bchain.BlockChainParser, chain bchain.BlockCha
 	if err != nil {
 		t.Fatal(err)
 	}
-	return s, path
+	return s
 }
 
 func closeAndDestroyPublicServer(t *testing.T, s *PublicServer, dbpath string) {
@@ -188,6 +194,24 @@ func insertFiatRate(date string, rates map[string]float32, tokenRates map[string
 	return d.WriteBatch(wb)
 }
 
+// initTestOrphanedBlocks initializes test data for /api/v2/orphans endpoint,
+// it simulates a reorganization which replaced an orphaned block by the block2
+func initTestOrphanedBlocks(d *db.RocksDB, block2 *bchain.Block) error {
+	if err := d.DisconnectDeepBlockRange(block2.Height, block2.Height, nil, []db.OrphanedBlock{
+		{
+			Height:       225494,
+			Hash:         "0000000000000000000a2a8f2dd3c6b5c5ea42b2b0c7bc26a7d7e3c4e37bb1fe",
+			Time:         1521595600,
+			Txs:          2,
+			Size:         1234,
+			OrphanedTime: 1521595700,
+		},
+	}); err != nil {
+		return err
+	}
+	return d.ConnectBlock(block2)
+}
+
 // initTestFiatRates initializes test data for /api/v2/tickers endpoint
 func initTestFiatRates(d *db.RocksDB) error {
 	if err := insertFiatRate("20180320020000", map[string]float32{
@@ -487,6 +511,33 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"txCount":3,"totalFeesSat":"1284","averageFeePerKb":1398,"decilesFeePerKb":[155,155,155,155,1679,1679,1679,2361,2361,2361,2361]}`,
 			},
 		},
+		{
+			name:        "apiChainStats",
+			r:           newGetRequest(ts.URL + "/api/v2/chainstats?from=225494"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"from":225494,"to":225494,"blocks":[{"height":225494,"time":1521595678,"txs":4,"activeAddresses":9,"newAddresses":5,"coinsCreated":"1360029047","fees":"1284"}]}`,
+			},
+		},
+		{
+			name:        "apiOrphans",
+			r:           newGetRequest(ts.URL + "/api/v2/orphans"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"from":215495,"to":225494,"blocks":[{"height":225494,"hash":"0000000000000000000a2a8f2dd3c6b5c5ea42b2b0c7bc26a7d7e3c4e37bb1fe","time":1521595600,"txs":2,"size":1234,"orphanedTime":1521595700}]}`,
+			},
+		},
+		{
+			name:        "apiOrphans empty range",
+			r:           newGetRequest(ts.URL + "/api/v2/orphans?from=225000&to=225493"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"from":225000,"to":225493,"blocks":[]}`,
+			},
+		},
 		{
 			name:        "apiFiatRates missing currency",
 			r:           newGetRequest(ts.URL + "/api/v2/tickers"),
@@ -628,7 +679,7 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 			status:      http.StatusOK,
 			contentType: "application/json; charset=utf-8",
 			body: []string{
-				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"txids":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}`,
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"firstSeen":225493,"lastSeen":225494,"txids":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}`,
 			},
 		},
 		{
@@ -637,7 +688,7 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 			status:      http.StatusOK,
 			contentType: "application/json; charset=utf-8",
 			body: []string{
-				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2}`,
+				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"firstSeen":225493,"lastSeen":225494}`,
 			},
 		},
 		{
@@ -646,7 +697,7 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 			status:      http.StatusOK,
 			contentType: "application/json; charset=utf-8",
 			body: []string{
-				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"transactions":[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vin":[{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","n":0,"addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"isOwn":true,"value":"1234567890123"},{"txid":"00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840","vout":1,"n":1,"addresses":["mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz"],"isAddress":true,"value":"12345"}],"vout":[{"value":"317283951061","n":0,"spent":true,"hex":"76a914ccaaaf374e1b06cb83118453d102587b4273d09588ac","addresses":["mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX"],"isAddress":true},{"value":"917283951061","n":1,"hex":"76a9148d802c045445df49613f6a70ddd2e48526f3701f88ac","addresses":["mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"],"isAddress":true},{"value":"0","n":2,"hex":"6a072020f1686f6a20","addresses":["OP_RETURN 2020f1686f6a20"],"isAddress":false}],"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","blockHeight":225494,"confirmations":1,"blockTime":1521595678,"value":"1234567902122","valueIn":"1234567902468","fees":"346"},{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vin":[],"vout":[{"value":"1234567890123","n":0,"spent":true,"hex":"76a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac","addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"isOwn":true},{"value":"1","n":1,"spent":true,"hex":"a91452724c5178682f70e0ba31c6ec0633755a3b41d987","addresses":["2MzmAKayJmja784jyHvRUW1bXPget1csRRG"],"isAddress":true},{"value":"9876","n":2,"spent":true,"hex":"a914e921fc4912a315078f370d959f2c4f7b6d2a683c87","addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true}],"blockHash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","blockHeight":225493,"confirmations":2,"blockTime":1521515026,"value":"1234567900000","valueIn":"0","fees":"0"}]}`,
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"firstSeen":225493,"lastSeen":225494,"transactions":[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vin":[{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","n":0,"addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"isOwn":true,"value":"1234567890123"},{"txid":"00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840","vout":1,"n":1,"addresses":["mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz"],"isAddress":true,"value":"12345"}],"vout":[{"value":"317283951061","n":0,"spent":true,"hex":"76a914ccaaaf374e1b06cb83118453d102587b4273d09588ac","addresses":["mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX"],"isAddress":true},{"value":"917283951061","n":1,"hex":"76a9148d802c045445df49613f6a70ddd2e48526f3701f88ac","addresses":["mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"],"isAddress":true},{"value":"0","n":2,"hex":"6a072020f1686f6a20","addresses":["OP_RETURN 2020f1686f6a20"],"isAddress":false}],"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","blockHeight":225494,"confirmations":1,"blockTime":1521595678,"value":"1234567902122","valueIn":"1234567902468","fees":"346"},{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vin":[],"vout":[{"value":"1234567890123","n":0,"spent":true,"hex":"76a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac","addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"isOwn":true},{"value":"1","n":1,"spent":true,"hex":"a91452724c5178682f70e0ba31c6ec0633755a3b41d987","addresses":["2MzmAKayJmja784jyHvRUW1bXPget1csRRG"],"isAddress":true},{"value":"9876","n":2,"spent":true,"hex":"a914e921fc4912a315078f370d959f2c4f7b6d2a683c87","addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true}],"blockHash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","blockHeight":225493,"confirmations":2,"blockTime":1521515026,"value":"1234567900000","valueIn":"0","fees":"0"}]}`,
 			},
 		},
 		{
@@ -739,6 +790,35 @@ func httpTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 				`{"error":"Missing xpub"}`,
 			},
 		},
+		{
+			name:        "apiXpubExport csv currency=usd",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "/export?currency=usd"),
+			status:      http.StatusOK,
+			contentType: "text/csv; charset=utf-8",
+			body: []string{
+				"txid,blockHeight,blockTime,type,received,change,sent,fee,net,currency,fiatRate,fiatNet,fiatFee\n" +
+					"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75,225493,2018-03-20T03:03:46Z,received,0.00000001,0,0,,0.00000001,usd,2002,0.00,\n" +
+					"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71,225494,2018-03-21T01:27:58Z,sent,1186.41975499,0.00000001,0.00000001,,1186.41975499,usd,2003,2376398.77,\n",
+			},
+		},
+		{
+			name:        "apiXpubExport json from=225494",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "/export?format=json&from=225494"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"txid":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","blockHeight":225494,"blockTime":1521595678,"type":"sent","received":"118641975499","change":"1","sent":"1","net":"118641975499"}]`,
+			},
+		},
+		{
+			name:        "apiXpubExport unsupported format",
+			r:           newGetRequest(ts.URL + "/api/v2/xpub/" + dbtestdata.Xpub + "/export?format=xml"),
+			status:      http.StatusBadRequest,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"error":"Unsupported format xml"}`,
+			},
+		},
 		{
 			name:        "apiUtxo v1",
 			r:           newGetRequest(ts.URL + "/api/v1/utxo/mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"),
@@ -1064,7 +1144,7 @@ func websocketTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 					"details":    "txids",
 				},
 			},
-			want: `{"id":"3","data":{"page":1,"totalPages":1,"itemsOnPage":25,"address":"2MzmAKayJmja784jyHvRUW1bXPget1csRRG","balance":"0","totalReceived":"1","totalSent":"1","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"txids":["3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}}`,
+			want: `{"id":"3","data":{"page":1,"totalPages":1,"itemsOnPage":25,"address":"2MzmAKayJmja784jyHvRUW1bXPget1csRRG","balance":"0","totalReceived":"1","totalSent":"1","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"firstSeen":225493,"lastSeen":225494,"txids":["3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]}}`,
 		},
 		{
 			name: "websocket getAccountInfo xpub gap",
@@ -1447,6 +1527,47 @@ func websocketTestsBitcoinType(t *testing.T, ts *httptest.Server) {
 			},
 			want: `{"id":"40","data":{"error":{"message":"Not supported"}}}`,
 		},
+		{
+			name: "websocket subscribeReorg",
+			req: websocketReq{
+				Method: "subscribeReorg",
+			},
+			want: `{"id":"41","data":{"subscribed":true}}`,
+		},
+		{
+			name: "websocket unsubscribeReorg",
+			req: websocketReq{
+				Method: "unsubscribeReorg",
+			},
+			want: `{"id":"42","data":{"subscribed":false}}`,
+		},
+		{
+			name: "websocket subscribeAccounts",
+			req: websocketReq{
+				Method: "subscribeAccounts",
+				Params: map[string]interface{}{
+					"descriptors": []string{dbtestdata.Xpub},
+				},
+			},
+			want: `{"id":"43","data":{"subscribed":true}}`,
+		},
+		{
+			name: "websocket subscribeAccounts not registered",
+			req: websocketReq{
+				Method: "subscribeAccounts",
+				Params: map[string]interface{}{
+					"descriptors": []string{dbtestdata.Xpub, dbtestdata.TaprootDescriptor},
+				},
+			},
+			want: `{"id":"44","data":{"error":{"message":"Account not registered: ` + dbtestdata.TaprootDescriptor + `"}}}`,
+		},
+		{
+			name: "websocket unsubscribeAccounts",
+			req: websocketReq{
+				Method: "unsubscribeAccounts",
+			},
+			want: `{"id":"45","data":{"subscribed":false}}`,
+		},
 	}
 
 	// send all requests at once
@@ -1532,6 +1653,9 @@ func Test_PublicServer_BitcoinType(t *testing.T) {
 
 	httpTestsBitcoinType(t, ts)
 	socketioTestsBitcoinType(t, ts)
+	if _, err := s.api.RegisterAccount(dbtestdata.Xpub, 0); err != nil {
+		t.Fatal(err)
+	}
 	websocketTestsBitcoinType(t, ts)
 }
 
@@ -1558,7 +1682,7 @@ func httpTestsExtendedIndex(t *testing.T, ts *httptest.Server) {
 			status:      http.StatusOK,
 			contentType: "application/json; charset=utf-8",
 			body: []string{
-				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"transactions":[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vin":[{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","n":0,"addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"isOwn":true,"value":"1234567890123"},{"txid":"00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840","vout":1,"n":1,"addresses":["mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz"],"isAddress":true,"value":"12345"}],"vout":[{"value":"317283951061","n":0,"spent":true,"spentTxId":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","spentHeight":225494,"hex":"76a914ccaaaf374e1b06cb83118453d102587b4273d09588ac","addresses":["mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX"],"isAddress":true},{"value":"917283951061","n":1,"hex":"76a9148d802c045445df49613f6a70ddd2e48526f3701f88ac","addresses":["mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"],"isAddress":true},{"value":"0","n":2,"hex":"6a072020f1686f6a20","addresses":["OP_RETURN 2020f1686f6a20"],"isAddress":false}],"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","blockHeight":225494,"confirmations":1,"blockTime":1521595678,"value":"1234567902122","valueIn":"1234567902468","fees":"346"},{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vin":[],"vout":[{"value":"1234567890123","n":0,"spent":true,"spentTxId":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","spentHeight":225494,"hex":"76a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac","addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"isOwn":true},{"value":"1","n":1,"spent":true,"spentTxId":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","spentIndex":1,"spentHeight":225494,"hex":"a91452724c5178682f70e0ba31c6ec0633755a3b41d987","addresses":["2MzmAKayJmja784jyHvRUW1bXPget1csRRG"],"isAddress":true},{"value":"9876","n":2,"spent":true,"spentTxId":"05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07","spentHeight":225494,"hex":"a914e921fc4912a315078f370d959f2c4f7b6d2a683c87","addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true}],"blockHash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","blockHeight":225493,"confirmations":2,"blockTime":1521515026,"value":"1234567900000","valueIn":"0","fees":"0"}]}`,
+				`{"page":1,"totalPages":1,"itemsOnPage":1000,"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"firstSeen":225493,"lastSeen":225494,"transactions":[{"txid":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","vin":[{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","n":0,"addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"isOwn":true,"value":"1234567890123"},{"txid":"00b2c06055e5e90e9c82bd4181fde310104391a7fa4f289b1704e5d90caa3840","vout":1,"n":1,"addresses":["mtGXQvBowMkBpnhLckhxhbwYK44Gs9eEtz"],"isAddress":true,"value":"12345"}],"vout":[{"value":"317283951061","n":0,"spent":true,"spentTxId":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","spentHeight":225494,"hex":"76a914ccaaaf374e1b06cb83118453d102587b4273d09588ac","addresses":["mzB8cYrfRwFRFAGTDzV8LkUQy5BQicxGhX"],"isAddress":true},{"value":"917283951061","n":1,"hex":"76a9148d802c045445df49613f6a70ddd2e48526f3701f88ac","addresses":["mtR97eM2HPWVM6c8FGLGcukgaHHQv7THoL"],"isAddress":true},{"value":"0","n":2,"hex":"6a072020f1686f6a20","addresses":["OP_RETURN 2020f1686f6a20"],"isAddress":false}],"blockHash":"00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6","blockHeight":225494,"confirmations":1,"blockTime":1521595678,"value":"1234567902122","valueIn":"1234567902468","fees":"346"},{"txid":"effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75","vin":[],"vout":[{"value":"1234567890123","n":0,"spent":true,"spentTxId":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","spentHeight":225494,"hex":"76a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac","addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true,"isOwn":true},{"value":"1","n":1,"spent":true,"spentTxId":"3d90d15ed026dc45e19ffb52875ed18fa9e8012ad123d7f7212176e2b0ebdb71","spentIndex":1,"spentHeight":225494,"hex":"a91452724c5178682f70e0ba31c6ec0633755a3b41d987","addresses":["2MzmAKayJmja784jyHvRUW1bXPget1csRRG"],"isAddress":true},{"value":"9876","n":2,"spent":true,"spentTxId":"05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07","spentHeight":225494,"hex":"a914e921fc4912a315078f370d959f2c4f7b6d2a683c87","addresses":["2NEVv9LJmAnY99W1pFoc5UJjVdypBqdnvu1"],"isAddress":true}],"blockHash":"0000000076fbbed90fd75b0e18856aa35baa984e9c9d444cf746ad85e94e2997","blockHeight":225493,"confirmations":2,"blockTime":1521515026,"value":"1234567900000","valueIn":"0","fees":"0"}]}`,
 			},
 		},
 		{
@@ -1612,6 +1736,174 @@ func Test_PublicServer_BitcoinType_ExtendedIndex(t *testing.T) {
 	httpTestsExtendedIndex(t, ts)
 }
 
+func setupMemoryStore(parser bchain.BlockChainParser, chain bchain.BlockChain, t *testing.T) (*db.MemoryStore, *common.InternalState, []*bchain.Block) {
+	m, err := db.NewMemoryStore(parser, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is, err := m.LoadInternalState("fakecoin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetInternalState(is)
+	bestHeight, err := chain.GetBestBlockHeight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks []*bchain.Block
+	for height := bestHeight - 1; height <= bestHeight; height++ {
+		block, err := chain.GetBlock("", height)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.ConnectBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+	for i := uint32(0); i < blocks[0].Height; i++ {
+		is.BlockTimes = append(is.BlockTimes, 0)
+	}
+	is.FinishedSync(bestHeight)
+	return m, is, blocks
+}
+
+func Test_PublicServer_BitcoinType_MemoryStore(t *testing.T) {
+	parser, chain := setupChain(t)
+
+	m, is, blocks := setupMemoryStore(parser, chain, t)
+	defer m.Close()
+	s := newTestPublicServer(m, is, chain, t, false)
+	s.ConnectFullPublicInterface()
+	// take the handler of the public server and pass it to the test server
+	ts := httptest.NewServer(s.https.Handler)
+	defer ts.Close()
+
+	performHttpTests([]httpTests{
+		{
+			name:        "apiAddress v2 details=basic",
+			r:           newGetRequest(ts.URL + "/api/v2/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?details=basic"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"0","totalReceived":"1234567890123","totalSent":"1234567890123","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":2,"firstSeen":225493,"lastSeen":225494}`,
+			},
+		},
+		{
+			name:        "apiAddress v2 details=txids",
+			r:           newGetRequest(ts.URL + "/api/v2/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?details=txids"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`"txids":["7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"]`,
+			},
+		},
+		{
+			name:        "apiTx v2",
+			r:           newGetRequest(ts.URL + "/api/v2/tx/effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"value":"1234567890123","n":0,"spent":true,"spentTxId":"7c3be24063f268aaa1ed81b64776798f56088757641a34fb156c4f51ed2e9d25","spentHeight":225494,`,
+			},
+		},
+	}, t, ts)
+
+	// the disconnected block is removed from the address history and the spent outputs are unspent again
+	last := blocks[len(blocks)-1]
+	if err := m.DisconnectBlockRangeBitcoinType(last.Height, last.Height); err != nil {
+		t.Fatal(err)
+	}
+	is.RemoveLastBlockTimes(1)
+	is.FinishedSync(last.Height - 1)
+	performHttpTests([]httpTests{
+		{
+			name:        "apiAddress v2 details=basic after disconnect",
+			r:           newGetRequest(ts.URL + "/api/v2/address/mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw?details=basic"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"address":"mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw","balance":"1234567890123","totalReceived":"1234567890123","totalSent":"0","unconfirmedBalance":"0","unconfirmedTxs":0,"txs":1,"firstSeen":225493,"lastSeen":225493}`,
+			},
+		},
+		{
+			name:        "apiTx v2 after disconnect",
+			r:           newGetRequest(ts.URL + "/api/v2/tx/effd9ef509383d536b1c8af5bf434c8efbf521a4f2befd4022bbd68694b4ac75"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`{"value":"1234567890123","n":0,"hex":"76a914a08eae93007f22668ab5e4a9c83c8cd1c325e3e088ac","addresses":["mv9uLThosiEnGRbVPS7Vhyw6VssbVRsiAw"],"isAddress":true}`,
+			},
+		},
+	}, t, ts)
+}
+
+// stakingParser is the bitcoin testnet parser of a coin with proof of stake coinstake transactions
+type stakingParser struct {
+	*btc.BitcoinParser
+}
+
+func (p *stakingParser) SupportsCoinstake() bool {
+	return true
+}
+
+func Test_PublicServer_BitcoinType_StakingRewards(t *testing.T) {
+	p, _ := setupChain(t)
+	parser := &stakingParser{BitcoinParser: p.(*btc.BitcoinParser)}
+	chain, err := dbtestdata.NewFakeBlockChain(parser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.NewMemoryStore(parser, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	is, err := m.LoadInternalState("fakecoin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetInternalState(is)
+	// the coinstake block replaces block 2
+	block1 := dbtestdata.GetTestBitcoinTypeBlock1(parser)
+	for i := uint32(0); i < block1.Height; i++ {
+		is.BlockTimes = append(is.BlockTimes, 0)
+	}
+	for _, block := range []*bchain.Block{block1, dbtestdata.GetTestBitcoinTypeCoinstakeBlock(parser)} {
+		if err := m.ConnectBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	is.FinishedSync(block1.Height + 1)
+	s := newTestPublicServer(m, is, chain, t, false)
+	s.ConnectFullPublicInterface()
+	// take the handler of the public server and pass it to the test server
+	ts := httptest.NewServer(s.https.Handler)
+	defer ts.Close()
+
+	performHttpTests([]httpTests{
+		{
+			name:        "apiBalanceHistory Addr1 staking reward",
+			r:           newGetRequest(ts.URL + "/api/v2/balancehistory/" + dbtestdata.Addr1),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"time":1521514800,"txs":1,"received":"100000000","sent":"0","sentToSelf":"0"`,
+				`{"time":1521594000,"txs":1,"received":"150000000","sent":"100000000","sentToSelf":"150000000","stakingReward":"50000000"`,
+			},
+		},
+		{
+			name:        "apiBalanceHistory Addr2 staking reward",
+			r:           newGetRequest(ts.URL + "/api/v2/balancehistory/" + dbtestdata.Addr2 + "?from=1521594000"),
+			status:      http.StatusOK,
+			contentType: "application/json; charset=utf-8",
+			body: []string{
+				`[{"time":1521594000,"txs":1,"received":"10000000","sent":"0","sentToSelf":"0","stakingReward":"10000000"`,
+			},
+		},
+	}, t, ts)
+}
+
 func Test_formatInt64(t *testing.T) {
 	tests := []struct {
 		name string
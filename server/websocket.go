@@ -43,12 +43,21 @@ type websocketChannel struct {
 	alive         bool
 	aliveLock     sync.Mutex
 	addrDescs     []string // subscribed address descriptors as strings
+	accounts      []string // subscribed account descriptors
+}
+
+// wsAccount is a registered account subscribed by the websocket clients
+type wsAccount struct {
+	account   db.Account
+	addrDescs []string // derived address descriptors as strings
+	channels  map[*websocketChannel]string
+	balance   *WsAccountBalance // the last sent balance, nil if no balance was sent yet
 }
 
 // WebsocketServer is a handle to websocket server
 type WebsocketServer struct {
 	upgrader                        *websocket.Upgrader
-	db                              *db.RocksDB
+	db                              db.Store
 	txCache                         *db.TxCache
 	chain                           bchain.BlockChain
 	chainParser                     bchain.BlockChainParser
@@ -59,6 +68,8 @@ type WebsocketServer struct {
 	block0hash                      string
 	newBlockSubscriptions           map[*websocketChannel]string
 	newBlockSubscriptionsLock       sync.Mutex
+	reorgSubscriptions              map[*websocketChannel]string
+	reorgSubscriptionsLock          sync.Mutex
 	newTransactionEnabled           bool
 	newTransactionSubscriptions     map[*websocketChannel]string
 	newTransactionSubscriptionsLock sync.Mutex
@@ -67,10 +78,14 @@ type WebsocketServer struct {
 	fiatRatesSubscriptions          map[string]map[*websocketChannel]string
 	fiatRatesTokenSubscriptions     map[*websocketChannel][]string
 	fiatRatesSubscriptionsLock      sync.Mutex
+	accountSubscriptions            map[string]*wsAccount
+	accountAddresses                map[string][]string // address descriptor to the subscribed accounts deriving it
+	accountsInMempool               map[string]struct{} // accounts with new mempool txs since the last mempool resync
+	accountSubscriptionsLock        sync.Mutex
 }
 
 // NewWebsocketServer creates new websocket interface to blockbook and returns its handle
-func NewWebsocketServer(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*WebsocketServer, error) {
+func NewWebsocketServer(db db.Store, chain bchain.BlockChain, mempool bchain.Mempool, txCache *db.TxCache, metrics *common.Metrics, is *common.InternalState) (*WebsocketServer, error) {
 	api, err := api.NewWorker(db, chain, mempool, txCache, metrics, is)
 	if err != nil {
 		return nil, err
@@ -95,11 +110,15 @@ func NewWebsocketServer(db *db.RocksDB, chain bchain.BlockChain, mempool bchain.
 		api:                         api,
 		block0hash:                  b0,
 		newBlockSubscriptions:       make(map[*websocketChannel]string),
+		reorgSubscriptions:          make(map[*websocketChannel]string),
 		newTransactionEnabled:       is.EnableSubNewTx,
 		newTransactionSubscriptions: make(map[*websocketChannel]string),
 		addressSubscriptions:        make(map[string]map[*websocketChannel]string),
 		fiatRatesSubscriptions:      make(map[string]map[*websocketChannel]string),
 		fiatRatesTokenSubscriptions: make(map[*websocketChannel][]string),
+		accountSubscriptions:        make(map[string]*wsAccount),
+		accountAddresses:            make(map[string][]string),
+		accountsInMempool:           make(map[string]struct{}),
 	}
 	return s, nil
 }
@@ -246,9 +265,11 @@ func (s *WebsocketServer) onConnect(c *websocketChannel) {
 
 func (s *WebsocketServer) onDisconnect(c *websocketChannel) {
 	s.unsubscribeNewBlock(c)
+	s.unsubscribeReorg(c)
 	s.unsubscribeNewTransaction(c)
 	s.unsubscribeAddresses(c)
 	s.unsubscribeFiatRates(c)
+	s.unsubscribeAccounts(c)
 	glog.Info("Client disconnected ", c.id, ", ", c.ip)
 	s.metrics.WebsocketClients.Dec()
 }
@@ -314,6 +335,25 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *WsRe
 		}
 		return
 	},
+	"getStakingInfo": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
+		r := WsStakingInfoReq{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			rv, _, err = s.api.GetDescriptorStakingInfo(r.Descriptor, r.Gap)
+		}
+		return
+	},
+	"getSilentPaymentTweaks": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
+		r := WsSilentPaymentTweaksReq{}
+		err = json.Unmarshal(req.Params, &r)
+		if err == nil {
+			if r.Height < 0 {
+				return nil, errors.New("Invalid height")
+			}
+			rv, err = s.api.GetSilentPaymentTweaks(uint32(r.Height))
+		}
+		return
+	},
 	"getTransaction": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
 		r := WsTransactionReq{}
 		err = json.Unmarshal(req.Params, &r)
@@ -347,6 +387,12 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *WsRe
 	"unsubscribeNewBlock": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
 		return s.unsubscribeNewBlock(c)
 	},
+	"subscribeReorg": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
+		return s.subscribeReorg(c, req)
+	},
+	"unsubscribeReorg": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
+		return s.unsubscribeReorg(c)
+	},
 	"subscribeNewTransaction": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
 		return s.subscribeNewTransaction(c, req)
 	},
@@ -378,6 +424,17 @@ var requestHandlers = map[string]func(*WebsocketServer, *websocketChannel, *WsRe
 	"unsubscribeFiatRates": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
 		return s.unsubscribeFiatRates(c)
 	},
+	"subscribeAccounts": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
+		var r WsSubscribeAccountsReq
+		err = json.Unmarshal(req.Params, &r)
+		if err != nil {
+			return nil, err
+		}
+		return s.subscribeAccounts(c, r.Descriptors, req)
+	},
+	"unsubscribeAccounts": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
+		return s.unsubscribeAccounts(c)
+	},
 	"ping": func(s *WebsocketServer, c *websocketChannel, req *WsReq) (rv interface{}, err error) {
 		r := struct{}{}
 		return r, nil
@@ -655,6 +712,22 @@ func (s *WebsocketServer) unsubscribeNewBlock(c *websocketChannel) (res interfac
 	return &subscriptionResponse{false}, nil
 }
 
+func (s *WebsocketServer) subscribeReorg(c *websocketChannel, req *WsReq) (res interface{}, err error) {
+	s.reorgSubscriptionsLock.Lock()
+	defer s.reorgSubscriptionsLock.Unlock()
+	s.reorgSubscriptions[c] = req.ID
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeReorg"})).Set(float64(len(s.reorgSubscriptions)))
+	return &subscriptionResponse{true}, nil
+}
+
+func (s *WebsocketServer) unsubscribeReorg(c *websocketChannel) (res interface{}, err error) {
+	s.reorgSubscriptionsLock.Lock()
+	defer s.reorgSubscriptionsLock.Unlock()
+	delete(s.reorgSubscriptions, c)
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeReorg"})).Set(float64(len(s.reorgSubscriptions)))
+	return &subscriptionResponse{false}, nil
+}
+
 func (s *WebsocketServer) subscribeNewTransaction(c *websocketChannel, req *WsReq) (res interface{}, err error) {
 	s.newTransactionSubscriptionsLock.Lock()
 	defer s.newTransactionSubscriptionsLock.Unlock()
@@ -788,6 +861,229 @@ func (s *WebsocketServer) unsubscribeFiatRates(c *websocketChannel) (res interfa
 	return &subscriptionResponse{false}, nil
 }
 
+func (s *WebsocketServer) getAccountAddrDescs(a *db.Account) ([]string, error) {
+	ads, err := s.api.GetAccountAddressDescriptors(a)
+	if err != nil {
+		return nil, err
+	}
+	rv := make([]string, len(ads))
+	for i, ad := range ads {
+		rv[i] = string(ad)
+	}
+	return rv, nil
+}
+
+// setAccountAddresses replaces the tracked addresses of the subscribed account, it must be called with accountSubscriptionsLock
+func (s *WebsocketServer) setAccountAddresses(wa *wsAccount, addrDescs []string) {
+	descriptor := wa.account.Descriptor
+	for _, ads := range wa.addrDescs {
+		accounts := s.accountAddresses[ads]
+		for i := range accounts {
+			if accounts[i] == descriptor {
+				accounts = append(accounts[:i], accounts[i+1:]...)
+				break
+			}
+		}
+		if len(accounts) == 0 {
+			delete(s.accountAddresses, ads)
+		} else {
+			s.accountAddresses[ads] = accounts
+		}
+	}
+	for _, ads := range addrDescs {
+		s.accountAddresses[ads] = append(s.accountAddresses[ads], descriptor)
+	}
+	wa.addrDescs = addrDescs
+}
+
+// unsubscribe accounts without accountSubscriptionsLock - can be called only from subscribeAccounts and unsubscribeAccounts
+func (s *WebsocketServer) doUnsubscribeAccounts(c *websocketChannel) {
+	for _, descriptor := range c.accounts {
+		wa, ok := s.accountSubscriptions[descriptor]
+		if ok {
+			delete(wa.channels, c)
+			if len(wa.channels) == 0 {
+				s.setAccountAddresses(wa, nil)
+				delete(s.accountSubscriptions, descriptor)
+				delete(s.accountsInMempool, descriptor)
+			}
+		}
+	}
+	c.accounts = nil
+}
+
+// subscribeAccounts subscribes the events of the accounts registered by the internal api
+// The addresses of the accounts are derived by the server, also the addresses derived later when the used addresses approach the gap.
+func (s *WebsocketServer) subscribeAccounts(c *websocketChannel, descriptors []string, req *WsReq) (res interface{}, err error) {
+	accounts := make([]*db.Account, len(descriptors))
+	addrDescs := make([][]string, len(descriptors))
+	for i, descriptor := range descriptors {
+		a, err := s.api.GetAccount(descriptor)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil {
+			return nil, api.NewAPIError("Account not registered: "+descriptor, true)
+		}
+		// derive the addresses outside of the lock, it may take some time for a new account
+		if addrDescs[i], err = s.getAccountAddrDescs(a); err != nil {
+			return nil, err
+		}
+		accounts[i] = a
+	}
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	// unsubscribe all previous subscriptions
+	s.doUnsubscribeAccounts(c)
+	for i, a := range accounts {
+		wa, ok := s.accountSubscriptions[a.Descriptor]
+		if !ok {
+			wa = &wsAccount{account: *a, channels: make(map[*websocketChannel]string)}
+			s.accountSubscriptions[a.Descriptor] = wa
+		}
+		s.setAccountAddresses(wa, addrDescs[i])
+		if _, ok = wa.channels[c]; !ok {
+			wa.channels[c] = req.ID
+			c.accounts = append(c.accounts, a.Descriptor)
+		}
+	}
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeAccounts"})).Set(float64(len(s.accountSubscriptions)))
+	return &subscriptionResponse{true}, nil
+}
+
+// unsubscribeAccounts unsubscribes all account subscriptions by this channel
+func (s *WebsocketServer) unsubscribeAccounts(c *websocketChannel) (res interface{}, err error) {
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	s.doUnsubscribeAccounts(c)
+	s.metrics.WebsocketSubscribes.With((common.Labels{"method": "subscribeAccounts"})).Set(float64(len(s.accountSubscriptions)))
+	return &subscriptionResponse{false}, nil
+}
+
+// getSubscribedAccounts returns the copies of the subscribed accounts, all or only those in the filter
+func (s *WebsocketServer) getSubscribedAccounts(filter map[string]struct{}) []db.Account {
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	accounts := make([]db.Account, 0, len(s.accountSubscriptions))
+	for descriptor, wa := range s.accountSubscriptions {
+		if _, ok := filter[descriptor]; ok || filter == nil {
+			accounts = append(accounts, wa.account)
+		}
+	}
+	return accounts
+}
+
+func (s *WebsocketServer) getAccountBalanceEvent(a *db.Account) (*WsAccountEvent, error) {
+	ai, err := s.api.GetXpubAddress(a.Descriptor, 1, 1, api.AccountDetailsBasic, &api.AddressFilter{Vout: api.AddressFilterVoutOff}, a.Gap, "")
+	if err != nil {
+		return nil, err
+	}
+	return &WsAccountEvent{
+		Descriptor: a.Descriptor,
+		Event:      "balance",
+		Balance: &WsAccountBalance{
+			Balance:            ai.BalanceSat,
+			UnconfirmedBalance: ai.UnconfirmedBalanceSat,
+			Txs:                ai.Txs,
+			UnconfirmedTxs:     ai.UnconfirmedTxs,
+			UsedTokens:         ai.UsedTokens,
+		},
+	}, nil
+}
+
+func (s *WebsocketServer) sendAccountEvents(events []*WsAccountEvent) {
+	if len(events) == 0 {
+		return
+	}
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	wa, ok := s.accountSubscriptions[events[0].Descriptor]
+	if ok {
+		for _, e := range events {
+			if e.Balance != nil {
+				wa.balance = e.Balance
+			}
+		}
+		for c, id := range wa.channels {
+			for _, e := range events {
+				c.DataOut(&WsRes{
+					ID:   id,
+					Data: e,
+				})
+			}
+		}
+		glog.Info("broadcasting ", len(events), " account events to ", len(wa.channels), " channels")
+	}
+}
+
+// onNewBlockAccounts sends the transactions of the subscribed accounts in the new block and their balances
+// and starts the tracking of the addresses derived after the newly used addresses
+// The events are computed from the changes of the accounts by the block, the balance is requested from the api
+// only if no balance was sent yet or if there were unconfirmed transactions, which may be confirmed by the block.
+func (s *WebsocketServer) onNewBlockAccounts(height uint32) {
+	changes, err := s.db.GetAccountChanges(height)
+	if err != nil {
+		glog.Error("GetAccountChanges error ", err, " for block ", height)
+		return
+	}
+	for i := range changes {
+		ac := &changes[i]
+		var a db.Account
+		var balance *WsAccountBalance
+		s.accountSubscriptionsLock.Lock()
+		wa, ok := s.accountSubscriptions[ac.Descriptor]
+		if ok {
+			a, balance = wa.account, wa.balance
+		}
+		s.accountSubscriptionsLock.Unlock()
+		if !ok {
+			continue
+		}
+		events := make([]*WsAccountEvent, 0, len(ac.Txids)+1)
+		for _, txid := range ac.Txids {
+			tx, err := s.api.GetTransaction(txid, false, false)
+			if err != nil {
+				glog.Error("GetTransaction error ", err, " for ", txid)
+				continue
+			}
+			events = append(events, &WsAccountEvent{Descriptor: a.Descriptor, Event: "tx", Tx: tx})
+		}
+		var e *WsAccountEvent
+		if balance != nil && balance.UnconfirmedTxs == 0 {
+			b := balance.Balance.AsBigInt()
+			b.Add(&b, &ac.BalanceSat)
+			e = &WsAccountEvent{
+				Descriptor: a.Descriptor,
+				Event:      "balance",
+				Balance: &WsAccountBalance{
+					Balance:            (*api.Amount)(&b),
+					UnconfirmedBalance: balance.UnconfirmedBalance,
+					Txs:                balance.Txs + len(ac.Txids),
+					UsedTokens:         balance.UsedTokens + ac.NewUsedAddresses,
+				},
+			}
+		} else if e, err = s.getAccountBalanceEvent(&a); err != nil {
+			glog.Error("GetXpubAddress error ", err, " for account ", a.Descriptor)
+			continue
+		}
+		events = append(events, e)
+		// the addresses are derived further only after a newly used address
+		if ac.NewUsedAddresses > 0 {
+			addrDescs, err := s.getAccountAddrDescs(&a)
+			if err != nil {
+				glog.Error("GetAccountAddressDescriptors error ", err, " for account ", a.Descriptor)
+				continue
+			}
+			s.accountSubscriptionsLock.Lock()
+			if wa, ok := s.accountSubscriptions[a.Descriptor]; ok {
+				s.setAccountAddresses(wa, addrDescs)
+			}
+			s.accountSubscriptionsLock.Unlock()
+		}
+		s.sendAccountEvents(events)
+	}
+}
+
 func (s *WebsocketServer) onNewBlockAsync(hash string, height uint32) {
 	s.newBlockSubscriptionsLock.Lock()
 	defer s.newBlockSubscriptionsLock.Unlock()
@@ -810,6 +1106,36 @@ func (s *WebsocketServer) onNewBlockAsync(hash string, height uint32) {
 // OnNewBlock is a callback that broadcasts info about new block to subscribed clients
 func (s *WebsocketServer) OnNewBlock(hash string, height uint32) {
 	go s.onNewBlockAsync(hash, height)
+	s.accountSubscriptionsLock.Lock()
+	accounts := len(s.accountSubscriptions)
+	s.accountSubscriptionsLock.Unlock()
+	if accounts > 0 {
+		go s.onNewBlockAccounts(height)
+	}
+}
+
+func (s *WebsocketServer) onReorgAsync(reorg *db.Reorg) {
+	s.reorgSubscriptionsLock.Lock()
+	defer s.reorgSubscriptionsLock.Unlock()
+	data := WsReorg{
+		Orphaned: make([]WsBlockID, len(reorg.Orphaned)),
+		Tip:      WsBlockID{Height: reorg.TipHeight, Hash: reorg.TipHash},
+	}
+	for i := range reorg.Orphaned {
+		data.Orphaned[i] = WsBlockID{Height: reorg.Orphaned[i].Height, Hash: reorg.Orphaned[i].Hash}
+	}
+	for c, id := range s.reorgSubscriptions {
+		c.DataOut(&WsRes{
+			ID:   id,
+			Data: &data,
+		})
+	}
+	glog.Info("broadcasting reorg of ", len(reorg.Orphaned), " blocks, new tip ", reorg.TipHeight, " ", reorg.TipHash, " to ", len(s.reorgSubscriptions), " channels")
+}
+
+// OnReorg is a callback that broadcasts info about chain reorganization to subscribed clients
+func (s *WebsocketServer) OnReorg(reorg *db.Reorg) {
+	go s.onReorgAsync(reorg)
 }
 
 func (s *WebsocketServer) sendOnNewTx(tx *api.Tx) {
@@ -899,7 +1225,45 @@ func (s *WebsocketServer) getNewTxSubscriptions(tx *bchain.MempoolTx) map[string
 	return subscribed
 }
 
-func (s *WebsocketServer) onNewTxAsync(tx *bchain.MempoolTx, subscribed map[string]struct{}) {
+// getNewTxAccountSubscriptions returns the subscribed accounts with an address in the inputs or outputs of the tx
+// The accounts are marked to send their balances after the mempool resync, when the tx is in the mempool index.
+func (s *WebsocketServer) getNewTxAccountSubscriptions(tx *bchain.MempoolTx) []string {
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	if len(s.accountAddresses) == 0 {
+		return nil
+	}
+	var subscribed []string
+	add := func(addrDesc bchain.AddressDescriptor) {
+		for _, descriptor := range s.accountAddresses[string(addrDesc)] {
+			s.accountsInMempool[descriptor] = struct{}{}
+			found := false
+			for i := range subscribed {
+				if subscribed[i] == descriptor {
+					found = true
+					break
+				}
+			}
+			if !found {
+				subscribed = append(subscribed, descriptor)
+			}
+		}
+	}
+	for i := range tx.Vin {
+		if len(tx.Vin[i].AddrDesc) > 0 {
+			add(tx.Vin[i].AddrDesc)
+		}
+	}
+	for i := range tx.Vout {
+		addrDesc, err := s.chainParser.GetAddrDescFromVout(&tx.Vout[i])
+		if err == nil && len(addrDesc) > 0 {
+			add(addrDesc)
+		}
+	}
+	return subscribed
+}
+
+func (s *WebsocketServer) onNewTxAsync(tx *bchain.MempoolTx, subscribed map[string]struct{}, accounts []string) {
 	atx, err := s.api.GetTransactionFromMempoolTx(tx)
 	if err != nil {
 		glog.Error("GetTransactionFromMempoolTx error ", err, " for ", tx.Txid)
@@ -909,13 +1273,39 @@ func (s *WebsocketServer) onNewTxAsync(tx *bchain.MempoolTx, subscribed map[stri
 	for stringAddressDescriptor := range subscribed {
 		s.sendOnNewTxAddr(stringAddressDescriptor, atx)
 	}
+	for _, descriptor := range accounts {
+		s.sendAccountEvents([]*WsAccountEvent{{Descriptor: descriptor, Event: "tx", Tx: atx}})
+	}
 }
 
 // OnNewTx is a callback that broadcasts info about a tx affecting subscribed address
 func (s *WebsocketServer) OnNewTx(tx *bchain.MempoolTx) {
 	subscribed := s.getNewTxSubscriptions(tx)
-	if len(s.newTransactionSubscriptions) > 0 || len(subscribed) > 0 {
-		go s.onNewTxAsync(tx, subscribed)
+	accounts := s.getNewTxAccountSubscriptions(tx)
+	if len(s.newTransactionSubscriptions) > 0 || len(subscribed) > 0 || len(accounts) > 0 {
+		go s.onNewTxAsync(tx, subscribed, accounts)
+	}
+}
+
+func (s *WebsocketServer) onMempoolSyncAsync(changed map[string]struct{}) {
+	accounts := s.getSubscribedAccounts(changed)
+	for i := range accounts {
+		e, err := s.getAccountBalanceEvent(&accounts[i])
+		if err != nil {
+			glog.Error("GetXpubAddress error ", err, " for account ", accounts[i].Descriptor)
+			continue
+		}
+		s.sendAccountEvents([]*WsAccountEvent{e})
+	}
+}
+
+// OnMempoolSync is a callback that broadcasts the balances of the subscribed accounts changed by new mempool txs
+func (s *WebsocketServer) OnMempoolSync() {
+	s.accountSubscriptionsLock.Lock()
+	defer s.accountSubscriptionsLock.Unlock()
+	if len(s.accountsInMempool) > 0 {
+		go s.onMempoolSyncAsync(s.accountsInMempool)
+		s.accountsInMempool = make(map[string]struct{})
 	}
 }
 
@@ -1,10 +1,14 @@
 package server
 
-import "encoding/json"
+import (
+	"encoding/json"
+
+	"github.com/trezor/blockbook/api"
+)
 
 type WsReq struct {
 	ID     string          `json:"id"`
-	Method string          `json:"method" ts_type:"'getAccountInfo' | 'getInfo' | 'getBlockHash' | 'getAccountUtxo' | 'getBalanceHistory' | 'getTransaction' | 'getTransactionSpecific' | 'estimateFee' | 'sendTransaction' | 'subscribeNewBlock' | 'unsubscribeNewBlock' | 'subscribeNewTransaction' | 'unsubscribeNewTransaction' | 'subscribeAddresses' | 'unsubscribeAddresses' | 'subscribeFiatRates' | 'unsubscribeFiatRates' | 'ping' | 'getCurrentFiatRates' | 'getFiatRatesForTimestamps' | 'getFiatRatesTickersList'"`
+	Method string          `json:"method" ts_type:"'getAccountInfo' | 'getInfo' | 'getBlockHash' | 'getAccountUtxo' | 'getBalanceHistory' | 'getStakingInfo' | 'getTransaction' | 'getTransactionSpecific' | 'estimateFee' | 'sendTransaction' | 'subscribeNewBlock' | 'unsubscribeNewBlock' | 'subscribeNewTransaction' | 'unsubscribeNewTransaction' | 'subscribeAddresses' | 'unsubscribeAddresses' | 'subscribeFiatRates' | 'unsubscribeFiatRates' | 'ping' | 'getCurrentFiatRates' | 'getFiatRatesForTimestamps' | 'getFiatRatesTickersList'"`
 	Params json.RawMessage `json:"params" ts_type:"any"`
 }
 
@@ -72,6 +76,15 @@ type WsBalanceHistoryReq struct {
 	GroupBy    uint32   `json:"groupBy,omitempty"`
 }
 
+type WsStakingInfoReq struct {
+	Descriptor string `json:"descriptor"`
+	Gap        int    `json:"gap,omitempty"`
+}
+
+type WsSilentPaymentTweaksReq struct {
+	Height int `json:"height"`
+}
+
 type WsTransactionReq struct {
 	Txid string `json:"txid"`
 }
@@ -98,6 +111,27 @@ type WsSendTransactionReq struct {
 type WsSubscribeAddressesReq struct {
 	Addresses []string `json:"addresses"`
 }
+type WsSubscribeAccountsReq struct {
+	Descriptors []string `json:"descriptors"`
+}
+
+type WsAccountBalance struct {
+	Balance            *api.Amount `json:"balance"`
+	UnconfirmedBalance *api.Amount `json:"unconfirmedBalance"`
+	Txs                int         `json:"txs"`
+	UnconfirmedTxs     int         `json:"unconfirmedTxs"`
+	UsedTokens         int         `json:"usedTokens"`
+}
+
+// WsAccountEvent is sent to the subscribers of a registered account, event "tx" with a new mempool or confirmed
+// transaction of the account is followed by event "balance" with the updated balance of the account
+type WsAccountEvent struct {
+	Descriptor string            `json:"descriptor"`
+	Event      string            `json:"event"`
+	Tx         *api.Tx           `json:"tx,omitempty"`
+	Balance    *WsAccountBalance `json:"balance,omitempty"`
+}
+
 type WsSubscribeFiatRatesReq struct {
 	Currency string   `json:"currency,omitempty"`
 	Tokens   []string `json:"tokens,omitempty"`
@@ -118,3 +152,13 @@ type WsFiatRatesTickersListReq struct {
 	Timestamp int64  `json:"timestamp,omitempty"`
 	Token     string `json:"token,omitempty"`
 }
+
+type WsBlockID struct {
+	Height uint32 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+type WsReorg struct {
+	Orphaned []WsBlockID `json:"orphaned"`
+	Tip      WsBlockID   `json:"tip"`
+}
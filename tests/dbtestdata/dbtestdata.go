@@ -17,6 +17,8 @@ const (
 	TxidB2T3 = "05e2e48aeabdd9b75def7b48d756ba304713c2aba7b522bf9dbc893fc4231b07"
 	TxidB2T4 = "fdd824a780cbb718eeb766eb05d83fdefc793a27082cd5e67f856d69798cf7db"
 
+	TxidCoinstake = "7ac55ba9ac0ea5a8c00b3a7386d6d6a9bf8eadba1e9bc9bc8ac4cbf80bd5c7b6"
+
 	Xpub              = "upub5E1xjDmZ7Hhej6LPpS8duATdKXnRYui7bDYj6ehfFGzWDZtmCmQkZhc3Zb7kgRLtHWd16QFxyP86JKL3ShZEBFX88aciJ3xyocuyhZZ8g6q"
 	TaprootDescriptor = "tr([5c9e228d/86'/1'/0']tpubDC88gkaZi5HvJGxGDNLADkvtdpni3mLmx6vr2KnXmWMG8zfkBRggsxHVBkUpgcwPe2KKpkyvTJCdXHb1UHEWE64vczyyPQfHr1skBcsRedN/{0,1}/*)#4rqwxvej"
 
@@ -275,3 +277,51 @@ func GetTestBitcoinTypeBlock2(parser bchain.BlockChainParser) *bchain.Block {
 		},
 	}
 }
+
+// GetTestBitcoinTypeCoinstakeBlock returns a proof of stake block of the height of block #2,
+// its coinstake transaction spends the output of TxidB1T1 to Addr1 and pays the stake and the reward to Addr1 and Addr2
+func GetTestBitcoinTypeCoinstakeBlock(parser bchain.BlockChainParser) *bchain.Block {
+	return &bchain.Block{
+		BlockHeader: bchain.BlockHeader{
+			Height:        225494,
+			Hash:          "00000000eb0443fd7dc4a1ed5c686a8e995057805f9a161d9a5a77a95e72b7b6",
+			Size:          2345678,
+			Time:          1521595678,
+			Confirmations: 1,
+		},
+		Txs: []bchain.Tx{
+			{
+				Txid: TxidCoinstake,
+				Vin: []bchain.Vin{
+					{
+						Txid: TxidB1T1,
+						Vout: 0,
+					},
+				},
+				Vout: []bchain.Vout{
+					{
+						N:            0,
+						ScriptPubKey: bchain.ScriptPubKey{},
+					},
+					{
+						N: 1,
+						ScriptPubKey: bchain.ScriptPubKey{
+							Hex: AddressToPubKeyHex(Addr1, parser),
+						},
+						ValueSat: *big.NewInt(150000000),
+					},
+					{
+						N: 2,
+						ScriptPubKey: bchain.ScriptPubKey{
+							Hex: AddressToPubKeyHex(Addr2, parser),
+						},
+						ValueSat: *big.NewInt(10000000),
+					},
+				},
+				Blocktime:     1521595678,
+				Time:          1521595678,
+				Confirmations: 1,
+			},
+		},
+	}
+}
@@ -63,10 +63,27 @@ func testHandleFork(t *testing.T, h *TestHandler) {
 			verifyTransactions2(t, d, rng, fakeAddr2txs, false)
 			verifyTransactions2(t, d, rng, realAddr2txs, true)
 			verifyAddresses2(t, d, h.Chain, realBlocks)
+			verifyOrphanedBlocks(t, d, rng, fakeBlocks)
 		})
 	}
 }
 
+func verifyOrphanedBlocks(t *testing.T, d *db.RocksDB, rng Range, fakeBlocks []BlockID) {
+	orphaned, err := d.GetOrphanedBlocks(rng.Lower, rng.Upper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := make(map[BlockID]struct{}, len(orphaned))
+	for i := range orphaned {
+		m[BlockID{Height: orphaned[i].Height, Hash: orphaned[i].Hash}] = struct{}{}
+	}
+	for _, b := range fakeBlocks {
+		if _, found := m[b]; !found {
+			t.Errorf("Block %d %s not found in orphaned blocks", b.Height, b.Hash)
+		}
+	}
+}
+
 func verifyAddresses2(t *testing.T, d *db.RocksDB, chain bchain.BlockChain, blks []BlockID) {
 	parser := chain.GetChainParser()
 